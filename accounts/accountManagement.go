@@ -34,7 +34,6 @@ const (
 	UserPermission = "User"
 
 	rootPwdExpirationDays = 3550
-	pwdExpirationDays     = 90
 )
 
 var (
@@ -79,12 +78,18 @@ func init() {
 
 // NewUserAm : Generate and return a new Account Management object using the given priviledge, password and salt (in case they are valid)
 func NewUserAm(privilege string, pass []byte, saltData []byte, checkPwdStrength bool) (*AmUserInfo, error) {
+	return NewUserAmWithPolicy(privilege, pass, saltData, checkPwdStrength, nil)
+}
+
+// NewUserAmWithPolicy : Generate and return a new Account Management object using the given priviledge, password and salt (in case they are valid)
+// The password is checked using the given effective password policy of the user (nil for the default policy)
+func NewUserAmWithPolicy(privilege string, pass []byte, saltData []byte, checkPwdStrength bool, policy *password.PasswordPolicy) (*AmUserInfo, error) {
 	err := IsValidPrivilege(privilege)
 	if err != nil {
 		return nil, err
 	}
 	// was userPwd := password.UserPwd{Password: pass, Expiration: getPwdExpiration(id), Salt: saltData}
-	userPwd, err := password.NewUserPwd(pass, saltData, checkPwdStrength)
+	userPwd, err := password.NewUserPwdWithPolicy(pass, saltData, checkPwdStrength, policy)
 	if err != nil {
 		return nil, err
 	}
@@ -107,10 +112,10 @@ func GetUsersPrivilege() UsersPrivilege {
 }
 
 // Return the time expiration of the AM password, root time expiration is different
-// than all other users time expiration
-func getPwdExpiration(id string) time.Time {
-	if id != defs.RootUserName {
-		return time.Now().Add(time.Hour * 24 * pwdExpirationDays)
+// than all other users time expiration (which is set by their password policy, passwords don't expire in 800-63B mode)
+func getPwdExpiration(id string, policy password.PasswordPolicy) time.Time {
+	if id != defs.RootUserName || policy.NistMode {
+		return password.GetNewPasswordExpirationTime(policy)
 	}
 	// root password dosn't have expiration limit
 	return time.Now().Add(time.Hour * 24 * rootPwdExpirationDays)
@@ -127,14 +132,21 @@ func (u *AmUserInfo) UpdateUserPrivilege(privilege string) error {
 }
 
 // UpdateUserPwd : Update the AM property password to the given password and set the expiration time
-// The password will be updated only if the new password is valid and the curent password matches the given one
+// The password will be updated only if the new password is valid and the curent password matches the given one,
+// if checkPwdStrength is set the password must not be in the password blocklist or be derived from the user name
 func (u *AmUserInfo) UpdateUserPwd(userName string, currentPwd []byte, pwd []byte, checkPwdStrength bool) error {
+	if checkPwdStrength {
+		err := password.CheckBlocklist(string(pwd), userName)
+		if err != nil {
+			return err
+		}
+	}
 	newPwd, err := u.Pwd.UpdatePassword(currentPwd, pwd, checkPwdStrength)
 	if err != nil {
 		return err
 	}
 	u.Pwd.Password = newPwd
-	u.Pwd.Expiration = getPwdExpiration(userName)
+	u.Pwd.Expiration = getPwdExpiration(userName, u.Pwd.GetPolicy())
 	return nil
 }
 
@@ -148,6 +160,23 @@ func (u *AmUserInfo) ResetUserPwd() ([]byte, error) {
 	return newPwd, nil
 }
 
+// ResetUserPwdWithToken : Update the AM property password to the given password if the given password reset token is valid
+// and set the expiration time, the password must not be in the password blocklist or be derived from the user name
+func (u *AmUserInfo) ResetUserPwdWithToken(userName string, token string, pwd []byte, checkPwdStrength bool) error {
+	if checkPwdStrength {
+		err := password.CheckBlocklist(string(pwd), userName)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := u.Pwd.ResetPasswordWithToken(token, pwd, checkPwdStrength)
+	if err != nil {
+		return err
+	}
+	u.Pwd.Expiration = getPwdExpiration(userName, u.Pwd.GetPolicy())
+	return nil
+}
+
 // PasswordErrorThrotling : throttle the session in case of wrong password,
 //	the delay is the sum of a constant value: throttleMiliSec plus a random between 1 and randomThrottleMiliSec
 //	the random is to be counterpart to timing attacks
@@ -165,7 +194,7 @@ func (u *AmUserInfo) IsPasswordMatch(pwd []byte) error {
 
 // IsPasswordMatchHandler : use IsPasswordMatch with throttling parameters other than the default ones, for testing purposes
 func (u *AmUserInfo) IsPasswordMatchHandler(pwd []byte, throttleMiliSec int64, randomThrottleMiliSec int64) error {
-	saltedPwd, _ := salt.GenerateSaltedPassword([]byte(pwd), password.MinPasswordLength, password.MaxPasswordLength, u.Pwd.Salt, -1)
+	saltedPwd, _ := salt.GenerateSaltedPassword(u.Pwd.GetPolicy().NormalizePwd(pwd), password.MinPasswordLength, password.MaxPasswordLength, u.Pwd.Salt, -1)
 	tPwd := password.GetHashedPwd(saltedPwd)
 	err := u.Pwd.IsPasswordMatch(tPwd)
 	// on error throttle for 1 second, reset the error counter
@@ -216,6 +245,14 @@ func (s Serializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
 
 // AddToStorage : Add the AM property information to the secure_storage
 func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add AM property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the AM property information to an items writer, e.g. a storage transaction
+func (s Serializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
 	lock.Lock()
 	defer lock.Unlock()
 
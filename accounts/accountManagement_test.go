@@ -9,6 +9,7 @@ import (
 
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
 	"github.com/ibm-security-innovation/libsecurity-go/password"
+	"github.com/ibm-security-innovation/libsecurity-go/salt"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 )
 
@@ -25,6 +26,12 @@ var (
 func init() {
 	logger.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
 	defaultPassword = []byte(password.GenerateNewValidPassword())
+	password.SetHashParams(password.HashParams{Algorithm: password.Pbkdf2Sha256Algorithm, Iterations: 1000})
+}
+
+func getPwdHash(pwd []byte, saltData []byte) []byte {
+	tPwd, _ := salt.GenerateSaltedPassword(pwd, password.MinPasswordLength, password.MaxPasswordLength, saltData, -1)
+	return password.GetHashedPwd(tPwd)
 }
 
 // Test that a new user AM is generated only when all the parameters are valid
@@ -69,14 +76,18 @@ func Test_updateAM(t *testing.T) {
 	userPwd, _ := password.NewUserPwd(defaultPassword, defaultSalt, true)
 	userAm, _ := NewUserAm(SuperUserPermission, defaultPassword, defaultSalt, true)
 	pwd := ""
+	current := defaultPassword
 	for p := range privilege {
 		for i := 0; i < password.MaxPasswordLength; i++ {
 			pOk := IsValidPrivilege(p)
 			pwdOk := userPwd.IsNewPwdValid([]byte(pwd), false)
 			ok := pOk == nil && pwdOk == nil
 			updatePOk := userAm.UpdateUserPrivilege(p)
-			updatePwdOk := userAm.UpdateUserPwd(defaultUserName, userAm.Pwd.Password, []byte(pwd), false)
+			updatePwdOk := userAm.UpdateUserPwd(defaultUserName, getPwdHash(current, userAm.Pwd.Salt), []byte(pwd), false)
 			updateOk := updatePOk == nil && updatePwdOk == nil
+			if updatePwdOk == nil {
+				current = []byte(pwd)
+			}
 			if ok == false && updateOk == true {
 				t.Errorf("Test fail: Successfully updated user AM with invalid parameters: privilege '%v' (%v) password '%v' (%v)",
 					p, pOk, pwd, pwdOk)
@@ -100,10 +111,14 @@ func Test_equalAM(t *testing.T) {
 	if userAm.IsEqual(nil, false) == true {
 		t.Errorf("Test fail: Unequal AM found equal with nil")
 	}
+	currentPwd := defaultPassword
 	for p := range usersPrivilege {
 		userAm1.UpdateUserPrivilege(p)
 		for _, pass := range pwd {
-			userAm1.UpdateUserPwd(defaultUserName, userAm.Pwd.Password, []byte(pass), false)
+			err := userAm1.UpdateUserPwd(defaultUserName, getPwdHash(currentPwd, defaultSalt), []byte(pass), false)
+			if err == nil {
+				currentPwd = []byte(pass)
+			}
 			for exp := 0; exp < 2; exp++ {
 				if exp > 0 {
 					userAm1.Pwd.Expiration = time.Now().Add(time.Duration(100*24) * time.Hour)
@@ -143,6 +158,25 @@ func Test_IsPasswordMatch(t *testing.T) {
 	}
 }
 
+// Test that in 800-63B mode the NFKC normalized password is matched and that it doesn't expire (also for the root user)
+func Test_nistModeAM(t *testing.T) {
+	policy := password.NewNistPasswordPolicy()
+	userAm, err := NewUserAmWithPolicy(UserPermission, []byte("ｎｏｒｍａｌｉｚｅｄ"), defaultSalt, true, &policy)
+	if err != nil {
+		t.Fatalf("Test fail: can't create an AM using the 800-63B policy, error: %v", err)
+	}
+	err = userAm.IsPasswordMatchHandler([]byte("normalized"), 0, 1)
+	if err != nil {
+		t.Errorf("Test fail: the NFKC normalized password was not matched, error: %v", err)
+	}
+	for _, name := range []string{defaultUserName, defs.RootUserName} {
+		expiration := getPwdExpiration(name, policy)
+		if expiration != password.GetNewPasswordExpirationTime(policy) {
+			t.Errorf("Test fail: the password expiration %v of '%v' is not as expected, passwords must not expire in 800-63B mode", expiration, name)
+		}
+	}
+}
+
 func Test_IsPasswordMatch_Should_Not_Allow_Second_Login_With_Temporary_Password(t *testing.T) {
 	pwd := defaultPassword
 
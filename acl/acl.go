@@ -366,6 +366,14 @@ func (s Serializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
 
 // AddToStorage : Add the ACL property information to the secure_storage
 func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add an ACL property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the ACL property information to an items writer, e.g. a storage transaction
+func (s Serializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
 	lock.Lock()
 	defer lock.Unlock()
 
@@ -38,8 +38,12 @@ const (
 	OtpPropertyName string = "OTP"
 	// OcraPropertyName : Saved name for the OCRA properties
 	OcraPropertyName string = "OCRA"
+	// RecoveryPropertyName : Saved name for the OTP recovery codes properties
+	RecoveryPropertyName string = "RECOVERY"
 	// PwdPropertyName : Saved name for the Password properties
 	PwdPropertyName string = "PWD"
+	// PwdPolicyPropertyName : Saved name for the password policy properties (of groups)
+	PwdPolicyPropertyName string = "PWDPOLICY"
 	// UmPropertyName : Saved name for the users/groups/resources properties
 	UmPropertyName string = "UM"
 
@@ -53,12 +57,14 @@ const (
 var (
 	// PropertiesName : which properties to store/load from secure storage
 	PropertiesName = map[string]bool{
-		AmPropertyName:   true,
-		AclPropertyName:  true,
-		OtpPropertyName:  true,
-		OcraPropertyName: true,
-		PwdPropertyName:  true,
-		UmPropertyName:   true,
+		AmPropertyName:        true,
+		AclPropertyName:       true,
+		OtpPropertyName:       true,
+		OcraPropertyName:      true,
+		RecoveryPropertyName:  true,
+		PwdPropertyName:       true,
+		UmPropertyName:        true,
+		PwdPolicyPropertyName: true,
 	}
 )
 
@@ -70,6 +76,12 @@ type Serializer interface {
 	IsEqualProperties(d1 interface{}, d2 interface{}) bool
 }
 
+// ItemsSerializer : optional set of functions that a module may implement so that its property can be added
+// to any items writer, e.g. a storage transaction, together with other items
+type ItemsSerializer interface {
+	AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error
+}
+
 // SerializersMap : hash structure, the key is the module property name
 type SerializersMap map[string]Serializer
 
@@ -196,8 +196,20 @@ func (e *Entity) getProperty(propertyName string) (interface{}, error) {
 	return data, nil
 }
 
+// Return a copy of the properties associated with the entity
+func (e *Entity) getProperties() map[string]interface{} {
+	propertyLock.Lock()
+	defer propertyLock.Unlock()
+
+	properties := make(map[string]interface{}, len(e.EntityProperties))
+	for propertyName, data := range e.EntityProperties {
+		properties[propertyName] = data
+	}
+	return properties
+}
+
 // Add the group's data to disk (in JSON format)
-func (g *Group) addGroupToStorage(prefix string, storage *ss.SecureStorage) error {
+func (g *Group) addGroupToStorage(prefix string, storage ss.ItemsWriter) error {
 	if storage == nil {
 		return fmt.Errorf("Cannot add group to storage: Storage is nil")
 	}
@@ -206,7 +218,7 @@ func (g *Group) addGroupToStorage(prefix string, storage *ss.SecureStorage) erro
 }
 
 // Add the Entity's data to disk (in JSON format)
-func (e *Entity) addEntityToStorage(prefix string, storage *ss.SecureStorage) error {
+func (e *Entity) addEntityToStorage(prefix string, storage ss.ItemsWriter) error {
 	if storage == nil {
 		return fmt.Errorf("Cannot add to storage: Storage is nil")
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/ibm-security-innovation/libsecurity-go/accounts"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+	"github.com/ibm-security-innovation/libsecurity-go/password"
 	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
 )
 
@@ -28,6 +29,10 @@ var (
 	RemoveEntityFromAcl func(el1 interface{}, name string)
 )
 
+func init() {
+	ss.GetItemGroup = getStorageKeyEntityName
+}
+
 // Permission could be any string
 type Permission string
 
@@ -42,6 +47,7 @@ type EntityManager struct {
 	Groups    gList
 	Resources rList
 	Permissions pList
+	keysStorage *ss.SecureStorage // if the data was loaded using a key provider: an empty storage that is protected by the same keys
 }
 
 func (el EntityManager) String() string {
@@ -93,12 +99,15 @@ func (el *EntityManager) GetEntityAccount(name string, pwd []byte) (*accounts.Am
 func (el *EntityManager) GetEntityAccountHandler(name string, pwd []byte, throttleMiliSec int64, randomThrottleMiliSec int64) (*accounts.AmUserInfo, error) {
 	errStr := "entity name and password does not match"
 
+	// verify the password also for unknown entities, so that the hashing time does not reveal them
 	if el.IsEntityInList(name) == false {
+		password.VerifyDummyPwd(pwd)
 		defs.TimingAttackSleep(throttleMiliSec, randomThrottleMiliSec)
 		return nil, fmt.Errorf(errStr)
 	}
 	data, err := el.GetPropertyAttachedToEntity(name, defs.AmPropertyName)
 	if err != nil {
+		password.VerifyDummyPwd(pwd)
 		defs.TimingAttackSleep(throttleMiliSec, randomThrottleMiliSec)
 		return nil, fmt.Errorf(errStr)
 	}
@@ -205,7 +214,11 @@ func (el *EntityManager) RemoveGroup(name string) error {
 	if RemoveEntityFromAcl != nil {
 		RemoveEntityFromAcl(el, name)
 	}
+	members := el.Groups[name].Group
 	delete(el.Groups, name)
+	for userName := range members {
+		el.updatePasswordPolicy(userName)
+	}
 	return nil
 }
 
@@ -260,7 +273,12 @@ func (el *EntityManager) AddUserToGroup(groupName string, name string) error {
 	if exist == false {
 		return fmt.Errorf("User '%v' is not in the entity users list yet", name)
 	}
-	return e.addUserToGroup(name)
+	err = e.addUserToGroup(name)
+	if err != nil {
+		return err
+	}
+	el.updatePasswordPolicy(name)
+	return nil
 }
 
 // IsUserPartOfAGroup : Check if the given user is part of the given group
@@ -292,7 +310,62 @@ func (el *EntityManager) RemoveUserFromGroup(groupName string, name string) erro
 	if err != nil {
 		return err
 	}
-	return e.removeUserFromGroup(name)
+	err = e.removeUserFromGroup(name)
+	if err != nil {
+		return err
+	}
+	el.updatePasswordPolicy(name)
+	return nil
+}
+
+// GetEntityPasswordPolicy : Return the effective password policy of the given user: the strictest combination of the
+// password policies of all the groups the user is a member of, or nil if none of them has a password policy
+// (the default password policy is used)
+func (el *EntityManager) GetEntityPasswordPolicy(name string) *password.PasswordPolicy {
+	var policies []password.PasswordPolicy
+
+	for _, g := range el.Groups {
+		if g.isUserInGroup(name) == false {
+			continue
+		}
+		data, err := g.getProperty(defs.PwdPolicyPropertyName)
+		if err == nil {
+			policies = append(policies, *data.(*password.PasswordPolicy))
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	policy := password.GetStrictestPolicy(policies...)
+	return &policy
+}
+
+// Set the effective password policy of the password properties (account management and password) of the given user
+func (el *EntityManager) updatePasswordPolicy(name string) {
+	u, exist := el.Users[name]
+	if exist == false {
+		return
+	}
+	policy := el.GetEntityPasswordPolicy(name)
+	data, err := u.getProperty(defs.AmPropertyName)
+	if amData, ok := data.(*accounts.AmUserInfo); err == nil && ok {
+		amData.Pwd.SetPolicy(policy)
+	}
+	data, err = u.getProperty(defs.PwdPropertyName)
+	if pwdData, ok := data.(*password.UserPwd); err == nil && ok {
+		pwdData.SetPolicy(policy)
+	}
+}
+
+// Set the effective password policy of all the members of the given group
+func (el *EntityManager) updateGroupPasswordPolicy(groupName string) {
+	g, exist := el.Groups[groupName]
+	if exist == false {
+		return
+	}
+	for name := range g.Group {
+		el.updatePasswordPolicy(name)
+	}
 }
 
 // Check if the given user name is in the EntityManager
@@ -332,16 +405,37 @@ func (el *EntityManager) AddPropertyToEntity(name string, propertyName string, d
 	if ret != nil {
 		return ret
 	}
+	if propertyName == defs.PwdPolicyPropertyName {
+		if el.isGroupInList(name) == false {
+			return fmt.Errorf("Cannot add password policy property to '%v', it can be added only to a %v", name, groupTypeStr)
+		}
+		policy, ok := data.(*password.PasswordPolicy)
+		if ok == false {
+			return fmt.Errorf("Cannot add password policy property: Not the right type")
+		}
+		err := policy.IsValid()
+		if err != nil {
+			return err
+		}
+	}
 	if el.isUserInList(name) {
 		if propertyName == defs.AclPropertyName {
 			return fmt.Errorf("Cannot add ACL property to %v, it is ilegal", userTypeStr)
 		}
-		return el.Users[name].addProperty(propertyName, data)
+		err := el.Users[name].addProperty(propertyName, data)
+		if err == nil {
+			el.updatePasswordPolicy(name)
+		}
+		return err
 	} else if el.isGroupInList(name) {
 		if propertyName == defs.AclPropertyName {
 			return fmt.Errorf("Cannot add ACL property to %v, it is ilegal", groupTypeStr)
 		}
-		return el.Groups[name].addProperty(propertyName, data)
+		err := el.Groups[name].addProperty(propertyName, data)
+		if err == nil && propertyName == defs.PwdPolicyPropertyName {
+			el.updateGroupPasswordPolicy(name)
+		}
+		return err
 	} else if el.isResourceInList(name) {
 		return el.Resources[name].addProperty(propertyName, data)
 	}
@@ -376,7 +470,11 @@ func (el *EntityManager) RemovePropertyFromEntity(name string, propertyName stri
 	if el.isUserInList(name) {
 		return el.Users[name].removeProperty(propertyName)
 	} else if el.isGroupInList(name) {
-		return el.Groups[name].removeProperty(propertyName)
+		err := el.Groups[name].removeProperty(propertyName)
+		if err == nil && propertyName == defs.PwdPolicyPropertyName {
+			el.updateGroupPasswordPolicy(name)
+		}
+		return err
 	} else if el.isResourceInList(name) {
 		return el.Resources[name].removeProperty(propertyName)
 	}
@@ -391,29 +489,39 @@ func getPropertyStoreFmt(propertyName string, entityName string) string {
 	return propertyName + "-" + entityName
 }
 
-func addUserResourceToStorage(typeStr string, name string, e Entity, prefix string, storage *ss.SecureStorage) error {
-	err := e.addEntityToStorage(getEntityStoreFmt(typeStr+prefix, entityToken, name), storage)
+// Add the entity item and the items of its properties to the storage using one transaction, so either all of them
+// are added or none of them. The properties that their serializer doesn't implement defs.ItemsSerializer can't be
+// added to the transaction, they are added directly to the storage after the transaction is committed
+func addEntityItemsToStorage(name string, properties map[string]interface{}, addEntity func(tx *ss.Transaction) error, storage *ss.SecureStorage) error {
+	var others []string
+
+	if storage == nil {
+		return fmt.Errorf("Cannot add to storage: Storage is nil")
+	}
+	tx := storage.NewTransaction()
+	err := addEntity(tx)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	for propertyName := range e.EntityProperties {
-		data, _ := e.getProperty(propertyName)
-		err = defs.Serializers[propertyName].AddToStorage(getPropertyStoreFmt(propertyName, name), data, storage)
+	for propertyName, data := range properties {
+		s, ok := defs.Serializers[propertyName].(defs.ItemsSerializer)
+		if ok == false {
+			others = append(others, propertyName)
+			continue
+		}
+		err = s.AddToItemsWriter(getPropertyStoreFmt(propertyName, name), data, tx)
 		if err != nil {
+			tx.Rollback()
 			return fmt.Errorf("While storing to property '%v', error: %v", propertyName, err)
 		}
 	}
-	return nil
-}
-
-func addGroupToStorage(typeStr string, name string, g *Group, prefix string, storage *ss.SecureStorage) error {
-	err := g.addGroupToStorage(getEntityStoreFmt(typeStr+prefix, entityToken, name), storage)
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	for propertyName := range g.EntityProperties {
-		data, _ := g.getProperty(propertyName)
-		err = defs.Serializers[propertyName].AddToStorage(getPropertyStoreFmt(propertyName, name), data, storage)
+	for _, propertyName := range others {
+		err = defs.Serializers[propertyName].AddToStorage(getPropertyStoreFmt(propertyName, name), properties[propertyName], storage)
 		if err != nil {
 			return fmt.Errorf("While storing to property '%v', error: %v", propertyName, err)
 		}
@@ -421,22 +529,137 @@ func addGroupToStorage(typeStr string, name string, g *Group, prefix string, sto
 	return nil
 }
 
+func addUserResourceToStorage(typeStr string, name string, e Entity, prefix string, storage *ss.SecureStorage) error {
+	return addEntityItemsToStorage(name, e.getProperties(), func(tx *ss.Transaction) error {
+		return e.addEntityToStorage(getEntityStoreFmt(typeStr+prefix, entityToken, name), tx)
+	}, storage)
+}
+
+func addGroupToStorage(typeStr string, name string, g *Group, prefix string, storage *ss.SecureStorage) error {
+	return addEntityItemsToStorage(name, g.getProperties(), func(tx *ss.Transaction) error {
+		return g.addGroupToStorage(getEntityStoreFmt(typeStr+prefix, entityToken, name), tx)
+	}, storage)
+}
+
+// Return the entity that the given storage key belongs to, it is used to store
+// the items of each entity together by the storage backends that support it
+func getStorageKeyEntityName(key string) string {
+	for _, typeStr := range []string{userTypeStr, groupTypeStr, resourceTypeStr} {
+		entityPrefix := getEntityStoreFmt(typeStr, entityToken, "")
+		if strings.HasPrefix(key, entityPrefix) {
+			return strings.TrimPrefix(key, entityPrefix)
+		}
+	}
+	if strings.HasPrefix(key, getEntityStoreFmt(permissionTypeStr, "", "")) {
+		return permissionTypeStr
+	}
+	for propertyName := range defs.Serializers {
+		propertyPrefix := getPropertyStoreFmt(propertyName, "")
+		if strings.HasPrefix(key, propertyPrefix) {
+			return strings.TrimPrefix(key, propertyPrefix)
+		}
+	}
+	return ""
+}
+
+// Return the backend of the given file, it keeps the default number of previous generations of the file
+func newFileBackend(filePath string) ss.Backend {
+	backend, _ := ss.NewBackend(ss.FileBackendName, filePath) // the file backend is always supported
+	return backend
+}
+
 // LoadInfo : Load the EntityManager data from the storage
 // and constract/reconstract the EntityManager
 func LoadInfo(filePath string, secret []byte, el *EntityManager) error {
-	prefix := ""
+	return LoadInfoFromBackend(newFileBackend(filePath), secret, el)
+}
+
+// LoadInfoFromBackend : Load the EntityManager data from the storage using the given backend
+// and constract/reconstract the EntityManager
+func LoadInfoFromBackend(backend ss.Backend, secret []byte, el *EntityManager) error {
 	if el == nil {
 		return fmt.Errorf("Internal error: Entity list is nil")
 	}
-	stStorage, err := ss.LoadInfo(filePath, secret)
+	stStorage, err := ss.LoadInfoFromBackend(backend, secret)
 	if err != nil {
 		logger.Error.Printf("%v", err)
 		return fmt.Errorf("%v", err)
 	}
-	storage := stStorage.GetDecryptStorageData()
-	if storage == nil {
+	err = el.loadFromStorage(stStorage, backend.String())
+	if err == nil {
+		el.keysStorage = nil
+	}
+	return err
+}
+
+// LoadInfoWithKeyProvider : Load the EntityManager data from the storage using the given backend,
+// the storage is unlocked by the given key provider. The master key and the key providers of the storage are kept,
+// so the data can be stored again using them (see StoreInfoWithLoadedKeys)
+func LoadInfoWithKeyProvider(backend ss.Backend, provider ss.KeyProvider, el *EntityManager) error {
+	if el == nil {
+		return fmt.Errorf("Internal error: Entity list is nil")
+	}
+	stStorage, err := ss.LoadInfoWithKeyProvider(backend, provider)
+	if err != nil {
+		logger.Error.Printf("%v", err)
+		return fmt.Errorf("%v", err)
+	}
+	err = el.loadFromStorage(stStorage, backend.String())
+	if err != nil {
+		return err
+	}
+	el.keysStorage, err = ss.NewStorageWithKeysOf(stStorage)
+	return err
+}
+
+// IsLoadedWithKeyProvider : Return true if the EntityManager data was loaded from a storage that was unlocked by a key provider
+func (el *EntityManager) IsLoadedWithKeyProvider() bool {
+	return el.keysStorage != nil
+}
+
+// Return a storage that holds the decrypted items of the entities and the permissions, that are found using prefix scans,
+// and the decrypted items of the entities properties
+func readEntitiesItems(stStorage *ss.SecureStorage, prefix string) (*ss.SecureStorage, error) {
+	storage := &ss.SecureStorage{Data: make(ss.SecureDataMap)}
+	for _, typeStr := range []string{userTypeStr, groupTypeStr, resourceTypeStr, permissionTypeStr} {
+		typePrefix := getEntityStoreFmt(typeStr+prefix, entityToken, "")
+		if typeStr == permissionTypeStr {
+			typePrefix = getEntityStoreFmt(typeStr+prefix, "", "")
+		}
+		keys, err := stStorage.GetKeys(typePrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			storage.Data[key], err = stStorage.GetItem(key)
+			if err != nil {
+				return nil, err
+			}
+			if typeStr == permissionTypeStr {
+				continue
+			}
+			name := strings.TrimPrefix(key, typePrefix)
+			for propertyName := range defs.Serializers {
+				propertyKey := getPropertyStoreFmt(propertyName, name)
+				value, err := stStorage.GetItem(propertyKey)
+				if err == nil { // the item exist for this entity
+					storage.Data[propertyKey] = value
+				}
+			}
+		}
+	}
+	return storage, nil
+}
+
+func (el *EntityManager) loadFromStorage(stStorage *ss.SecureStorage, filePath string) error {
+	prefix := ""
+	if stStorage == nil {
 		return fmt.Errorf("loadInfo: Storage is nil")
 	}
+	storage, err := readEntitiesItems(stStorage, prefix)
+	if err != nil {
+		return fmt.Errorf("Error while reading file: '%s', error: %s", filePath, err)
+	}
 	for key, value := range storage.Data {
 		userType := strings.HasPrefix(key, getEntityStoreFmt(userTypeStr+prefix, entityToken, ""))
 		groupType := strings.HasPrefix(key, getEntityStoreFmt(groupTypeStr+prefix, entityToken, ""))
@@ -481,20 +704,64 @@ func LoadInfo(filePath string, secret []byte, el *EntityManager) error {
 			el.AddPermission(permission)
 		}
 	}
+	// the groups and their password policies may be loaded after their members
+	for name := range el.Users {
+		el.updatePasswordPolicy(name)
+	}
 	return nil
 }
 
 // StoreInfo : Store all the data of all the entities in the list including their properties in the secure storage
 func (el *EntityManager) StoreInfo(filePath string, secret []byte, checkSecretStrength bool) error {
+	return el.StoreInfoToBackend(newFileBackend(filePath), secret, checkSecretStrength)
+}
+
+// StoreInfoToBackend : Store all the data of all the entities in the list including their properties in the secure storage using the given backend
+func (el *EntityManager) StoreInfoToBackend(backend ss.Backend, secret []byte, checkSecretStrength bool) error {
 	lock.Lock()
 	defer lock.Unlock()
 
-	prefix := ""
 	storage, err := ss.NewStorage(secret, checkSecretStrength)
 	if err != nil {
 		logger.Error.Printf("Fatal error: Cannot create storage, error: %v", err)
 		return fmt.Errorf("Fatal error: Cannot create storage, error: %v", err)
 	}
+	return el.storeToStorage(storage, backend)
+}
+
+// StoreInfoWithKeyProviders : Store all the data of all the entities in the list including their properties in the secure storage using the given backend,
+// the storage is protected by a new data key that is wrapped by each of the given key providers
+func (el *EntityManager) StoreInfoWithKeyProviders(backend ss.Backend, providers []ss.KeyProvider) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	storage, err := ss.NewStorageWithKeyProviders(providers...)
+	if err != nil {
+		logger.Error.Printf("Fatal error: Cannot create storage, error: %v", err)
+		return fmt.Errorf("Fatal error: Cannot create storage, error: %v", err)
+	}
+	return el.storeToStorage(storage, backend)
+}
+
+// StoreInfoWithLoadedKeys : Store all the data of all the entities in the list including their properties in the secure storage using the given backend,
+// the storage is protected by the master key and the key providers of the storage that the data was loaded from using a key provider
+func (el *EntityManager) StoreInfoWithLoadedKeys(backend ss.Backend) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if el.keysStorage == nil {
+		return fmt.Errorf("The data was not loaded using a key provider")
+	}
+	storage, err := ss.NewStorageWithKeysOf(el.keysStorage)
+	if err != nil {
+		logger.Error.Printf("Fatal error: Cannot create storage, error: %v", err)
+		return fmt.Errorf("Fatal error: Cannot create storage, error: %v", err)
+	}
+	return el.storeToStorage(storage, backend)
+}
+
+func (el *EntityManager) storeToStorage(storage *ss.SecureStorage, backend ss.Backend) error {
+	prefix := ""
 	for name, e := range el.Users {
 		err := addUserResourceToStorage(userTypeStr, name, e.Entity, prefix, storage)
 		if err != nil {
@@ -519,8 +786,8 @@ func (el *EntityManager) StoreInfo(filePath string, secret []byte, checkSecretSt
 			return err
 		}
 	}
-	logger.Info.Println("Store Security Tool data to file:", filePath)
-	return storage.StoreInfo(filePath)
+	logger.Info.Println("Store Security Tool data to:", backend)
+	return storage.StoreInfoToBackend(backend)
 }
 
 //------------------- ACL global Permissions list handler
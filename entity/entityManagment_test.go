@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"math"
 	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
 	am "github.com/ibm-security-innovation/libsecurity-go/accounts"
+	"github.com/ibm-security-innovation/libsecurity-go/password"
 	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 )
@@ -18,6 +20,11 @@ var (
 	salt   = []byte("Salt")
 )
 
+func init() {
+	// a cheap password hashing, the throttling delays are measured by the tests
+	password.SetHashParams(password.HashParams{Algorithm: password.Pbkdf2Sha256Algorithm, Iterations: 1000})
+}
+
 // Print an EntityManager with its properties
 func (el *EntityManager) getEntityManagerStrWithProperties() string {
 	str := ""
@@ -381,7 +388,253 @@ func Test_StoreLoad(t *testing.T) {
 	}
 }
 
+// Verify that when the directory backend is used, the data of each entity is stored in a separate file
+// and that the loaded entity list includes all the stored entities and permissions
+func Test_StoreLoadDirectoryBackend(t *testing.T) {
+	dirPath := "./tryDir"
+	usersName := []string{"User0", "User1"}
+	defer os.RemoveAll(dirPath)
+
+	usersList := New()
+	GenerateUserData(usersList, usersName, secret, salt)
+	GenerateGroupList(usersList, usersName)
+	usersList.AddPermission("can use it")
+	logger.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+	backend, _ := ss.NewBackend(ss.DirectoryBackendName, dirPath)
+	err := usersList.StoreInfoToBackend(backend, secret, false)
+	if err != nil {
+		t.Fatalf("Test fail: can't store to directory backend, error: %v", err)
+	}
+	files, _ := ioutil.ReadDir(dirPath)
+	// a file for each entity, one for the permissions and a header file
+	expected := len(usersList.Users) + len(usersList.Groups) + len(usersList.Resources) + 2
+	if len(files) != expected {
+		t.Errorf("Test fail: the number of stored files %v is not as expected %v", len(files), expected)
+	}
+	usersList1 := New()
+	err = LoadInfoFromBackend(backend, secret, usersList1)
+	if err != nil {
+		t.Fatalf("Test fail: can't load from directory backend, error: %v", err)
+	}
+	if len(usersList.Users) != len(usersList1.Users) ||
+		len(usersList.Groups) != len(usersList1.Groups) || len(usersList.Resources) != len(usersList1.Resources) ||
+		usersList.Permissions.IsEqual(usersList1.Permissions) == false {
+		t.Errorf("Test fail, Stored entity list: %v != loaded one: %v", usersList, usersList1)
+	}
+	for name := range usersList.Users {
+		if usersList1.isUserInList(name) == false {
+			t.Errorf("Test fail, Stored user '%v' was not loaded", name)
+		}
+	}
+}
+
+// Verify that the entity list that was stored using key providers can be loaded using each of them
+func Test_StoreLoadKeyProviders(t *testing.T) {
+	filePath := "./tmp.txt"
+	usersName := []string{"User0", "User1"}
+	defer os.Remove(filePath)
+
+	usersList := New()
+	GenerateUserData(usersList, usersName, secret, salt)
+	logger.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+	p1, _ := ss.NewPassphraseKeyProvider("operator1", []byte("passphrase 1"))
+	p2, _ := ss.NewPassphraseKeyProvider("operator2", []byte("passphrase 2"))
+	backend := ss.NewFileBackend(filePath)
+	err := usersList.StoreInfoWithKeyProviders(backend, []ss.KeyProvider{p1, p2})
+	if err != nil {
+		t.Fatalf("Test fail: can't store using key providers, error: %v", err)
+	}
+	for _, p := range []ss.KeyProvider{p1, p2} {
+		usersList1 := New()
+		err = LoadInfoWithKeyProvider(backend, p, usersList1)
+		if err != nil {
+			t.Fatalf("Test fail: can't load using key provider '%v', error: %v", p.Name(), err)
+		}
+		for name := range usersList.Users {
+			if usersList1.isUserInList(name) == false {
+				t.Errorf("Test fail, Stored user '%v' was not loaded using key provider '%v'", name, p.Name())
+			}
+		}
+	}
+	err = LoadInfoFromBackend(backend, secret, New())
+	if err == nil {
+		t.Errorf("Test fail: the entity list that was stored using key providers was loaded using a secret")
+	}
+}
+
+// Verify that the entity list that was loaded using a key provider is stored using the same keys,
+// so it can be loaded using each of the key providers, and that it can't be stored so if it was loaded using a secret
+func Test_StoreLoadedKeys(t *testing.T) {
+	filePath := "./tmp.txt"
+	filePath1 := "./tmp1.txt"
+	usersName := []string{"User0", "User1"}
+	defer os.Remove(filePath)
+	defer os.Remove(filePath1)
+
+	usersList := New()
+	GenerateUserData(usersList, usersName, secret, salt)
+	logger.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+	p1, _ := ss.NewPassphraseKeyProvider("operator1", []byte("passphrase 1"))
+	p2, _ := ss.NewPassphraseKeyProvider("operator2", []byte("passphrase 2"))
+	backend := ss.NewFileBackend(filePath)
+	backend1 := ss.NewFileBackend(filePath1)
+	usersList.StoreInfoWithKeyProviders(backend, []ss.KeyProvider{p1, p2})
+	if usersList.IsLoadedWithKeyProvider() || usersList.StoreInfoWithLoadedKeys(backend1) == nil {
+		t.Errorf("Test fail: the entity list that was not loaded using a key provider was stored using the loaded keys")
+	}
+	usersList1 := New()
+	err := LoadInfoWithKeyProvider(backend, p1, usersList1)
+	if err != nil || usersList1.IsLoadedWithKeyProvider() == false {
+		t.Fatalf("Test fail: can't load using key provider '%v', error: %v", p1.Name(), err)
+	}
+	err = usersList1.StoreInfoWithLoadedKeys(backend1)
+	if err != nil {
+		t.Fatalf("Test fail: can't store using the loaded keys, error: %v", err)
+	}
+	for _, p := range []ss.KeyProvider{p1, p2} {
+		usersList2 := New()
+		err = LoadInfoWithKeyProvider(backend1, p, usersList2)
+		if err != nil {
+			t.Fatalf("Test fail: can't load the entity list that was stored using the loaded keys using key provider '%v', error: %v", p.Name(), err)
+		}
+		for name := range usersList.Users {
+			if usersList2.isUserInList(name) == false {
+				t.Errorf("Test fail, Stored user '%v' was not loaded using key provider '%v'", name, p.Name())
+			}
+		}
+	}
+	err = LoadInfoFromBackend(backend1, secret, New())
+	if err == nil {
+		t.Errorf("Test fail: the entity list that was stored using the loaded keys was loaded using a secret")
+	}
+}
+
 // Test corners: 
+// Verify that the properties of the modules can be added to the storage using a transaction:
+// they are added only when the transaction is committed
+func Test_addPropertiesInTransaction(t *testing.T) {
+	usersName := []string{"u1", "u2"}
+	usersList := New()
+	GenerateUserData(usersList, usersName, secret, salt)
+	u := usersList.Users[usersName[0]]
+	storage, _ := ss.NewStorage([]byte("12345678"), false)
+	tx := storage.NewTransaction()
+	for propertyName := range u.EntityProperties {
+		s, ok := defs.Serializers[propertyName].(defs.ItemsSerializer)
+		if ok == false {
+			t.Fatalf("Test fail: the serializer of the property '%v' can't add it to a transaction", propertyName)
+		}
+		data, _ := u.getProperty(propertyName)
+		err := s.AddToItemsWriter(getPropertyStoreFmt(propertyName, u.Name), data, tx)
+		if err != nil {
+			t.Errorf("Test fail: can't add the property '%v' to the transaction, error: %v", propertyName, err)
+		}
+	}
+	if len(storage.Data) != 0 {
+		t.Errorf("Test fail: the properties were added to the storage before the transaction was committed")
+	}
+	err := tx.Commit()
+	if err != nil || len(storage.Data) != len(u.EntityProperties) {
+		t.Errorf("Test fail: %v items were stored instead of %v, error: %v", len(storage.Data), len(u.EntityProperties), err)
+	}
+}
+
+// A serializer that adds one item and then fails, it is used to verify that the items of an entity are stored together
+type failingSerializer struct{}
+
+func (s failingSerializer) PrintProperties(data interface{}) string { return "" }
+
+func (s failingSerializer) IsEqualProperties(d1 interface{}, d2 interface{}) bool { return false }
+
+func (s failingSerializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+func (s failingSerializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
+	storage.AddItem(prefix, "partial")
+	return fmt.Errorf("The property can't be stored")
+}
+
+func (s failingSerializer) ReadFromStorage(key string, storage *ss.SecureStorage) (interface{}, error) {
+	return nil, fmt.Errorf("The property can't be read")
+}
+
+// Verify that when one of the properties of an entity can't be stored, none of the items of that entity are stored
+// and that the entity items are stored when all its properties are stored
+func Test_storeEntityAllOrNothing(t *testing.T) {
+	failingPropertyName := "failing"
+	usersName := []string{"u1", "u2"}
+	usersList := New()
+	GenerateUserData(usersList, usersName, secret, salt)
+	u := usersList.Users[usersName[0]]
+	defs.Serializers[failingPropertyName] = failingSerializer{}
+	defer delete(defs.Serializers, failingPropertyName)
+
+	storage, _ := ss.NewStorage([]byte("12345678"), false)
+	err := addUserResourceToStorage(userTypeStr, u.Name, u.Entity, "", storage)
+	if err != nil || len(storage.Data) != len(u.EntityProperties)+1 {
+		t.Fatalf("Test fail: %v items were stored instead of %v, error: %v", len(storage.Data), len(u.EntityProperties)+1, err)
+	}
+	u.EntityProperties[failingPropertyName] = "data"
+	storage, _ = ss.NewStorage([]byte("12345678"), false)
+	err = addUserResourceToStorage(userTypeStr, u.Name, u.Entity, "", storage)
+	if err == nil {
+		t.Errorf("Test fail: the entity was stored although one of its properties can't be stored")
+	}
+	if len(storage.Data) != 0 {
+		t.Errorf("Test fail: %v items of the entity were stored although one of its properties can't be stored", len(storage.Data))
+	}
+	delete(u.EntityProperties, failingPropertyName)
+}
+
+// Verify that the effective password policy of a user is the strictest policy of its groups and that it is
+// updated when the user joins or leaves a group and when a group policy is added or removed
+// Verify that a password policy can be added only to groups
+func Test_groupPasswordPolicy(t *testing.T) {
+	userName := "u1"
+	groupsName := []string{"g1", "g2"}
+	el := New()
+	el.AddUser(userName)
+	for _, name := range groupsName {
+		el.AddGroup(name)
+	}
+	a1, _ := am.NewUserAm(am.UserPermission, secret, salt, false)
+	el.AddPropertyToEntity(userName, defs.AmPropertyName, a1)
+
+	p1 := password.NewDefaultPasswordPolicy()
+	p1.MinLength = 12
+	p2 := password.NewDefaultPasswordPolicy()
+	p2.MaxAttempts = 3
+	el.AddPropertyToEntity(groupsName[0], defs.PwdPolicyPropertyName, &p1)
+	el.AddPropertyToEntity(groupsName[1], defs.PwdPolicyPropertyName, &p2)
+	if a1.Pwd.Policy != nil {
+		t.Errorf("Test fail: the user that is not a member of any group has the policy %v", a1.Pwd.Policy)
+	}
+	el.AddUserToGroup(groupsName[0], userName)
+	el.AddUserToGroup(groupsName[1], userName)
+	expected := password.GetStrictestPolicy(p1, p2)
+	if a1.Pwd.GetPolicy() != expected {
+		t.Errorf("Test fail: the user policy %v is not as expected %v", a1.Pwd.GetPolicy(), expected)
+	}
+	el.RemovePropertyFromEntity(groupsName[1], defs.PwdPolicyPropertyName)
+	if a1.Pwd.GetPolicy() != p1 {
+		t.Errorf("Test fail: the user policy %v is not as expected %v after the group policy was removed", a1.Pwd.GetPolicy(), p1)
+	}
+	el.RemoveUserFromGroup(groupsName[0], userName)
+	if a1.Pwd.Policy != nil {
+		t.Errorf("Test fail: the user that left its groups has the policy %v", a1.Pwd.Policy)
+	}
+	err := el.AddPropertyToEntity(userName, defs.PwdPolicyPropertyName, &p1)
+	if err == nil {
+		t.Errorf("Test fail: a password policy was added to a user")
+	}
+	p1.MaxAttempts = 0
+	err = el.AddPropertyToEntity(groupsName[1], defs.PwdPolicyPropertyName, &p1)
+	if err == nil {
+		t.Errorf("Test fail: the illegal password policy %v was added", p1)
+	}
+}
+
 func Test_corners(t *testing.T) {
 	userName := "u1"
 	groupName := "g1"
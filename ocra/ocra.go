@@ -715,6 +715,14 @@ func (s Serializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
 
 // AddToStorage : Add the OCRA property information to the secure_storage
 func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add OCRA property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the OCRA property information to an items writer, e.g. a storage transaction
+func (s Serializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
 	d, ok := data.(*UserOcra)
 	if ok == false {
 		return fmt.Errorf("Cannot store the OCRA property: Not the right type")
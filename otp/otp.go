@@ -40,6 +40,7 @@ const (
 	defaultIntervalSec = 30
 
 	minNumOfDigits = 6 // RFC 4226 R4
+	maxNumOfDigits = 8 // the maximum number of digits that the OTP parameters of a user may use
 	minSecretLen   = 4 // TODO 16 // RFC 4226 R6, for OCRA examples it must be 8
 	maxSecretLen   = 255
 	minIntervalSec = 10
@@ -0,0 +1,84 @@
+package otp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A self service enrollment is done in 2 phases: a pending OTP user with a strong random secret is generated and its
+// Key URI is imported by the authenticator application, the OTP is activated only after the user confirms the enrollment
+// using a valid code generated by the authenticator application. A pending enrollment that was not confirmed in time expires
+
+const (
+	enrollmentSecretLen = 20 // 160 bits, as recommended by RFC 4226 R6
+
+	defaultPendingExpirationSec = 600
+	minPendingExpirationSec     = 60
+	maxPendingExpirationSec     = 24 * 3600
+)
+
+var (
+	pendingLock       sync.Mutex
+	pendingExpiration = defaultPendingExpirationSec * time.Second
+)
+
+// SetPendingExpiration : Set the time that a pending enrollment can be confirmed in, after it was generated
+func SetPendingExpiration(expiration time.Duration) error {
+	if expiration < minPendingExpirationSec*time.Second || expiration > maxPendingExpirationSec*time.Second {
+		return fmt.Errorf("The pending enrollment expiration %v is not in the allowed range: %vs-%vs", expiration, minPendingExpirationSec, maxPendingExpirationSec)
+	}
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	pendingExpiration = expiration
+	return nil
+}
+
+// GetPendingExpiration : Return the time that a pending enrollment can be confirmed in
+func GetPendingExpiration() time.Duration {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	return pendingExpiration
+}
+
+// NewPendingOtpUser : generate a new pending otp user with the given OTP parameters and a random secret,
+// it must be confirmed by ConfirmOtpEnrollment before it expires
+func NewPendingOtpUser(params OtpParams) (*UserInfoOtp, error) {
+	secret := make([]byte, enrollmentSecretLen)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	u, err := NewSimpleOtpUserWithParams(secret, false, params)
+	if err != nil {
+		return nil, err
+	}
+	u.Pending = true
+	// stored in UTC without the monotonic clock reading so it is the same after it is read from the storage
+	u.PendingExpiration = time.Now().Add(GetPendingExpiration()).UTC().Round(0)
+	return u, nil
+}
+
+// IsPendingExpired : Check if the OTP enrollment is pending and can't be confirmed anymore
+func (u UserInfoOtp) IsPendingExpired() bool {
+	return u.Pending && time.Now().After(u.PendingExpiration)
+}
+
+// ConfirmOtpEnrollment : Activate the pending OTP if the given code is as expected, the code is verified
+// (including the throttling and the blocking) the same as any other code
+func (u *UserInfoOtp) ConfirmOtpEnrollment(code string, otpType TypeOfOtp) (bool, error) {
+	if u.Pending == false {
+		return false, fmt.Errorf("The OTP enrollment is not pending")
+	}
+	if u.IsPendingExpired() {
+		return false, fmt.Errorf("The OTP enrollment expired at %v, please enroll again", u.PendingExpiration)
+	}
+	ok, err := u.verifyOtpUserCodeHelper(code, otpType, 0, true)
+	if ok == false {
+		return false, err
+	}
+	u.Pending = false
+	u.PendingExpiration = time.Time{}
+	return true, nil
+}
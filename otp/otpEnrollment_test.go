@@ -0,0 +1,73 @@
+package otp
+
+import (
+	"testing"
+	"time"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+)
+
+// Verify that the pending OTP can't be used before it is confirmed, that it is not activated by a wrong code
+// and that after it is confirmed it is active
+func Test_confirmPendingEnrollment(t *testing.T) {
+	user, err := NewPendingOtpUser(NewDefaultOtpParams())
+	if err != nil {
+		t.Fatalf("Test fail: can't generate a pending OTP user, error: %v", err)
+	}
+	if len(user.Secret) != enrollmentSecretLen || user.Pending == false || user.IsPendingExpired() {
+		t.Fatalf("Test fail: the generated OTP user is not pending or its secret length is %v instead of %v", len(user.Secret), enrollmentSecretLen)
+	}
+	code, _ := user.BaseHotp.AtCount(user.BaseHotp.Count)
+	ok, _ := user.VerifyOtpUserCode(code, HotpType)
+	if ok {
+		t.Errorf("Test fail: the code of a pending OTP was verified")
+	}
+	ok, _ = user.ConfirmOtpEnrollment(wrongCode, TotpType)
+	if ok || user.Pending == false {
+		t.Errorf("Test fail: the pending OTP enrollment was confirmed using a wrong code")
+	}
+	user.Throttle.throttlingTimerTotp = defs.GetBeginningOfTime()
+	code, _ = user.BaseTotp.Now()
+	ok, err = user.ConfirmOtpEnrollment(code, TotpType)
+	if ok == false || user.Pending {
+		t.Fatalf("Test fail: the pending OTP enrollment was not confirmed using a valid code, error: %v", err)
+	}
+	code, _ = user.BaseHotp.AtCount(user.BaseHotp.Count)
+	ok, err = user.VerifyOtpUserCode(code, HotpType)
+	if ok == false {
+		t.Errorf("Test fail: the code of the confirmed OTP was not verified, error: %v", err)
+	}
+	_, err = user.ConfirmOtpEnrollment(code, HotpType)
+	if err == nil {
+		t.Errorf("Test fail: an active OTP enrollment was confirmed")
+	}
+}
+
+// Verify that an expired pending enrollment can't be confirmed and that the expiration range is enforced
+func Test_pendingEnrollmentExpired(t *testing.T) {
+	defer SetPendingExpiration(defaultPendingExpirationSec * time.Second)
+
+	user, _ := NewPendingOtpUser(NewDefaultOtpParams())
+	user.PendingExpiration = time.Now().Add(-time.Second)
+	code, _ := user.BaseTotp.Now()
+	ok, err := user.ConfirmOtpEnrollment(code, TotpType)
+	if ok || err == nil || user.IsPendingExpired() == false {
+		t.Errorf("Test fail: an expired pending OTP enrollment was confirmed")
+	}
+	for _, sec := range []time.Duration{minPendingExpirationSec - 1, maxPendingExpirationSec + 1} {
+		if SetPendingExpiration(sec*time.Second) == nil {
+			t.Errorf("Test fail: the illegal pending enrollment expiration %vs was accepted", sec)
+		}
+	}
+	SetPendingExpiration(minPendingExpirationSec * time.Second)
+	user, _ = NewPendingOtpUser(NewDefaultOtpParams())
+	if user.PendingExpiration.After(time.Now().Add(minPendingExpirationSec * time.Second)) {
+		t.Errorf("Test fail: the pending enrollment expires at %v, after %vs", user.PendingExpiration, minPendingExpirationSec)
+	}
+}
+
+func Test_StoreLoadPending(t *testing.T) {
+	user, _ := NewPendingOtpUser(NewDefaultOtpParams())
+
+	defs.StoreLoadTest(t, user, defs.OtpPropertyName)
+}
@@ -0,0 +1,226 @@
+package otp
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ibm-security-innovation/libsecurity-go/qrcode"
+)
+
+// The Key URI Format (as used by Google Authenticator and the other authenticator applications) is:
+//	otpauth://<totp|hotp>/<issuer>:<account>?secret=<base32 secret>&issuer=<issuer>&algorithm=<SHA1|SHA256|SHA512>&digits=<digits>&period=<seconds>&counter=<counter>
+// the period is used only by TOTP and the counter is used (and required) only by HOTP
+
+const (
+	keyURIScheme = "otpauth"
+	hotpURIType  = "hotp"
+	totpURIType  = "totp"
+
+	secretParam    = "secret"
+	issuerParam    = "issuer"
+	algorithmParam = "algorithm"
+	digitsParam    = "digits"
+	periodParam    = "period"
+	counterParam   = "counter"
+)
+
+var keyURISecretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// KeyURI : The OTP provisioning information of a user, in the Key URI Format it can be imported by authenticator applications
+type KeyURI struct {
+	Type      TypeOfOtp
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int   // TOTP only, in seconds
+	Counter   int64 // HOTP only
+}
+
+func (k KeyURI) String() string {
+	typeStr := totpURIType
+	if k.Type == HotpType {
+		typeStr = hotpURIType
+	}
+	label := url.PathEscape(k.Account)
+	if len(k.Issuer) > 0 {
+		label = url.PathEscape(k.Issuer) + ":" + label
+	}
+	params := []string{secretParam + "=" + keyURISecretEncoding.EncodeToString(k.Secret)}
+	if len(k.Issuer) > 0 {
+		params = append(params, issuerParam+"="+escapeQueryValue(k.Issuer))
+	}
+	params = append(params, algorithmParam+"="+k.Algorithm, fmt.Sprintf("%v=%v", digitsParam, k.Digits))
+	if k.Type == HotpType {
+		params = append(params, fmt.Sprintf("%v=%v", counterParam, k.Counter))
+	} else {
+		params = append(params, fmt.Sprintf("%v=%v", periodParam, k.Period))
+	}
+	return fmt.Sprintf("%v://%v/%v?%v", keyURIScheme, typeStr, label, strings.Join(params, "&"))
+}
+
+// The authenticator applications expect the spaces to be encoded as %20 and not as +
+func escapeQueryValue(val string) string {
+	return strings.Replace(url.QueryEscape(val), "+", "%20", -1)
+}
+
+// IsValid : Verify that the Key URI fields are valid and can be used to generate the OTP codes
+func (k KeyURI) IsValid() error {
+	if k.Type != HotpType && k.Type != TotpType {
+		return fmt.Errorf("The Key URI is not valid: the OTP type %v must be HOTP (%v) or TOTP (%v)", k.Type, HotpType, TotpType)
+	}
+	if len(k.Account) == 0 {
+		return fmt.Errorf("The Key URI is not valid: the account name must not be empty")
+	}
+	if strings.Contains(k.Account, ":") || strings.Contains(k.Issuer, ":") {
+		return fmt.Errorf("The Key URI is not valid: the account name '%v' and the issuer '%v' must not include ':'", k.Account, k.Issuer)
+	}
+	err := isSecretValid(k.Secret)
+	if err != nil {
+		return err
+	}
+	_, exist := algorithms[k.Algorithm]
+	if exist == false {
+		return fmt.Errorf("The Key URI is not valid: the algorithm '%v' is not supported, the supported algorithms are: '%v', '%v', '%v'",
+			k.Algorithm, Sha1AlgorithmName, Sha256AlgorithmName, Sha512AlgorithmName)
+	}
+	if k.Digits < minNumOfDigits || k.Digits > maxNumOfDigits {
+		return fmt.Errorf("The Key URI is not valid: the number of digits %v must be between %v and %v", k.Digits, minNumOfDigits, maxNumOfDigits)
+	}
+	if k.Type == TotpType && (k.Period < minIntervalSec || k.Period > maxIntervalSec) {
+		return fmt.Errorf("The Key URI is not valid: the period %vs must be between %vs and %vs", k.Period, minIntervalSec, maxIntervalSec)
+	}
+	if k.Type == HotpType && k.Counter < 0 {
+		return fmt.Errorf("The Key URI is not valid: the counter %v must not be negative", k.Counter)
+	}
+	return nil
+}
+
+// GetKeyURI : Return the Key URI of the user's HOTP or TOTP, the account is the user name
+// as it is displayed by the authenticator application and the issuer is the service name (optional)
+func (u UserInfoOtp) GetKeyURI(otpType TypeOfOtp, issuer string, account string) (*KeyURI, error) {
+	k := KeyURI{Type: otpType, Issuer: issuer, Account: account}
+	var baseOtp *Otp
+	if otpType == HotpType && u.BaseHotp != nil {
+		baseOtp = u.BaseHotp.BaseOtp
+		k.Counter = u.BaseHotp.Count
+	} else if otpType == TotpType && u.BaseTotp != nil {
+		baseOtp = u.BaseTotp.BaseOtp
+		k.Period = int(u.BaseTotp.Interval.Seconds())
+	}
+	if baseOtp == nil {
+		return nil, fmt.Errorf("The user has no OTP of type %v", otpType)
+	}
+	algorithm, err := getAlgorithmName(baseOtp.digest)
+	if err != nil {
+		return nil, err
+	}
+	k.Secret = append([]byte{}, baseOtp.Secret...)
+	k.Algorithm = algorithm
+	k.Digits = baseOtp.Digits
+	err = k.IsValid()
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ParseKeyURI : Parse the given otpauth:// Key URI, the missing optional parameters get their default values
+func ParseKeyURI(uri string) (*KeyURI, error) {
+	var k KeyURI
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: %v", uri, err)
+	}
+	if u.Scheme != keyURIScheme {
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: the scheme must be '%v'", uri, keyURIScheme)
+	}
+	switch u.Host {
+	case hotpURIType:
+		k.Type = HotpType
+	case totpURIType:
+		k.Type = TotpType
+	default:
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: the OTP type '%v' must be '%v' or '%v'", uri, u.Host, hotpURIType, totpURIType)
+	}
+	label := strings.TrimPrefix(u.Path, "/")
+	k.Account = label
+	idx := strings.Index(label, ":")
+	if idx >= 0 {
+		k.Issuer = label[:idx]
+		k.Account = strings.TrimLeft(label[idx+1:], " ")
+	}
+	query := u.Query()
+	issuer := query.Get(issuerParam)
+	if len(issuer) > 0 {
+		if len(k.Issuer) > 0 && k.Issuer != issuer {
+			return nil, fmt.Errorf("The Key URI '%v' is not valid: the label issuer '%v' is not the same as the issuer parameter '%v'", uri, k.Issuer, issuer)
+		}
+		k.Issuer = issuer
+	}
+	secret := strings.ToUpper(strings.TrimRight(query.Get(secretParam), "="))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: the secret parameter is missing", uri)
+	}
+	k.Secret, err = keyURISecretEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: the secret is not base32 encoded: %v", uri, err)
+	}
+	k.Algorithm = Sha1AlgorithmName
+	if val := query.Get(algorithmParam); len(val) > 0 {
+		k.Algorithm = strings.ToUpper(val)
+	}
+	k.Digits, err = getIntParam(query, digitsParam, defaultNumOfDigits)
+	if err == nil && k.Type == TotpType {
+		k.Period, err = getIntParam(query, periodParam, defaultIntervalSec)
+	}
+	if err == nil && k.Type == HotpType {
+		if len(query.Get(counterParam)) == 0 {
+			return nil, fmt.Errorf("The Key URI '%v' is not valid: the counter parameter is required for HOTP", uri)
+		}
+		k.Counter, err = strconv.ParseInt(query.Get(counterParam), 10, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("The Key URI '%v' is not valid: %v", uri, err)
+	}
+	err = k.IsValid()
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func getIntParam(query url.Values, name string, defaultVal int) (int, error) {
+	str := query.Get(name)
+	if len(str) == 0 {
+		return defaultVal, nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("the %v parameter '%v' is not a number", name, str)
+	}
+	return val, nil
+}
+
+// GetOtp : Return the OTP that the Key URI describes, it generates the same codes as the authenticator application
+func (k KeyURI) GetOtp() (*Otp, error) {
+	err := k.IsValid()
+	if err != nil {
+		return nil, err
+	}
+	return NewOtpAdvance(k.Secret, k.Digits, algorithms[k.Algorithm])
+}
+
+// QRCode : Return the Key URI encoded as a QR code, to be scanned by the authenticator application
+func (k KeyURI) QRCode(level qrcode.ErrorCorrectionLevel) (*qrcode.Code, error) {
+	err := k.IsValid()
+	if err != nil {
+		return nil, err
+	}
+	return qrcode.Encode([]byte(k.String()), level)
+}
@@ -0,0 +1,111 @@
+package otp
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/ibm-security-innovation/libsecurity-go/qrcode"
+)
+
+const (
+	testIssuer  = "Example Co"
+	testAccount = "alice@example.com"
+)
+
+// Verify that the Key URI example of the Key URI Format is parsed as expected and that the parsed Key URI
+// generates the same codes as the RFC 4226 test vectors
+func Test_parseKeyURIExample(t *testing.T) {
+	k, err := ParseKeyURI("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		t.Fatalf("Test fail: can't parse the Key URI, error: %v", err)
+	}
+	exp := KeyURI{Type: TotpType, Issuer: "Example", Account: "alice@google.com", Secret: []byte("Hello!\xde\xad\xbe\xef"),
+		Algorithm: Sha1AlgorithmName, Digits: defaultNumOfDigits, Period: defaultIntervalSec}
+	if k.String() != exp.String() || string(k.Secret) != string(exp.Secret) {
+		t.Errorf("Test fail: the parsed Key URI is '%v' instead of '%v'", k, exp)
+	}
+
+	k, err = ParseKeyURI("otpauth://hotp/Example%20Co:%20bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=1&digits=6")
+	if err != nil {
+		t.Fatalf("Test fail: can't parse the HOTP Key URI, error: %v", err)
+	}
+	if k.Issuer != testIssuer || k.Account != "bob" || k.Counter != 1 {
+		t.Errorf("Test fail: the parsed HOTP Key URI '%v' is not as expected", k)
+	}
+	otp, err := k.GetOtp()
+	if err != nil {
+		t.Fatalf("Test fail: can't get the OTP of the Key URI '%v', error: %v", k, err)
+	}
+	code, _ := otp.Generate(k.Counter)
+	if code != "287082" { // RFC 4226 test vector of count 1
+		t.Errorf("Test fail: the code of the Key URI '%v' is %v instead of 287082", k, code)
+	}
+}
+
+// Verify that the Key URIs of the user's HOTP and TOTP are parsed back to the same values and
+// generate the same codes as the user's OTPs
+func Test_userKeyURI(t *testing.T) {
+	user, _ := NewSimpleOtpUser(BaseSecret, false)
+	user.BaseTotp.BaseOtp.digest = sha256.New
+	user.BaseTotp.BaseOtp.Digits = 8
+	user.BaseTotp.Interval = 60 * time.Second
+
+	for _, otpType := range []TypeOfOtp{HotpType, TotpType} {
+		k, err := user.GetKeyURI(otpType, testIssuer, testAccount)
+		if err != nil {
+			t.Fatalf("Test fail: can't get the Key URI of type %v, error: %v", otpType, err)
+		}
+		k1, err := ParseKeyURI(k.String())
+		if err != nil || k1.String() != k.String() {
+			t.Fatalf("Test fail: the Key URI '%v' was parsed to '%v', error: %v", k, k1, err)
+		}
+		otp, _ := k1.GetOtp()
+		var code, exp string
+		if otpType == HotpType {
+			code, _ = otp.Generate(k1.Counter)
+			exp, _ = user.BaseHotp.AtCount(user.BaseHotp.Count)
+		} else {
+			totp := Totp{Interval: time.Duration(k1.Period) * time.Second, BaseOtp: otp}
+			code, _ = totp.Now()
+			exp, _ = user.BaseTotp.Now()
+		}
+		if code != exp {
+			t.Errorf("Test fail: the code of the Key URI '%v' is %v instead of %v", k1, code, exp)
+		}
+		_, err = k.QRCode(qrcode.Medium)
+		if err != nil {
+			t.Errorf("Test fail: can't encode the Key URI '%v' as a QR code, error: %v", k, err)
+		}
+	}
+	if k, _ := user.GetKeyURI(TotpType, testIssuer, testAccount); k.Algorithm != Sha256AlgorithmName || k.Digits != 8 || k.Period != 60 {
+		t.Errorf("Test fail: the TOTP Key URI '%v' does not use the user's algorithm, digits and period", k)
+	}
+}
+
+// Verify that illegal Key URIs and users that can't be described by a Key URI are rejected
+func Test_keyURICorners(t *testing.T) {
+	illegal := []string{"http://totp/a?secret=JBSWY3DPEHPK3PXP", "otpauth://motp/a?secret=JBSWY3DPEHPK3PXP", "otpauth://totp/a",
+		"otpauth://totp/a?secret=JBSWY3DP!HPK3PXP", "otpauth://totp/?secret=JBSWY3DPEHPK3PXP", "otpauth://totp/a?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/a?secret=JBSWY3DPEHPK3PXP&digits=5", "otpauth://totp/a?secret=JBSWY3DPEHPK3PXP&digits=x",
+		"otpauth://totp/a?secret=JBSWY3DPEHPK3PXP&period=5", "otpauth://hotp/a?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://hotp/a?secret=JBSWY3DPEHPK3PXP&counter=-1", "otpauth://totp/A:a?secret=JBSWY3DPEHPK3PXP&issuer=B",
+		"otpauth://totp/a?secret=JBSW"}
+	for _, uri := range illegal {
+		_, err := ParseKeyURI(uri)
+		if err == nil {
+			t.Errorf("Test fail: the illegal Key URI '%v' was accepted", uri)
+		}
+	}
+	user, _ := NewSimpleOtpUser(BaseSecret, false)
+	_, err := user.GetKeyURI(TotpType, "a:b", testAccount)
+	if err == nil {
+		t.Errorf("Test fail: a Key URI with an issuer that includes ':' was generated")
+	}
+	user.BaseHotp.BaseOtp.digest = md5.New
+	_, err = user.GetKeyURI(HotpType, testIssuer, testAccount)
+	if err == nil {
+		t.Errorf("Test fail: a Key URI of an OTP that uses MD5 was generated")
+	}
+}
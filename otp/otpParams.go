@@ -0,0 +1,176 @@
+package otp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"reflect"
+	"time"
+)
+
+// The OTP parameters of each user: the algorithm (the HMAC digest), the number of digits and the TOTP period.
+// The Otp is stored with the name of its algorithm instead of the digest function, so the user that is read from
+// the storage generates the same codes
+
+const (
+	// Sha1AlgorithmName : the name of the SHA-1 algorithm (the default)
+	Sha1AlgorithmName = "SHA1"
+	// Sha256AlgorithmName : the name of the SHA-256 algorithm
+	Sha256AlgorithmName = "SHA256"
+	// Sha512AlgorithmName : the name of the SHA-512 algorithm
+	Sha512AlgorithmName = "SHA512"
+)
+
+var algorithms = map[string]func() hash.Hash{
+	Sha1AlgorithmName:   sha1.New,
+	Sha256AlgorithmName: sha256.New,
+	Sha512AlgorithmName: sha512.New,
+}
+
+// OtpParams : The user's OTP parameters, the same parameters are used by the HOTP and the TOTP
+type OtpParams struct {
+	Algorithm string
+	Digits    int
+	PeriodSec int // TOTP only
+}
+
+// The stored Otp
+type otpJSON struct {
+	Secret    []byte
+	Digits    int
+	Algorithm string
+}
+
+func (p OtpParams) String() string {
+	return fmt.Sprintf("Algorithm: %v, digits: %v, period: %vs", p.Algorithm, p.Digits, p.PeriodSec)
+}
+
+// NewDefaultOtpParams : Return the default OTP parameters: SHA1, 6 digits and a TOTP period of 30 seconds
+func NewDefaultOtpParams() OtpParams {
+	return OtpParams{Algorithm: Sha1AlgorithmName, Digits: defaultNumOfDigits, PeriodSec: defaultIntervalSec}
+}
+
+// IsValid : Verify that the algorithm is supported and that the number of digits and the TOTP period are in the allowed ranges
+func (p OtpParams) IsValid() error {
+	_, err := GetDigest(p.Algorithm)
+	if err != nil {
+		return err
+	}
+	if p.Digits < minNumOfDigits || p.Digits > maxNumOfDigits {
+		return fmt.Errorf("The number of digits %v is not in the allowed range: %v-%v", p.Digits, minNumOfDigits, maxNumOfDigits)
+	}
+	if p.PeriodSec < minIntervalSec || p.PeriodSec > maxIntervalSec {
+		return fmt.Errorf("The TOTP period %vs is not in the allowed range: %vs-%vs", p.PeriodSec, minIntervalSec, maxIntervalSec)
+	}
+	return nil
+}
+
+// GetDigest : Return the digest function of the given algorithm name
+func GetDigest(algorithm string) (func() hash.Hash, error) {
+	digest, exist := algorithms[algorithm]
+	if exist == false {
+		return nil, fmt.Errorf("The OTP algorithm '%v' is not supported, the supported algorithms are: '%v', '%v', '%v'",
+			algorithm, Sha1AlgorithmName, Sha256AlgorithmName, Sha512AlgorithmName)
+	}
+	return digest, nil
+}
+
+// Return the name of the given digest, a digest that is not set is the default digest
+func getAlgorithmName(digest func() hash.Hash) (string, error) {
+	if digest == nil {
+		return Sha1AlgorithmName, nil
+	}
+	ptr := reflect.ValueOf(digest).Pointer()
+	for name, d := range algorithms {
+		if reflect.ValueOf(d).Pointer() == ptr {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("The OTP digest is not supported, the supported algorithms are: '%v', '%v', '%v'",
+		Sha1AlgorithmName, Sha256AlgorithmName, Sha512AlgorithmName)
+}
+
+// MarshalJSON : Return the Otp in JSON format, the digest is replaced by its algorithm name
+// (an error is returned if the digest is not one of the supported algorithms)
+func (otp Otp) MarshalJSON() ([]byte, error) {
+	name, err := getAlgorithmName(otp.digest)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(otpJSON{Secret: otp.Secret, Digits: otp.Digits, Algorithm: name})
+}
+
+// UnmarshalJSON : Set the Otp from its JSON format, the digest is set by its algorithm name
+// (the default digest if the algorithm is not set)
+func (otp *Otp) UnmarshalJSON(data []byte) error {
+	var o otpJSON
+
+	err := json.Unmarshal(data, &o)
+	if err != nil {
+		return err
+	}
+	digest := defaultHashFunc
+	if len(o.Algorithm) > 0 {
+		digest, err = GetDigest(o.Algorithm)
+		if err != nil {
+			return err
+		}
+	}
+	otp.Secret = o.Secret
+	otp.Digits = o.Digits
+	otp.digest = digest
+	return nil
+}
+
+// SetOtpParams : Set the user's HOTP and TOTP parameters. When the TOTP period is changed, the last accepted
+// time step is converted to the new period, so the codes of the time that was already used are still rejected
+func (u *UserInfoOtp) SetOtpParams(params OtpParams) error {
+	err := params.IsValid()
+	if err != nil {
+		return err
+	}
+	if u.BaseHotp == nil || u.BaseTotp == nil {
+		return fmt.Errorf("The OTP user is not valid: its HOTP or TOTP is not set")
+	}
+	digest := algorithms[params.Algorithm]
+	for _, otp := range []*Otp{u.BaseHotp.BaseOtp, u.BaseTotp.BaseOtp} {
+		otp.digest = digest
+		otp.Digits = params.Digits
+	}
+	period := time.Duration(params.PeriodSec) * time.Second
+	oldPeriodSec := int64(u.BaseTotp.Interval.Seconds())
+	if u.Throttle.LastTotpStep > 0 && oldPeriodSec > 0 && period != u.BaseTotp.Interval {
+		newPeriodSec := int64(params.PeriodSec)
+		u.Throttle.LastTotpStep = ((u.Throttle.LastTotpStep+1)*oldPeriodSec+newPeriodSec-1)/newPeriodSec - 1
+	}
+	u.BaseTotp.Interval = period
+	return nil
+}
+
+// GetOtpParams : Return the user's OTP parameters
+func (u UserInfoOtp) GetOtpParams() (OtpParams, error) {
+	if u.BaseTotp == nil || u.BaseTotp.BaseOtp == nil {
+		return OtpParams{}, fmt.Errorf("The OTP user is not valid: its TOTP is not set")
+	}
+	name, err := getAlgorithmName(u.BaseTotp.BaseOtp.digest)
+	if err != nil {
+		return OtpParams{}, err
+	}
+	return OtpParams{Algorithm: name, Digits: u.BaseTotp.BaseOtp.Digits, PeriodSec: int(u.BaseTotp.Interval.Seconds())}, nil
+}
+
+// NewSimpleOtpUserWithParams : generate a new otp user with the default throttling parameters and the given OTP parameters
+func NewSimpleOtpUserWithParams(secret []byte, checkSecretStrength bool, params OtpParams) (*UserInfoOtp, error) {
+	u, err := NewSimpleOtpUser(secret, checkSecretStrength)
+	if err != nil {
+		return nil, err
+	}
+	err = u.SetOtpParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
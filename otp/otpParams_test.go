@@ -0,0 +1,135 @@
+package otp
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"testing"
+	"time"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+type totpTestVector struct {
+	time   int64
+	result []string // SHA1, SHA256, SHA512
+}
+
+var (
+	// The RFC 6238 appendix B secrets of each of the algorithms
+	rfc6238Secrets = map[string][]byte{
+		Sha1AlgorithmName:   []byte("12345678901234567890"),
+		Sha256AlgorithmName: []byte("12345678901234567890123456789012"),
+		Sha512AlgorithmName: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	rfc6238Algorithms = []string{Sha1AlgorithmName, Sha256AlgorithmName, Sha512AlgorithmName}
+
+	// The RFC 6238 appendix B test vectors: 8 digits and a period of 30 seconds
+	rfc6238Vectors = []totpTestVector{
+		{59, []string{"94287082", "46119246", "90693936"}},
+		{1111111109, []string{"07081804", "68084774", "25091201"}},
+		{1111111111, []string{"14050471", "67062674", "99943326"}},
+		{1234567890, []string{"89005924", "91819424", "93441116"}},
+		{2000000000, []string{"69279037", "90698825", "38618901"}},
+		{20000000000, []string{"65353130", "77737706", "47863826"}},
+	}
+)
+
+// Verify that the TOTP of users with each of the algorithms generates the RFC 6238 test vectors
+func Test_rfc6238TestVectors(t *testing.T) {
+	for i, algorithm := range rfc6238Algorithms {
+		user, err := NewSimpleOtpUserWithParams(rfc6238Secrets[algorithm], false, OtpParams{algorithm, 8, defaultIntervalSec})
+		if err != nil {
+			t.Fatalf("Test fail: can't generate an OTP user using %v, error: %v", algorithm, err)
+		}
+		for _, v := range rfc6238Vectors {
+			code, err := user.BaseTotp.AtTime(time.Unix(v.time, 0))
+			if err != nil || code != v.result[i] {
+				t.Errorf("Test fail: the TOTP code using %v at %v is '%v' instead of '%v', error: %v", algorithm, v.time, code, v.result[i], err)
+			}
+		}
+	}
+}
+
+// Verify that the user's OTP parameters are used by both the HOTP and the TOTP, and that illegal parameters are rejected
+// Verify that a user with an unsupported digest can't be converted to JSON
+func Test_otpParams(t *testing.T) {
+	params := OtpParams{Sha512AlgorithmName, 8, 60}
+	user, err := NewSimpleOtpUserWithParams(BaseSecret, false, params)
+	if err != nil {
+		t.Fatalf("Test fail: can't generate an OTP user using %v, error: %v", params, err)
+	}
+	p, err := user.GetOtpParams()
+	if err != nil || p != params {
+		t.Errorf("Test fail: the OTP parameters are %v instead of %v, error: %v", p, params, err)
+	}
+	baseOtp, _ := NewOtpAdvance(BaseSecret, params.Digits, algorithms[params.Algorithm])
+	totp := Totp{Interval: time.Duration(params.PeriodSec) * time.Second, BaseOtp: baseOtp}
+	hotp := Hotp{Count: user.BaseHotp.Count, BaseOtp: baseOtp}
+	code, _ := user.BaseTotp.Now()
+	exp, _ := totp.Now()
+	hotpCode, _ := user.BaseHotp.AtCount(user.BaseHotp.Count)
+	hotpExp, _ := hotp.AtCount(hotp.Count)
+	if code != exp || hotpCode != hotpExp || len(code) != params.Digits {
+		t.Errorf("Test fail: the codes of the user '%v', '%v' are not the expected codes '%v', '%v'", code, hotpCode, exp, hotpExp)
+	}
+
+	illegal := []OtpParams{{"MD5", 6, 30}, {"sha1", 6, 30}, {Sha1AlgorithmName, 5, 30}, {Sha1AlgorithmName, 9, 30},
+		{Sha1AlgorithmName, 6, minIntervalSec - 1}, {Sha1AlgorithmName, 6, maxIntervalSec + 1}}
+	for _, p := range illegal {
+		if user.SetOtpParams(p) == nil {
+			t.Errorf("Test fail: the illegal OTP parameters %v were accepted", p)
+		}
+	}
+	user.BaseTotp.BaseOtp.digest = md5.New
+	_, err = user.GetOtpParams()
+	if err == nil {
+		t.Errorf("Test fail: the OTP parameters of a user that uses MD5 were returned")
+	}
+	_, err = json.Marshal(user)
+	if err == nil {
+		t.Errorf("Test fail: a user that uses MD5 was converted to JSON")
+	}
+}
+
+// Verify that when the TOTP period is changed, the codes of the time of the last accepted time step are still rejected
+func Test_otpParamsPeriodChange(t *testing.T) {
+	user, _ := NewSimpleOtpUserWithParams(BaseSecret, false, NewDefaultOtpParams())
+	user.Throttle.LastTotpStep = 101 // [3030, 3060)
+	user.SetOtpParams(OtpParams{Sha1AlgorithmName, 6, 60})
+	if user.Throttle.LastTotpStep != 50 { // [3000, 3060)
+		t.Errorf("Test fail: the last accepted time step using a period of 60 seconds is %v instead of 50", user.Throttle.LastTotpStep)
+	}
+	user.SetOtpParams(OtpParams{Sha1AlgorithmName, 6, 45})
+	if user.Throttle.LastTotpStep != 67 { // [3015, 3060)
+		t.Errorf("Test fail: the last accepted time step using a period of 45 seconds is %v instead of 67", user.Throttle.LastTotpStep)
+	}
+}
+
+// Verify that the OTP parameters are stored and that the user that is read from the storage generates the same codes
+func Test_StoreLoadOtpParams(t *testing.T) {
+	key := "key"
+	for _, algorithm := range rfc6238Algorithms {
+		params := OtpParams{algorithm, 8, 45}
+		user, _ := NewSimpleOtpUserWithParams(BaseSecret, false, params)
+		defs.StoreLoadTest(t, user, defs.OtpPropertyName)
+
+		storage, _ := ss.NewStorage([]byte("12345678"), false)
+		s := Serializer{}
+		s.AddToStorage(key, user, storage)
+		data, err := s.ReadFromStorage(key, storage.GetDecryptStorageData())
+		if err != nil {
+			t.Fatalf("Test fail: can't read the OTP user from the storage, error: %v", err)
+		}
+		loadedUser := data.(*UserInfoOtp)
+		p, err := loadedUser.GetOtpParams()
+		if err != nil || p != params {
+			t.Errorf("Test fail: the OTP parameters read from the storage are %v instead of %v, error: %v", p, params, err)
+		}
+		code, _ := loadedUser.BaseHotp.AtCount(loadedUser.BaseHotp.Count)
+		exp, _ := user.BaseHotp.AtCount(user.BaseHotp.Count)
+		if code != exp {
+			t.Errorf("Test fail: the code of the user read from the storage is '%v' instead of '%v'", code, exp)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package otp
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	"github.com/ibm-security-innovation/libsecurity-go/salt"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+// Recovery codes are the fallback of users that lost their authenticator: a set of single use random codes that are
+// shown to the user once, only their salted hashes are stored. Each code is consumed when it is used.
+// The recovery codes are a separate property, so they can be used even if the user's OTP was removed, and they are
+// verified using the same throttling and blocking rules as the OTP codes (with the HOTP throttling timer).
+// If the user has an OTP, its state applies to the recovery codes as well: the recovery codes can't be used while
+// the OTP is blocked or throttled, and a wrong recovery code is counted as a wrong OTP code
+
+const (
+	// DefaultNumOfRecoveryCodes : The number of recovery codes that are generated by default
+	DefaultNumOfRecoveryCodes = 10
+	minNumOfRecoveryCodes     = 1
+	maxNumOfRecoveryCodes     = 20
+
+	recoveryCodeLen       = 10 // 50 bits
+	recoveryCodeAlphabet  = "abcdefghijklmnopqrstuvwxyz234567"
+	recoveryCodeSeparator = "-" // displayed in the middle of the code, it is ignored when the code is verified
+	recoverySaltLen       = 16
+)
+
+var recoverySaltParams = salt.Params{Digest: salt.Sha256DigestName, Hmac: true, Iterations: 1000, OutputLen: 32}
+
+// UserInfoRecovery : structure that holds the salted hashes of the user's unused recovery codes and the blocking
+// and throttling state of their verification
+type UserInfoRecovery struct {
+	Codes    [][]byte // The serialized salted hashes of the unused codes
+	Blocked  bool
+	Throttle throtteling
+	lock     sync.Mutex // a code must be consumed once even if it is verified concurrently
+}
+
+func (r *UserInfoRecovery) String() string {
+	return fmt.Sprintf("Recovery codes: remaining: %v, is blocked: %v, Throttling: %v, total consecutive errors: %v",
+		len(r.Codes), r.Blocked, r.Throttle, r.Throttle.consErrorCounter)
+}
+
+// RecoverySerializer : virtual set of functions that must be implemented by each module
+type RecoverySerializer struct{}
+
+func init() {
+	defs.Serializers[defs.RecoveryPropertyName] = &RecoverySerializer{}
+}
+
+func isNumOfRecoveryCodesValid(numOfCodes int) error {
+	if numOfCodes < minNumOfRecoveryCodes || numOfCodes > maxNumOfRecoveryCodes {
+		return fmt.Errorf("The number of recovery codes %v is not in the allowed range: %v-%v", numOfCodes, minNumOfRecoveryCodes, maxNumOfRecoveryCodes)
+	}
+	return nil
+}
+
+// Return the code without the separators and the spaces, in lower case
+func normalizeRecoveryCode(code string) string {
+	code = strings.Replace(code, recoveryCodeSeparator, "", -1)
+	code = strings.Replace(code, " ", "", -1)
+	return strings.ToLower(code)
+}
+
+// Return a new random recovery code and its serialized salted hash
+func newRecoveryCode() (string, []byte, error) {
+	buf := make([]byte, recoveryCodeLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("Random read failed: %v", err)
+	}
+	for i, b := range buf {
+		buf[i] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)] // the alphabet length divides 256, no bias
+	}
+	saltData, err := salt.GetRandomSalt(recoverySaltLen)
+	if err != nil {
+		return "", nil, err
+	}
+	hashed, err := salt.GenerateSerializedSaltedPassword(buf, recoveryCodeLen, recoveryCodeLen, saltData, recoverySaltParams)
+	if err != nil {
+		return "", nil, err
+	}
+	half := recoveryCodeLen / 2
+	return string(buf[:half]) + recoveryCodeSeparator + string(buf[half:]), hashed, nil
+}
+
+// NewRecoveryCodes : Generate the given number of recovery codes for a user, the codes are returned only once
+func NewRecoveryCodes(numOfCodes int) (*UserInfoRecovery, []string, error) {
+	r := &UserInfoRecovery{Throttle: newThrottle(defaultThrottlingLen, defaultThrottlingSec, defaultUnblockSec, defaultHotpWindowsSize, defaultTotpWindowsSizeSec)}
+	codes, err := r.RegenerateRecoveryCodes(numOfCodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, codes, nil
+}
+
+// RegenerateRecoveryCodes : Replace all the user's recovery codes by the given number of new codes,
+// the codes are returned only once. The blocking state is not changed
+func (r *UserInfoRecovery) RegenerateRecoveryCodes(numOfCodes int) ([]string, error) {
+	err := isNumOfRecoveryCodesValid(numOfCodes)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, numOfCodes)
+	hashes := make([][]byte, numOfCodes)
+	for i := range codes {
+		codes[i], hashes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Codes = hashes
+	return codes, nil
+}
+
+// GetNumOfRemainingCodes : Return the number of the recovery codes that were not used yet
+func (r *UserInfoRecovery) GetNumOfRemainingCodes() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.Codes)
+}
+
+// Remove the matching code, return false if no code matches. It must be called while the lock is held
+func (r *UserInfoRecovery) consumeCode(code string) bool {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLen {
+		return false
+	}
+	for i, hashed := range r.Codes {
+		ok, _ := salt.MatchSerializedSaltedPassword([]byte(code), recoveryCodeLen, recoveryCodeLen, hashed)
+		if ok {
+			r.Codes = append(r.Codes[:i], r.Codes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// The recovery codes have the blocking and throttling state of an OTP user (without its OTP),
+// so the same code is used to apply the OTP rules
+func (r *UserInfoRecovery) applyOtpRules(f func(u *UserInfoOtp) (bool, error)) (bool, error) {
+	u := UserInfoOtp{Blocked: r.Blocked, Throttle: r.Throttle}
+	ok, err := f(&u)
+	r.Blocked = u.Blocked
+	r.Throttle = u.Throttle
+	return ok, err
+}
+
+// VerifyRecoveryCode : Verify that the given code is one of the user's recovery codes, if so the code is consumed.
+// If the user is blocked or the throttling time didn't pass, return an error. If the code doesn't match and
+// the number of consecutive errors pass the throttling cliff, the recovery codes are blocked till manual or automatic unblock.
+// The otpUser is the user's OTP (nil if the user has no OTP): if it is blocked or throttled the code is not checked,
+// and a wrong code is handled as a wrong HOTP code of the otpUser too
+func (r *UserInfoRecovery) VerifyRecoveryCode(code string, otpUser *UserInfoOtp) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.Codes) == 0 {
+		return false, fmt.Errorf("All the recovery codes were used, new recovery codes must be generated")
+	}
+	return r.applyOtpRules(func(u *UserInfoOtp) (bool, error) {
+		err := u.isValid()
+		if err != nil {
+			return false, err
+		}
+		ok, err := u.canCheckOtpCode(HotpType, 0)
+		if !ok {
+			return ok, err
+		}
+		if otpUser != nil {
+			ok, err = otpUser.canCheckOtpCode(HotpType, 0)
+			if !ok {
+				return ok, err
+			}
+		}
+		if r.consumeCode(code) == false {
+			ok, err = u.handleErrorCode(HotpType)
+			if otpUser != nil {
+				_, otpErr := otpUser.handleErrorCode(HotpType)
+				if err == nil {
+					err = otpErr
+				}
+			}
+			return ok, err
+		}
+		u.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+		u.Throttle.consErrorCounter = defaultConsErrorCounter // clear the consecutive error counter
+		return true, nil
+	})
+}
+
+// IsRecoveryBlocked : check if the user's recovery codes are blocked
+func (r *UserInfoRecovery) IsRecoveryBlocked() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	blocked, _ := r.applyOtpRules(func(u *UserInfoOtp) (bool, error) {
+		u.checkAndUpdateUnBlockState()
+		return u.getBlockState(), nil
+	})
+	return blocked
+}
+
+// SetRecoveryBlockedState : set the blocking state of the user's recovery codes
+func (r *UserInfoRecovery) SetRecoveryBlockedState(block bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.applyOtpRules(func(u *UserInfoOtp) (bool, error) {
+		u.setBlockedState(block)
+		return true, nil
+	})
+}
+
+// All the properties must implement a set of functions:
+// PrintProperties, IsEqualProperties, AddToStorage, ReadFromStorage
+
+// PrintProperties : Print the recovery codes property data
+func (s RecoverySerializer) PrintProperties(data interface{}) string {
+	d, ok := data.(*UserInfoRecovery)
+	if ok == false {
+		return "Cannot print the recovery codes property: Not the right type"
+	}
+	return d.String()
+}
+
+// IsEqualProperties : Compare 2 recovery codes properties (without parts that are not saved)
+func (s RecoverySerializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
+	d1, ok1 := da1.(*UserInfoRecovery)
+	d2, ok2 := da2.(*UserInfoRecovery)
+	if ok1 == false || ok2 == false {
+		return false
+	}
+	// don't comapre the parts that are not saved
+	d2.Throttle.throttlingTimerHotp = d1.Throttle.throttlingTimerHotp
+	d2.Throttle.throttlingTimerTotp = d1.Throttle.throttlingTimerTotp
+	d2.Throttle.consErrorCounter = d1.Throttle.consErrorCounter
+	d2.Throttle.unblockTimer = d1.Throttle.unblockTimer
+	return reflect.DeepEqual(d1, d2)
+}
+
+// AddToStorage : Add the recovery codes property information to the secure_storage
+func (s RecoverySerializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add recovery codes property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the recovery codes property information to an items writer, e.g. a storage transaction
+func (s RecoverySerializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
+	d, ok := data.(*UserInfoRecovery)
+	if ok == false {
+		return fmt.Errorf("Cannot store the recovery codes property: Not the right type")
+	}
+	if storage == nil {
+		return fmt.Errorf("Cannot add recovery codes property to storage: Storage is nil")
+	}
+	value, _ := json.Marshal(d)
+	return storage.AddItem(prefix, string(value))
+}
+
+// ReadFromStorage : Return the entity recovery codes data read from the secure storage (in JSON format)
+func (s RecoverySerializer) ReadFromStorage(key string, storage *ss.SecureStorage) (interface{}, error) {
+	var r UserInfoRecovery
+
+	if storage == nil {
+		return nil, fmt.Errorf("Cannot read recovery codes property from storage: Storage is nil")
+	}
+	value, exist := storage.Data[key]
+	if !exist {
+		return nil, fmt.Errorf("Key '%v' was not found in storage", key)
+	}
+	err := json.Unmarshal([]byte(value), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,200 @@
+package otp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+const (
+	numOfTestRecoveryCodes = 5
+	wrongRecoveryCode      = "abcde-fghij"
+)
+
+func testGenerateRecoveryCodes(t *testing.T) (*UserInfoRecovery, []string) {
+	r, codes, err := NewRecoveryCodes(numOfTestRecoveryCodes)
+	if err != nil {
+		t.Fatalf("Test fail: can't generate recovery codes, error: %v", err)
+	}
+	return r, codes
+}
+
+// Verify that the generated codes are unique and that only their hashes are stored,
+// and that the number of codes must be in the allowed range
+func Test_newRecoveryCodes(t *testing.T) {
+	r, codes := testGenerateRecoveryCodes(t)
+	if len(codes) != numOfTestRecoveryCodes || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes {
+		t.Fatalf("Test fail: %v codes were generated and %v are remaining instead of %v", len(codes), r.GetNumOfRemainingCodes(), numOfTestRecoveryCodes)
+	}
+	found := make(map[string]bool)
+	for i, code := range codes {
+		if len(normalizeRecoveryCode(code)) != recoveryCodeLen || found[code] {
+			t.Errorf("Test fail: the generated recovery code '%v' is not valid or it is not unique", code)
+		}
+		found[code] = true
+		if strings.Contains(string(r.Codes[i]), normalizeRecoveryCode(code)) {
+			t.Errorf("Test fail: the recovery code '%v' is stored as is: '%v'", code, string(r.Codes[i]))
+		}
+	}
+	for _, n := range []int{minNumOfRecoveryCodes - 1, maxNumOfRecoveryCodes + 1} {
+		_, _, err := NewRecoveryCodes(n)
+		if err == nil {
+			t.Errorf("Test fail: %v recovery codes were generated, the allowed range is %v-%v", n, minNumOfRecoveryCodes, maxNumOfRecoveryCodes)
+		}
+	}
+}
+
+// Verify that each code can be used once (ignoring the separator and the case), that a wrong code is rejected
+// and that the old codes can't be used after the codes are regenerated
+func Test_verifyRecoveryCodes(t *testing.T) {
+	r, codes := testGenerateRecoveryCodes(t)
+	inputs := []string{codes[0], strings.ToUpper(codes[1]), strings.Replace(codes[2], recoveryCodeSeparator, " ", -1)}
+	for i, code := range inputs {
+		ok, err := r.VerifyRecoveryCode(code, nil)
+		if ok == false || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes-i-1 {
+			t.Errorf("Test fail: the recovery code '%v' was not accepted or it was not consumed, error: %v", code, err)
+		}
+		ok, _ = r.VerifyRecoveryCode(code, nil)
+		if ok {
+			t.Errorf("Test fail: the recovery code '%v' was accepted twice", code)
+		}
+		r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	}
+	ok, _ := r.VerifyRecoveryCode(wrongRecoveryCode, nil)
+	if ok || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes-len(inputs) {
+		t.Errorf("Test fail: the wrong recovery code '%v' was accepted", wrongRecoveryCode)
+	}
+	r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	newCodes, _ := r.RegenerateRecoveryCodes(numOfTestRecoveryCodes)
+	ok, _ = r.VerifyRecoveryCode(codes[numOfTestRecoveryCodes-1], nil)
+	if ok || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes {
+		t.Errorf("Test fail: the old recovery code '%v' was accepted after the codes were regenerated", codes[numOfTestRecoveryCodes-1])
+	}
+	r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	for _, code := range newCodes {
+		r.VerifyRecoveryCode(code, nil)
+	}
+	ok, err := r.VerifyRecoveryCode(newCodes[0], nil)
+	if ok || err == nil || r.GetNumOfRemainingCodes() != 0 {
+		t.Errorf("Test fail: a recovery code was accepted after all the codes were used")
+	}
+}
+
+// Verify that a code that is verified concurrently is accepted only once
+func Test_verifyRecoveryCodeConcurrently(t *testing.T) {
+	const numOfTries = 10
+	r, codes := testGenerateRecoveryCodes(t)
+	results := make(chan bool, numOfTries)
+	var wg sync.WaitGroup
+	for i := 0; i < numOfTries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _ := r.VerifyRecoveryCode(codes[0], nil)
+			results <- ok
+		}()
+	}
+	wg.Wait()
+	close(results)
+	accepted := 0
+	for ok := range results {
+		if ok {
+			accepted++
+		}
+	}
+	if accepted != 1 || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes-1 {
+		t.Errorf("Test fail: the recovery code was accepted %v times and %v codes are remaining", accepted, r.GetNumOfRemainingCodes())
+	}
+}
+
+// Verify that a valid code is not checked before the throttling time passes, that the recovery codes are blocked
+// after too many wrong codes and that a blocked user can't use a valid code until it is unblocked
+func Test_recoveryCodesThrottlingAndBlocking(t *testing.T) {
+	r, codes := testGenerateRecoveryCodes(t)
+	r.VerifyRecoveryCode(wrongRecoveryCode, nil)
+	ok, err := r.VerifyRecoveryCode(codes[0], nil)
+	if ok || err == nil || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes {
+		t.Errorf("Test fail: the recovery code was checked before the throttling time passed")
+	}
+	for i := int32(1); i <= r.Throttle.Cliff; i++ {
+		r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+		r.VerifyRecoveryCode(wrongRecoveryCode, nil)
+	}
+	if r.IsRecoveryBlocked() == false {
+		t.Fatalf("Test fail: the recovery codes were not blocked after %v wrong codes", r.Throttle.Cliff+1)
+	}
+	ok, _ = r.VerifyRecoveryCode(codes[0], nil)
+	if ok || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes {
+		t.Errorf("Test fail: the recovery code of a blocked user was accepted")
+	}
+	r.SetRecoveryBlockedState(false)
+	r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	ok, err = r.VerifyRecoveryCode(codes[0], nil)
+	if ok == false || r.IsRecoveryBlocked() || r.Throttle.consErrorCounter != 0 {
+		t.Errorf("Test fail: the recovery code was not accepted after the user was unblocked, error: %v", err)
+	}
+}
+
+// Verify that the recovery codes can't be used while the user's OTP is blocked or throttled,
+// and that a wrong recovery code is counted as a wrong OTP code
+func Test_recoveryCodesWithOtpState(t *testing.T) {
+	r, codes := testGenerateRecoveryCodes(t)
+	user, _ := NewSimpleOtpUser(BaseSecret, false)
+	user.SetOtpUserBlockedState(true)
+	ok, err := r.VerifyRecoveryCode(codes[0], user)
+	if ok || err == nil || r.GetNumOfRemainingCodes() != numOfTestRecoveryCodes {
+		t.Errorf("Test fail: the recovery code was accepted while the user's OTP is blocked")
+	}
+	user.SetOtpUserBlockedState(false)
+	r.VerifyRecoveryCode(wrongRecoveryCode, user)
+	if user.Throttle.consErrorCounter != 1 {
+		t.Errorf("Test fail: the wrong recovery code was not counted as a wrong OTP code, consecutive errors: %v", user.Throttle.consErrorCounter)
+	}
+	r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	ok, err = r.VerifyRecoveryCode(codes[0], user)
+	if ok || err == nil {
+		t.Errorf("Test fail: the recovery code was accepted while the user's OTP is throttled")
+	}
+	for i := int32(1); i <= user.Throttle.Cliff; i++ {
+		r.SetRecoveryBlockedState(false)
+		r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+		user.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+		r.VerifyRecoveryCode(wrongRecoveryCode, user)
+	}
+	blocked, _ := user.IsOtpUserBlocked()
+	if blocked == false {
+		t.Errorf("Test fail: the user's OTP was not blocked after %v wrong recovery codes", user.Throttle.Cliff+1)
+	}
+	r.SetRecoveryBlockedState(false)
+	r.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	user.SetOtpUserBlockedState(false)
+	user.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
+	ok, err = r.VerifyRecoveryCode(codes[0], user)
+	if ok == false {
+		t.Errorf("Test fail: the recovery code was not accepted after the user's OTP was unblocked, error: %v", err)
+	}
+}
+
+// Verify that the recovery codes that are read from the storage can be used
+func Test_StoreLoadRecovery(t *testing.T) {
+	key := "key"
+	r, codes := testGenerateRecoveryCodes(t)
+
+	defs.StoreLoadTest(t, r, defs.RecoveryPropertyName)
+
+	storage, _ := ss.NewStorage([]byte("12345678"), false)
+	s := RecoverySerializer{}
+	s.AddToStorage(key, r, storage)
+	data, err := s.ReadFromStorage(key, storage.GetDecryptStorageData())
+	if err != nil {
+		t.Fatalf("Test fail: can't read the recovery codes from the storage, error: %v", err)
+	}
+	loaded := data.(*UserInfoRecovery)
+	ok, err := loaded.VerifyRecoveryCode(codes[0], nil)
+	if ok == false || loaded.GetNumOfRemainingCodes() != numOfTestRecoveryCodes-1 {
+		t.Errorf("Test fail: the recovery code was not accepted after the codes were read from the storage, error: %v", err)
+	}
+}
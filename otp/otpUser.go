@@ -18,6 +18,7 @@ package otp
 import (
 	"encoding/json"
 	"fmt"
+	"hash"
 	"reflect"
 	"time"
 
@@ -65,7 +66,7 @@ type throtteling struct {
 	AutoUnblockSec      time.Duration // Number of seconds to release block, 0 means that the release should be manuel
 	unblockTimer        time.Time     // When to unblock the user
 	CheckTotpWindowSec  time.Duration // The window size in seconds tfor backword check: to handle clock driffts
-	lastTotpCode        string        // save the last totp code to avoid reuse of code in the same time period
+	LastTotpStep        int64         // The time step of the last accepted totp code, to avoid reuse of codes of this or earlier time steps
 }
 
 func (t throtteling) String() string {
@@ -75,11 +76,13 @@ func (t throtteling) String() string {
 
 // UserInfoOtp : structure that holds all the properties associated to a user
 type UserInfoOtp struct {
-	Secret   []byte
-	Blocked  bool
-	Throttle throtteling // Handle all the throttle parameters
-	BaseHotp *Hotp
-	BaseTotp *Totp
+	Secret            []byte
+	Blocked           bool
+	Throttle          throtteling // Handle all the throttle parameters
+	BaseHotp          *Hotp
+	BaseTotp          *Totp
+	Pending           bool      // The OTP is not active until its enrollment is confirmed by a valid code
+	PendingExpiration time.Time // The pending enrollment must be confirmed before this time
 }
 
 func (u UserInfoOtp) String() string {
@@ -109,7 +112,7 @@ func newThrottle(cliffLen int32, thrTimeSec time.Duration, autoUnblockSec time.D
 		autoUnblockSec,
 		defs.GetBeginningOfTime(),
 		totpWindowSize,
-		"",
+		0,
 	}
 }
 
@@ -156,7 +159,7 @@ func NewOtpUser(secret []byte, checkSecretStrength bool, lock bool, cliffLen int
 	}
 	return &UserInfoOtp{secret, lock,
 		newThrottle(cliffLen, thrTimeSec, autoUnblockSec, hotpWindowSize, totpWindowSize),
-		hotp, totp}, err
+		hotp, totp, false, time.Time{}}, err
 }
 
 func (u *UserInfoOtp) setBlockedState(val bool) {
@@ -219,17 +222,13 @@ func (u *UserInfoOtp) findHotpCodeMatch(code string, size int32) (bool, int32, e
 	return false, 0, nil // no match
 }
 
-// Check if the input code match the expected code in a given window time
-func (u *UserInfoOtp) findTotpCodeMatch(code string, timeOffsetSec int32) (bool, error) {
+// Check if the input code match the expected code in a given window time, return the time step of the matched code.
+// A code of a time step that is not after the last accepted time step was already used and is rejected (RFC 6238 section 5.2)
+func (u *UserInfoOtp) findTotpCodeMatch(code string, timeOffsetSec int32) (bool, int64, error) {
 	var start, last int64
+	now := time.Now()
+	offsets := []int64{0} // the current time is checked first
 	offset := int64(timeOffsetSec)
-	calcCode, _ := u.BaseTotp.Now()
-	if code == calcCode {
-		if debug {
-			fmt.Println("Code", code, "was found with no offset")
-		}
-		return true, nil
-	}
 	if offset > 0 {
 		start = 1
 		last = offset
@@ -238,19 +237,32 @@ func (u *UserInfoOtp) findTotpCodeMatch(code string, timeOffsetSec int32) (bool,
 		last = 1
 	}
 	for i := start; i <= last; i += int64(u.BaseTotp.Interval.Seconds()) {
-		calcCode, err := u.BaseTotp.AtTime(time.Now().Add(time.Duration(i) * time.Second))
+		offsets = append(offsets, i)
+	}
+	replayed := false
+	for _, i := range offsets {
+		calcTime := now.Add(time.Duration(i) * time.Second)
+		calcCode, err := u.BaseTotp.AtTime(calcTime)
 		if debug {
 			fmt.Println("calc code:", calcCode, ", compare with:", code, ", offset:", i,
-				"window size:", timeOffsetSec, "time now:", time.Now(), "calc time:", time.Now().Add(time.Duration(i)*time.Second))
+				"window size:", timeOffsetSec, "time now:", now, "calc time:", calcTime)
 		}
 		if err != nil {
-			return false, err // error must be checked before return value, to be on the safe side teh return is false
+			return false, 0, err // error must be checked before return value, to be on the safe side teh return is false
 		}
-		if code == calcCode {
-			return true, nil // the update of the counter offset must be done in the higher level
+		if code != calcCode {
+			continue
+		}
+		step := u.BaseTotp.timeCode(calcTime)
+		if step > u.Throttle.LastTotpStep {
+			return true, step, nil // the update of the last time step must be done in the higher level
 		}
+		replayed = true
 	}
-	return false, nil // no match
+	if replayed {
+		return false, 0, fmt.Errorf("The TOTP code was already used, you will have to wait for the next time period")
+	}
+	return false, 0, nil // no match
 }
 
 func (u *UserInfoOtp) handleErrorCode(otpType TypeOfOtp) (bool, error) {
@@ -274,7 +286,7 @@ func (u *UserInfoOtp) handleErrorCode(otpType TypeOfOtp) (bool, error) {
 	return false, fmt.Errorf("Too many false attempts. You have been locked out")
 }
 
-func (u *UserInfoOtp) handleOkCode(code string, otpType TypeOfOtp, offset int32) (bool, error) {
+func (u *UserInfoOtp) handleOkCode(otpType TypeOfOtp, offset int32, totpStep int64) (bool, error) {
 	if otpType == HotpType && offset != 0 {
 		u.BaseHotp.Count += int64(offset) // resync the provider interal counter to the client counter
 		// TODO log
@@ -282,9 +294,9 @@ func (u *UserInfoOtp) handleOkCode(code string, otpType TypeOfOtp, offset int32)
 	if otpType == HotpType {
 		u.Throttle.throttlingTimerHotp = defs.GetBeginningOfTime()
 		u.BaseHotp.Next()
-	} else { // you can't try the code till the next Totp period
+	} else { // you can't use a code of this or an earlier Totp period
 		u.Throttle.throttlingTimerTotp = defs.GetBeginningOfTime()
-		u.Throttle.lastTotpCode = code
+		u.Throttle.LastTotpStep = totpStep
 	}
 	u.Throttle.consErrorCounter = defaultConsErrorCounter // clear the consecutive error counter
 	return true, nil
@@ -297,6 +309,7 @@ func (u *UserInfoOtp) VerifyCode(code string, otpType TypeOfOtp) (bool, error) {
 	var found bool
 	var err error
 	var offset int32
+	var totpStep int64
 
 	err = u.isValid()
 	if err != nil {
@@ -304,15 +317,12 @@ func (u *UserInfoOtp) VerifyCode(code string, otpType TypeOfOtp) (bool, error) {
 	}
 
 	if debug {
-		fmt.Println("otpType", otpType, "last code", u.Throttle.lastTotpCode, "code", code)
+		fmt.Println("otpType", otpType, "last TOTP time step", u.Throttle.LastTotpStep, "code", code)
 	}
 	if otpType == HotpType {
 		found, offset, err = u.findHotpCodeMatch(code, int32(u.Throttle.CheckHotpWindow))
 	} else {
-		if u.Throttle.lastTotpCode == code { // avoid replay attack for totp
-			return false, fmt.Errorf("The TOTP code was already used, you will have to wait for the next time period")
-		}
-		found, err = u.findTotpCodeMatch(code, int32(u.Throttle.CheckTotpWindowSec))
+		found, totpStep, err = u.findTotpCodeMatch(code, int32(u.Throttle.CheckTotpWindowSec)) // avoid replay attack for totp
 	}
 	if err != nil {
 		return false, err // error must be checked before return value, to be on the safe side teh return is false
@@ -323,7 +333,7 @@ func (u *UserInfoOtp) VerifyCode(code string, otpType TypeOfOtp) (bool, error) {
 	if !found {
 		return u.handleErrorCode(otpType)
 	}
-	return u.handleOkCode(code, otpType, offset)
+	return u.handleOkCode(otpType, offset, totpStep)
 }
 
 func (u UserInfoOtp) isOtpUserBlockedHelper(offsetTime time.Duration) (bool, error) {
@@ -374,10 +384,14 @@ func (u *UserInfoOtp) canCheckOtpCode(otpType TypeOfOtp, timeFactorSec time.Dura
 // If the code dosn't match and the number of consecutive errors pass the Throtlling parameter
 // for this user, the user acount will be blocked till manuel or automatic unblock
 func (u *UserInfoOtp) VerifyOtpUserCode(code string, otpType TypeOfOtp) (bool, error) {
-	return u.verifyOtpUserCodeHelper(code, otpType, 0)
+	return u.verifyOtpUserCodeHelper(code, otpType, 0, false)
 }
 
-func (u *UserInfoOtp) verifyOtpUserCodeHelper(code string, otpType TypeOfOtp, timeFactorSec time.Duration) (bool, error) {
+// The code of a pending OTP is verified only when its enrollment is confirmed (allowPending is set)
+func (u *UserInfoOtp) verifyOtpUserCodeHelper(code string, otpType TypeOfOtp, timeFactorSec time.Duration, allowPending bool) (bool, error) {
+	if u.Pending && allowPending == false {
+		return false, fmt.Errorf("The OTP enrollment was not confirmed yet")
+	}
 	ok, err := u.canCheckOtpCode(otpType, timeFactorSec)
 	if !ok {
 		return ok, err
@@ -414,16 +428,39 @@ func (s Serializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
 	t2.Throttle.throttlingTimerTotp = t1.Throttle.throttlingTimerTotp
 	t2.Throttle.consErrorCounter = t1.Throttle.consErrorCounter
 	t2.Throttle.unblockTimer = t1.Throttle.unblockTimer
-	t2.Throttle.lastTotpCode = t1.Throttle.lastTotpCode
-	t2.BaseTotp.BaseOtp.digest = nil
-	t1.BaseTotp.BaseOtp.digest = nil
-	t2.BaseHotp.BaseOtp.digest = nil
-	t1.BaseHotp.BaseOtp.digest = nil
-	return reflect.DeepEqual(t1, t2)
+	// functions can't be compared, the digests are compared by their algorithm names
+	otps := []*Otp{t1.BaseTotp.BaseOtp, t2.BaseTotp.BaseOtp, t1.BaseHotp.BaseOtp, t2.BaseHotp.BaseOtp}
+	digests := make([]func() hash.Hash, len(otps))
+	for i, otp := range otps {
+		digests[i] = otp.digest
+	}
+	for i := 0; i < len(otps); i += 2 {
+		n1, err1 := getAlgorithmName(otps[i].digest)
+		n2, err2 := getAlgorithmName(otps[i+1].digest)
+		if err1 != nil || err2 != nil || n1 != n2 {
+			return false
+		}
+	}
+	for _, otp := range otps {
+		otp.digest = nil
+	}
+	equal := reflect.DeepEqual(t1, t2)
+	for i, otp := range otps {
+		otp.digest = digests[i]
+	}
+	return equal
 }
 
 // AddToStorage : Add the OTP property information to the secure_storage
 func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add OTP property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the OTP property information to an items writer, e.g. a storage transaction
+func (s Serializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
 	d, ok := data.(*UserInfoOtp)
 	if ok == false {
 		return fmt.Errorf("Cannot store the OTP property: Not the right type")
@@ -431,8 +468,11 @@ func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.Se
 	if storage == nil {
 		return fmt.Errorf("Cannot add OTP property to storage: Storage is nil")
 	}
-	value, _ := json.Marshal(d)
-	err := storage.AddItem(prefix, string(value))
+	value, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("Cannot store the OTP property: %v", err)
+	}
+	err = storage.AddItem(prefix, string(value))
 	if err != nil {
 		return err
 	}
@@ -6,9 +6,10 @@ import (
 	"time"
 
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
 )
 
-// TODO add totp tests: repalay attack and time drift
+// TODO add totp tests: time drift
 
 const (
 	wrongCode = "1234"
@@ -45,7 +46,7 @@ func Test_CheckErrorThrottling(t *testing.T) {
 		refTime := time.Now()
 		otpUser.setBlockedState(false)                                          // so the user will not be blocked
 		factor := time.Duration(i+1) * throttleTimeSec                          //was int32(math.Pow(2, float64(i))) * throttleTimeSec
-		ok, err := otpUser.verifyOtpUserCodeHelper(wrongCode, HotpType, factor) // error codes to increase the delay
+		ok, err := otpUser.verifyOtpUserCodeHelper(wrongCode, HotpType, factor, false) // error codes to increase the delay
 		if err != nil {
 			t.Error("Test fail, err:", err)
 		}
@@ -66,7 +67,7 @@ func Test_CheckErrorThrottling(t *testing.T) {
 				if codeOk {
 					t.Error("Test fail, Time:", time.Now(), ", OTP shuld not be checked before:", throttleTimer)
 				}
-				codeOk, err = otpUser.verifyOtpUserCodeHelper(code, HotpType, factor)
+				codeOk, err = otpUser.verifyOtpUserCodeHelper(code, HotpType, factor, false)
 				if debug {
 					fmt.Println("Calculated code = ", code, ", match = ", ok)
 				}
@@ -159,7 +160,7 @@ func Test_CheckOtpTotpWindow(t *testing.T) {
 			w = w * s
 			for i, offset := range offsets {
 				offset = offset * s
-				otpUser.Throttle.lastTotpCode = "" // clear the last match
+				otpUser.Throttle.LastTotpStep = 0 // clear the last accepted time step
 				otpUser.Throttle.CheckTotpWindowSec = time.Duration(w)
 				testTime := time.Now().Add(time.Duration(offset) * time.Second)
 				code, _ := totp.AtTime(testTime)
@@ -205,7 +206,7 @@ func Test_CheckAutomaticUnblockUser(t *testing.T) {
 	} else {
 		code, _ := hotp.AtCount(hotp.Count)
 		for _, o := range offsetsSec {
-			otpUser.verifyOtpUserCodeHelper(code, HotpType, otpUser.Throttle.AutoUnblockSec+o)
+			otpUser.verifyOtpUserCodeHelper(code, HotpType, otpUser.Throttle.AutoUnblockSec+o, false)
 			blocked, _ := otpUser.isOtpUserBlockedHelper(otpUser.Throttle.AutoUnblockSec + o)
 			if !blocked && o < 0 {
 				t.Error("Test fail, User must not be automatically unblocked before", otpUser.Throttle.AutoUnblockSec,
@@ -292,3 +293,88 @@ func Test_StoreLoad(t *testing.T) {
 
 	defs.StoreLoadTest(t, otpUser, defs.OtpPropertyName)
 }
+
+// Wait for the next time step if the current time step ends in the next few seconds,
+// so the codes that are calculated by the test are of the time steps that the user verifies them in
+func waitForTimeStepStart(totp *Totp) {
+	interval := int64(totp.Interval.Seconds())
+	left := interval - time.Now().Unix()%interval
+	if left <= 3 {
+		time.Sleep(time.Duration(left) * time.Second)
+	}
+}
+
+// Verify that a TOTP code is accepted only once, that the codes of earlier time steps in the window
+// are rejected after a code of a later time step was accepted, for both a backward and a forward window
+func Test_TotpReplay(t *testing.T) {
+	interval := time.Duration(defaultIntervalSec)
+	for _, window := range []time.Duration{-interval, 2 * interval} { // the forward window is checked from 1 second after the current time
+		otpUser, totp := addDefaultOtpUserGetTotp(t, 0)
+		otpUser.Throttle.CheckTotpWindowSec = window
+		waitForTimeStepStart(totp)
+		now := time.Now()
+		early, late := now.Add(interval*time.Second*-1), now // the window code is the early code for a backward window
+		if window > 0 {
+			early, late = now, now.Add(interval*time.Second)
+		}
+		earlyCode, _ := totp.AtTime(early)
+		lateCode, _ := totp.AtTime(late)
+		found, err := otpUser.VerifyOtpUserCode(earlyCode, TotpType)
+		if found == false || otpUser.Throttle.LastTotpStep != totp.timeCode(early) {
+			t.Fatalf("Test fail: the code of the time step %v was not accepted using window %vs, error: %v", totp.timeCode(early), int(window), err)
+		}
+		found, err = otpUser.VerifyOtpUserCode(earlyCode, TotpType)
+		if found || err == nil {
+			t.Errorf("Test fail: the code of the time step %v was accepted twice using window %vs", totp.timeCode(early), int(window))
+		}
+		found, err = otpUser.VerifyOtpUserCode(lateCode, TotpType)
+		if found == false || otpUser.Throttle.LastTotpStep != totp.timeCode(late) {
+			t.Errorf("Test fail: the code of the later time step %v was not accepted using window %vs, error: %v", totp.timeCode(late), int(window), err)
+		}
+		otpUser.Throttle.LastTotpStep = 0
+		otpUser.VerifyOtpUserCode(lateCode, TotpType)
+		found, err = otpUser.VerifyOtpUserCode(earlyCode, TotpType)
+		if found || err == nil {
+			t.Errorf("Test fail: the code of the time step %v was accepted after the code of the time step %v using window %vs",
+				totp.timeCode(early), totp.timeCode(late), int(window))
+		}
+	}
+}
+
+// Verify that the last accepted time step is stored and read from the storage, so a code that was accepted
+// before the user was stored is rejected by the user that was read from the storage
+func Test_TotpReplayStoreLoad(t *testing.T) {
+	key := "key"
+	otpUser, totp := addDefaultOtpUserGetTotp(t, 0)
+	waitForTimeStepStart(totp)
+	code, _ := totp.Now()
+	found, err := otpUser.VerifyOtpUserCode(code, TotpType)
+	if found == false {
+		t.Fatalf("Test fail: the TOTP code was not accepted, error: %v", err)
+	}
+	storage, _ := ss.NewStorage([]byte("12345678"), false)
+	s := Serializer{}
+	err = s.AddToStorage(key, otpUser, storage)
+	if err != nil {
+		t.Fatalf("Test fail: can't add the OTP user to the storage, error: %v", err)
+	}
+	data, err := s.ReadFromStorage(key, storage.GetDecryptStorageData())
+	if err != nil {
+		t.Fatalf("Test fail: can't read the OTP user from the storage, error: %v", err)
+	}
+	loadedUser := data.(*UserInfoOtp)
+	if loadedUser.Throttle.LastTotpStep != otpUser.Throttle.LastTotpStep {
+		t.Errorf("Test fail: the last accepted time step read from the storage is %v instead of %v", loadedUser.Throttle.LastTotpStep, otpUser.Throttle.LastTotpStep)
+	}
+	found, err = loadedUser.VerifyOtpUserCode(code, TotpType)
+	if found || err == nil {
+		t.Errorf("Test fail: the TOTP code that was accepted before the user was stored was accepted by the user read from the storage")
+	}
+	waitForTimeStepStart(totp) // the user read from the storage verifies the codes of later time steps
+	code, _ = totp.AtTime(time.Now().Add(time.Duration(defaultIntervalSec) * time.Second))
+	loadedUser.Throttle.CheckTotpWindowSec = 2 * defaultIntervalSec
+	found, err = loadedUser.VerifyOtpUserCode(code, TotpType)
+	if found == false {
+		t.Errorf("Test fail: the TOTP code of a later time step was not accepted by the user read from the storage, error: %v", err)
+	}
+}
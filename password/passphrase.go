@@ -0,0 +1,198 @@
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+)
+
+// A passphrase is a sequence of words that are selected at random from the embedded word list (diceware style):
+// it is easier to remember and to type than a random password with the same entropy. Some of the words may be
+// capitalized and random digits and symbols (from defs.ExtraCharStr) may be appended to random words in order to
+// satisfy the password policy character classes rules.
+// The reported entropy counts only the word selections and the injected characters values (the capitalized words and
+// the injection positions are not counted), so it is a lower bound of the passphrase entropy
+
+const (
+	defaultPassphraseWords     = 6
+	defaultPassphraseSeparator = "-"
+	maxPassphraseWords         = 20
+	maxPassphraseInjected      = 10
+	maxSeparatorLen            = 3
+)
+
+var (
+	passphraseWords = strings.Fields(passphraseWordsStr)
+
+	passphraseLock        sync.Mutex
+	resetPassphraseParams *PassphraseParams
+)
+
+// PassphraseParams : The parameters of a generated passphrase: the number of words, the separator between the words,
+// the number of capitalized words and the number of digits and symbols that are injected
+type PassphraseParams struct {
+	Words     int
+	Separator string
+	UpperCase int
+	Digits    int
+	Symbols   int
+}
+
+// Passphrase : A generated passphrase and its entropy in bits
+type Passphrase struct {
+	Passphrase  string
+	EntropyBits float64
+}
+
+func (p PassphraseParams) String() string {
+	return fmt.Sprintf("Words: %v, separator: '%v', upper case words: %v, digits: %v, symbols: %v", p.Words, p.Separator, p.UpperCase, p.Digits, p.Symbols)
+}
+
+// NewDefaultPassphraseParams : Return the default passphrase parameters: defaultPassphraseWords words separated by '-'
+func NewDefaultPassphraseParams() PassphraseParams {
+	return PassphraseParams{Words: defaultPassphraseWords, Separator: defaultPassphraseSeparator}
+}
+
+// IsValid : Verify that the passphrase parameters are valid
+func (p PassphraseParams) IsValid() error {
+	if p.Words < 1 || p.Words > maxPassphraseWords {
+		return fmt.Errorf("The number of passphrase words %v must be between 1 and %v", p.Words, maxPassphraseWords)
+	}
+	if p.UpperCase < 0 || p.UpperCase > p.Words {
+		return fmt.Errorf("The number of upper case words %v must be between 0 and the number of words %v", p.UpperCase, p.Words)
+	}
+	if p.Digits < 0 || p.Digits > maxPassphraseInjected || p.Symbols < 0 || p.Symbols > maxPassphraseInjected {
+		return fmt.Errorf("The number of injected digits %v and symbols %v must be between 0 and %v", p.Digits, p.Symbols, maxPassphraseInjected)
+	}
+	if len(p.Separator) > maxSeparatorLen || strings.IndexFunc(p.Separator, isLetter) >= 0 {
+		return fmt.Errorf("The separator '%v' must include up to %v characters that are not letters", p.Separator, maxSeparatorLen)
+	}
+	return nil
+}
+
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Return a uniformly distributed random number in the range 0 to n-1
+func getRandomIndex(n int) (int, error) {
+	idx, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("Random read failed: %v", err)
+	}
+	return int(idx.Int64()), nil
+}
+
+// GeneratePassphrase : Generate a random passphrase using the given parameters and return it with its entropy
+func GeneratePassphrase(params PassphraseParams) (Passphrase, error) {
+	err := params.IsValid()
+	if err != nil {
+		return Passphrase{}, err
+	}
+	words := make([]string, params.Words)
+	for i := range words {
+		idx, err := getRandomIndex(len(passphraseWords))
+		if err != nil {
+			return Passphrase{}, err
+		}
+		words[i] = passphraseWords[idx]
+	}
+	// capitalize the first letter of upper case words, each of them is selected from the words that were not capitalized yet
+	for i := 0; i < params.UpperCase; i++ {
+		idx, err := getRandomIndex(params.Words - i)
+		if err != nil {
+			return Passphrase{}, err
+		}
+		for j := range words {
+			if words[j][0] >= 'a' && words[j][0] <= 'z' {
+				if idx == 0 {
+					words[j] = strings.ToUpper(words[j][:1]) + words[j][1:]
+					break
+				}
+				idx--
+			}
+		}
+	}
+	entropy := float64(params.Words) * math.Log2(float64(len(passphraseWords)))
+	injected := []struct {
+		count int
+		chars string
+	}{{params.Digits, "0123456789"}, {params.Symbols, defs.ExtraCharStr}}
+	for _, inj := range injected {
+		for i := 0; i < inj.count; i++ {
+			c, err := getRandomIndex(len(inj.chars))
+			if err != nil {
+				return Passphrase{}, err
+			}
+			idx, err := getRandomIndex(params.Words)
+			if err != nil {
+				return Passphrase{}, err
+			}
+			words[idx] += inj.chars[c : c+1]
+			entropy += math.Log2(float64(len(inj.chars)))
+		}
+	}
+	return Passphrase{Passphrase: strings.Join(words, params.Separator), EntropyBits: entropy}, nil
+}
+
+// GeneratePolicyValidPassphrase : Generate a passphrase that adheres to the given password policy, the given parameters
+// are the minimum ones: the number of capitalized words, digits and symbols are raised to the policy minimums and
+// words are added until the passphrase is long enough (and strong enough if the policy has a minimum strength score)
+func GeneratePolicyValidPassphrase(policy PasswordPolicy, params PassphraseParams) (Passphrase, error) {
+	params.UpperCase = maxInt(params.UpperCase, policy.MinUpperCase)
+	params.Digits = maxInt(params.Digits, policy.MinDigits)
+	params.Symbols = maxInt(params.Symbols, policy.MinExtraChars)
+	params.Words = maxInt(params.Words, params.UpperCase)
+	for ; params.Words <= maxPassphraseWords; params.Words++ {
+		p, err := GeneratePassphrase(params)
+		if err != nil {
+			return Passphrase{}, err
+		}
+		if len(p.Passphrase) > policy.MaxLength {
+			break
+		}
+		if policy.CheckStrength(p.Passphrase) == nil {
+			return p, nil
+		}
+	}
+	return Passphrase{}, fmt.Errorf("Can't generate a passphrase that adheres to the password policy using the parameters: %v", params)
+}
+
+// SetResetPassphraseParams : Set the parameters of the passphrases that ResetPassword generates,
+// nil to generate random passwords (the default)
+func SetResetPassphraseParams(params *PassphraseParams) error {
+	if params != nil {
+		err := params.IsValid()
+		if err != nil {
+			return err
+		}
+	}
+	passphraseLock.Lock()
+	defer passphraseLock.Unlock()
+	resetPassphraseParams = params
+	return nil
+}
+
+func getResetPassphraseParams() *PassphraseParams {
+	passphraseLock.Lock()
+	defer passphraseLock.Unlock()
+	return resetPassphraseParams
+}
+
+// Generate the temporary password of a password reset: a passphrase if the reset passphrase parameters were set
+// (and a passphrase that adheres to the policy can be generated), otherwise a random password
+func generateResetPassword(policy PasswordPolicy) []byte {
+	params := getResetPassphraseParams()
+	if params != nil {
+		p, err := GeneratePolicyValidPassphrase(policy, *params)
+		if err == nil {
+			return []byte(p.Passphrase)
+		}
+	}
+	return generatePolicyValidPassword(policy)
+}
@@ -0,0 +1,115 @@
+package password
+
+// The passphrase word list: 1296 (6^4) short, common and easy to type English words, in the spirit of the EFF short
+// word lists, each word can be selected by 4 dice rolls. The words are unique, lower case and 4-6 letters long
+
+const passphraseWordsStr = `
+acid acorn acre actor adapt adobe adult aerial afar affix agent agile
+aging ahead aide alarm album alert alias alibi alien alike alive alley
+allot allow alloy almond aloft alone alpha amber amble amend amino ample
+amuse angel angle ankle annex anvil apple apron aqua arbor arena argue
+arise armor aroma arrow ascend ashen aside askew aspen asset atlas atom
+attic audio audit august aunt avenue avid avoid awake award aware awning
+axis axle bacon badge bagel baggy baked baker balmy banana banjo barley
+barn baron basil basin batch bath baton bayou beach beacon beak beam
+bean beard beast beech beef beep beetle begin being belly bench berry
+bike bingo birch bird bison bite blade blank blast blaze blend bless
+blink bliss block blond bloom blot blue bluff blunt blur blush board
+boast boat body boil bold bolt bonus book boost boot booth bore
+boss bounce bowl brain brake brand brass brave bread break breeze brick
+bride brief brim brine brink brisk broad broil brook broom broth brush
+bucket buckle buffet bugle build bulb bulk bumpy bunch bunny burly burst
+bush busy butter buzz cabin cable cactus cadet cage cake calm camel
+camera camp canal candy cane canoe canvas canyon cape cargo carol carpet
+carrot carry cart carve case cash catch cattle cause cave cedar celery
+cell chair chalk champ chant chaos charm chart chase cheek cheer cheese
+chef cherry chess chest chew chick chief child chili chill chime chin
+chip chirp choir chop chord chore chunk churn cider cinema circle cite
+city civic clam clamp clap clash clasp class claw clay clean clear
+clerk click cliff climb cling clip cloak clock close cloth cloud clover
+clown club clue clump coach coast coat cobalt cocoa code coil coin
+cola cold colt comb comet comic comma coral cord cork corn couch
+cough count cover cozy crab craft crane crank crate crawl crazy cream
+creek crest crew crib crisp crop cross crowd crown crumb crush crust
+cube cuddle cupid curb curl curry curve cycle daily dairy daisy dance
+dandy dart dash data dawn deal debit debut decal deck decoy deed
+deep deer delta demo denim dense depot depth derby desk detour dial
+diary dice diet digit dime diner dingo dirt disco dish diver dock
+dodge doing doll dome donor donut door dose dough dove down dozen
+draft drag drain drama drape drawn dream dress drift drill drink drip
+drive drone drum dryer duck duet duke dune dusk dust duty dwarf
+eagle early earth easel east easy ebony echo edge eject elbow elder
+elect elegy email ember empty enamel endow enjoy entry envoy epic equal
+erase essay ether even exact exit expert fable fact fade fair fairy
+faith fame fancy fang farm fast fauna feast fence fern ferry fetch
+fever fiber field fifth fifty figure film final finch fire first fish
+five flag flame flap flash flask fleet flesh flick flight flint flip
+float flock flood floor flora flour flute foam focus foggy folk font
+food forest forge fork form fort fossil found frame fresh frill frog
+frost froth fruit fudge fuel fungi funny fuse gala galaxy gallon game
+gamma garden garlic gate gauge gear gecko genie giant gift ginger glad
+glass gleam glide globe glory glove glow glue gnome goal goat gold
+golf good goose gospel gown grab grace grade grain grand grape graph
+grass gravy great green grid grill grin grip groom group grove growl
+guard guava guess guest guide guitar gulf gully guppy habit hail hair
+half hall halo hammer hand happy harbor hardy harp hatch haven hawk
+hazel head heap heart heat hedge heel hello helmet herb herd hero
+heron hike hill hinge hint hippo hobby holly home honey hood hoop
+hope horn horse host hotel hound house human humid humor hurry husky
+icing icon idea idle igloo image inch index inlet input iris iron
+island item ivory jacket jade jazz jeans jelly jersey jewel jigsaw joke
+jolly judge juice jumbo jump jungle junior jury kayak keen kick kilt
+kind king kiosk kite kitten kiwi knack knee knife knit knob knot
+koala label lace ladder lady lake lamb lamp lance land lane lapel
+large laser lasso latch later lathe lava lawn layer lazy leaf lean
+ledge lemon lens level lever lilac lily limb lime limit linen lion
+liquid list little llama load loaf lobby local lock lodge loft logic
+lotus loud lounge loyal lucky lumber lunar lunch lyric macaw magic maid
+mail major mango manor maple marble march mare market marsh mask mason
+match math maze meal medal melon memo menu merit mesa metal meter
+middle mighty milk mill mimic mind mine mint mirror misty mitten mixer
+moat model mold monk month moon moose moss motel moth motor mound
+mount mouse mouth movie muffin mule mural muscle music myth nail name
+napkin narrow navy near neat nectar needle neon nest nickel night noble
+noise noodle north nose notch note novel number nurse oasis ocean octave
+odor offer olive omega onion opal open opera orange orbit orchid order
+organ otter ounce oval oven owner oxide oyster pace paddle page pail
+paint palm panda panel pansy pantry paper parade park parrot party pasta
+paste patch path patio pause peach peak peanut pear pecan pedal pencil
+penny pepper perch perky petal piano pier pigeon pilot pinch pine pink
+pint pipe pirate pitch pixel pizza place plaid plain plan plane plank
+plant plate plaza plenty plot plow plum plume plush pocket poem poet
+point polar pole polka pond pony pool poppy porch portal pouch pound
+powder prank press price pride prime print prism prize proof prose proud
+prune puffin pulse puma pump punch pupil puppy purple purse quack quail
+quake query quest quick quiet quilt quirk quiz quota quote rabbit race
+radar radio raft rain raisin rake rally ramp ranch range rapid raven
+razor reach ready realm rebel reef relax relay relic remedy rent reply
+rescue rhino rhyme ribbon rice ridge right rigid ring rinse ripple river
+road roast robin robot rodeo roof rookie room rope rose rotor rough
+round route rover royal ruby rudder rugby ruler rustic saddle saga sage
+sail salad salmon salon salsa salt salute sand satin sauce sauna savor
+scale scarf scene scent school scoop score scout scrap screen scuba seal
+season seat second sedan seed senior seven shade shadow shake shark sheep
+shelf shell shift shine ship shirt shoe shore short shovel shrimp shrub
+sign silk silver simple siren skate sketch skill skirt skunk slate sled
+sleep sleeve slice slide slope sloth small smile smoke snack snail snake
+snow soap soccer sock soda sofa soil solar solid sonic sound soup
+south space spade spark speak spear speed spell spice spider spike spine
+spoon sport spot spray spring sprout squad squid stable stack staff stage
+stair stamp stand star start statue steam steel stem step stick stone
+stool storm story stove straw street stripe stuck stump style sugar suit
+summer summit sunny super surf swamp swan sweet swift swing syrup table
+tackle taco tail talent tango tank tape taxi teacup team teapot tempo
+tennis tent term thaw theme thorn thread thumb ticket tide tiger tile
+timber tiny toast today token tomato tonic tool topaz torch total totem
+toucan towel tower town track trade trail train tray treat tree trend
+tribe trick trio trout truck trunk tuba tulip tuna tundra tunnel turtle
+tuxedo twig twin twist ultra uncle union unit upper urban usage useful
+utmost valley valve vapor vase vault velvet venue verb verse vessel vest
+video view villa vine violet visor vista vivid vocal voice vote voyage
+waffle wagon waist walrus wand warmth wasp water wave weave wedge whale
+wheat wheel whisk wick widget width willow wind wing winter wire wisdom
+wolf wombat wood wool word world worm wrap wren wrist yacht yard
+yarn year yeast yield yodel young zebra zero zesty zinc zone zoom
+`
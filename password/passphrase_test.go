@@ -0,0 +1,133 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+)
+
+func countChars(str string, chars string) int {
+	cnt := 0
+	for _, c := range str {
+		if strings.ContainsRune(chars, c) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Verify that the word list includes 6^4 unique lower case words
+func Test_passphraseWords(t *testing.T) {
+	if len(passphraseWords) != 6*6*6*6 {
+		t.Errorf("Test fail: the passphrase word list includes %v words instead of %v", len(passphraseWords), 6*6*6*6)
+	}
+	words := make(map[string]bool)
+	for _, w := range passphraseWords {
+		if words[w] {
+			t.Errorf("Test fail: the word '%v' appears more than once in the passphrase word list", w)
+		}
+		words[w] = true
+		if strings.ToLower(w) != w || strings.IndexFunc(w, func(c rune) bool { return isLetter(c) == false }) >= 0 {
+			t.Errorf("Test fail: the word '%v' is not a lower case word", w)
+		}
+	}
+}
+
+// Verify that the generated passphrases include the requested number of words, capitalized words, digits and symbols
+// and that the entropy is reported as expected
+func Test_generatePassphrase(t *testing.T) {
+	params := PassphraseParams{Words: 5, Separator: " ", UpperCase: 2, Digits: 2, Symbols: 1}
+	for i := 0; i < 20; i++ {
+		p, err := GeneratePassphrase(params)
+		if err != nil {
+			t.Fatalf("Test fail: can't generate a passphrase using the parameters: %v, error: %v", params, err)
+		}
+		words := strings.Split(p.Passphrase, params.Separator)
+		upper, digits, symbols := 0, 0, 0
+		for _, w := range words {
+			if w[0] >= 'A' && w[0] <= 'Z' {
+				upper++
+			}
+			digits += countChars(w, "0123456789")
+			symbols += countChars(w, defs.ExtraCharStr)
+		}
+		if len(words) != params.Words || upper != params.UpperCase || digits != params.Digits || symbols != params.Symbols {
+			t.Errorf("Test fail: the passphrase '%v' does not match the parameters: %v", p.Passphrase, params)
+		}
+	}
+	p, _ := GeneratePassphrase(NewDefaultPassphraseParams())
+	exp := defaultPassphraseWords * math.Log2(float64(len(passphraseWords)))
+	if math.Abs(p.EntropyBits-exp) > 0.001 {
+		t.Errorf("Test fail: the entropy of the passphrase '%v' is %v bits instead of %v bits", p.Passphrase, p.EntropyBits, exp)
+	}
+	p, _ = GeneratePassphrase(params)
+	exp = 5*math.Log2(float64(len(passphraseWords))) + 2*math.Log2(10) + math.Log2(float64(len(defs.ExtraCharStr)))
+	if math.Abs(p.EntropyBits-exp) > 0.001 {
+		t.Errorf("Test fail: the entropy of the passphrase '%v' is %v bits instead of %v bits", p.Passphrase, p.EntropyBits, exp)
+	}
+}
+
+// Verify that illegal passphrase parameters are rejected
+func Test_passphraseParamsCorners(t *testing.T) {
+	illegal := []PassphraseParams{{Words: 0}, {Words: maxPassphraseWords + 1}, {Words: 2, UpperCase: 3}, {Words: 4, Digits: -1},
+		{Words: 4, Symbols: maxPassphraseInjected + 1}, {Words: 4, Separator: "a"}, {Words: 4, Separator: "----"}}
+	for _, params := range illegal {
+		_, err := GeneratePassphrase(params)
+		if err == nil {
+			t.Errorf("Test fail: the illegal passphrase parameters: %v were accepted", params)
+		}
+	}
+	if SetResetPassphraseParams(&illegal[0]) == nil {
+		t.Errorf("Test fail: the illegal reset passphrase parameters: %v were accepted", illegal[0])
+	}
+}
+
+// Verify that the generated passphrases adhere to the given policies and that a passphrase
+// that can't adhere to the policy maximum length is not generated
+func Test_policyValidPassphrase(t *testing.T) {
+	strict := NewDefaultPasswordPolicy()
+	strict.MinLength = 30
+	strict.MinUpperCase = 3
+	strict.MinDigits = 3
+	strict.MinExtraChars = 3
+	strict.MinStrengthScore = MaxStrengthScore
+	policies := []PasswordPolicy{NewDefaultPasswordPolicy(), NewNistPasswordPolicy(), strict}
+	for _, policy := range policies {
+		p, err := GeneratePolicyValidPassphrase(policy, PassphraseParams{Words: 3, Separator: "."})
+		if err != nil {
+			t.Errorf("Test fail: can't generate a passphrase for the policy: %v, error: %v", policy, err)
+		} else if policy.CheckStrength(p.Passphrase) != nil {
+			t.Errorf("Test fail: the generated passphrase '%v' does not adhere to the policy: %v", p.Passphrase, policy)
+		}
+	}
+	strict.MaxLength = strict.MinLength
+	strict.MinStrengthScore = 0
+	_, err := GeneratePolicyValidPassphrase(strict, PassphraseParams{Words: 12})
+	if err == nil {
+		t.Errorf("Test fail: a passphrase that is longer than the policy maximum length was generated")
+	}
+}
+
+// Verify that when the reset passphrase parameters are set, the reset password is a passphrase that can be used
+func Test_resetPassphrase(t *testing.T) {
+	defer SetResetPassphraseParams(nil)
+	params := NewDefaultPassphraseParams()
+	err := SetResetPassphraseParams(&params)
+	if err != nil {
+		t.Fatalf("Test fail: can't set the reset passphrase parameters: %v, error: %v", params, err)
+	}
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	tmpPwd, err := user.ResetPassword()
+	if err != nil {
+		t.Fatalf("Test fail: Reset password fail, error: %v", err)
+	}
+	if strings.Count(string(tmpPwd), params.Separator) < params.Words-1 {
+		t.Errorf("Test fail: the reset password '%v' is not a passphrase of %v words", string(tmpPwd), params.Words)
+	}
+	err = user.IsPasswordMatch(getPwdHash(tmpPwd, user.Salt))
+	if err != nil {
+		t.Errorf("Test fail: the reset passphrase '%v' was not accepted, error: %v", string(tmpPwd), err)
+	}
+}
@@ -1,10 +1,23 @@
 // Package password : The password package provides implementation of Password services: Encryption, salting, reset, time expiration and throttling.
 //
 // The password package handles the following:
-//	- Generating a new (salted) password,
+//	- Generating a new (salted) password, the stored password is hashed using a configurable password hashing algorithm
+//	  (bcrypt, scrypt, Argon2id or PBKDF2-SHA256) and encoded as a PHC string,
+//	- An optional server side pepper (kept outside of the storage file) that is mixed into the password hashing,
+//	  with several versions so it can be rotated
 //	- Checking if a given password matches a given user's password
 //	- Updating a user's password
 //	- Resetting a password to a password that can only be used once within a predifined window of time
+//	- Resetting a password by the user using a single use reset token that expires, the token is delivered to the user
+//	  using a pluggable delivery channel and only its hash is stored
+//	- Password policies: the length, character classes, history depth, expiration, maximum attempts and temporary
+//	  password lifetime rules of the passwords, the policies may be attached to groups
+//	- A NIST SP 800-63B mode (a policy setting): no composition rules, no periodic expiration, Unicode passwords
+//	  that are normalized using NFKC, blocklist screening and rate limiting of wrong attempts instead of a lockout
+//	- Estimating the strength of passwords by matching them against common patterns (dictionary words, keyboard
+//	  sequences, repeats, dates, l33t substitutions), a policy may require a minimum estimated strength score
+//	- Generating diceware style passphrases from an embedded word list, with optional injected digits and symbols
+//	  to satisfy a policy, the reset passwords may be passphrases
 //
 // Passwords have the following properties:
 //	- The current password
@@ -17,18 +30,13 @@
 package password
 
 import (
-	"bytes"
 	"crypto/rand"
-	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
-	"strings"
 	"sync"
 	"time"
-	"unicode"
 
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 	"github.com/ibm-security-innovation/libsecurity-go/salt"
@@ -49,32 +57,42 @@ const (
 
 	noiseRandomMiliSec = 2 // to avoid timimg attacks
 
-	minUpperCase  = 1
-	minLowerCase  = 1
-	minDigits     = 1
-	minExtraChars = 1
+	// UnlockedState : The lock state of a password that can be used
+	UnlockedState = "unlocked"
+	// LockedState : The lock state of a password that is locked until its lock duration is over
+	LockedState = "locked"
+	// HardLockedState : The lock state of a password that is locked until it is reset
+	HardLockedState = "hard-locked"
 )
 
 var (
-	maxPwdAttempts = defaultPwdAttempts
-
 	pLock  sync.Mutex
 	p1Lock sync.Mutex
+
+	noExpirationTime = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
 )
 
 // UserPwd : structure that holds all the parameters relevant to handle password such as the passward, salt, expiration time, counters etc.
+// The password and the old passwords are stored as PHC strings (or as the legacy hash of passwords that were stored before)
+// The policy is the effective password policy of the user, the default policy is used if it is nil
 type UserPwd struct {
 	Password      []byte
 	Salt          []byte
 	Expiration    time.Time
 	ErrorsCounter int
+	LastErrorTime time.Time
+	LockedUntil   time.Time
+	HardLocked    bool
+	ResetToken    []byte `json:",omitempty"` // the hash of the password reset token
+	ResetTokenExp time.Time
 	TemporaryPwd  bool // must be replaced after the first use
-	OldPasswords  [defaultNumberOfOldPasswords][]byte
+	OldPasswords  [][]byte
+	Policy        *PasswordPolicy `json:",omitempty"`
 }
 
 func (u UserPwd) String() string {
-	return fmt.Sprintf("Password: %v, Salt: %v, Expiration: %v, Errors counter: %v, Temporary password: %v, Old passwords: %v",
-		u.Password, u.Salt, u.Expiration, u.ErrorsCounter, u.TemporaryPwd, u.OldPasswords)
+	return fmt.Sprintf("Password: %v, Salt: %v, Expiration: %v, Errors counter: %v, Last error time: %v, Locked until: %v, Hard locked: %v, Temporary password: %v, Old passwords: %v",
+		u.Password, u.Salt, u.Expiration, u.ErrorsCounter, u.LastErrorTime, u.LockedUntil, u.HardLocked, u.TemporaryPwd, u.OldPasswords)
 }
 
 // Serializer : virtual set of functions that must be implemented by each module
@@ -93,62 +111,109 @@ func isPwdLengthValid(pwd []byte) error {
 	return nil
 }
 
+// GetPolicy : Return the effective password policy of the user
+func (u UserPwd) GetPolicy() PasswordPolicy {
+	if u.Policy == nil {
+		return GetDefaultPasswordPolicy()
+	}
+	return *u.Policy
+}
+
+// SetPolicy : Set the effective password policy of the user, nil for the default policy.
+// The policy is used from the next password change, the current password and its expiration are not changed
+func (u *UserPwd) SetPolicy(policy *PasswordPolicy) {
+	u.Policy = policy
+}
+
+// CheckPasswordStrength : Verify that the given password strength is good enougth according to the user's effective policy
+func (u UserPwd) CheckPasswordStrength(pass string) error {
+	return u.GetPolicy().CheckStrength(pass)
+}
+
+// Verify that the password adheres to the policy: its length is always checked, the character classes only if checkPwdStrength is set
+func checkNewPwd(policy PasswordPolicy, pwd []byte, checkPwdStrength bool) error {
+	err := isPwdLengthValid(pwd)
+	if err != nil {
+		return err
+	}
+	err = policy.checkLength(string(pwd))
+	if err != nil {
+		return err
+	}
+	if checkPwdStrength {
+		return policy.CheckStrength(string(pwd))
+	}
+	return nil
+}
+
 // IsNewPwdValid : Verify that the password is legal: its length is OK and it wasn't recently used
+// (the number of old passwords that are checked is the history depth of the user's effective policy)
 func (u UserPwd) IsNewPwdValid(pwd []byte, checkPwdStrength bool) error {
 	err := isPwdLengthValid(pwd)
 	if err != nil {
 		return err
 	}
-	err = CheckPasswordStrength(string(pwd))
-	if err != nil && checkPwdStrength {
-		return err
+	if checkPwdStrength {
+		err = u.CheckPasswordStrength(string(pwd))
+		if err != nil {
+			return err
+		}
 	}
 	newPwd := GetHashedPwd(pwd)
-	if compareHashedPwd(newPwd, u.Password) == true {
+	if verifyPwd(newPwd, u.Password) == true {
 		return fmt.Errorf("The new password is illegal: It is the same as the current password. Please select a new password.")
 	}
-	for _, s := range u.OldPasswords {
-		if bytes.Compare(newPwd, s) == 0 { // the constant delay comparison must be used only once
+	// each of the old passwords may be hashed using a different algorithm
+	depth := u.GetPolicy().HistoryDepth
+	for i, s := range u.OldPasswords {
+		if i >= depth {
+			break
+		}
+		if len(s) > 0 && verifyPwd(newPwd, s) == true {
 			return fmt.Errorf("The new password is illegal: It was already used. Please select a new password")
 		}
 	}
 	return nil
 }
 
-// GetHashedPwd : The password should be handled and stored as hashed and not in clear text
-// This function implementation may later be updated to crypto.cbytes
-func GetHashedPwd(pwd []byte) []byte {
-	hasher := sha256.New()
-	hasher.Write(pwd)
-	return hasher.Sum(nil)
-}
-
-func compareHashedPwd(pwd1 []byte, pwd2 []byte) bool {
-	defs.TimingAttackSleep(0, noiseRandomMiliSec)
-	return subtle.ConstantTimeCompare(pwd1, pwd2) == 1
-}
-
 // NewUserPwd : Generate a new UserPwd for a given password
 // The generated password is with a default expiration time
 func NewUserPwd(pwd []byte, saltData []byte, checkPwdStrength bool) (*UserPwd, error) {
-	err := isPwdLengthValid(pwd)
+	return NewUserPwdWithPolicy(pwd, saltData, checkPwdStrength, nil)
+}
+
+// NewUserPwdWithPolicy : Generate a new UserPwd for a given password using the given effective password policy
+// (nil for the default policy), the password expiration time is set by the policy
+func NewUserPwdWithPolicy(pwd []byte, saltData []byte, checkPwdStrength bool, policy *PasswordPolicy) (*UserPwd, error) {
+	u := UserPwd{Salt: saltData, Policy: policy}
+	p := u.GetPolicy()
+	pwd = p.NormalizePwd(pwd)
+	err := checkNewPwd(p, pwd, checkPwdStrength)
 	if err != nil {
 		return nil, err
 	}
-	err = CheckPasswordStrength(string(pwd))
-	if err != nil && checkPwdStrength {
+	newPwd, err := salt.GenerateSaltedPassword(pwd, MinPasswordLength, MaxPasswordLength, saltData, -1)
+	if err != nil {
 		return nil, err
 	}
-	newPwd, err := salt.GenerateSaltedPassword(pwd, MinPasswordLength, MaxPasswordLength, saltData, -1)
+	setPwd, err := hashPwd(GetHashedPwd(newPwd), GetHashParams())
 	if err != nil {
 		return nil, err
 	}
-	setPwd := GetHashedPwd(newPwd)
-	return &UserPwd{setPwd, saltData, getNewDefaultPasswordExpirationTime(), 0, defaultTemporaryPwd, [defaultNumberOfOldPasswords][]byte{}}, nil
+	u.Password = setPwd
+	u.Expiration = GetNewPasswordExpirationTime(p)
+	u.TemporaryPwd = defaultTemporaryPwd
+	u.OldPasswords = make([][]byte, p.HistoryDepth)
+	return &u, nil
 }
 
-func getNewDefaultPasswordExpirationTime() time.Time {
-	return time.Now().Add(time.Duration(defaultExpirationDurationDays*24) * time.Hour)
+// GetNewPasswordExpirationTime : Return the expiration time of a new password according to the given policy,
+// passwords don't expire in 800-63B mode
+func GetNewPasswordExpirationTime(policy PasswordPolicy) time.Time {
+	if policy.NistMode {
+		return noExpirationTime
+	}
+	return time.Now().Add(time.Duration(policy.ExpirationDays*24) * time.Hour)
 }
 
 // SetTemporaryPwd : sets the temporary password status to the given value
@@ -158,7 +223,7 @@ func (u *UserPwd) SetTemporaryPwd(flag bool) {
 
 // UpdatePassword : Update password and expiration time
 func (u *UserPwd) UpdatePassword(currentPwd []byte, pwd []byte, checkPwdStrength bool) ([]byte, error) {
-	return u.updatePasswordHandler(currentPwd, pwd, getNewDefaultPasswordExpirationTime(), defaultTemporaryPwd, checkPwdStrength)
+	return u.updatePasswordHandler(currentPwd, pwd, GetNewPasswordExpirationTime(u.GetPolicy()), defaultTemporaryPwd, checkPwdStrength)
 }
 
 // Update the password, it's expioration time and it's state (is it a one-time-password or a regular one)
@@ -166,18 +231,20 @@ func (u *UserPwd) updatePasswordHandler(currentPwd []byte, pwd []byte, expiratio
 	pLock.Lock()
 	defer pLock.Unlock()
 
-	err := isPwdLengthValid(pwd)
+	pwd = u.GetPolicy().NormalizePwd(pwd)
+	err := checkNewPwd(u.GetPolicy(), pwd, checkPwdStrength)
 	if err != nil {
 		return nil, err
 	}
-	err = CheckPasswordStrength(string(pwd))
-	if err != nil && checkPwdStrength {
-		return nil, err
-	}
 	err = u.isPasswordMatchHandler(currentPwd, true)
 	if err != nil {
 		return nil, err
 	}
+	return u.setPassword(pwd, expiration, temporaryPwd)
+}
+
+// Replace the password by the given one, if it is valid, and keep the current password in the old passwords
+func (u *UserPwd) setPassword(pwd []byte, expiration time.Time, temporaryPwd bool) ([]byte, error) {
 	tmpPwd, err := salt.GenerateSaltedPassword(pwd, MinPasswordLength, MaxPasswordLength, u.Salt, -1)
 	if err != nil {
 		return nil, fmt.Errorf("There was a problem while generating the new password: %v", err)
@@ -186,65 +253,126 @@ func (u *UserPwd) updatePasswordHandler(currentPwd []byte, pwd []byte, expiratio
 	if err != nil {
 		return nil, err
 	}
-	newPwd := GetHashedPwd(tmpPwd)
-	copy(u.OldPasswords[1:], u.OldPasswords[:])
-	u.OldPasswords[0] = u.Password
+	newPwd, err := hashPwd(GetHashedPwd(tmpPwd), GetHashParams())
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem while generating the new password: %v", err)
+	}
+	depth := u.GetPolicy().HistoryDepth
+	u.OldPasswords = append([][]byte{u.Password}, u.OldPasswords...)
+	if len(u.OldPasswords) > depth {
+		u.OldPasswords = u.OldPasswords[:depth]
+	}
 	u.Password = newPwd
 	u.Expiration = expiration
-	u.ErrorsCounter = 0
+	u.unlock()
+	u.clearResetToken()
 	u.SetTemporaryPwd(temporaryPwd)
 	return newPwd, nil
 }
 
 // IsPasswordMatch : Verify that the given password is the expected one and that it is not expired
+// The given password is the hash (GetHashedPwd) of the salted password. When it matches a password that was hashed
+// using other parameters than the current ones (e.g. a legacy hash), the password is re-hashed using the current parameters
 func (u *UserPwd) IsPasswordMatch(pwd []byte) error {
 	return u.isPasswordMatchHandler(pwd, false)
 }
 
 // Verify that the given password is the expected one and that it is not expired
-// If the overrideChecks is set, do not check the errorCounter and expiration, it uses for passwordUpdate
+// If the overrideChecks is set, do not check the length and expiration, it uses for passwordUpdate.
+// The lock state and the error counter are checked on every path to avoid backdoors
 func (u *UserPwd) isPasswordMatchHandler(pwd []byte, overrideChecks bool) error {
 	p1Lock.Lock()
 	defer p1Lock.Unlock()
 
+	err := u.checkAttempts(pwd)
+	if err != nil {
+		return err
+	}
 	if overrideChecks == false {
-		if u.ErrorsCounter >= maxPwdAttempts {
-			compareHashedPwd(pwd, u.Password) // against timing attacks
-			return fmt.Errorf("Too many password attempts. You must reset password before trying again.")
-		}
-		err := isPwdLengthValid(pwd)
+		err = isPwdLengthValid(pwd)
 		if err != nil {
 			return err
 		}
-		if compareHashedPwd(pwd, u.Password) == false {
-			u.ErrorsCounter = u.ErrorsCounter + 1
-			return fmt.Errorf("Password is wrong, please try again")
-		} // don't check it again
-		// Check expiration only for valid password: to hide the information that the user is valid
-		if time.Now().After(u.Expiration) {
-			return fmt.Errorf("Password has expired, please replace it")
-		}
 	}
-	// the error counter must be increased also for password update to avoid backdoors
-	if overrideChecks != false && compareHashedPwd(pwd, u.Password) == false {
-		u.ErrorsCounter = u.ErrorsCounter + 1
+	if verifyPwd(pwd, u.Password) == false {
+		u.setWrongAttempt()
 		return fmt.Errorf("Password is wrong, please try again")
 	}
+	// Check expiration only for valid password: to hide the information that the user is valid
+	if overrideChecks == false && time.Now().After(u.Expiration) {
+		return fmt.Errorf("Password has expired, please replace it")
+	}
 	if u.TemporaryPwd == true {
 		u.Expiration = defs.GetBeginningOfTime() // old use time.Now()              // The password expired => it can't be used any more.
 		u.SetTemporaryPwd(defaultTemporaryPwd) // Reset to the default option for the next password
 	}
-	u.ErrorsCounter = 0
+	u.unlock()
+	if isRehashNeeded(u.Password) {
+		newPwd, err := hashPwd(pwd, GetHashParams())
+		if err == nil {
+			u.Password = newPwd
+		}
+	}
 	return nil
 }
 
-// ResetPassword : Reset the password of a given user to a random password and make it a One-time-password with
-// a short window time in which it should be used and replaced by the user
-func (u *UserPwd) ResetPassword() ([]byte, error) {
-	pass := GenerateNewValidPassword()
-	expiration := time.Now().Add(time.Duration(defaultTemporaryPwdExpirationMinutes) * time.Second * 60)
+// Verify that the password is not locked: a hard locked password can't be used until it is reset,
+// a locked password is automatically unlocked when its lock duration is over
+func (u *UserPwd) checkAttempts(pwd []byte) error {
+	state, lockedUntil := u.GetLockState()
+	if state == UnlockedState {
+		return nil
+	}
+	verifyPwd(pwd, u.Password) // against timing attacks
+	if state == HardLockedState {
+		return fmt.Errorf("Too many password attempts. You must reset password before trying again.")
+	}
+	return fmt.Errorf("Too many password attempts. Please try again in %v", time.Until(lockedUntil).Round(time.Second))
+}
+
+// Count the wrong attempt and lock the password according to the policy lockout rules
+func (u *UserPwd) setWrongAttempt() {
+	policy := u.GetPolicy()
+	u.ErrorsCounter = u.ErrorsCounter + 1
+	u.LastErrorTime = time.Now()
+	if u.ErrorsCounter < policy.MaxAttempts {
+		return
+	}
+	if policy.LockoutSeconds == 0 || (policy.HardLockAttempts > 0 && u.ErrorsCounter >= policy.HardLockAttempts) {
+		u.HardLocked = true
+		return
+	}
+	u.LockedUntil = u.LastErrorTime.Add(policy.getLockoutDuration(u.ErrorsCounter))
+}
+
+// Clear the wrong attempts and the lock of the password
+func (u *UserPwd) unlock() {
 	u.ErrorsCounter = 0
-	_, err := u.updatePasswordHandler(u.Password, pass, expiration, true, true)
+	u.LockedUntil = time.Time{}
+	u.HardLocked = false
+}
+
+// GetLockState : Return the lock state of the password: unlocked, locked (until the returned time) or hard locked
+func (u UserPwd) GetLockState() (string, time.Time) {
+	if u.HardLocked || (u.GetPolicy().LockoutSeconds == 0 && u.ErrorsCounter >= u.GetPolicy().MaxAttempts) {
+		return HardLockedState, time.Time{}
+	}
+	if time.Now().Before(u.LockedUntil) {
+		return LockedState, u.LockedUntil
+	}
+	return UnlockedState, time.Time{}
+}
+
+// ResetPassword : Reset the password of a given user to a random password (or a passphrase if the reset passphrase
+// parameters were set) and make it a One-time-password with a short window time in which it should be used and replaced by the user
+func (u *UserPwd) ResetPassword() ([]byte, error) {
+	policy := u.GetPolicy()
+	pass := generateResetPassword(policy)
+	expiration := time.Now().Add(time.Duration(policy.TemporaryPwdExpirationMinutes) * time.Second * 60)
+	pLock.Lock()
+	u.unlock()
+	_, err := u.setPassword(pass, expiration, true)
+	pLock.Unlock()
 	u.SetTemporaryPwd(true)
 	u.Expiration = expiration // to override the temporary password setting
 	if err != nil {
@@ -258,31 +386,9 @@ func (u *UserPwd) UpdatePasswordAfterReset(currentPwd []byte, pwd []byte, expira
 	return u.updatePasswordHandler(currentPwd, pwd, expiration, false, true)
 }
 
-// CheckPasswordStrength : VErify that the given password strength is good enougth
+// CheckPasswordStrength : Verify that the given password strength is good enougth according to the default password policy
 func CheckPasswordStrength(pass string) error {
-	extraCnt := 0
-	digitCnt := 0
-	upperCaseCnt := 0
-	lowerCaseCnt := 0
-
-	for _, c := range defs.ExtraCharStr {
-		extraCnt += strings.Count(pass, string(c))
-	}
-	for _, c := range pass {
-		if unicode.IsUpper(c) {
-			upperCaseCnt++
-		} else if unicode.IsLower(c) {
-			lowerCaseCnt++
-		} else if unicode.IsDigit(c) {
-			digitCnt++
-		}
-	}
-	if len(pass) < MinPasswordLength || extraCnt < minExtraChars || digitCnt < minDigits ||
-		upperCaseCnt < minUpperCase || lowerCaseCnt < minLowerCase {
-		return fmt.Errorf("The checked password does not pass the password strength test. In order to be strong, the password must adhere to all of the following:\nContains at least %v characters\nIncludes at least %v digits\nIncludes at least %v letters, where at least %v must be uppercase and at least %v must be lowercase\nIncludes at least %v special characters from the following list:\nSpecial characters: '%v'",
-			MinPasswordLength, minDigits, minUpperCase+minLowerCase, minUpperCase, minLowerCase, minExtraChars, defs.ExtraCharStr)
-	}
-	return nil
+	return GetDefaultPasswordPolicy().CheckStrength(pass)
 }
 
 // GenerateNewValidPassword : Generate a valid password that includes defaultPasswordLen characters
@@ -291,24 +397,49 @@ func CheckPasswordStrength(pass string) error {
 // iterations to fit the rules
 // The entropy is not perfect but its good enougth for temporary reset password
 func GenerateNewValidPassword() []byte {
+	return generatePassword(defaultPasswordLen, 2, 2, 2)
+}
+
+// Generate a password that adheres to the given policy, with at least the characters that GenerateNewValidPassword uses
+// when the policy maximum length allows it
+func generatePolicyValidPassword(policy PasswordPolicy) []byte {
+	upper := maxInt(2, policy.MinUpperCase)
+	digits := maxInt(2, policy.MinDigits)
+	extra := maxInt(2, policy.MinExtraChars)
+	if upper+digits+extra+policy.MinLowerCase > policy.MaxLength {
+		upper, digits, extra = policy.MinUpperCase, policy.MinDigits, policy.MinExtraChars
+	}
+	pLen := minInt(maxInt(maxInt(defaultPasswordLen, policy.MinLength), upper+digits+extra+policy.MinLowerCase), policy.MaxLength)
+	pwd := generatePassword(pLen, upper, digits, extra)
+	// a random password may still be too guessable: a longer one is generated until it reaches the policy minimum score
+	for policy.MinStrengthScore > 0 && EstimateStrength(string(pwd)).Score < policy.MinStrengthScore && pLen < policy.MaxLength {
+		pLen++
+		pwd = generatePassword(pLen, upper, digits, extra)
+	}
+	return pwd
+}
+
+// Generate a random password of the given length with the given number of upper case characters, digits
+// and extra characters, all the other characters are lower case
+func generatePassword(pLen int, upper int, digits int, extra int) []byte {
 	extraChars := []byte(defs.ExtraCharStr)
-	pwd := make([]byte, defaultPasswordLen)
+	pwd := make([]byte, pLen)
 	_, err := io.ReadFull(rand.Reader, pwd)
 	if err != nil {
 		panic(fmt.Errorf("Random read failed: %v", err))
 	}
 	// Entropy is not the best: random is 0-255 map to 0-21
-	for i := 0; i < defaultPasswordLen; i++ {
+	for i := 0; i < pLen; i++ {
 		if pwd[i] < 'a' || pwd[i] > 'z' {
 			pwd[i] = (pwd[i] % ('z' - 'a')) + 'a'
 		}
 	}
 
-	// Replace 6 characters with 2 Upper case characters, 2 digits and 2 extra characters
-	for j := 0; j < 6 && j < defaultPasswordLen; j++ {
-		if j < 2 {
+	// Replace the first characters with the upper case characters, digits and extra characters
+	for j := 0; j < upper+digits+extra && j < pLen; j++ {
+		if j < upper {
 			pwd[j] = pwd[j] - 'a' + 'A'
-		} else if j >= 2 && j < 4 {
+		} else if j < upper+digits {
 			// entropy is not the best map 0-21 to 0-9
 			pwd[j] = (pwd[j] % 10) + '0'
 		} else {
@@ -318,7 +449,7 @@ func GenerateNewValidPassword() []byte {
 	}
 
 	// Shuffle the characters of the password except of the first one that must be a letter
-	// The first char is allways upper case
+	// The first char is allways upper case (if there are upper case characters)
 	shuffleIterations := 100
 	buf := make([]byte, shuffleIterations*2)
 	_, err = io.ReadFull(rand.Reader, buf)
@@ -353,6 +484,14 @@ func (s Serializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
 
 // AddToStorage : Add the Password property information to the secure_storage
 func (s Serializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add password property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the Password property information to an items writer, e.g. a storage transaction
+func (s Serializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
 	d, ok := data.(*UserPwd)
 	if ok == false {
 		return fmt.Errorf("Cannot store the password property: Not the right type")
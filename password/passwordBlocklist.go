@@ -0,0 +1,289 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+// The password blocklist rejects common passwords and passwords that were exposed in data breaches.
+// It is loaded at startup from 2 local files (no network access is needed):
+//	- The common passwords file: one password per line (empty lines and lines that start with '#' are ignored).
+//	  The passwords are compared case insensitively, after common character substitutions (e.g. '@' for 'a', '0' for 'o')
+//	  and after removing the digits and special characters that are added at their ends (so "P@ssword1!" matches "password")
+//	- The breached passwords file: a sorted array of the first breachedPrefixLen bytes of the SHA-1 of breached passwords,
+//	  it is generated by WriteBreachedPasswordsFile from a sorted list of hex encoded SHA-1 hashes (e.g. the "HASH:count"
+//	  lines of the Have I Been Pwned passwords list ordered by hash). A prefix match is a match: a few unrelated passwords
+//	  may be rejected too. The file is not read into memory, the prefixes are searched in the file
+// Passwords that are derived from the user name (including its reverse) are rejected as well
+
+const (
+	breachedPrefixLen = 8
+	minUserNameLen    = 3
+)
+
+var (
+	blocklistLock sync.Mutex
+	blocklist     *Blocklist
+
+	leetSubstitutions = map[rune]rune{'@': 'a', '4': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'}
+)
+
+// Blocklist : the common passwords and the SHA-1 prefixes of breached passwords that can't be used
+type Blocklist struct {
+	common        map[string]bool
+	breached      io.ReaderAt // sorted breachedPrefixLen bytes prefixes
+	numOfBreached int
+	breachedFile  *os.File // the breached passwords file, if the prefixes are read from a file
+}
+
+// BlockedPasswordError : the error that is returned when the password is in the blocklist or is derived from the user name
+type BlockedPasswordError struct {
+	Reason string
+}
+
+func (e BlockedPasswordError) Error() string {
+	return fmt.Sprintf("The password is not allowed: %v. Please select a different password", e.Reason)
+}
+
+// IsBlockedPasswordError : Check if the given error is a blocked password error
+func IsBlockedPasswordError(err error) bool {
+	_, ok := err.(BlockedPasswordError)
+	return ok
+}
+
+// NewBlocklist : Return a new blocklist of the given common passwords and the given breached passwords SHA-1 prefixes
+// (the content of a breached passwords file)
+func NewBlocklist(common []string, breached []byte) (*Blocklist, error) {
+	if len(breached)%breachedPrefixLen != 0 {
+		return nil, fmt.Errorf("The breached passwords data length %v is not a multiple of %v", len(breached), breachedPrefixLen)
+	}
+	for i := breachedPrefixLen; i < len(breached); i += breachedPrefixLen {
+		if bytes.Compare(breached[i-breachedPrefixLen:i], breached[i:i+breachedPrefixLen]) > 0 {
+			return nil, fmt.Errorf("The breached passwords data is not sorted")
+		}
+	}
+	return newBlocklist(common, bytes.NewReader(breached), len(breached)/breachedPrefixLen), nil
+}
+
+func newBlocklist(common []string, breached io.ReaderAt, numOfBreached int) *Blocklist {
+	b := Blocklist{common: make(map[string]bool), breached: breached, numOfBreached: numOfBreached}
+	for _, pwd := range common {
+		pwd = strings.TrimSpace(pwd)
+		if len(pwd) == 0 || strings.HasPrefix(pwd, "#") {
+			continue
+		}
+		b.common[undoLeetSubstitutions(pwd)] = true
+	}
+	return &b
+}
+
+// LoadBlocklist : Load the blocklist from the given common passwords file and breached passwords file,
+// each of the file names may be empty. The breached passwords file must be generated by WriteBreachedPasswordsFile,
+// it is kept open (till Close is called) and the prefixes are searched in it
+func LoadBlocklist(commonFileName string, breachedFileName string) (*Blocklist, error) {
+	var common []string
+
+	if len(commonFileName) > 0 {
+		data, err := ioutil.ReadFile(commonFileName)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read the common passwords file '%v', error: %v", commonFileName, err)
+		}
+		common = strings.Split(string(data), "\n")
+	}
+	if len(breachedFileName) == 0 {
+		return newBlocklist(common, bytes.NewReader(nil), 0), nil
+	}
+	f, err := os.Open(breachedFileName)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read the breached passwords file '%v', error: %v", breachedFileName, err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size()%breachedPrefixLen != 0 {
+		err = fmt.Errorf("its length %v is not a multiple of %v", info.Size(), breachedPrefixLen)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Can't read the breached passwords file '%v', error: %v", breachedFileName, err)
+	}
+	b := newBlocklist(common, f, int(info.Size()/breachedPrefixLen))
+	b.breachedFile = f
+	return b, nil
+}
+
+// Close : Close the breached passwords file of the blocklist (if it was loaded from a file)
+func (b *Blocklist) Close() error {
+	if b.breachedFile == nil {
+		return nil
+	}
+	return b.breachedFile.Close()
+}
+
+// WriteBreachedPasswordsFile : Generate a breached passwords file from the given list of hex encoded SHA-1 hashes of
+// breached passwords, one hash per line, optionally followed by ':' and the number of times it was seen.
+// The hashes must be sorted (e.g. the Have I Been Pwned passwords list ordered by hash): they are streamed to the file
+// without being held in memory. The file is written to a temporary file that replaces the given file when it is done
+func WriteBreachedPasswordsFile(fileName string, hashes io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // the temporary file is removed if it was not renamed
+	err = writeBreachedPrefixes(f, hashes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), os.FileMode(ss.FilePermissions))
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fileName)
+}
+
+// Write the sorted unique prefixes of the given sorted hashes
+func writeBreachedPrefixes(out io.Writer, hashes io.Reader) error {
+	var prev []byte
+
+	w := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(hashes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		hash, err := hex.DecodeString(strings.SplitN(line, ":", 2)[0])
+		if err != nil || len(hash) != sha1.Size {
+			return fmt.Errorf("The line '%v' is not a hex encoded SHA-1 hash", line)
+		}
+		prefix := hash[:breachedPrefixLen]
+		cmp := bytes.Compare(prev, prefix)
+		if prev != nil && cmp > 0 {
+			return fmt.Errorf("The hashes are not sorted: the line '%v' is after a greater hash", line)
+		}
+		if prev != nil && cmp == 0 {
+			continue
+		}
+		_, err = w.Write(prefix)
+		if err != nil {
+			return err
+		}
+		prev = prefix
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// SetBlocklist : Set the blocklist that is used by the password checks, nil to disable the blocklist checks
+func SetBlocklist(b *Blocklist) {
+	blocklistLock.Lock()
+	defer blocklistLock.Unlock()
+	blocklist = b
+}
+
+func getBlocklist() *Blocklist {
+	blocklistLock.Lock()
+	defer blocklistLock.Unlock()
+	return blocklist
+}
+
+// Return the password in lower case after the common character substitutions are reverted
+func undoLeetSubstitutions(pwd string) string {
+	return strings.Map(func(c rune) rune {
+		if sub, exist := leetSubstitutions[c]; exist {
+			return sub
+		}
+		return c
+	}, strings.ToLower(pwd))
+}
+
+// Return the password without the digits and special characters at its beginning and end
+func trimPwd(pwd string) string {
+	return strings.TrimFunc(pwd, func(c rune) bool {
+		return unicode.IsLetter(c) == false
+	})
+}
+
+func (b Blocklist) isCommon(pwd string) bool {
+	if b.common[undoLeetSubstitutions(pwd)] || b.common[strings.ToLower(pwd)] {
+		return true
+	}
+	trimmed := trimPwd(strings.ToLower(pwd))
+	return len(trimmed) > 0 && (b.common[trimmed] || b.common[undoLeetSubstitutions(trimmed)])
+}
+
+// The prefixes are read using ReadAt, so the search is safe for concurrent use
+func (b Blocklist) isBreached(pwd string) (bool, error) {
+	var err error
+
+	hash := sha1.Sum([]byte(pwd))
+	prefix := hash[:breachedPrefixLen]
+	readPrefix := func(i int) []byte {
+		buf := make([]byte, breachedPrefixLen)
+		_, e := b.breached.ReadAt(buf, int64(i)*breachedPrefixLen)
+		if e != nil && err == nil {
+			err = e
+		}
+		return buf
+	}
+	i := sort.Search(b.numOfBreached, func(i int) bool {
+		return bytes.Compare(readPrefix(i), prefix) >= 0
+	})
+	found := i < b.numOfBreached && bytes.Equal(readPrefix(i), prefix)
+	if err != nil {
+		return false, fmt.Errorf("Can't read the breached passwords, error: %v", err)
+	}
+	return found, nil
+}
+
+// Check if the password is derived from the user name: it includes the user name or its reverse
+func isDerivedFromUserName(pwd string, userName string) bool {
+	if len(userName) < minUserNameLen {
+		return false
+	}
+	name := undoLeetSubstitutions(userName)
+	reversed := []rune(name)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	p := undoLeetSubstitutions(pwd)
+	return strings.Contains(p, name) || strings.Contains(p, string(reversed))
+}
+
+// CheckBlocklist : Verify that the given password is not a common or a breached password and (if the user name is given)
+// that it is not derived from the user name. A BlockedPasswordError is returned if it is
+func CheckBlocklist(pwd string, userName string) error {
+	if isDerivedFromUserName(pwd, userName) {
+		return BlockedPasswordError{"it is derived from the user name"}
+	}
+	b := getBlocklist()
+	if b == nil {
+		return nil
+	}
+	if b.isCommon(pwd) {
+		return BlockedPasswordError{"it is a commonly used password"}
+	}
+	breached, err := b.isBreached(pwd)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return BlockedPasswordError{"it appeared in a data breach"}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	commonPwdsFileName   = "./tmpCommon.txt"
+	breachedPwdsFileName = "./tmpBreached.bin"
+)
+
+func getSha1Str(pwd string) string {
+	hash := sha1.Sum([]byte(pwd))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// Verify that common passwords (including their variants) and breached passwords are rejected by the password checks
+// and that other passwords are accepted
+func Test_blocklist(t *testing.T) {
+	defer SetBlocklist(nil)
+	defer os.Remove(commonPwdsFileName)
+	defer os.Remove(breachedPwdsFileName)
+
+	breached := []string{"Xq9#Breach1", "Yw8@Breach2", "Zr7%Breach3"}
+	ioutil.WriteFile(commonPwdsFileName, []byte("# common passwords\npassword\nqwertyuiop\n\n"), 0600)
+	var lines []string
+	for i, pwd := range append(breached, breached[0]) {
+		lines = append(lines, fmt.Sprintf("%v:%v", getSha1Str(pwd), i+1))
+	}
+	sort.Strings(lines)
+	err := WriteBreachedPasswordsFile(breachedPwdsFileName, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("Test fail: can't write the breached passwords file, error: %v", err)
+	}
+	blocklist, err := LoadBlocklist(commonPwdsFileName, breachedPwdsFileName)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the blocklist, error: %v", err)
+	}
+	defer blocklist.Close()
+	if blocklist.numOfBreached != len(breached) {
+		t.Errorf("Test fail: the breached passwords file includes %v prefixes instead of %v", blocklist.numOfBreached, len(breached))
+	}
+	if CheckPasswordStrength("Password1#") != nil {
+		t.Errorf("Test fail: the password 'Password1#' was rejected before the blocklist was set")
+	}
+	SetBlocklist(blocklist)
+	blocked := append([]string{"Password1#", "P@ssw0rd12#", "12@Qwertyuiop"}, breached...)
+	for _, pwd := range blocked {
+		err := CheckPasswordStrength(pwd)
+		if IsBlockedPasswordError(err) == false {
+			t.Errorf("Test fail: the blocked password '%v' was not rejected as blocked, error: %v", pwd, err)
+		}
+	}
+	for _, pwd := range []string{"Passw1#rdX", "Xq9#Breach4", string(defaultPassword)} {
+		err := CheckPasswordStrength(pwd)
+		if err != nil {
+			t.Errorf("Test fail: the password '%v' was rejected, error: %v", pwd, err)
+		}
+	}
+}
+
+// Verify that passwords that are derived from the user name are rejected
+func Test_userNameDerivedPassword(t *testing.T) {
+	userName := "Alice"
+	for _, pwd := range []string{"Alice123!", "12@al1ce#X", "Ecila#12Ab", "xxALICExx"} {
+		err := CheckBlocklist(pwd, userName)
+		if IsBlockedPasswordError(err) == false {
+			t.Errorf("Test fail: the password '%v' that is derived from the user name '%v' was not rejected", pwd, userName)
+		}
+	}
+	for _, pwd := range []string{"Al1x#12Ab", string(defaultPassword)} {
+		err := CheckBlocklist(pwd, userName)
+		if err != nil {
+			t.Errorf("Test fail: the password '%v' was rejected, error: %v", pwd, err)
+		}
+	}
+	if CheckBlocklist("Ab1@Ab1@", "Ab") != nil {
+		t.Errorf("Test fail: a password was rejected because it includes a very short user name")
+	}
+}
+
+// Verify that illegal breached passwords data and hashes are rejected
+func Test_blocklistCorners(t *testing.T) {
+	defer os.Remove(breachedPwdsFileName)
+
+	_, err := NewBlocklist(nil, []byte("1234567"))
+	if err == nil {
+		t.Errorf("Test fail: breached passwords data that is not a multiple of %v bytes was accepted", breachedPrefixLen)
+	}
+	_, err = NewBlocklist(nil, []byte("bbbbbbbbaaaaaaaa"))
+	if err == nil {
+		t.Errorf("Test fail: unsorted breached passwords data was accepted")
+	}
+	unsorted := getSha1Str("b") + "\n" + getSha1Str("a") // the hash of "b" is greater than the hash of "a"
+	for _, hashes := range []string{"1234", "zz" + getSha1Str("a")[2:], unsorted} {
+		err = WriteBreachedPasswordsFile(breachedPwdsFileName, strings.NewReader(hashes))
+		if err == nil {
+			t.Errorf("Test fail: the illegal or unsorted SHA-1 hashes '%v' were accepted", hashes)
+		}
+	}
+	_, err = LoadBlocklist("", "./notExist.bin")
+	if err == nil {
+		t.Errorf("Test fail: a missing breached passwords file was loaded")
+	}
+}
@@ -0,0 +1,693 @@
+package password
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The password strength estimator (in the style of zxcvbn) estimates the number of guesses an attacker needs in order
+// to find the password: the password is matched against common patterns (dictionary words and common passwords,
+// also reversed or with l33t substitutions, keyboard sequences, alphabetic and numeric sequences, repeats, years and dates),
+// the guesses of each match are estimated and the sequence of matches (and brute force segments) that covers the password
+// with the minimum number of guesses is selected. The number of guesses is mapped to a score between 0 (too guessable)
+// and 4 (very unguessable) and feedback is returned: a warning about the weakest pattern and suggestions how to improve it
+
+const (
+	// MaxStrengthScore : The score of very unguessable passwords
+	MaxStrengthScore = 4
+
+	maxEstimatedLen         = 64 // longer passwords are estimated in chunks of this length
+	maxEstimatedChunks      = 16 // the characters after these chunks are not estimated
+	maxGuessesLog10         = 300
+	bruteforceCardinality   = 10
+	minGuessesSingleChar    = 10
+	minGuessesMultiChar     = 50
+	minGuessesBeforeGrowing = 10000
+	minYearSpace            = 20
+	minYear                 = 1000
+	maxYear                 = 2050
+	blocklistWordRank       = 10000
+
+	dictionaryPattern = "dictionary"
+	spatialPattern    = "spatial"
+	sequencePattern   = "sequence"
+	repeatPattern     = "repeat"
+	yearPattern       = "year"
+	datePattern       = "date"
+	bruteforcePattern = "bruteforce"
+)
+
+var (
+	// The most common passwords and words, ordered by their frequency
+	commonWords = []string{"password", "123456", "12345678", "qwerty", "123456789", "12345", "1234", "111111", "1234567",
+		"dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein", "shadow", "master", "666666", "qwertyuiop",
+		"123321", "mustang", "1234567890", "michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000",
+		"qazwsx", "123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter", "buster", "soccer",
+		"harley", "batman", "andrew", "tigger", "sunshine", "iloveyou", "charlie", "robert", "thomas", "hockey", "ranger",
+		"daniel", "starwars", "112233", "george", "computer", "michelle", "jessica", "pepper", "zxcvbn", "555555",
+		"11111111", "131313", "freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger", "princess", "joshua",
+		"cheese", "amanda", "summer", "love", "ashley", "nicole", "chelsea", "matthew", "access", "yankees", "987654321",
+		"dallas", "austin", "thunder", "taylor", "matrix", "admin", "welcome", "login", "secret", "hello", "security",
+		"changeme", "default", "root", "user", "test", "guest", "winter", "spring", "autumn", "flower", "money", "house",
+		"apple", "orange", "banana", "coffee", "water", "family", "friend", "forever", "company", "office", "london",
+		"paris", "england", "america", "internet", "service", "system", "server", "network", "mother", "father", "sister",
+		"brother", "happy", "lucky", "angel", "heaven", "purple", "silver", "golden", "diamond", "dream", "magic",
+		"tiger", "lion", "eagle", "hammer", "soldier", "player", "secure", "private", "public", "library", "school",
+		"student", "teacher", "doctor", "garden", "picture", "music", "guitar", "pizza", "chocolate"}
+	commonWordsRank = make(map[string]int)
+
+	keyboardRows        = []string{"1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+	keyboardShiftedRows = []string{"!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?"}
+	keyboardKeys        = make(map[rune]keyboardKey)
+	keyboardAvgDegree   float64
+
+	dateWithSeparatorRegex = regexp.MustCompile(`^(\d{1,4})([\s/\\_.-])(\d{1,2})([\s/\\_.-])(\d{1,4})$`)
+)
+
+// StrengthEstimate : The estimated strength of a password: its score between 0 (too guessable) and MaxStrengthScore
+// (very unguessable), the log10 of the estimated number of guesses needed to find it, a warning about its weakest
+// pattern and suggestions how to make it stronger
+type StrengthEstimate struct {
+	Score        int
+	GuessesLog10 float64
+	Warning      string
+	Suggestions  []string
+}
+
+type keyboardKey struct {
+	row     int
+	col     int
+	shifted bool
+}
+
+// A pattern that matches the runes i to j-1 of the password
+type patternMatch struct {
+	pattern  string
+	i        int
+	j        int
+	token    string
+	guesses  float64
+	rank     int  // dictionary
+	userWord bool // dictionary
+	reversed bool // dictionary
+	l33t     bool // dictionary
+	turns    int  // spatial
+	baseLen  int  // repeat
+}
+
+func init() {
+	for i := len(commonWords) - 1; i >= 0; i-- {
+		commonWordsRank[commonWords[i]] = i + 1
+	}
+	for r, row := range keyboardRows {
+		for c, key := range row {
+			keyboardKeys[key] = keyboardKey{r, c, false}
+		}
+		for c, key := range keyboardShiftedRows[r] {
+			keyboardKeys[key] = keyboardKey{r, c, true}
+		}
+	}
+	degree := 0
+	for _, row := range keyboardRows {
+		for _, c1 := range row {
+			for _, c2 := range strings.Join(keyboardRows, "") {
+				if _, adjacent := getKeyboardDirection(c1, c2); adjacent {
+					degree++
+				}
+			}
+		}
+	}
+	keyboardAvgDegree = float64(degree) / float64(len(strings.Join(keyboardRows, "")))
+}
+
+// Return the direction from the first key to the second one and true if they are adjacent on the keyboard.
+// The keyboard rows are staggered: each key is adjacent to the 2 keys above it at the same and next columns
+func getKeyboardDirection(c1 rune, c2 rune) (int, bool) {
+	k1, ok1 := keyboardKeys[c1]
+	k2, ok2 := keyboardKeys[c2]
+	if ok1 == false || ok2 == false {
+		return 0, false
+	}
+	dr := k2.row - k1.row
+	dc := k2.col - k1.col
+	if (dr == 0 && (dc == 1 || dc == -1)) || (dr == -1 && (dc == 0 || dc == 1)) || (dr == 1 && (dc == 0 || dc == -1)) {
+		return dr*3 + dc, true
+	}
+	return 0, false
+}
+
+func nCk(n int, k int) float64 {
+	if k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r = r * float64(n-k+d) / float64(d)
+	}
+	return r
+}
+
+func factorial(n int) float64 {
+	r := 1.0
+	for i := 2; i <= n; i++ {
+		r *= float64(i)
+	}
+	return r
+}
+
+// Return the number of variations of 2 groups of characters (e.g. upper and lower case):
+// a password that uses only one of them has 1 variation
+func getVariations(cnt1 int, cnt2 int) float64 {
+	if cnt1 == 0 || cnt2 == 0 {
+		return 1
+	}
+	variations := 0.0
+	for i := 1; i <= minInt(cnt1, cnt2); i++ {
+		variations += nCk(cnt1+cnt2, i)
+	}
+	return variations
+}
+
+func getUpperCaseVariations(token []rune) float64 {
+	upper := 0
+	lower := 0
+	for _, c := range token {
+		if unicode.IsUpper(c) {
+			upper++
+		} else if unicode.IsLower(c) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	// the common capitalizations: the first character, the last character or all the characters
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(token[0]) || unicode.IsUpper(token[len(token)-1]))) {
+		return 2
+	}
+	return getVariations(upper, lower)
+}
+
+func getL33tVariations(token []rune) float64 {
+	subbed := 0
+	unsubbed := 0
+	letters := make(map[rune]bool)
+	for _, c := range token {
+		if sub, exist := leetSubstitutions[c]; exist {
+			subbed++
+			letters[sub] = true
+		}
+	}
+	for _, c := range token {
+		if letters[unicode.ToLower(c)] {
+			unsubbed++
+		}
+	}
+	if unsubbed == 0 {
+		return 2
+	}
+	return getVariations(subbed, unsubbed)
+}
+
+func reverseRunes(r []rune) []rune {
+	reversed := make([]rune, len(r))
+	for i, c := range r {
+		reversed[len(r)-1-i] = c
+	}
+	return reversed
+}
+
+// Match all the substrings that are common passwords, common words, user inputs or blocklist common passwords,
+// as is, reversed or after l33t substitutions
+func matchDictionary(pwd []rune, userWords map[string]int) []patternMatch {
+	var matches []patternMatch
+	var common map[string]bool
+
+	if b := getBlocklist(); b != nil {
+		common = b.common
+	}
+	lower := []rune(strings.ToLower(string(pwd)))
+	for i := 0; i < len(pwd); i++ {
+		for j := i + 3; j <= len(pwd); j++ {
+			for _, reversed := range []bool{false, true} {
+				word := string(lower[i:j])
+				if reversed {
+					word = string(reverseRunes(lower[i:j]))
+				}
+				normalized := undoLeetSubstitutions(word)
+				m := patternMatch{pattern: dictionaryPattern, i: i, j: j, token: string(pwd[i:j]), reversed: reversed}
+				if rank, exist := userWords[word]; exist {
+					m.rank, m.userWord = rank, true
+				} else if rank, exist := commonWordsRank[word]; exist {
+					m.rank = rank
+				} else if rank, exist := userWords[normalized]; exist {
+					m.rank, m.userWord, m.l33t = rank, true, true
+				} else if rank, exist := commonWordsRank[normalized]; exist {
+					m.rank, m.l33t = rank, true
+				} else if common[normalized] {
+					m.rank, m.l33t = blocklistWordRank, normalized != word
+				} else {
+					continue
+				}
+				m.guesses = float64(m.rank) * getUpperCaseVariations(pwd[i:j])
+				if m.l33t {
+					m.guesses *= getL33tVariations(pwd[i:j])
+				}
+				if reversed {
+					m.guesses *= 2
+				}
+				matches = append(matches, m)
+			}
+		}
+	}
+	return matches
+}
+
+// Match the sequences of adjacent keyboard keys of at least 3 characters
+func matchSpatial(pwd []rune) []patternMatch {
+	var matches []patternMatch
+
+	for i := 0; i < len(pwd)-2; i++ {
+		j := i + 1
+		turns := 0
+		lastDirection := -100
+		for ; j < len(pwd); j++ {
+			direction, adjacent := getKeyboardDirection(pwd[j-1], pwd[j])
+			if adjacent == false {
+				break
+			}
+			if direction != lastDirection {
+				turns++
+				lastDirection = direction
+			}
+		}
+		if j-i >= 3 {
+			matches = append(matches, patternMatch{pattern: spatialPattern, i: i, j: j, token: string(pwd[i:j]), turns: turns,
+				guesses: getSpatialGuesses(pwd[i:j], turns)})
+		}
+	}
+	return matches
+}
+
+func getSpatialGuesses(token []rune, turns int) float64 {
+	startingPositions := float64(len(keyboardKeys) / 2)
+	guesses := 0.0
+	for i := 2; i <= len(token); i++ {
+		for j := 1; j <= minInt(turns, i-1); j++ {
+			guesses += nCk(i-1, j-1) * startingPositions * math.Pow(keyboardAvgDegree, float64(j))
+		}
+	}
+	shifted := 0
+	for _, c := range token {
+		if keyboardKeys[c].shifted {
+			shifted++
+		}
+	}
+	if shifted == len(token) {
+		return guesses * 2
+	}
+	return guesses * getVariations(shifted, len(token)-shifted)
+}
+
+// Match the alphabetic and numeric sequences (e.g. abc, 6543 or 13579) of at least 3 characters
+func matchSequence(pwd []rune) []patternMatch {
+	var matches []patternMatch
+
+	for i := 0; i < len(pwd)-2; i++ {
+		delta := int(pwd[i+1]) - int(pwd[i])
+		if delta == 0 || delta > 5 || delta < -5 {
+			continue
+		}
+		j := i + 2
+		for j < len(pwd) && int(pwd[j])-int(pwd[j-1]) == delta {
+			j++
+		}
+		if j-i < 3 {
+			continue
+		}
+		base := 26.0
+		if strings.ContainsRune("aAzZ019", pwd[i]) {
+			base = 4
+		} else if unicode.IsDigit(pwd[i]) {
+			base = 10
+		}
+		guesses := base * float64(j-i)
+		if delta < 0 {
+			guesses *= 2
+		}
+		matches = append(matches, patternMatch{pattern: sequencePattern, i: i, j: j, token: string(pwd[i:j]), guesses: guesses})
+		i = j - 2
+	}
+	return matches
+}
+
+// Match the repeated characters or repeated substrings (e.g. aaa or abcabc) of at least 3 characters
+func matchRepeat(pwd []rune, userWords map[string]int) []patternMatch {
+	var matches []patternMatch
+
+	for i := 0; i < len(pwd)-2; i++ {
+		best := patternMatch{}
+		for baseLen := 1; i+baseLen*2 <= len(pwd); baseLen++ {
+			base := string(pwd[i : i+baseLen])
+			j := i + baseLen
+			for j+baseLen <= len(pwd) && string(pwd[j:j+baseLen]) == base {
+				j += baseLen
+			}
+			if j-i > best.j-best.i && j-i >= 3 && j-i > baseLen {
+				best = patternMatch{pattern: repeatPattern, i: i, j: j, token: string(pwd[i:j]), baseLen: baseLen}
+			}
+		}
+		if best.baseLen > 0 {
+			baseGuesses, _ := getMinimumGuesses(pwd[i:i+best.baseLen], userWords, true)
+			best.guesses = baseGuesses * float64((best.j-best.i)/best.baseLen)
+			matches = append(matches, best)
+		}
+	}
+	return matches
+}
+
+func getYearGuesses(year int) float64 {
+	return math.Max(math.Abs(float64(year-time.Now().Year())), minYearSpace)
+}
+
+// Return the year of the given 2 or 4 digits year string, or -1 if it is not valid
+func getYear(str string) int {
+	year, err := strconv.Atoi(str)
+	if err != nil || (len(str) != 2 && len(str) != 4) {
+		return -1
+	}
+	if len(str) == 2 {
+		if year > 50 {
+			return 1900 + year
+		}
+		return 2000 + year
+	}
+	if year < minYear || year > maxYear {
+		return -1
+	}
+	return year
+}
+
+// Return the year of the date that the given 3 parts represent (day, month and year in any of the common orders),
+// or -1 if they are not a valid date
+func getDateYear(p1 string, p2 string, p3 string) int {
+	for _, parts := range [][]string{{p1, p2, p3}, {p3, p2, p1}} {
+		year := getYear(parts[2])
+		d1, err1 := strconv.Atoi(parts[0])
+		d2, err2 := strconv.Atoi(parts[1])
+		if year < 0 || err1 != nil || err2 != nil || len(parts[0]) > 2 || len(parts[1]) > 2 {
+			continue
+		}
+		if (d1 >= 1 && d1 <= 31 && d2 >= 1 && d2 <= 12) || (d2 >= 1 && d2 <= 31 && d1 >= 1 && d1 <= 12) {
+			return year
+		}
+	}
+	return -1
+}
+
+// Match the years (1900-2099) and the dates, with or without separators
+func matchDate(pwd []rune) []patternMatch {
+	var matches []patternMatch
+
+	for i := 0; i < len(pwd); i++ {
+		for j := i + 4; j <= len(pwd) && j-i <= 10; j++ {
+			token := string(pwd[i:j])
+			year := -1
+			guesses := 0.0
+			pattern := datePattern
+			if res := dateWithSeparatorRegex.FindStringSubmatch(token); res != nil {
+				if res[2] == res[4] {
+					year = getDateYear(res[1], res[3], res[5])
+				}
+				guesses = 4
+			} else if _, err := strconv.Atoi(token); err == nil && j-i <= 8 {
+				if j-i == 4 && (strings.HasPrefix(token, "19") || strings.HasPrefix(token, "20")) && getYear(token) > 0 {
+					year = getYear(token)
+					pattern = yearPattern
+				}
+				for k1 := 1; k1 < j-i-1 && year < 0; k1++ {
+					for k2 := k1 + 1; k2 < j-i && year < 0; k2++ {
+						year = getDateYear(token[:k1], token[k1:k2], token[k2:])
+					}
+				}
+				guesses = 1
+			}
+			if year < 0 {
+				continue
+			}
+			guesses *= getYearGuesses(year)
+			if pattern == datePattern {
+				guesses *= 365
+			}
+			matches = append(matches, patternMatch{pattern: pattern, i: i, j: j, token: token, guesses: guesses})
+		}
+	}
+	return matches
+}
+
+func getAllMatches(pwd []rune, userWords map[string]int) []patternMatch {
+	matches := matchDictionary(pwd, userWords)
+	matches = append(matches, matchSpatial(pwd)...)
+	matches = append(matches, matchSequence(pwd)...)
+	matches = append(matches, matchRepeat(pwd, userWords)...)
+	matches = append(matches, matchDate(pwd)...)
+	for i := range matches {
+		minGuesses := float64(minGuessesMultiChar)
+		if matches[i].j-matches[i].i == 1 {
+			minGuesses = minGuessesSingleChar
+		}
+		matches[i].guesses = math.Max(matches[i].guesses, minGuesses)
+	}
+	return matches
+}
+
+func getBruteforceMatch(pwd []rune, i int, j int) patternMatch {
+	guesses := math.Pow(bruteforceCardinality, float64(j-i))
+	if j-i == 1 {
+		guesses = math.Max(guesses, minGuessesSingleChar+1)
+	} else {
+		guesses = math.Max(guesses, minGuessesMultiChar+1)
+	}
+	return patternMatch{pattern: bruteforcePattern, i: i, j: j, token: string(pwd[i:j]), guesses: guesses}
+}
+
+type matchesSequence struct {
+	guesses float64 // the product of the guesses of the matches
+	matches []patternMatch
+}
+
+// Return the minimum number of guesses of the password and the sequence of matches that covers it with this number
+// of guesses: the number of guesses of a sequence of l matches is l! times the product of their guesses
+// (plus a penalty for long sequences, unless excludeAdditive is set)
+func getMinimumGuesses(pwd []rune, userWords map[string]int, excludeAdditive bool) (float64, []patternMatch) {
+	n := len(pwd)
+	if n == 0 {
+		return 1, nil
+	}
+	matchesByEnd := make([][]patternMatch, n+1)
+	for _, m := range getAllMatches(pwd, userWords) {
+		matchesByEnd[m.j] = append(matchesByEnd[m.j], m)
+	}
+	// optimal[k][l] is the sequence of l matches with the minimum guesses that covers the first k characters
+	optimal := make([]map[int]matchesSequence, n+1)
+	optimal[0] = map[int]matchesSequence{0: {guesses: 1}}
+	update := func(prev matchesSequence, l int, m patternMatch) {
+		guesses := prev.guesses * m.guesses
+		if cur, exist := optimal[m.j][l+1]; exist && cur.guesses <= guesses {
+			return
+		}
+		matches := append(append([]patternMatch{}, prev.matches...), m)
+		optimal[m.j][l+1] = matchesSequence{guesses, matches}
+	}
+	for k := 1; k <= n; k++ {
+		optimal[k] = make(map[int]matchesSequence)
+		for _, m := range matchesByEnd[k] {
+			for l, prev := range optimal[m.i] {
+				update(prev, l, m)
+			}
+		}
+		for i := 0; i < k; i++ {
+			m := getBruteforceMatch(pwd, i, k)
+			for l, prev := range optimal[i] {
+				if l > 0 && prev.matches[l-1].pattern == bruteforcePattern {
+					continue
+				}
+				update(prev, l, m)
+			}
+		}
+	}
+	minGuesses := math.Inf(1)
+	var best []patternMatch
+	for l, seq := range optimal[n] {
+		guesses := factorial(l) * seq.guesses
+		if excludeAdditive == false {
+			guesses += math.Pow(minGuessesBeforeGrowing, float64(l-1))
+		}
+		if guesses < minGuesses {
+			minGuesses = guesses
+			best = seq.matches
+		}
+	}
+	return minGuesses, best
+}
+
+func getScore(guesses float64) int {
+	delta := 5.0
+	for score, threshold := range []float64{1e3, 1e6, 1e8, 1e10} {
+		if guesses < threshold+delta {
+			return score
+		}
+	}
+	return MaxStrengthScore
+}
+
+func getMatchFeedback(m patternMatch, isSoleMatch bool) (string, []string) {
+	var suggestions []string
+	warning := ""
+
+	switch m.pattern {
+	case dictionaryPattern:
+		if m.userWord {
+			warning = "Passwords that include your user name or personal information are easy to guess"
+		} else if isSoleMatch && m.reversed == false && m.l33t == false && m.rank <= 10 {
+			warning = "This is a top-10 common password"
+		} else if isSoleMatch && m.reversed == false && m.l33t == false && m.rank <= 100 {
+			warning = "This is a top-100 common password"
+		} else if isSoleMatch {
+			warning = "This is similar to a commonly used password"
+		} else {
+			warning = "A word by itself is easy to guess"
+		}
+		token := []rune(m.token)
+		if unicode.IsUpper(token[0]) {
+			suggestions = append(suggestions, "Capitalization doesn't help very much")
+		} else if strings.ToUpper(m.token) == m.token && strings.ToLower(m.token) != m.token {
+			suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+		}
+		if m.reversed {
+			suggestions = append(suggestions, "Reversed words aren't much harder to guess")
+		}
+		if m.l33t {
+			suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+		}
+	case spatialPattern:
+		warning = "Short keyboard patterns are easy to guess"
+		if m.turns == 1 {
+			warning = "Straight rows of keys are easy to guess"
+		}
+		suggestions = append(suggestions, "Use a longer keyboard pattern with more turns")
+	case repeatPattern:
+		warning = "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\""
+		if m.baseLen == 1 {
+			warning = "Repeats like \"aaa\" are easy to guess"
+		}
+		suggestions = append(suggestions, "Avoid repeated words and characters")
+	case sequencePattern:
+		warning = "Sequences like abc or 6543 are easy to guess"
+		suggestions = append(suggestions, "Avoid sequences")
+	case yearPattern:
+		warning = "Recent years are easy to guess"
+		suggestions = append(suggestions, "Avoid recent years", "Avoid years that are associated with you")
+	case datePattern:
+		warning = "Dates are often easy to guess"
+		suggestions = append(suggestions, "Avoid dates and years that are associated with you")
+	}
+	return warning, suggestions
+}
+
+// Return the feedback of a weak password: the warning and suggestions of its longest match
+func getFeedback(score int, matches []patternMatch) (string, []string) {
+	if len(matches) == 0 {
+		return "", []string{"Use a few words, avoid common phrases", "No need for symbols, digits, or uppercase letters"}
+	}
+	if score > 2 {
+		return "", nil
+	}
+	longest := matches[0]
+	for _, m := range matches[1:] {
+		if m.j-m.i > longest.j-longest.i {
+			longest = m
+		}
+	}
+	warning, suggestions := getMatchFeedback(longest, len(matches) == 1)
+	return warning, append([]string{"Add another word or two. Uncommon words are better"}, suggestions...)
+}
+
+// EstimateStrength : Estimate the strength of the given password, the user inputs (e.g. the user name)
+// are matched as the most guessable dictionary words
+func EstimateStrength(pwd string, userInputs ...string) StrengthEstimate {
+	userWords := make(map[string]int)
+	for i, word := range userInputs {
+		word = strings.ToLower(word)
+		if _, exist := userWords[word]; len(word) > 0 && exist == false {
+			userWords[word] = i + 1
+		}
+	}
+	runes := []rune(pwd)
+	if len(runes) > maxEstimatedLen*maxEstimatedChunks {
+		runes = runes[:maxEstimatedLen*maxEstimatedChunks]
+	}
+	if period := getRepeatPeriod(runes); period > 0 {
+		guesses, _ := getMinimumGuesses(runes[:period], userWords, false)
+		m := patternMatch{pattern: repeatPattern, i: 0, j: len(runes), token: string(runes), baseLen: period,
+			guesses: guesses * float64(len(runes)/period)}
+		return newStrengthEstimate(math.Log10(m.guesses), []patternMatch{m})
+	}
+	// each chunk is estimated by the same matchers, a chunk that is repeated is estimated once and
+	// its repetitions only multiply its guesses (as a repeat pattern)
+	var matches []patternMatch
+	chunksCount := make(map[string]int)
+	guessesLog10 := 0.0
+	for i := 0; i < len(runes); i += maxEstimatedLen {
+		chunk := runes[i:minInt(i+maxEstimatedLen, len(runes))]
+		chunksCount[string(chunk)]++
+		if chunksCount[string(chunk)] > 1 {
+			continue
+		}
+		guesses, chunkMatches := getMinimumGuesses(chunk, userWords, i > 0)
+		guessesLog10 += math.Log10(guesses)
+		matches = append(matches, chunkMatches...)
+	}
+	for _, cnt := range chunksCount {
+		guessesLog10 += math.Log10(float64(cnt))
+	}
+	return newStrengthEstimate(guessesLog10, matches)
+}
+
+func newStrengthEstimate(guessesLog10 float64, matches []patternMatch) StrengthEstimate {
+	guessesLog10 = math.Min(guessesLog10, maxGuessesLog10)
+	score := getScore(math.Pow(10, guessesLog10))
+	warning, suggestions := getFeedback(score, matches)
+	return StrengthEstimate{Score: score, GuessesLog10: guessesLog10, Warning: warning, Suggestions: suggestions}
+}
+
+// Return the length of the shortest substring (up to maxEstimatedLen characters) that the whole password is
+// a repeat of (the last repetition may be partial), 0 if the password is not a repeat
+func getRepeatPeriod(pwd []rune) int {
+	for period := 1; period <= maxEstimatedLen && period*2 <= len(pwd); period++ {
+		i := period
+		for i < len(pwd) && pwd[i] == pwd[i-period] {
+			i++
+		}
+		if i == len(pwd) {
+			return period
+		}
+	}
+	return 0
+}
+
+func (e StrengthEstimate) String() string {
+	str := fmt.Sprintf("Score: %v (guesses: 10^%.1f)", e.Score, e.GuessesLog10)
+	if len(e.Warning) > 0 {
+		str += fmt.Sprintf(", warning: %v", e.Warning)
+	}
+	if len(e.Suggestions) > 0 {
+		str += fmt.Sprintf(", suggestions: %v", strings.Join(e.Suggestions, ". "))
+	}
+	return str
+}
@@ -0,0 +1,84 @@
+package password
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Verify that passwords that are built of common patterns get low scores with a warning and suggestions
+// and that unguessable passwords get high scores without them
+func Test_estimateStrength(t *testing.T) {
+	weak := map[string]string{
+		"password":     "This is a top-10 common password",
+		"P@ssw0rd":     "This is similar to a commonly used password",
+		"drowssap":     "This is similar to a commonly used password",
+		"abcdefgh":     "Sequences like abc or 6543 are easy to guess",
+		"aaaaaaaaaa":   "Repeats like \"aaa\" are easy to guess",
+		"abcabcabcabc": "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\"",
+		"12/31/1990":   "Dates are often easy to guess",
+		"zxcvfrewq":    "Short keyboard patterns are easy to guess",
+		"Alice1990":    "Passwords that include your user name or personal information are easy to guess",
+	}
+	for pwd, warning := range weak {
+		e := EstimateStrength(pwd, "Alice")
+		if e.Score > 1 || e.Warning != warning || len(e.Suggestions) == 0 {
+			t.Errorf("Test fail: the estimate of the weak password '%v': %v is not as expected, warning: '%v'", pwd, e, warning)
+		}
+	}
+	for _, pwd := range []string{"correcthorsebatterystaple", "xK9#mQ2$vL7p"} {
+		e := EstimateStrength(pwd)
+		if e.Score != MaxStrengthScore || len(e.Warning) > 0 || len(e.Suggestions) > 0 {
+			t.Errorf("Test fail: the estimate of the strong password '%v': %v is not as expected", pwd, e)
+		}
+	}
+	if EstimateStrength("Alice1990").Score <= EstimateStrength("Alice1990", "alice").Score {
+		t.Errorf("Test fail: the user inputs were not used to estimate the password strength")
+	}
+}
+
+// Verify that the repeats of long passwords are estimated as repeats (and not as brute force characters)
+// and that the estimate of very long passwords is finite and can be marshaled
+func Test_estimateLongPasswordStrength(t *testing.T) {
+	for _, pwd := range []string{strings.Repeat("ab", 40), strings.Repeat("1", 1000), strings.Repeat("abc", 200), strings.Repeat("password", 100000)} {
+		e := EstimateStrength(pwd)
+		_, err := json.Marshal(e)
+		if e.Score > 1 || math.IsInf(e.GuessesLog10, 0) || err != nil {
+			t.Errorf("Test fail: the estimate of the long repeated password (%v characters): %v is not as expected, error: %v", len(pwd), e, err)
+		}
+	}
+	var pwd []byte
+	for i := 0; i < 10000; i++ {
+		pwd = append(pwd, byte('!'+(i*i*7+i*13)%94))
+	}
+	e := EstimateStrength(string(pwd))
+	_, err := json.Marshal(e)
+	if e.Score != MaxStrengthScore || e.GuessesLog10 > maxGuessesLog10 || err != nil {
+		t.Errorf("Test fail: the estimate of the long password: %v is not as expected, error: %v", e, err)
+	}
+}
+
+// Verify that a policy with a minimum strength score checks the score instead of the character classes
+func Test_policyStrengthScore(t *testing.T) {
+	policy := NewDefaultPasswordPolicy()
+	policy.MinStrengthScore = 3
+
+	if policy.CheckStrength("Password1#") == nil {
+		t.Errorf("Test fail: the password 'Password1#' with a low strength score was accepted by the policy %v", policy)
+	}
+	if policy.CheckStrength("correcthorsebatterystaple") != nil {
+		t.Errorf("Test fail: the strong password 'correcthorsebatterystaple' was rejected by the policy %v", policy)
+	}
+	for i := 0; i < 10; i++ {
+		pwd := generatePolicyValidPassword(policy)
+		err := policy.CheckStrength(string(pwd))
+		if err != nil {
+			t.Errorf("Test fail: the generated password '%v' does not adhere to the policy %v, error: %v", string(pwd), policy, err)
+		}
+	}
+	policy.MinStrengthScore = MaxStrengthScore + 1
+	if policy.IsValid() == nil {
+		t.Errorf("Test fail: the illegal policy %v was accepted", policy)
+	}
+}
@@ -0,0 +1,346 @@
+package password
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	"github.com/ibm-security-innovation/libsecurity-go/salt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The stored passwords are hashed using a slow, salted password hashing algorithm and encoded as self describing PHC strings
+// ($algorithm$parameters$salt$hash), so passwords that were hashed using different algorithms or costs can be verified.
+// Passwords that were stored before (a SHA-256 of the salted password) are still verified, they are re-hashed
+// using the configured algorithm when they are matched. The password may be mixed with a server side pepper before
+// it is hashed (see passwordPepper.go)
+
+const (
+	// BcryptAlgorithm : bcrypt password hashing, its cost is log2 of the number of iterations
+	BcryptAlgorithm = "bcrypt"
+	// ScryptAlgorithm : scrypt password hashing, its cost is log2 of the CPU/memory cost (N)
+	ScryptAlgorithm = "scrypt"
+	// Argon2idAlgorithm : Argon2id password hashing
+	Argon2idAlgorithm = "argon2id"
+	// Pbkdf2Sha256Algorithm : PBKDF2 with HMAC-SHA256 password hashing
+	Pbkdf2Sha256Algorithm = "pbkdf2-sha256"
+	// LegacyAlgorithm : a single SHA-256 of the salted password, used only to verify passwords that were stored before
+	LegacyAlgorithm = "sha256"
+	// DefaultHashAlgorithm : the default password hashing algorithm of new passwords
+	DefaultHashAlgorithm = Argon2idAlgorithm
+
+	hashSaltLen = 16
+	hashLen     = 32
+
+	maxHashIterations  = 1 << 24
+	maxHashMemory      = 4 * 1024 * 1024 // KiB
+	maxHashParallelism = 255
+	maxScryptLogCost   = 24
+)
+
+var (
+	hashLock      sync.Mutex
+	hashParams, _ = NewHashParams(DefaultHashAlgorithm)
+	dummyHashed   []byte // hashed using dummyParams, to verify passwords of unknown users
+	dummyParams   HashParams
+	dummyPepper   int
+
+	phcEncoding = base64.RawStdEncoding
+)
+
+// HashParams : the password hashing algorithm and its cost parameters.
+// Iterations is the bcrypt cost, the scrypt cost (log2 of N), the number of Argon2id passes or the number of PBKDF2 iterations,
+// Memory is the Argon2id memory size in KiB, BlockSize is the scrypt block size (r) and
+// Parallelism is the number of Argon2id threads or the scrypt parallelization (p)
+type HashParams struct {
+	Algorithm   string
+	Iterations  int
+	Memory      int
+	BlockSize   int
+	Parallelism int
+}
+
+func (p HashParams) String() string {
+	return fmt.Sprintf("Algorithm: %v, iterations: %v, memory: %v, block size: %v, parallelism: %v",
+		p.Algorithm, p.Iterations, p.Memory, p.BlockSize, p.Parallelism)
+}
+
+// NewHashParams : Return the default (recommended) parameters of the given password hashing algorithm
+func NewHashParams(algorithm string) (HashParams, error) {
+	switch algorithm {
+	case BcryptAlgorithm:
+		return HashParams{Algorithm: algorithm, Iterations: 10}, nil
+	case ScryptAlgorithm:
+		return HashParams{Algorithm: algorithm, Iterations: 15, BlockSize: 8, Parallelism: 1}, nil
+	case Argon2idAlgorithm:
+		return HashParams{Algorithm: algorithm, Iterations: 2, Memory: 19 * 1024, Parallelism: 1}, nil
+	case Pbkdf2Sha256Algorithm:
+		return HashParams{Algorithm: algorithm, Iterations: 600000}, nil
+	}
+	return HashParams{}, fmt.Errorf("The password hashing algorithm '%v' is not supported, the supported algorithms are: '%v', '%v', '%v', '%v'",
+		algorithm, BcryptAlgorithm, ScryptAlgorithm, Argon2idAlgorithm, Pbkdf2Sha256Algorithm)
+}
+
+func (p HashParams) isValid() error {
+	switch p.Algorithm {
+	case BcryptAlgorithm:
+		if p.Iterations < bcrypt.MinCost || p.Iterations > bcrypt.MaxCost {
+			return fmt.Errorf("The bcrypt cost %v must be between %v and %v", p.Iterations, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return nil
+	case ScryptAlgorithm:
+		if p.Iterations < 1 || p.Iterations > maxScryptLogCost {
+			return fmt.Errorf("The scrypt cost %v must be between 1 and %v", p.Iterations, maxScryptLogCost)
+		}
+		if p.BlockSize < 1 || p.Parallelism < 1 || p.Parallelism > maxHashParallelism {
+			return fmt.Errorf("The scrypt block size %v must be at least 1 and the parallelization %v must be between 1 and %v",
+				p.BlockSize, p.Parallelism, maxHashParallelism)
+		}
+		if p.BlockSize > maxHashMemory*1024/128>>uint(p.Iterations) {
+			return fmt.Errorf("The scrypt memory (cost %v, block size %v) must be at most %v KiB", p.Iterations, p.BlockSize, maxHashMemory)
+		}
+		return nil
+	case Argon2idAlgorithm:
+		if p.Parallelism < 1 || p.Parallelism > maxHashParallelism {
+			return fmt.Errorf("The Argon2id parallelism %v must be between 1 and %v", p.Parallelism, maxHashParallelism)
+		}
+		if p.Memory < 8*p.Parallelism || p.Memory > maxHashMemory {
+			return fmt.Errorf("The Argon2id memory %v KiB must be at least 8 KiB per thread and at most %v KiB", p.Memory, maxHashMemory)
+		}
+	case Pbkdf2Sha256Algorithm:
+	default:
+		_, err := NewHashParams(p.Algorithm)
+		return err
+	}
+	if p.Iterations < 1 || p.Iterations > maxHashIterations {
+		return fmt.Errorf("The number of iterations %v must be between 1 and %v", p.Iterations, maxHashIterations)
+	}
+	return nil
+}
+
+// SetHashParams : Set the password hashing algorithm and parameters that are used for new passwords,
+// the stored passwords that were hashed using other parameters are re-hashed when they are matched
+func SetHashParams(p HashParams) error {
+	err := p.isValid()
+	if err != nil {
+		return err
+	}
+	hashLock.Lock()
+	defer hashLock.Unlock()
+	hashParams = p
+	return nil
+}
+
+// GetHashParams : Return the password hashing algorithm and parameters that are used for new passwords
+func GetHashParams() HashParams {
+	hashLock.Lock()
+	defer hashLock.Unlock()
+	return hashParams
+}
+
+// GetHashedPwd : Return the hash of the given (salted) password that is used to verify it: a SHA-256 of the password.
+// The stored password is the PHC string of this hash using the configured password hashing algorithm
+func GetHashedPwd(pwd []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write(pwd)
+	return hasher.Sum(nil)
+}
+
+func deriveHash(pwd []byte, saltData []byte, p HashParams) ([]byte, error) {
+	switch p.Algorithm {
+	case ScryptAlgorithm:
+		return scrypt.Key(pwd, saltData, 1<<uint(p.Iterations), p.BlockSize, p.Parallelism, hashLen)
+	case Argon2idAlgorithm:
+		return argon2.IDKey(pwd, saltData, uint32(p.Iterations), uint32(p.Memory), uint8(p.Parallelism), hashLen), nil
+	case Pbkdf2Sha256Algorithm:
+		return pbkdf2.Key(pwd, saltData, p.Iterations, hashLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("The password hashing algorithm '%v' is not supported", p.Algorithm)
+}
+
+// Return the PHC string parameters part of the given parameters
+func (p HashParams) getPhcParams() string {
+	switch p.Algorithm {
+	case ScryptAlgorithm:
+		return fmt.Sprintf("ln=%v,r=%v,p=%v", p.Iterations, p.BlockSize, p.Parallelism)
+	case Argon2idAlgorithm:
+		return fmt.Sprintf("v=%v$m=%v,t=%v,p=%v", argon2.Version, p.Memory, p.Iterations, p.Parallelism)
+	}
+	return fmt.Sprintf("i=%v", p.Iterations)
+}
+
+// Hash the given password using a random salt, the given parameters and the current pepper (if set)
+// and return it encoded as a PHC string
+func hashPwd(pwd []byte, p HashParams) ([]byte, error) {
+	err := p.isValid()
+	if err != nil {
+		return nil, err
+	}
+	version := GetPepperVersion()
+	pwd, err = getPepperedPwd(pwd, version)
+	if err != nil {
+		return nil, err
+	}
+	if p.Algorithm == BcryptAlgorithm {
+		hashed, err := bcrypt.GenerateFromPassword(pwd, p.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		return addPepperVersion(hashed, version), nil
+	}
+	saltData, err := salt.GetRandomSalt(hashSaltLen)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := deriveHash(pwd, saltData, p)
+	if err != nil {
+		return nil, err
+	}
+	hashed := fmt.Sprintf("$%v$%v$%v$%v", p.Algorithm, p.getPhcParams(), phcEncoding.EncodeToString(saltData), phcEncoding.EncodeToString(hash))
+	return addPepperVersion([]byte(hashed), version), nil
+}
+
+// Parse the comma separated name=value parameters of a PHC string into the given values
+func parsePhcParams(str string, values map[string]*int) error {
+	for _, param := range strings.Split(str, ",") {
+		nameValue := strings.SplitN(param, "=", 2)
+		if len(nameValue) != 2 || values[nameValue[0]] == nil {
+			return fmt.Errorf("The parameter '%v' is not valid", param)
+		}
+		val, err := strconv.Atoi(nameValue[1])
+		if err != nil {
+			return fmt.Errorf("The parameter '%v' is not valid", param)
+		}
+		*values[nameValue[0]] = val
+	}
+	return nil
+}
+
+// Return the parameters, the salt and the hash of the given PHC string
+func parsePhcString(hashed []byte) (HashParams, []byte, []byte, error) {
+	var p HashParams
+
+	str := string(hashed)
+	if strings.HasPrefix(str, "$2a$") || strings.HasPrefix(str, "$2b$") || strings.HasPrefix(str, "$2y$") {
+		cost, err := bcrypt.Cost(hashed)
+		return HashParams{Algorithm: BcryptAlgorithm, Iterations: cost}, nil, nil, err
+	}
+	fields := strings.Split(str, "$")
+	if len(fields) < 5 || len(fields[0]) != 0 {
+		return p, nil, nil, fmt.Errorf("The hashed password is not a valid PHC string")
+	}
+	p.Algorithm = fields[1]
+	params := fields[2]
+	if p.Algorithm == Argon2idAlgorithm {
+		if len(fields) != 6 || fields[2] != fmt.Sprintf("v=%v", argon2.Version) {
+			return p, nil, nil, fmt.Errorf("The Argon2id version of the hashed password is not supported")
+		}
+		fields = append(fields[:2], fields[3:]...)
+		params = fields[2]
+	}
+	if len(fields) != 5 {
+		return p, nil, nil, fmt.Errorf("The hashed password is not a valid PHC string")
+	}
+	var err error
+	switch p.Algorithm {
+	case ScryptAlgorithm:
+		err = parsePhcParams(params, map[string]*int{"ln": &p.Iterations, "r": &p.BlockSize, "p": &p.Parallelism})
+	case Argon2idAlgorithm:
+		err = parsePhcParams(params, map[string]*int{"m": &p.Memory, "t": &p.Iterations, "p": &p.Parallelism})
+	default:
+		err = parsePhcParams(params, map[string]*int{"i": &p.Iterations})
+	}
+	if err == nil {
+		err = p.isValid()
+	}
+	if err != nil {
+		return p, nil, nil, err
+	}
+	saltData, err := phcEncoding.DecodeString(fields[3])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	hash, err := phcEncoding.DecodeString(fields[4])
+	return p, saltData, hash, err
+}
+
+// GetPwdHashParams : Return the password hashing algorithm and parameters of the given stored password
+func GetPwdHashParams(hashed []byte) (HashParams, error) {
+	if isLegacyHashedPwd(hashed) {
+		return HashParams{Algorithm: LegacyAlgorithm}, nil
+	}
+	_, hashed, err := splitPepperVersion(hashed)
+	if err != nil {
+		return HashParams{}, err
+	}
+	p, _, _, err := parsePhcString(hashed)
+	return p, err
+}
+
+// GetPwdPepperVersion : Return the pepper version of the given stored password, 0 if it was hashed without a pepper
+func GetPwdPepperVersion(hashed []byte) int {
+	version, _, _ := splitPepperVersion(hashed)
+	return version
+}
+
+// The passwords that were stored before are the SHA-256 of the salted password, PHC strings are longer
+func isLegacyHashedPwd(hashed []byte) bool {
+	return len(hashed) == sha256.Size
+}
+
+// Verify that the given password matches the stored one, in constant time
+func verifyPwd(pwd []byte, hashed []byte) bool {
+	defs.TimingAttackSleep(0, noiseRandomMiliSec)
+	if isLegacyHashedPwd(hashed) {
+		return subtle.ConstantTimeCompare(pwd, hashed) == 1
+	}
+	version, hashed, err := splitPepperVersion(hashed)
+	if err != nil {
+		return false
+	}
+	pwd, err = getPepperedPwd(pwd, version)
+	if err != nil {
+		return false
+	}
+	p, saltData, hash, err := parsePhcString(hashed)
+	if err != nil {
+		return false
+	}
+	if p.Algorithm == BcryptAlgorithm {
+		return bcrypt.CompareHashAndPassword(hashed, pwd) == nil
+	}
+	calc, err := deriveHash(pwd, saltData, p)
+	return err == nil && subtle.ConstantTimeCompare(calc, hash) == 1
+}
+
+// VerifyDummyPwd : Verify the given password against a dummy hashed password that uses the current hashing parameters.
+// It should be called when the user is not found, so that the response time does not reveal whether the user exists
+func VerifyDummyPwd(pwd []byte) {
+	p := GetHashParams()
+	version := GetPepperVersion()
+	hashLock.Lock()
+	hashed := dummyHashed
+	if dummyParams != p || dummyPepper != version {
+		hashed, _ = hashPwd(GetHashedPwd([]byte("dummy")), p)
+		dummyHashed = hashed
+		dummyParams = p
+		dummyPepper = version
+	}
+	hashLock.Unlock()
+	verifyPwd(pwd, hashed)
+}
+
+// Check if the stored password should be re-hashed: it was hashed using other parameters or another pepper version
+// than the current ones
+func isRehashNeeded(hashed []byte) bool {
+	p, err := GetPwdHashParams(hashed)
+	return err == nil && (p != GetHashParams() || GetPwdPepperVersion(hashed) != GetPepperVersion())
+}
@@ -0,0 +1,133 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+var testHashParams = []HashParams{
+	{Algorithm: BcryptAlgorithm, Iterations: 4},
+	{Algorithm: ScryptAlgorithm, Iterations: 10, BlockSize: 8, Parallelism: 1},
+	{Algorithm: Argon2idAlgorithm, Iterations: 1, Memory: 1024, Parallelism: 2},
+	{Algorithm: Pbkdf2Sha256Algorithm, Iterations: 1000},
+}
+
+// Verify that passwords hashed using each of the algorithms are encoded as PHC strings
+// and that only the same password matches them
+func Test_hashVerifyPwd(t *testing.T) {
+	pwd := getPwdHash(defaultPassword, defaultSaltStr)
+	wrongPwd := getPwdHash([]byte(string(defaultPassword)+"a"), defaultSaltStr)
+
+	for _, p := range testHashParams {
+		hashed, err := hashPwd(pwd, p)
+		if err != nil {
+			t.Fatalf("Test fail: can't hash the password using %v, error: %v", p, err)
+		}
+		if strings.HasPrefix(string(hashed), "$") == false {
+			t.Errorf("Test fail: the hashed password '%v' is not a PHC string", string(hashed))
+		}
+		p1, err := GetPwdHashParams(hashed)
+		if err != nil || p1 != p {
+			t.Errorf("Test fail: the parameters %v of the hashed password '%v' are not as expected %v, error: %v", p1, string(hashed), p, err)
+		}
+		if verifyPwd(pwd, hashed) == false {
+			t.Errorf("Test fail: the password was not matched using %v", p)
+		}
+		if verifyPwd(wrongPwd, hashed) == true {
+			t.Errorf("Test fail: a wrong password was matched using %v", p)
+		}
+		hashed1, _ := hashPwd(pwd, p)
+		if string(hashed) == string(hashed1) {
+			t.Errorf("Test fail: the same password was hashed twice to the same value using %v", p)
+		}
+	}
+}
+
+// Verify that a legacy password is matched and re-hashed using the current parameters
+// and that the current password is re-hashed when the parameters are changed
+func Test_rehashPwdOnMatch(t *testing.T) {
+	defaultParams := GetHashParams()
+	defer SetHashParams(defaultParams)
+
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	pwd := getPwdHash(defaultPassword, user.Salt)
+	user.Password = pwd
+	err := user.IsPasswordMatch(pwd)
+	if err != nil {
+		t.Fatalf("Test fail: the legacy password was not matched, error: %v", err)
+	}
+	p, _ := GetPwdHashParams(user.Password)
+	if p != defaultParams {
+		t.Errorf("Test fail: the legacy password was not re-hashed, its parameters: %v, expected: %v", p, defaultParams)
+	}
+	SetHashParams(testHashParams[0])
+	err = user.IsPasswordMatch(pwd)
+	p, _ = GetPwdHashParams(user.Password)
+	if err != nil || p != testHashParams[0] {
+		t.Errorf("Test fail: the password was not re-hashed using the new parameters %v, its parameters: %v, error: %v", testHashParams[0], p, err)
+	}
+	err = user.IsPasswordMatch(pwd)
+	if err != nil {
+		t.Errorf("Test fail: the re-hashed password was not matched, error: %v", err)
+	}
+}
+
+// Verify that the old passwords are rejected even if they were hashed using different algorithms
+func Test_oldPasswordsAcrossAlgorithms(t *testing.T) {
+	defaultParams := GetHashParams()
+	defer SetHashParams(defaultParams)
+
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	user.Password = getPwdHash(defaultPassword, user.Salt) // a legacy password
+	current := defaultPassword
+	for i, p := range testHashParams {
+		SetHashParams(p)
+		pwd := []byte(string(defaultPassword) + strings.Repeat("a", i+1))
+		_, err := user.UpdatePassword(getPwdHash(current, user.Salt), pwd, true)
+		if err != nil {
+			t.Fatalf("Test fail: can't update the password using %v, error: %v", p, err)
+		}
+		current = pwd
+	}
+	_, err := user.UpdatePassword(getPwdHash(current, user.Salt), defaultPassword, true)
+	if err == nil {
+		t.Errorf("Test fail: the legacy old password was accepted")
+	}
+	for i := range testHashParams[:len(testHashParams)-1] {
+		pwd := []byte(string(defaultPassword) + strings.Repeat("a", i+1))
+		_, err := user.UpdatePassword(getPwdHash(current, user.Salt), pwd, true)
+		if err == nil {
+			t.Errorf("Test fail: the old password that was hashed using %v was accepted", testHashParams[i])
+		}
+	}
+}
+
+// Verify that illegal hashing parameters and hashed passwords are rejected
+func Test_hashParamsCorners(t *testing.T) {
+	params := []HashParams{
+		{Algorithm: "md5", Iterations: 1},
+		{Algorithm: BcryptAlgorithm, Iterations: 2},
+		{Algorithm: ScryptAlgorithm, Iterations: 10, BlockSize: 0, Parallelism: 1},
+		{Algorithm: ScryptAlgorithm, Iterations: maxScryptLogCost, BlockSize: 8, Parallelism: 1},
+		{Algorithm: Argon2idAlgorithm, Iterations: 1, Memory: 8, Parallelism: 2},
+		{Algorithm: Pbkdf2Sha256Algorithm, Iterations: 0},
+	}
+	for _, p := range params {
+		err := SetHashParams(p)
+		if err == nil {
+			t.Errorf("Test fail: the illegal hashing parameters %v were accepted", p)
+		}
+	}
+	for _, name := range []string{BcryptAlgorithm, ScryptAlgorithm, Argon2idAlgorithm, Pbkdf2Sha256Algorithm} {
+		p, err := NewHashParams(name)
+		if err != nil || p.isValid() != nil {
+			t.Errorf("Test fail: the default parameters of '%v': %v are not valid, error: %v", name, p, err)
+		}
+	}
+	pwd := getPwdHash(defaultPassword, defaultSaltStr)
+	for _, hashed := range []string{"", "$pbkdf2-sha256$i=0$c2FsdA$aGFzaA", "$argon2id$v=1$m=1024,t=1,p=1$c2FsdA$aGFzaA", "$pbkdf2-sha256$x=1000$c2FsdA$aGFzaA"} {
+		if verifyPwd(pwd, []byte(hashed)) {
+			t.Errorf("Test fail: the password was matched to the illegal hashed password '%v'", hashed)
+		}
+	}
+}
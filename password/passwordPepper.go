@@ -0,0 +1,120 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+// A pepper is a server side secret that is kept outside of the storage file (e.g. in a file that is read like the
+// secure key file), so the stored password hashes can't be attacked using the storage file alone.
+// When peppers are set, the password is mixed with the pepper of the highest version (HMAC-SHA256 keyed by the pepper)
+// before it is hashed, and the hashed password is prefixed by the pepper version: $pepper$v=<version><PHC string>.
+// Several pepper versions may be set so the pepper can be rotated: passwords that were hashed using an older pepper
+// version (or without a pepper) are re-hashed using the current pepper when they are matched
+
+const (
+	pepperPrefix = "$pepper$v="
+
+	minPepperLen = 16
+)
+
+var (
+	pepperLock sync.Mutex
+	peppers    map[int][]byte
+	pepperVer  int // the highest pepper version, 0 if no pepper is set
+)
+
+// SetPeppers : Set the peppers by their versions (starting at 1), the pepper of the highest version is used for new
+// hashes and the others are used to verify passwords that were hashed using them. nil to stop using peppers
+func SetPeppers(newPeppers map[int][]byte) error {
+	version := 0
+	for v, pepper := range newPeppers {
+		if v < 1 {
+			return fmt.Errorf("The pepper version %v must be at least 1", v)
+		}
+		if len(pepper) < minPepperLen {
+			return fmt.Errorf("The pepper of version %v must be at least %v bytes long", v, minPepperLen)
+		}
+		if v > version {
+			version = v
+		}
+	}
+	pepperLock.Lock()
+	defer pepperLock.Unlock()
+	peppers = make(map[int][]byte)
+	for v, pepper := range newPeppers {
+		peppers[v] = append([]byte{}, pepper...)
+	}
+	pepperVer = version
+	return nil
+}
+
+// LoadPeppers : Read the pepper files (by their versions) using the same mechanism as the secure key file
+// (storage.GetSecureKey) and set them as the peppers
+func LoadPeppers(fileNames map[int]string) error {
+	newPeppers := make(map[int][]byte)
+	for v, fileName := range fileNames {
+		newPeppers[v] = ss.GetSecureKey(fileName)
+	}
+	return SetPeppers(newPeppers)
+}
+
+// GetPepperVersion : Return the pepper version that is used for new hashes, 0 if no pepper is set
+func GetPepperVersion() int {
+	pepperLock.Lock()
+	defer pepperLock.Unlock()
+	return pepperVer
+}
+
+func getPepper(version int) ([]byte, bool) {
+	pepperLock.Lock()
+	defer pepperLock.Unlock()
+	pepper, exist := peppers[version]
+	return pepper, exist
+}
+
+// Return the password mixed with the pepper of the given version, version 0 means no pepper
+func getPepperedPwd(pwd []byte, version int) ([]byte, error) {
+	if version == 0 {
+		return pwd, nil
+	}
+	pepper, exist := getPepper(version)
+	if exist == false {
+		return nil, fmt.Errorf("The pepper of version %v is not set", version)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(pwd)
+	return mac.Sum(nil), nil
+}
+
+// Return the pepper version of the hashed password and the hashed password without the pepper prefix
+func splitPepperVersion(hashed []byte) (int, []byte, error) {
+	str := string(hashed)
+	if strings.HasPrefix(str, pepperPrefix) == false {
+		return 0, hashed, nil
+	}
+	str = str[len(pepperPrefix):]
+	idx := strings.Index(str, "$")
+	if idx < 0 {
+		return 0, nil, fmt.Errorf("The hashed password is not a valid PHC string")
+	}
+	version, err := strconv.Atoi(str[:idx])
+	if err != nil || version < 1 {
+		return 0, nil, fmt.Errorf("The pepper version '%v' of the hashed password is not valid", str[:idx])
+	}
+	return version, []byte(str[idx:]), nil
+}
+
+// Add the pepper prefix of the given version to the hashed password
+func addPepperVersion(hashed []byte, version int) []byte {
+	if version == 0 {
+		return hashed
+	}
+	return []byte(fmt.Sprintf("%v%v%v", pepperPrefix, version, string(hashed)))
+}
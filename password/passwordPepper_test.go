@@ -0,0 +1,114 @@
+package password
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	pepperFileName = "./tmpPepper"
+)
+
+var (
+	testPepper1 = []byte("0123456789abcdef-pepper-1")
+	testPepper2 = []byte("0123456789abcdef-pepper-2")
+)
+
+// Verify that illegal pepper versions and peppers are rejected
+func Test_pepperCorners(t *testing.T) {
+	defer SetPeppers(nil)
+
+	illegal := []map[int][]byte{{0: testPepper1}, {-1: testPepper1}, {1: testPepper1, 2: []byte("short")}}
+	for _, p := range illegal {
+		if SetPeppers(p) == nil {
+			t.Errorf("Test fail: the illegal peppers %v were accepted", p)
+		}
+	}
+	for _, hashed := range []string{"$pepper$v=0$pbkdf2-sha256$i=1000$abcd$abcd", "$pepper$v=a$pbkdf2-sha256$i=1000$abcd$abcd", "$pepper$v=1"} {
+		if _, err := GetPwdHashParams([]byte(hashed)); err == nil {
+			t.Errorf("Test fail: the illegal hashed password '%v' was accepted", hashed)
+		}
+	}
+}
+
+// Verify that when a pepper is set, the password is hashed using it, it matches only when the pepper is set
+// and that the pepper of each version is used to verify the passwords that were hashed using it
+func Test_hashVerifyPepperedPwd(t *testing.T) {
+	defer SetPeppers(nil)
+	pwd := getPwdHash(defaultPassword, defaultSaltStr)
+
+	for _, p := range testHashParams {
+		SetPeppers(map[int][]byte{1: testPepper1})
+		hashed, err := hashPwd(pwd, p)
+		if err != nil {
+			t.Fatalf("Test fail: can't hash the password using %v, error: %v", p, err)
+		}
+		if strings.HasPrefix(string(hashed), pepperPrefix+"1$") == false || GetPwdPepperVersion(hashed) != 1 {
+			t.Errorf("Test fail: the hashed password '%v' does not include the pepper version 1", string(hashed))
+		}
+		p1, err := GetPwdHashParams(hashed)
+		if err != nil || p1 != p {
+			t.Errorf("Test fail: the parameters %v of the hashed password '%v' are not as expected %v, error: %v", p1, string(hashed), p, err)
+		}
+		if verifyPwd(pwd, hashed) == false {
+			t.Errorf("Test fail: the peppered password was not matched using %v", p)
+		}
+		SetPeppers(map[int][]byte{1: testPepper2})
+		if verifyPwd(pwd, hashed) == true {
+			t.Errorf("Test fail: the peppered password was matched using a different pepper using %v", p)
+		}
+		SetPeppers(map[int][]byte{2: testPepper1})
+		if verifyPwd(pwd, hashed) == true {
+			t.Errorf("Test fail: the peppered password was matched when its pepper version was not set using %v", p)
+		}
+		SetPeppers(nil)
+		if verifyPwd(pwd, hashed) == true {
+			t.Errorf("Test fail: the peppered password was matched without a pepper using %v", p)
+		}
+	}
+}
+
+// Verify that the password is re-hashed using the current pepper when the user logs in after the pepper was rotated
+func Test_rehashPepperRotation(t *testing.T) {
+	defer SetPeppers(nil)
+
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	pwd := getPwdHash(defaultPassword, user.Salt)
+	peppers := []map[int][]byte{{1: testPepper1}, {1: testPepper1, 2: testPepper2}}
+	for i, p := range peppers {
+		SetPeppers(p)
+		err := user.IsPasswordMatch(pwd)
+		if err != nil {
+			t.Fatalf("Test fail: the password was not matched after the pepper version %v was set, error: %v", i+1, err)
+		}
+		if GetPwdPepperVersion(user.Password) != i+1 {
+			t.Errorf("Test fail: the password '%v' was not re-hashed using the pepper version %v", string(user.Password), i+1)
+		}
+	}
+	SetPeppers(map[int][]byte{2: testPepper2})
+	err := user.IsPasswordMatch(pwd)
+	if err != nil {
+		t.Errorf("Test fail: the password was not matched after the old pepper was removed, error: %v", err)
+	}
+}
+
+// Verify that the pepper files are loaded like the secure key file
+func Test_loadPeppers(t *testing.T) {
+	defer SetPeppers(nil)
+	defer os.Remove(pepperFileName)
+
+	ioutil.WriteFile(pepperFileName, testPepper1, 0600)
+	err := LoadPeppers(map[int]string{3: pepperFileName})
+	if err != nil {
+		t.Fatalf("Test fail: can't load the pepper file '%v', error: %v", pepperFileName, err)
+	}
+	if GetPepperVersion() != 3 {
+		t.Errorf("Test fail: the pepper version is %v instead of 3", GetPepperVersion())
+	}
+	hashed, _ := hashPwd(getPwdHash(defaultPassword, defaultSaltStr), GetHashParams())
+	if GetPwdPepperVersion(hashed) != 3 {
+		t.Errorf("Test fail: the hashed password '%v' does not include the pepper version 3", string(hashed))
+	}
+}
@@ -0,0 +1,388 @@
+package password
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A password policy defines the rules of the passwords: their length, the character classes they must include
+// (or instead of them, the minimum score of the password strength estimator), how many old passwords can't be reused,
+// their expiration, the lockout after wrong attempts and the lifetime of temporary passwords. Policies may be attached to groups: the effective policy of a user is
+// the strictest combination of the policies of all the groups the user is a member of, or the default policy
+// if none of them has a policy.
+// A policy may switch to the NIST SP 800-63B mode: there are no character classes rules and no periodic expiration,
+// the passwords may include any Unicode character and are normalized using NFKC (their length is the number of
+// characters, up to at least nistMaxLength), they are screened against the blocklist and after the maximum attempts
+// the wrong attempts are rate limited instead of blocking the password until it is reset.
+// The lockout: after MaxAttempts consecutive wrong attempts the password is locked for LockoutSeconds, each further
+// wrong attempt doubles the lock duration (up to MaxLockoutSeconds) and the password is automatically unlocked when the
+// lock duration is over. After HardLockAttempts consecutive wrong attempts (or after MaxAttempts if LockoutSeconds is 0)
+// the password is hard locked: it can't be used until it is reset
+
+const (
+	// MaxHistoryDepth : the maximum number of old passwords that a policy can keep to avoid their reuse
+	MaxHistoryDepth = 24
+
+	defaultMinUpperCase  = 1
+	defaultMinLowerCase  = 1
+	defaultMinDigits     = 1
+	defaultMinExtraChars = 1
+
+	defaultLockoutSeconds    = 60
+	defaultMaxLockoutSeconds = 60 * 60
+	defaultHardLockAttempts  = 0 // never: a hard lock by default lets anyone lock out any user (including root) until it is reset
+
+	nistMinLength = 8
+	nistMaxLength = 64
+
+	// NistModeName : The name of the NIST SP 800-63B mode
+	NistModeName = "nist-800-63b"
+)
+
+var (
+	policyLock    sync.Mutex
+	defaultPolicy = NewDefaultPasswordPolicy()
+)
+
+// PasswordPolicy : the rules that the passwords of a user must adhere to
+type PasswordPolicy struct {
+	MinLength                     int
+	MaxLength                     int
+	MinUpperCase                  int
+	MinLowerCase                  int
+	MinDigits                     int
+	MinExtraChars                 int
+	HistoryDepth                  int // number of old passwords that can't be reused
+	ExpirationDays                int
+	MaxAttempts                   int // number of consecutive wrong attempts before the password is locked
+	TemporaryPwdExpirationMinutes int
+	MinStrengthScore              int  // if set (1-MaxStrengthScore), the estimated strength score is checked instead of the character classes
+	NistMode                      bool `json:",omitempty"` // NIST SP 800-63B mode
+	LockoutSeconds                int  // the first lock duration, 0: the password is hard locked after MaxAttempts
+	MaxLockoutSeconds             int
+	HardLockAttempts              int // number of consecutive wrong attempts before the password is hard locked, 0: never
+}
+
+// PolicySerializer : virtual set of functions that must be implemented by each module
+type PolicySerializer struct{}
+
+func init() {
+	defs.Serializers[defs.PwdPolicyPropertyName] = &PolicySerializer{}
+	ss.SecretStrengthCheck = checkSecretStrength
+}
+
+// The secure storage secrets are checked using the default password policy
+func checkSecretStrength(secret string) error {
+	return GetDefaultPasswordPolicy().CheckStrength(secret)
+}
+
+func (p PasswordPolicy) String() string {
+	return fmt.Sprintf("Length: %v-%v, upper case: %v, lower case: %v, digits: %v, extra characters: %v, history depth: %v, expiration: %v days, max attempts: %v, temporary password expiration: %v minutes, min strength score: %v, 800-63B mode: %v, lockout: %v-%v seconds, hard lock attempts: %v",
+		p.MinLength, p.MaxLength, p.MinUpperCase, p.MinLowerCase, p.MinDigits, p.MinExtraChars, p.HistoryDepth,
+		p.ExpirationDays, p.MaxAttempts, p.TemporaryPwdExpirationMinutes, p.MinStrengthScore, p.NistMode,
+		p.LockoutSeconds, p.MaxLockoutSeconds, p.HardLockAttempts)
+}
+
+// NewDefaultPasswordPolicy : Return the password policy that is used by default
+func NewDefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:                     MinPasswordLength,
+		MaxLength:                     MaxPasswordLength,
+		MinUpperCase:                  defaultMinUpperCase,
+		MinLowerCase:                  defaultMinLowerCase,
+		MinDigits:                     defaultMinDigits,
+		MinExtraChars:                 defaultMinExtraChars,
+		HistoryDepth:                  defaultNumberOfOldPasswords,
+		ExpirationDays:                defaultExpirationDurationDays,
+		MaxAttempts:                   defaultPwdAttempts,
+		TemporaryPwdExpirationMinutes: defaultTemporaryPwdExpirationMinutes,
+		LockoutSeconds:                defaultLockoutSeconds,
+		MaxLockoutSeconds:             defaultMaxLockoutSeconds,
+		HardLockAttempts:              defaultHardLockAttempts,
+	}
+}
+
+// NewNistPasswordPolicy : Return the NIST SP 800-63B mode password policy
+func NewNistPasswordPolicy() PasswordPolicy {
+	p := NewDefaultPasswordPolicy()
+	p.MinLength = nistMinLength
+	p.MaxLength = nistMaxLength
+	p.MinUpperCase = 0
+	p.MinLowerCase = 0
+	p.MinDigits = 0
+	p.MinExtraChars = 0
+	p.NistMode = true
+	return p
+}
+
+// IsValid : Verify that the policy parameters are in the allowed ranges
+func (p PasswordPolicy) IsValid() error {
+	if p.MinLength < MinPasswordLength || p.MaxLength > MaxPasswordLength || p.MinLength > p.MaxLength {
+		return fmt.Errorf("The password length range %v-%v must be within %v-%v", p.MinLength, p.MaxLength, MinPasswordLength, MaxPasswordLength)
+	}
+	if p.MinUpperCase < 0 || p.MinLowerCase < 0 || p.MinDigits < 0 || p.MinExtraChars < 0 {
+		return fmt.Errorf("The minimum number of characters of each class must not be negative")
+	}
+	if p.MinUpperCase+p.MinLowerCase+p.MinDigits+p.MinExtraChars > p.MaxLength {
+		return fmt.Errorf("The minimum number of characters of all the classes must not exceed the maximum password length %v", p.MaxLength)
+	}
+	if p.HistoryDepth < 0 || p.HistoryDepth > MaxHistoryDepth {
+		return fmt.Errorf("The history depth %v must be between 0 and %v", p.HistoryDepth, MaxHistoryDepth)
+	}
+	if p.ExpirationDays < 1 || p.MaxAttempts < 1 || p.TemporaryPwdExpirationMinutes < 1 {
+		return fmt.Errorf("The expiration days %v, the maximum attempts %v and the temporary password expiration minutes %v must be at least 1",
+			p.ExpirationDays, p.MaxAttempts, p.TemporaryPwdExpirationMinutes)
+	}
+	if p.MinStrengthScore < 0 || p.MinStrengthScore > MaxStrengthScore {
+		return fmt.Errorf("The minimum strength score %v must be between 0 and %v", p.MinStrengthScore, MaxStrengthScore)
+	}
+	if p.LockoutSeconds < 0 || (p.LockoutSeconds > 0 && p.MaxLockoutSeconds < p.LockoutSeconds) {
+		return fmt.Errorf("The lockout duration %v seconds must not be negative and the maximum lockout duration %v seconds must not be shorter",
+			p.LockoutSeconds, p.MaxLockoutSeconds)
+	}
+	if p.HardLockAttempts < 0 || (p.HardLockAttempts > 0 && p.HardLockAttempts < p.MaxAttempts) {
+		return fmt.Errorf("The hard lock attempts %v must be 0 or at least the maximum attempts %v", p.HardLockAttempts, p.MaxAttempts)
+	}
+	if p.NistMode && p.LockoutSeconds == 0 {
+		return fmt.Errorf("In 800-63B mode the wrong attempts must be rate limited: the lockout duration must be set")
+	}
+	if p.NistMode && (p.MinLength < nistMinLength || p.MaxLength < nistMaxLength) {
+		return fmt.Errorf("In 800-63B mode the minimum password length %v must be at least %v and the maximum length %v must be at least %v",
+			p.MinLength, nistMinLength, p.MaxLength, nistMaxLength)
+	}
+	if p.NistMode && p.MinUpperCase+p.MinLowerCase+p.MinDigits+p.MinExtraChars > 0 {
+		return fmt.Errorf("In 800-63B mode the policy must not have character classes rules")
+	}
+	return nil
+}
+
+// SetDefaultPasswordPolicy : Set the password policy of the users that don't have a group policy
+func SetDefaultPasswordPolicy(p PasswordPolicy) error {
+	err := p.IsValid()
+	if err != nil {
+		return err
+	}
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	defaultPolicy = p
+	return nil
+}
+
+// GetDefaultPasswordPolicy : Return the password policy of the users that don't have a group policy
+func GetDefaultPasswordPolicy() PasswordPolicy {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	return defaultPolicy
+}
+
+// GetStrictestPolicy : Return the strictest combination of the given policies:
+// each rule is taken from the policy in which it is the strictest, the 800-63B mode is used only if all the policies use it
+func GetStrictestPolicy(policies ...PasswordPolicy) PasswordPolicy {
+	if len(policies) == 0 {
+		return GetDefaultPasswordPolicy()
+	}
+	p := policies[0]
+	for _, p1 := range policies[1:] {
+		p.MinLength = maxInt(p.MinLength, p1.MinLength)
+		p.MaxLength = minInt(p.MaxLength, p1.MaxLength)
+		p.MinUpperCase = maxInt(p.MinUpperCase, p1.MinUpperCase)
+		p.MinLowerCase = maxInt(p.MinLowerCase, p1.MinLowerCase)
+		p.MinDigits = maxInt(p.MinDigits, p1.MinDigits)
+		p.MinExtraChars = maxInt(p.MinExtraChars, p1.MinExtraChars)
+		p.HistoryDepth = maxInt(p.HistoryDepth, p1.HistoryDepth)
+		p.ExpirationDays = minInt(p.ExpirationDays, p1.ExpirationDays)
+		p.MaxAttempts = minInt(p.MaxAttempts, p1.MaxAttempts)
+		p.TemporaryPwdExpirationMinutes = minInt(p.TemporaryPwdExpirationMinutes, p1.TemporaryPwdExpirationMinutes)
+		p.MinStrengthScore = maxInt(p.MinStrengthScore, p1.MinStrengthScore)
+		p.NistMode = p.NistMode && p1.NistMode
+		p.LockoutSeconds = getStrictestLimit(p.LockoutSeconds, p1.LockoutSeconds, false)
+		p.MaxLockoutSeconds = maxInt(p.MaxLockoutSeconds, p1.MaxLockoutSeconds)
+		p.HardLockAttempts = getStrictestLimit(p.HardLockAttempts, p1.HardLockAttempts, true)
+	}
+	// the strictest length range may be empty: the longer minimum wins
+	if p.MaxLength < p.MinLength {
+		p.MaxLength = p.MinLength
+	}
+	return p
+}
+
+// Return the strictest of 2 limits where 0 means no limit: the lower one if lowerIsStricter is set,
+// otherwise 0 (e.g. a lock without automatic unlock) or the higher one
+func getStrictestLimit(a int, b int, lowerIsStricter bool) int {
+	if a == 0 || b == 0 {
+		if lowerIsStricter {
+			return maxInt(a, b)
+		}
+		return 0
+	}
+	if lowerIsStricter {
+		return minInt(a, b)
+	}
+	return maxInt(a, b)
+}
+
+// Return the lock duration after the given number of consecutive wrong attempts
+func (p PasswordPolicy) getLockoutDuration(errorsCounter int) time.Duration {
+	seconds := p.LockoutSeconds
+	for i := p.MaxAttempts; i < errorsCounter && seconds < p.MaxLockoutSeconds; i++ {
+		seconds *= 2
+	}
+	return time.Duration(minInt(seconds, p.MaxLockoutSeconds)) * time.Second
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// NormalizePwd : Return the password as it is checked and hashed: in 800-63B mode it is normalized using NFKC.
+// The passwords must be normalized before they are salted and hashed in order to be matched
+func (p PasswordPolicy) NormalizePwd(pwd []byte) []byte {
+	if p.NistMode == false {
+		return pwd
+	}
+	return norm.NFKC.Bytes(pwd)
+}
+
+// Verify that the password length is in the policy range, in 800-63B mode the length is the number of characters
+func (p PasswordPolicy) checkLength(pass string) error {
+	pLen := len(pass)
+	if p.NistMode {
+		pLen = utf8.RuneCountInString(pass)
+	}
+	if pLen < p.MinLength || pLen > p.MaxLength {
+		return fmt.Errorf("Password length %v is not in the allowed range %v-%v", pLen, p.MinLength, p.MaxLength)
+	}
+	return nil
+}
+
+// Verify that the estimated strength score of the password is at least the policy minimum score
+func (p PasswordPolicy) checkStrengthScore(pass string) error {
+	err := p.checkLength(pass)
+	if err != nil || p.MinStrengthScore == 0 {
+		return err
+	}
+	estimate := EstimateStrength(pass)
+	if estimate.Score < p.MinStrengthScore {
+		return fmt.Errorf("The checked password is too guessable, its strength score %v is lower than the required score %v. %v %v",
+			estimate.Score, p.MinStrengthScore, estimate.Warning, strings.Join(estimate.Suggestions, ". "))
+	}
+	return nil
+}
+
+// CheckStrength : Verify that the given password adheres to the policy length and character classes rules
+// (or to the minimum strength score if the policy sets it, in 800-63B mode only to the length and the minimum score)
+// and that it is not in the password blocklist
+func (p PasswordPolicy) CheckStrength(pass string) error {
+	pass = string(p.NormalizePwd([]byte(pass)))
+	if p.MinStrengthScore > 0 || p.NistMode {
+		err := p.checkStrengthScore(pass)
+		if err != nil {
+			return err
+		}
+		return CheckBlocklist(pass, "")
+	}
+	extraCnt := 0
+	digitCnt := 0
+	upperCaseCnt := 0
+	lowerCaseCnt := 0
+
+	for _, c := range defs.ExtraCharStr {
+		extraCnt += strings.Count(pass, string(c))
+	}
+	for _, c := range pass {
+		if unicode.IsUpper(c) {
+			upperCaseCnt++
+		} else if unicode.IsLower(c) {
+			lowerCaseCnt++
+		} else if unicode.IsDigit(c) {
+			digitCnt++
+		}
+	}
+	if p.checkLength(pass) != nil || extraCnt < p.MinExtraChars || digitCnt < p.MinDigits ||
+		upperCaseCnt < p.MinUpperCase || lowerCaseCnt < p.MinLowerCase {
+		return fmt.Errorf("The checked password does not pass the password strength test. In order to be strong, the password must adhere to all of the following:\nContains %v-%v characters\nIncludes at least %v digits\nIncludes at least %v letters, where at least %v must be uppercase and at least %v must be lowercase\nIncludes at least %v special characters from the following list:\nSpecial characters: '%v'",
+			p.MinLength, p.MaxLength, p.MinDigits, p.MinUpperCase+p.MinLowerCase, p.MinUpperCase, p.MinLowerCase, p.MinExtraChars, defs.ExtraCharStr)
+	}
+	return CheckBlocklist(pass, "")
+}
+
+// All the properties must implement a set of functions:
+// PrintProperties, IsEqualProperties, AddToStorage, ReadFromStorage
+
+// PrintProperties : Print the password policy property data
+func (s PolicySerializer) PrintProperties(data interface{}) string {
+	d, ok := data.(*PasswordPolicy)
+	if ok == false {
+		return "Cannot print the password policy property: Not the right type"
+	}
+	return d.String()
+}
+
+// IsEqualProperties : Compare 2 password policy properties
+func (s PolicySerializer) IsEqualProperties(da1 interface{}, da2 interface{}) bool {
+	d1, ok1 := da1.(*PasswordPolicy)
+	d2, ok2 := da2.(*PasswordPolicy)
+	if ok1 == false || ok2 == false {
+		return false
+	}
+	return reflect.DeepEqual(d1, d2)
+}
+
+// AddToStorage : Add the password policy property information to the secure_storage
+func (s PolicySerializer) AddToStorage(prefix string, data interface{}, storage *ss.SecureStorage) error {
+	if storage == nil {
+		return fmt.Errorf("Cannot add password policy property to storage: Storage is nil")
+	}
+	return s.AddToItemsWriter(prefix, data, storage)
+}
+
+// AddToItemsWriter : Add the password policy property information to an items writer, e.g. a storage transaction
+func (s PolicySerializer) AddToItemsWriter(prefix string, data interface{}, storage ss.ItemsWriter) error {
+	d, ok := data.(*PasswordPolicy)
+	if ok == false {
+		return fmt.Errorf("Cannot store the password policy property: Not the right type")
+	}
+	if storage == nil {
+		return fmt.Errorf("Cannot add password policy property to storage: Storage is nil")
+	}
+	value, _ := json.Marshal(d)
+	return storage.AddItem(prefix, string(value))
+}
+
+// ReadFromStorage : Return the entity password policy data read from the secure storage (in JSON format)
+func (s PolicySerializer) ReadFromStorage(key string, storage *ss.SecureStorage) (interface{}, error) {
+	var policy PasswordPolicy
+
+	if storage == nil {
+		return nil, fmt.Errorf("Cannot read password policy property from storage: Storage is nil")
+	}
+	value, exist := storage.Data[key]
+	if !exist {
+		return nil, fmt.Errorf("Key '%v' was not found in storage", key)
+	}
+	err := json.Unmarshal([]byte(value), &policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
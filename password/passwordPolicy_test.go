@@ -0,0 +1,297 @@
+package password
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+// Verify that only passwords that adhere to all the policy rules pass the strength check
+func Test_policyCheckStrength(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MaxLength: 12, MinUpperCase: 2, MinLowerCase: 2, MinDigits: 2, MinExtraChars: 2,
+		HistoryDepth: 1, ExpirationDays: 1, MaxAttempts: 1, TemporaryPwdExpirationMinutes: 1}
+	passwords := map[string]bool{
+		"AAbb12@#xy":    true,
+		"AAbb12@#xyzw":  true,
+		"AAbb12@#x":     false, // too short
+		"AAbb12@#xyzwv": false, // too long
+		"Abbb12@#xy":    false,
+		"AABB12@#xY":    false,
+		"AAbb1a@#xy":    false,
+		"AAbb12@axy":    false,
+	}
+	for pwd, valid := range passwords {
+		err := policy.CheckStrength(pwd)
+		if valid && err != nil {
+			t.Errorf("Test fail: the valid password '%v' was rejected by the policy %v, error: %v", pwd, policy, err)
+		} else if valid == false && err == nil {
+			t.Errorf("Test fail: the invalid password '%v' was accepted by the policy %v", pwd, policy)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		pwd := generatePolicyValidPassword(policy)
+		err := policy.CheckStrength(string(pwd))
+		if err != nil {
+			t.Errorf("Test fail: the generated password '%v' does not adhere to the policy %v, error: %v", string(pwd), policy, err)
+		}
+	}
+}
+
+// Verify that the secure storage secrets are checked using the default password policy
+func Test_storageSecretPolicy(t *testing.T) {
+	secret := []byte("Qz7@kLm9pX")
+	defer SetDefaultPasswordPolicy(NewDefaultPasswordPolicy())
+
+	_, err := ss.NewStorage([]byte("abcdefghij"), true)
+	if err == nil {
+		t.Errorf("Test fail: a secure storage was created using a secret that does not adhere to the default password policy")
+	}
+	_, err = ss.NewStorage(secret, true)
+	if err != nil {
+		t.Errorf("Test fail: a secure storage can't be created using the secret '%v', error: %v", string(secret), err)
+	}
+	policy := NewDefaultPasswordPolicy()
+	policy.MinDigits = 3
+	SetDefaultPasswordPolicy(policy)
+	_, err = ss.NewStorage(secret, true)
+	if err == nil {
+		t.Errorf("Test fail: a secure storage was created using the secret '%v' that has less digits than the default password policy %v", string(secret), policy)
+	}
+}
+
+// Verify that the strictest policy takes the strictest value of each rule
+func Test_strictestPolicy(t *testing.T) {
+	p1 := NewDefaultPasswordPolicy()
+	p2 := NewDefaultPasswordPolicy()
+	p1.MinLength = 12
+	p1.MinDigits = 3
+	p1.ExpirationDays = 200
+	p1.MaxAttempts = 3
+	p2.MaxLength = 20
+	p2.HistoryDepth = 10
+	p2.TemporaryPwdExpirationMinutes = 5
+
+	p := GetStrictestPolicy(p1, p2)
+	expected := p1
+	expected.MaxLength = 20
+	expected.HistoryDepth = 10
+	expected.ExpirationDays = p2.ExpirationDays
+	expected.TemporaryPwdExpirationMinutes = 5
+	if p != expected {
+		t.Errorf("Test fail: the strictest policy %v is not as expected %v", p, expected)
+	}
+	if GetStrictestPolicy() != GetDefaultPasswordPolicy() {
+		t.Errorf("Test fail: the strictest policy of no policies is not the default policy")
+	}
+}
+
+// Verify that the user's effective policy sets the history depth, the maximum attempts and the password length
+func Test_userPolicy(t *testing.T) {
+	policy := NewDefaultPasswordPolicy()
+	policy.MinLength = 12
+	policy.HistoryDepth = 2
+	policy.MaxAttempts = 2
+
+	_, err := NewUserPwdWithPolicy(defaultPassword, defaultSaltStr, true, &policy)
+	if err == nil {
+		t.Errorf("Test fail: the password '%v' that is shorter than the policy minimum length %v was accepted", string(defaultPassword), policy.MinLength)
+	}
+	pwds := []string{"Aa1@" + strings.Repeat("a", 8), "Bb2@" + strings.Repeat("b", 8), "Cc3@" + strings.Repeat("c", 8), "Dd4@" + strings.Repeat("d", 8)}
+	user, err := NewUserPwdWithPolicy([]byte(pwds[0]), defaultSaltStr, true, &policy)
+	if err != nil {
+		t.Fatalf("Test fail: can't create a user password using the policy %v, error: %v", policy, err)
+	}
+	for i := 1; i < len(pwds); i++ {
+		_, err = user.UpdatePassword(getPwdHash([]byte(pwds[i-1]), user.Salt), []byte(pwds[i]), true)
+		if err != nil {
+			t.Fatalf("Test fail: can't update the password to '%v', error: %v", pwds[i], err)
+		}
+	}
+	if len(user.OldPasswords) != policy.HistoryDepth {
+		t.Errorf("Test fail: the number of old passwords %v is not as expected %v", len(user.OldPasswords), policy.HistoryDepth)
+	}
+	current := getPwdHash([]byte(pwds[len(pwds)-1]), user.Salt)
+	_, err = user.UpdatePassword(current, []byte(pwds[len(pwds)-2]), true)
+	if err == nil {
+		t.Errorf("Test fail: the old password '%v' was reused", pwds[len(pwds)-2])
+	}
+	_, err = user.UpdatePassword(current, []byte(pwds[0]), true)
+	if err != nil {
+		t.Errorf("Test fail: the password '%v' that is older than the history depth was rejected, error: %v", pwds[0], err)
+	}
+
+	current = getPwdHash([]byte(pwds[0]), user.Salt)
+	wrongPwd := getPwdHash([]byte(pwds[1]), user.Salt)
+	for i := 0; i < policy.MaxAttempts; i++ {
+		user.IsPasswordMatch(wrongPwd)
+	}
+	err = user.IsPasswordMatch(current)
+	if err == nil {
+		t.Errorf("Test fail: the password was not blocked after %v wrong attempts", policy.MaxAttempts)
+	}
+	pwd, err := user.ResetPassword()
+	if err != nil || policy.CheckStrength(string(pwd)) != nil {
+		t.Errorf("Test fail: the reset password '%v' does not adhere to the policy %v, error: %v", string(pwd), policy, err)
+	}
+}
+
+// Verify that illegal policies are rejected
+func Test_policyCorners(t *testing.T) {
+	defaultPolicy := NewDefaultPasswordPolicy()
+	policies := []PasswordPolicy{defaultPolicy, defaultPolicy, defaultPolicy, defaultPolicy, defaultPolicy, defaultPolicy}
+	policies[0].MinLength = MinPasswordLength - 1
+	policies[1].MaxLength = policies[1].MinLength - 1
+	policies[2].MinDigits = -1
+	policies[3].MinUpperCase = MaxPasswordLength
+	policies[4].HistoryDepth = MaxHistoryDepth + 1
+	policies[5].MaxAttempts = 0
+	for _, p := range policies {
+		err := SetDefaultPasswordPolicy(p)
+		if err == nil {
+			t.Errorf("Test fail: the illegal policy %v was accepted", p)
+		}
+	}
+	if GetDefaultPasswordPolicy() != defaultPolicy {
+		t.Errorf("Test fail: the default policy %v was changed to an illegal policy %v", defaultPolicy, GetDefaultPasswordPolicy())
+	}
+}
+
+// Verify the 800-63B mode: no character classes rules, the length is the number of Unicode characters,
+// the passwords are normalized using NFKC, they don't expire and the wrong attempts are only rate limited
+func Test_nistPolicy(t *testing.T) {
+	policy := NewNistPasswordPolicy()
+	if policy.IsValid() != nil {
+		t.Errorf("Test fail: the 800-63B policy %v is not valid, error: %v", policy, policy.IsValid())
+	}
+	for _, pwd := range []string{"alllowercasepassphrase", "pässwörd ñandú", "日本語のパスワード", strings.Repeat("é", nistMaxLength)} {
+		err := policy.CheckStrength(pwd)
+		if err != nil {
+			t.Errorf("Test fail: the password '%v' was rejected by the 800-63B policy, error: %v", pwd, err)
+		}
+	}
+	for _, pwd := range []string{"short", "日本語のパス", strings.Repeat("é", nistMaxLength+1)} {
+		if policy.CheckStrength(pwd) == nil {
+			t.Errorf("Test fail: the password '%v' with an illegal length was accepted by the 800-63B policy", pwd)
+		}
+	}
+
+	user, err := NewUserPwdWithPolicy([]byte("ｆｕｌｌｗｉｄｔｈ pass"), defaultSaltStr, true, &policy)
+	if err != nil {
+		t.Fatalf("Test fail: can't create a user password using the 800-63B policy, error: %v", err)
+	}
+	current := getPwdHash([]byte("fullwidth pass"), user.Salt)
+	if user.IsPasswordMatch(current) != nil {
+		t.Errorf("Test fail: the NFKC normalized password was not matched")
+	}
+	if user.Expiration != noExpirationTime {
+		t.Errorf("Test fail: the password expiration %v is not as expected, passwords must not expire in 800-63B mode", user.Expiration)
+	}
+	wrongPwd := getPwdHash([]byte("wrong password"), user.Salt)
+	for i := 0; i < policy.MaxAttempts; i++ {
+		user.IsPasswordMatch(wrongPwd)
+	}
+	if user.IsPasswordMatch(current) == nil {
+		t.Errorf("Test fail: the password was matched right after %v wrong attempts", policy.MaxAttempts)
+	}
+	user.LockedUntil = time.Now()
+	if user.IsPasswordMatch(current) != nil || user.ErrorsCounter != 0 {
+		t.Errorf("Test fail: the password was not matched after the rate limit duration, errors counter: %v", user.ErrorsCounter)
+	}
+
+	policies := []PasswordPolicy{policy, policy}
+	policies[0].MaxLength = nistMaxLength - 1
+	policies[1].MinDigits = 1
+	for _, p := range policies {
+		if p.IsValid() == nil {
+			t.Errorf("Test fail: the illegal 800-63B policy %v was accepted", p)
+		}
+	}
+	if GetStrictestPolicy(policy, NewDefaultPasswordPolicy()).NistMode {
+		t.Errorf("Test fail: the strictest policy of a 800-63B policy and a default policy is in 800-63B mode")
+	}
+}
+
+// Verify the progressive lockout: the lock duration is doubled for each wrong attempt after the maximum attempts
+// up to the maximum lock duration, the password is unlocked when the lock is over and after the hard lock attempts
+// it is locked until it is reset
+func Test_progressiveLockout(t *testing.T) {
+	policy := NewDefaultPasswordPolicy()
+	policy.MaxAttempts = 3
+	policy.LockoutSeconds = 10
+	policy.MaxLockoutSeconds = 25
+	policy.HardLockAttempts = 6
+
+	user, _ := NewUserPwdWithPolicy(defaultPassword, defaultSaltStr, true, &policy)
+	current := getPwdHash(defaultPassword, user.Salt)
+	wrongPwd := getPwdHash([]byte(string(defaultPassword)+"a"), user.Salt)
+	for i := 0; i < policy.MaxAttempts; i++ {
+		user.IsPasswordMatch(wrongPwd)
+	}
+	expected := []int{10, 20, 25}
+	for i := 0; i < len(expected); i++ {
+		state, lockedUntil := user.GetLockState()
+		if state != LockedState || lockedUntil.Sub(user.LastErrorTime) != time.Duration(expected[i])*time.Second {
+			t.Errorf("Test fail: after %v wrong attempts the lock state is '%v' until %v, expected: '%v' for %v seconds",
+				user.ErrorsCounter, state, lockedUntil, LockedState, expected[i])
+		}
+		if user.IsPasswordMatch(current) == nil {
+			t.Errorf("Test fail: the locked password was matched")
+		}
+		if _, err := user.UpdatePassword(current, []byte(string(defaultPassword)+"1"), false); err == nil {
+			t.Errorf("Test fail: the locked password was updated")
+		}
+		user.LockedUntil = time.Now() // the lock is over
+		user.IsPasswordMatch(wrongPwd)
+	}
+	state, _ := user.GetLockState()
+	if state != HardLockedState || user.IsPasswordMatch(current) == nil {
+		t.Errorf("Test fail: the password was not hard locked after %v wrong attempts, its state: '%v'", user.ErrorsCounter, state)
+	}
+	user.ResetPassword()
+	state, _ = user.GetLockState()
+	if state != UnlockedState || user.ErrorsCounter != 0 {
+		t.Errorf("Test fail: the password was not unlocked after it was reset, its state: '%v'", state)
+	}
+
+	if NewDefaultPasswordPolicy().HardLockAttempts != 0 {
+		t.Errorf("Test fail: the default policy hard locks the password after %v wrong attempts", NewDefaultPasswordPolicy().HardLockAttempts)
+	}
+	user, _ = NewUserPwdWithPolicy(defaultPassword, defaultSaltStr, true, &policy)
+	user.IsPasswordMatch(wrongPwd)
+	if user.IsPasswordMatch(current) != nil || user.ErrorsCounter != 0 {
+		t.Errorf("Test fail: the wrong attempts counter %v was not cleared after a successful attempt", user.ErrorsCounter)
+	}
+	policy.LockoutSeconds = 0
+	for i := 0; i < policy.MaxAttempts; i++ {
+		user.IsPasswordMatch(wrongPwd)
+	}
+	state, _ = user.GetLockState()
+	if state != HardLockedState {
+		t.Errorf("Test fail: the password was not hard locked after %v wrong attempts without a lockout duration, its state: '%v'", policy.MaxAttempts, state)
+	}
+}
+
+// Verify that the strictest lockout rules are selected and that illegal lockout rules are rejected
+func Test_lockoutPolicy(t *testing.T) {
+	p1 := NewDefaultPasswordPolicy()
+	p2 := NewDefaultPasswordPolicy()
+	p1.LockoutSeconds = 0
+	p1.HardLockAttempts = 0
+	p2.HardLockAttempts = 50
+	p := GetStrictestPolicy(p1, p2)
+	if p.LockoutSeconds != 0 || p.HardLockAttempts != 50 {
+		t.Errorf("Test fail: the strictest policy lockout rules: %v are not as expected", p)
+	}
+	policies := []PasswordPolicy{p2, p2, p2, NewNistPasswordPolicy()}
+	policies[0].LockoutSeconds = -1
+	policies[1].MaxLockoutSeconds = policies[1].LockoutSeconds - 1
+	policies[2].HardLockAttempts = policies[2].MaxAttempts - 1
+	policies[3].LockoutSeconds = 0
+	for _, p := range policies {
+		if p.IsValid() == nil {
+			t.Errorf("Test fail: the illegal policy %v was accepted", p)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
+)
+
+// A password reset token lets users that forgot their password set a new one without an administrator: the token is
+// a high entropy random string that is delivered to the user using the configured delivery channel (e.g. by email),
+// only its SHA-256 hash is stored with the user's password. The token can be used once, before it expires
+// (after the policy temporary password lifetime), and it is revoked when the password is changed.
+// While the token of a user is pending, a new token is not sent, and the requests to send a token for the same
+// user name are throttled (whether or not the user exists), so the requests can't be used to flood the users or to lock out their pending tokens
+
+const (
+	resetTokenLen           = 32
+	resetTokenThrottlingSec = 60
+)
+
+var (
+	senderLock         sync.Mutex
+	resetTokenSender   ResetTokenSender
+	resetTokenRequests = make(map[string]time.Time)
+
+	// ErrInvalidResetToken : The error that is returned when the password reset token is not valid or it has expired
+	ErrInvalidResetToken = fmt.Errorf("The password reset token is not valid or it has expired")
+)
+
+// ResetTokenSender : The delivery channel of the password reset tokens to the users
+type ResetTokenSender interface {
+	SendResetToken(userName string, token string, expiration time.Time) error
+}
+
+// FileResetTokenSender : A delivery channel that appends the password reset tokens to a file
+// that is only readable by the owner (e.g. for an external mailer to pick them up)
+type FileResetTokenSender struct {
+	FileName string
+}
+
+// SendResetToken : Append the user name, the token and its expiration to the file
+func (f FileResetTokenSender) SendResetToken(userName string, token string, expiration time.Time) error {
+	file, err := os.OpenFile(f.FileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.FileMode(ss.FilePermissions))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%v %v %v\n", userName, token, expiration.Format(time.RFC3339))
+	return err
+}
+
+// SetResetTokenSender : Set the delivery channel of the password reset tokens, nil to disable the reset tokens
+func SetResetTokenSender(s ResetTokenSender) {
+	senderLock.Lock()
+	defer senderLock.Unlock()
+	resetTokenSender = s
+}
+
+// GetResetTokenSender : Return the delivery channel of the password reset tokens, nil if it was not set
+func GetResetTokenSender() ResetTokenSender {
+	senderLock.Lock()
+	defer senderLock.Unlock()
+	return resetTokenSender
+}
+
+// ThrottleResetTokenRequest : Return an error if a password reset token was requested for the given user name
+// in the last resetTokenThrottlingSec seconds, otherwise record the request. It should be called for each request,
+// including the requests for users that don't exist, so all the user names are handled the same
+func ThrottleResetTokenRequest(userName string) error {
+	senderLock.Lock()
+	defer senderLock.Unlock()
+
+	now := time.Now()
+	for name, t := range resetTokenRequests {
+		if now.Sub(t) >= resetTokenThrottlingSec*time.Second {
+			delete(resetTokenRequests, name)
+		}
+	}
+	if _, exist := resetTokenRequests[userName]; exist {
+		return fmt.Errorf("A password reset token was already requested for the user '%v', try again later", userName)
+	}
+	resetTokenRequests[userName] = now
+	return nil
+}
+
+func getResetTokenHash(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func (u *UserPwd) clearResetToken() {
+	u.ResetToken = nil
+	u.ResetTokenExp = time.Time{}
+}
+
+// NewResetToken : Generate a new password reset token for the user and return it with its expiration time,
+// the previous token of the user is revoked
+func (u *UserPwd) NewResetToken() (string, time.Time, error) {
+	buf := make([]byte, resetTokenLen)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Random read failed: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	pLock.Lock()
+	defer pLock.Unlock()
+	u.ResetToken = getResetTokenHash(token)
+	u.ResetTokenExp = time.Now().Add(time.Duration(u.GetPolicy().TemporaryPwdExpirationMinutes) * time.Minute)
+	return token, u.ResetTokenExp, nil
+}
+
+func (u *UserPwd) isResetTokenPending() bool {
+	pLock.Lock()
+	defer pLock.Unlock()
+	return len(u.ResetToken) > 0 && time.Now().Before(u.ResetTokenExp)
+}
+
+// SendResetToken : Generate a new password reset token for the given user and deliver it using the delivery channel.
+// If the user has a pending token that didn't expire, it is kept and a new token is not sent
+func (u *UserPwd) SendResetToken(userName string) error {
+	sender := GetResetTokenSender()
+	if sender == nil {
+		return fmt.Errorf("Password reset tokens can't be used: no delivery channel was set")
+	}
+	if u.isResetTokenPending() {
+		return nil
+	}
+	token, expiration, err := u.NewResetToken()
+	if err != nil {
+		return err
+	}
+	err = sender.SendResetToken(userName, token, expiration)
+	if err != nil {
+		pLock.Lock()
+		u.clearResetToken()
+		pLock.Unlock()
+		return fmt.Errorf("Can't send the password reset token: %v", err)
+	}
+	return nil
+}
+
+// ResetPasswordWithToken : Replace the password by the given one if the given reset token is valid, the token can't be used again.
+// The password is unlocked and its expiration time is set by the policy
+func (u *UserPwd) ResetPasswordWithToken(token string, pwd []byte, checkPwdStrength bool) ([]byte, error) {
+	pLock.Lock()
+	defer pLock.Unlock()
+
+	if len(u.ResetToken) == 0 || time.Now().After(u.ResetTokenExp) ||
+		subtle.ConstantTimeCompare(getResetTokenHash(token), u.ResetToken) != 1 {
+		return nil, ErrInvalidResetToken
+	}
+	pwd = u.GetPolicy().NormalizePwd(pwd)
+	err := checkNewPwd(u.GetPolicy(), pwd, checkPwdStrength)
+	if err != nil {
+		return nil, err
+	}
+	return u.setPassword(pwd, GetNewPasswordExpirationTime(u.GetPolicy()), false)
+}
@@ -0,0 +1,159 @@
+package password
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testTokenSender struct {
+	userName string
+	token    string
+	fail     bool
+}
+
+func (s *testTokenSender) SendResetToken(userName string, token string, expiration time.Time) error {
+	if s.fail {
+		return fmt.Errorf("the delivery failed")
+	}
+	s.userName = userName
+	s.token = token
+	return nil
+}
+
+// Verify that a reset token can't be sent without a delivery channel, that only its hash is stored
+// and that the token can't be used if the delivery failed
+func Test_sendResetToken(t *testing.T) {
+	defer SetResetTokenSender(nil)
+	userName := "User1"
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+
+	SetResetTokenSender(nil)
+	if user.SendResetToken(userName) == nil {
+		t.Errorf("Test fail: a reset token was sent without a delivery channel")
+	}
+	sender := &testTokenSender{}
+	SetResetTokenSender(sender)
+	err := user.SendResetToken(userName)
+	if err != nil {
+		t.Fatalf("Test fail: can't send a reset token, error: %v", err)
+	}
+	if sender.userName != userName || len(sender.token) == 0 {
+		t.Errorf("Test fail: the reset token was sent to '%v' instead of '%v', token: '%v'", sender.userName, userName, sender.token)
+	}
+	if len(user.ResetToken) == 0 || bytes.Contains(user.ResetToken, []byte(sender.token)) {
+		t.Errorf("Test fail: the reset token was not stored as a hash: %v", user.ResetToken)
+	}
+	token := sender.token
+	tokenHash := user.ResetToken
+	sender.token = ""
+	err = user.SendResetToken(userName)
+	if err != nil || len(sender.token) != 0 || bytes.Equal(tokenHash, user.ResetToken) == false {
+		t.Errorf("Test fail: the pending reset token was replaced, error: %v", err)
+	}
+	user.ResetTokenExp = time.Now().Add(-time.Second)
+	sender.fail = true
+	if user.SendResetToken(userName) == nil {
+		t.Errorf("Test fail: a failed delivery of the reset token was not reported")
+	}
+	if len(user.ResetToken) != 0 {
+		t.Errorf("Test fail: the reset token was kept after its delivery failed")
+	}
+	newPwd := []byte(string(defaultPassword) + "a1^A")
+	_, err = user.ResetPasswordWithToken(token, newPwd, true)
+	if err == nil {
+		t.Errorf("Test fail: the reset token was used after it expired and was revoked by a failed delivery")
+	}
+}
+
+// Verify that the requests to send a reset token for the same user name are throttled,
+// and that the requests for other user names are not
+func Test_throttleResetTokenRequest(t *testing.T) {
+	userName := "throttled user"
+	defer delete(resetTokenRequests, userName)
+
+	err := ThrottleResetTokenRequest(userName)
+	if err != nil {
+		t.Fatalf("Test fail: the first reset token request was throttled, error: %v", err)
+	}
+	if ThrottleResetTokenRequest(userName) == nil {
+		t.Errorf("Test fail: the second reset token request for '%v' was not throttled", userName)
+	}
+	err = ThrottleResetTokenRequest(userName + "1")
+	if err != nil {
+		t.Errorf("Test fail: a reset token request for another user was throttled, error: %v", err)
+	}
+	delete(resetTokenRequests, userName+"1")
+	resetTokenRequests[userName] = time.Now().Add(-resetTokenThrottlingSec * time.Second)
+	err = ThrottleResetTokenRequest(userName)
+	if err != nil {
+		t.Errorf("Test fail: a reset token request was throttled after the throttling time passed, error: %v", err)
+	}
+}
+
+// Verify that wrong and expired reset tokens are rejected, that a valid token sets the new password
+// and unlocks the user and that it can be used only once
+func Test_resetPasswordWithToken(t *testing.T) {
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	newPwd := []byte(string(defaultPassword) + "a1^A")
+
+	token, _, err := user.NewResetToken()
+	if err != nil {
+		t.Fatalf("Test fail: can't generate a reset token, error: %v", err)
+	}
+	for _, wrong := range []string{"", token + "a", token[1:]} {
+		_, err := user.ResetPasswordWithToken(wrong, newPwd, true)
+		if err == nil {
+			t.Errorf("Test fail: the wrong reset token '%v' was accepted", wrong)
+		}
+	}
+	user.ResetTokenExp = time.Now().Add(-time.Second)
+	_, err = user.ResetPasswordWithToken(token, newPwd, true)
+	if err == nil {
+		t.Errorf("Test fail: an expired reset token was accepted")
+	}
+
+	token, _, _ = user.NewResetToken()
+	for i := 0; i < user.GetPolicy().MaxAttempts; i++ {
+		user.IsPasswordMatch([]byte("wrong password"))
+	}
+	if state, _ := user.GetLockState(); state == UnlockedState {
+		t.Fatalf("Test fail: the password was not locked after %v wrong attempts", user.GetPolicy().MaxAttempts)
+	}
+	_, err = user.ResetPasswordWithToken(token, []byte("a"), true)
+	if err == nil {
+		t.Errorf("Test fail: an illegal new password was accepted")
+	}
+	_, err = user.ResetPasswordWithToken(token, newPwd, true)
+	if err != nil {
+		t.Fatalf("Test fail: a valid reset token was rejected, error: %v", err)
+	}
+	if state, _ := user.GetLockState(); state != UnlockedState {
+		t.Errorf("Test fail: the password is still %v after it was reset", state)
+	}
+	err = user.IsPasswordMatch(getPwdHash(newPwd, user.Salt))
+	if err != nil {
+		t.Errorf("Test fail: the password that was set using the reset token was not accepted, error: %v", err)
+	}
+	_, err = user.ResetPasswordWithToken(token, []byte(string(newPwd)+"b2^B"), true)
+	if err == nil {
+		t.Errorf("Test fail: the reset token was used twice")
+	}
+}
+
+// Verify that the reset token is revoked when the password is changed
+func Test_resetTokenRevoked(t *testing.T) {
+	user, _ := NewUserPwd(defaultPassword, defaultSaltStr, true)
+	newPwd := []byte(string(defaultPassword) + "a1^A")
+
+	token, _, _ := user.NewResetToken()
+	_, err := user.UpdatePassword(getPwdHash(defaultPassword, user.Salt), newPwd, true)
+	if err != nil {
+		t.Fatalf("Test fail: can't update the password, error: %v", err)
+	}
+	_, err = user.ResetPasswordWithToken(token, []byte(string(newPwd)+"b2^B"), true)
+	if err == nil {
+		t.Errorf("Test fail: the reset token was used after the password was changed")
+	}
+}
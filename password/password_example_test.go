@@ -12,6 +12,12 @@ var (
 	maxPasswordLength = 255
 )
 
+// Return the password that is used to verify the given password: the hash of the salted password
+func getUserPwdHash(pwd []byte, saltStr []byte) []byte {
+	tPwd, _ := salt.GenerateSaltedPassword(pwd, minPasswordLength, maxPasswordLength, saltStr, -1)
+	return password.GetHashedPwd(tPwd)
+}
+
 // Example of how to use the password.
 // 1. Create a new password.
 // 2. Verify that the initial password is set correctly
@@ -26,37 +32,40 @@ func ExampleUserPwd() {
 	saltStr, _ := salt.GetRandomSalt(8)
 
 	userPwd, _ := password.NewUserPwd(pwd, saltStr, true)
-	tPwd, _ := salt.GenerateSaltedPassword(pwd, minPasswordLength, maxPasswordLength, saltStr, -1)
-	newPwd := password.GetHashedPwd(tPwd)
-	err := userPwd.IsPasswordMatch(newPwd)
+	err := userPwd.IsPasswordMatch(getUserPwdHash(pwd, saltStr))
 	if err != nil {
 		fmt.Println("Error", err)
 	}
 	userNewPwd := []byte(string(pwd) + "a")
-	newPwd, err = userPwd.UpdatePassword(userPwd.Password, userNewPwd, true)
+	_, err = userPwd.UpdatePassword(getUserPwdHash(pwd, saltStr), userNewPwd, true)
 	if err != nil {
-		fmt.Printf("Password update for user %v to new password '%v' (%v) failed, error %v\n", id, newPwd, string(userNewPwd), err)
+		fmt.Printf("Password update for user %v to new password '%v' failed, error %v\n", id, string(userNewPwd), err)
 	} else {
-		fmt.Printf("User '%v', updated password to '%v' (%v)\n", id, newPwd, string(userNewPwd))
+		fmt.Printf("User '%v', updated password to '%v'\n", id, string(userNewPwd))
 	}
-	err = userPwd.IsPasswordMatch(newPwd)
+	err = userPwd.IsPasswordMatch(getUserPwdHash(userNewPwd, saltStr))
 	if err != nil {
-		fmt.Printf("Check of the new password, '%v' (%v), for user %v failed, error %v\n", newPwd, string(userNewPwd), id, err)
+		fmt.Printf("Check of the new password '%v' for user %v failed, error %v\n", string(userNewPwd), id, err)
 	} else {
-		fmt.Printf("User '%v', new password '%v' (%v) verified successfully\n", id, newPwd, string(userNewPwd))
+		fmt.Printf("User '%v', new password '%v' verified successfully\n", id, string(userNewPwd))
 	}
-	err = userPwd.IsPasswordMatch(pwd)
+	err = userPwd.IsPasswordMatch(getUserPwdHash(pwd, saltStr))
 	if err == nil {
-		fmt.Printf("Error: Old password '%v' (%v) for user %v accepted\n", pwd, string(pwd), id)
+		fmt.Printf("Error: Old password '%v' for user %v accepted\n", string(pwd), id)
 	} else {
-		fmt.Printf("User '%v', Note that the old password '%v' (%v) cannot be used anymore\n", id, pwd, string(pwd))
+		fmt.Printf("User '%v', Note that the old password '%v' cannot be used anymore\n", id, string(pwd))
 	}
-	newPwd, err = userPwd.UpdatePassword(userPwd.Password, pwd, true)
+	_, err = userPwd.UpdatePassword(getUserPwdHash(userNewPwd, saltStr), pwd, true)
 	if err == nil {
-		fmt.Printf("Error: Password '%v' (typed password %v) for user %v was already used\n", newPwd, string(pwd), id)
+		fmt.Printf("Error: Password '%v' for user %v was already used\n", string(pwd), id)
 	} else {
 		fmt.Printf("Entity '%v'. Note that the old password (entered password) %v was already used\n", id, string(pwd))
 	}
+	// Output:
+	// User 'User-1', updated password to 'a1B2c3d^@a'
+	// User 'User-1', new password 'a1B2c3d^@a' verified successfully
+	// User 'User-1', Note that the old password 'a1B2c3d^@' cannot be used anymore
+	// Entity 'User-1'. Note that the old password (entered password) a1B2c3d^@ was already used
 }
 
 // Example of how to use the reset password function:
@@ -74,14 +83,17 @@ func ExampleUserPwd_ResetPassword() {
 	newPwd := password.GetHashedPwd(tPwd)
 	err := userPwd.IsPasswordMatch(newPwd)
 	if err != nil {
-		fmt.Printf("Check of newly generated password '%v' for user %v failed, error %v\n", newPwd, id, err)
+		fmt.Printf("Check of newly generated password for user %v failed, error %v\n", id, err)
 	} else {
-		fmt.Printf("Entity %v, after resetting password '%v' verified successfully\n", id, newPwd)
+		fmt.Printf("Entity %v, after resetting password verified successfully\n", id)
 	}
 	err = userPwd.IsPasswordMatch(newPwd)
 	if err == nil {
-		fmt.Printf("Error: Newly generated password '%v' could be used only once\n", newPwd)
+		fmt.Printf("Error: Newly generated password could be used only once\n")
 	} else {
-		fmt.Printf("Newly generated password '%v', for entity %v, can only be used once\n", newPwd, id)
+		fmt.Printf("Newly generated password, for entity %v, can only be used once\n", id)
 	}
+	// Output:
+	// Entity User1, after resetting password verified successfully
+	// Newly generated password, for entity User1, can only be used once
 }
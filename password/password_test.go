@@ -18,6 +18,13 @@ var (
 
 func init() {
 	defaultPassword = []byte(GenerateNewValidPassword())
+	SetHashParams(HashParams{Algorithm: Pbkdf2Sha256Algorithm, Iterations: 1000})
+}
+
+// Return the hash of the salted password that is used to verify it
+func getPwdHash(pwd []byte, saltData []byte) []byte {
+	tPwd, _ := salt.GenerateSaltedPassword(pwd, MinPasswordLength, MaxPasswordLength, saltData, -1)
+	return GetHashedPwd(tPwd)
 }
 
 func checkValidPasswordLen(t *testing.T, user *UserPwd) {
@@ -82,15 +89,18 @@ func Test_UpdatePwd(t *testing.T) {
 		t.Error("Test fail, can't initialized user password structure, error:", err)
 		t.FailNow()
 	}
+	current := defaultPassword
 	for i := 0; i < defaultNumberOfOldPasswords*2; i++ {
 		pwd := []byte(string(defaultPassword) + fmt.Sprintf("%d", i))
-		newPwd, err := user.UpdatePassword(user.Password, pwd, true)
+		newPwd, err := user.UpdatePassword(getPwdHash(current, user.Salt), pwd, true)
 		if err != nil {
 			t.Errorf("Test fail: user: %v, password %v, ('%v') rejected, but it was't used, error: %v", user, newPwd, string(pwd), err)
+		} else {
+			current = pwd
 		}
 		for j := i; j >= i-defaultNumberOfOldPasswords && j >= 0; j-- {
 			pwd := []byte(string(defaultPassword) + fmt.Sprintf("%d", j))
-			newPwd, err := user.UpdatePassword(user.Password, pwd, true)
+			newPwd, err := user.UpdatePassword(getPwdHash(current, user.Salt), pwd, true)
 			if err == nil {
 				t.Errorf("Test fail: password %v ('%v') was already used, but it was accepted, user data: %v", newPwd, string(pwd), user)
 			}
@@ -162,20 +172,26 @@ func Test_VerifyPwdBlocked(t *testing.T) {
 		t.Error("Test fail, can't initialized user password structure, error:", err)
 		t.FailNow()
 	}
-	for i := 0; i < maxPwdAttempts*2; i++ {
+	current := defaultPassword
+	for i := 0; i < defaultPwdAttempts*2; i++ {
 		for j := 0; j < i; j++ {
 			user.IsPasswordMatch(wrongPwd)
 		}
-		err = user.IsPasswordMatch(user.Password)
-		if err != nil && i < maxPwdAttempts {
-			t.Errorf("Test fail: password was blocked after %v attempts, it should be blocked only after %v wrong attempts", i, maxPwdAttempts)
-		} else if err == nil && i >= maxPwdAttempts {
-			t.Errorf("Test fail: password was not blocked after %v wrong attempts, it should be blocked after %v wrong attempts", i, maxPwdAttempts)
-		} else if err != nil && i >= maxPwdAttempts {
+		err = user.IsPasswordMatch(getPwdHash(current, user.Salt))
+		if err != nil && i < defaultPwdAttempts {
+			t.Errorf("Test fail: password was blocked after %v attempts, it should be blocked only after %v wrong attempts", i, defaultPwdAttempts)
+		} else if err == nil && i >= defaultPwdAttempts {
+			t.Errorf("Test fail: password was not blocked after %v wrong attempts, it should be blocked after %v wrong attempts", i, defaultPwdAttempts)
+		} else if err != nil && i >= defaultPwdAttempts {
 			pwd := GenerateNewValidPassword()
 			expiration := time.Now().Add(time.Duration(defaultTemporaryPwdExpirationMinutes) * time.Second * 60)
-			user.updatePasswordHandler(user.Password, pwd, expiration, false, true)
-			err = user.IsPasswordMatch(user.Password)
+			_, err = user.updatePasswordHandler(getPwdHash(current, user.Salt), pwd, expiration, false, true)
+			if err == nil {
+				t.Errorf("Test fail: the blocked password was updated")
+			}
+			user.setPassword(pwd, expiration, false) // the password is set by the reset path
+			current = pwd
+			err = user.IsPasswordMatch(getPwdHash(current, user.Salt))
 			if err != nil {
 				t.Errorf("Test fail: password errorCoounter must be cleared after password set, counter attempts: %v", user.ErrorsCounter)
 			}
@@ -212,13 +228,16 @@ func Test_ResetPassword(t *testing.T) {
 	if err == nil {
 		t.Errorf("Test fail: The temporary pwd: '%v' accepted twice", newPwd)
 	}
+	current := tmpPwd
 	for i := 0; i < 3; i++ {
 		pass = []byte(string(pass) + "a1^A")
 		expiration := time.Now().Add(time.Duration(defaultTemporaryPwdExpirationMinutes) * time.Second * 60)
-		newPwd, err := user.UpdatePasswordAfterReset(user.Password, pass, expiration)
+		_, err := user.UpdatePasswordAfterReset(getPwdHash(current, user.Salt), pass, expiration)
 		if err != nil {
 			t.Errorf("Test fail: can't use the new password: '%v' (%v), return an error: %v", pass, string(pass), err)
 		} else {
+			current = pass
+			newPwd := getPwdHash(pass, user.Salt)
 			err := user.IsPasswordMatch(newPwd)
 			if err != nil {
 				t.Errorf("Test fail: correct password: '%v' (%v), return an error: %v", newPwd, string(pass), err)
@@ -0,0 +1,542 @@
+// Package qrcode : The qrcode package provides a pure Go QR code encoder (ISO/IEC 18004), e.g. for the enrollment of users into authenticator applications.
+//
+// The data is encoded in byte mode using the smallest version (1-40) that fits it at the requested error correction level,
+// the mask with the lowest penalty score is selected. The encoded symbol can be rendered as a PNG image or as an SVG image,
+// both include the standard quiet zone of 4 modules
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// ErrorCorrectionLevel : The error correction level of the QR code, the higher the level the more damage
+// the QR code can sustain and the more space the error correction data takes
+type ErrorCorrectionLevel int
+
+const (
+	// Low : about 7% of the codewords can be restored
+	Low ErrorCorrectionLevel = iota
+	// Medium : about 15% of the codewords can be restored
+	Medium
+	// Quartile : about 25% of the codewords can be restored
+	Quartile
+	// High : about 30% of the codewords can be restored
+	High
+)
+
+const (
+	minVersion = 1
+	maxVersion = 40
+	numOfMasks = 8
+
+	quietZone = 4
+
+	byteModeIndicator = 0x4
+
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+var (
+	levelNames = []string{"L", "M", "Q", "H"}
+	// the error correction level bits of the format information
+	formatBits = []int{1, 0, 3, 2}
+
+	// the number of error correction codewords in each block, by error correction level and version
+	eccCodewordsPerBlock = [][]int{
+		{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	// the number of error correction blocks, by error correction level and version
+	numOfEccBlocks = [][]int{
+		{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// Code : An encoded QR code symbol, the modules are indexed by row (y) and column (x)
+type Code struct {
+	Version int
+	Level   ErrorCorrectionLevel
+	Mask    int
+	size    int
+	modules [][]bool
+	isFunc  [][]bool
+}
+
+func (l ErrorCorrectionLevel) String() string {
+	if l < Low || l > High {
+		return fmt.Sprintf("Unknown error correction level %d", int(l))
+	}
+	return levelNames[l]
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("QR code: version: %v, error correction level: %v, mask: %v, size: %vx%v", c.Version, c.Level, c.Mask, c.size, c.size)
+}
+
+func isLevelValid(level ErrorCorrectionLevel) error {
+	if level < Low || level > High {
+		return fmt.Errorf("The error correction level %d is not valid, it must be one of: Low, Medium, Quartile or High", int(level))
+	}
+	return nil
+}
+
+// Return the number of modules that can store data (and error correction) codewords in the given version,
+// including the remainder bits
+func getNumOfRawDataModules(version int) int {
+	res := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		res -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			res -= 36
+		}
+	}
+	return res
+}
+
+// Return the number of data codewords (without the error correction codewords) of the given version and level
+func getNumOfDataCodewords(version int, level ErrorCorrectionLevel) int {
+	return getNumOfRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numOfEccBlocks[level][version]
+}
+
+// Return the number of bits of the character count indicator of the byte mode in the given version
+func getCharCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// Encode : Encode the given data in byte mode as a QR code of the smallest version that fits it at the given error correction level
+func Encode(data []byte, level ErrorCorrectionLevel) (*Code, error) {
+	err := isLevelValid(level)
+	if err != nil {
+		return nil, err
+	}
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if 4+getCharCountBits(version)+len(data)*8 <= getNumOfDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, fmt.Errorf("The data length %v is too long to be encoded in a QR code at error correction level %v", len(data), level)
+	}
+	codewords := getDataCodewords(data, version, level)
+	c := newCode(version, level)
+	c.drawCodewords(addEccAndInterleave(codewords, version, level))
+	c.Mask = c.selectMask()
+	c.applyMask(c.Mask)
+	c.drawFormatBits(c.Mask)
+	c.isFunc = nil
+	return c, nil
+}
+
+// Return the data codewords: the mode indicator, the character count, the data, the terminator and the padding
+func getDataCodewords(data []byte, version int, level ErrorCorrectionLevel) []byte {
+	var bb bitBuffer
+
+	bb.appendBits(byteModeIndicator, 4)
+	bb.appendBits(len(data), getCharCountBits(version))
+	for _, b := range data {
+		bb.appendBits(int(b), 8)
+	}
+	capacity := getNumOfDataCodewords(version, level) * 8
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.appendBits(0, terminator)
+	bb.appendBits(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.appendBits(pad, 8)
+	}
+	return bb.getBytes()
+}
+
+// Split the data codewords into blocks, add the error correction codewords to each block and interleave the blocks
+func addEccAndInterleave(data []byte, version int, level ErrorCorrectionLevel) []byte {
+	numBlocks := numOfEccBlocks[level][version]
+	blockEccLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := getNumOfRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := getReedSolomonDivisor(blockEccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		datLen := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+		dat := append([]byte{}, data[k:k+datLen]...)
+		k += datLen
+		ecc := getReedSolomonRemainder(dat, divisor)
+		if i < numShortBlocks {
+			dat = append(dat, 0) // a place holder, it is skipped when interleaving
+		}
+		blocks[i] = append(dat, ecc...)
+	}
+	res := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				res = append(res, block[i])
+			}
+		}
+	}
+	return res
+}
+
+func newCode(version int, level ErrorCorrectionLevel) *Code {
+	size := version*4 + 17
+	c := Code{Version: version, Level: level, size: size, modules: make([][]bool, size), isFunc: make([][]bool, size)}
+	for i := 0; i < size; i++ {
+		c.modules[i] = make([]bool, size)
+		c.isFunc[i] = make([]bool, size)
+	}
+	c.drawFunctionPatterns()
+	return &c
+}
+
+func (c *Code) setFunctionModule(x int, y int, isDark bool) {
+	c.modules[y][x] = isDark
+	c.isFunc[y][x] = true
+}
+
+// Draw the finder, timing and alignment patterns and reserve the format and version information areas
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.size; i++ {
+		c.setFunctionModule(6, i, i%2 == 0)
+		c.setFunctionModule(i, 6, i%2 == 0)
+	}
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.size-4, 3)
+	c.drawFinderPattern(3, c.size-4)
+
+	positions := getAlignmentPatternPositions(c.Version)
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			// the corners that overlap the finder patterns are skipped
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(positions[i], positions[j])
+		}
+	}
+	c.drawFormatBits(0) // reserved, drawn again after the mask is selected
+	c.drawVersion()
+}
+
+// Draw a finder pattern and its separator around the given center
+func (c *Code) drawFinderPattern(x int, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			dist := maxInt(absInt(dx), absInt(dy))
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < c.size && yy >= 0 && yy < c.size {
+				c.setFunctionModule(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+// Draw an alignment pattern around the given center
+func (c *Code) drawAlignmentPattern(x int, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunctionModule(x+dx, y+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+		}
+	}
+}
+
+// Return the centers of the alignment patterns (for both of the axes) of the given version
+func getAlignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	res := make([]int, numAlign)
+	res[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		res[i] = pos
+	}
+	return res
+}
+
+func getBit(x int, i uint) bool {
+	return (x>>i)&1 != 0
+}
+
+// Draw the 2 copies of the format information (the error correction level and the mask) and the dark module
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBits[c.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		c.setFunctionModule(8, i, getBit(bits, uint(i)))
+	}
+	c.setFunctionModule(8, 7, getBit(bits, 6))
+	c.setFunctionModule(8, 8, getBit(bits, 7))
+	c.setFunctionModule(7, 8, getBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunctionModule(14-i, 8, getBit(bits, uint(i)))
+	}
+	for i := 0; i < 8; i++ {
+		c.setFunctionModule(c.size-1-i, 8, getBit(bits, uint(i)))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunctionModule(8, c.size-15+i, getBit(bits, uint(i)))
+	}
+	c.setFunctionModule(8, c.size-8, true)
+}
+
+// Draw the 2 copies of the version information, only versions 7 and above have it
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		bit := getBit(bits, uint(i))
+		a := c.size - 11 + i%3
+		b := i / 3
+		c.setFunctionModule(a, b, bit)
+		c.setFunctionModule(b, a, bit)
+	}
+}
+
+// Draw the codewords in the data area, in the zigzag order (2 columns at a time, from the bottom right corner)
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 { // skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 { // upward
+					y = c.size - 1 - vert
+				}
+				if c.isFunc[y][x] == false && i < len(data)*8 {
+					c.modules[y][x] = getBit(int(data[i>>3]), uint(7-i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+func isMasked(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// Apply the given mask to the data modules, applying the same mask again restores them
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.isFunc[y][x] == false && isMasked(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// Return the mask that results in the lowest penalty score
+func (c *Code) selectMask() int {
+	best := 0
+	minPenalty := -1
+	for mask := 0; mask < numOfMasks; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		penalty := c.getPenaltyScore()
+		if minPenalty < 0 || penalty < minPenalty {
+			best = mask
+			minPenalty = penalty
+		}
+		c.applyMask(mask)
+	}
+	return best
+}
+
+// Return the penalty score of the symbol: runs of the same color, 2x2 blocks of the same color,
+// finder like patterns and the imbalance between the dark and the light modules
+func (c Code) getPenaltyScore() int {
+	res := 0
+	dark := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for i := 0; i < c.size; i++ {
+		for _, isRow := range []bool{true, false} {
+			get := func(j int) bool {
+				if isRow {
+					return c.modules[i][j]
+				}
+				return c.modules[j][i]
+			}
+			runLen := 1
+			for j := 1; j <= c.size; j++ {
+				if j < c.size && get(j) == get(j-1) {
+					runLen++
+					continue
+				}
+				if runLen >= 5 {
+					res += penaltyN1 + runLen - 5
+				}
+				runLen = 1
+			}
+			for j := 0; j+len(finderLike[0]) <= c.size; j++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, p := range pattern {
+						if get(j+k) != p {
+							match = false
+							break
+						}
+					}
+					if match {
+						res += penaltyN3
+					}
+				}
+			}
+		}
+	}
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x < c.size-1 && y < c.size-1 && c.modules[y][x] == c.modules[y][x+1] &&
+				c.modules[y][x] == c.modules[y+1][x] && c.modules[y][x] == c.modules[y+1][x+1] {
+				res += penaltyN2
+			}
+		}
+	}
+	total := c.size * c.size
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	res += k * penaltyN4
+	return res
+}
+
+// Size : Return the number of modules in each row and column of the symbol (without the quiet zone)
+func (c Code) Size() int {
+	return c.size
+}
+
+// IsDark : Return true if the module at the given column (x) and row (y) is dark, the modules outside of the symbol are light
+func (c Code) IsDark(x int, y int) bool {
+	return x >= 0 && x < c.size && y >= 0 && y < c.size && c.modules[y][x]
+}
+
+// Image : Return the QR code as an image, each module is moduleSize pixels and the quiet zone is included
+func (c Code) Image(moduleSize int) (image.Image, error) {
+	if moduleSize < 1 {
+		return nil, fmt.Errorf("The module size %v must be at least 1 pixel", moduleSize)
+	}
+	imgSize := (c.size + 2*quietZone) * moduleSize
+	img := image.NewGray(image.Rect(0, 0, imgSize, imgSize))
+	for py := 0; py < imgSize; py++ {
+		for px := 0; px < imgSize; px++ {
+			col := color.White
+			if c.IsDark(px/moduleSize-quietZone, py/moduleSize-quietZone) {
+				col = color.Black
+			}
+			img.Set(px, py, col)
+		}
+	}
+	return img, nil
+}
+
+// PNG : Return the QR code as a PNG image, each module is moduleSize pixels and the quiet zone is included
+func (c Code) PNG(moduleSize int) ([]byte, error) {
+	img, err := c.Image(moduleSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG : Return the QR code as an SVG image, each module is moduleSize user units and the quiet zone is included
+func (c Code) SVG(moduleSize int) (string, error) {
+	if moduleSize < 1 {
+		return "", fmt.Errorf("The module size %v must be at least 1", moduleSize)
+	}
+	dim := c.size + 2*quietZone
+	var path []string
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				path = append(path, fmt.Sprintf("M%v,%vh1v1h-1z", x+quietZone, y+quietZone))
+			}
+		}
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %v %v" width="%v" height="%v" stroke="none">
+<rect width="100%%" height="100%%" fill="#FFFFFF"/>
+<path d="%v" fill="#000000"/>
+</svg>
+`, dim, dim, dim*moduleSize, dim*moduleSize, strings.Join(path, " ")), nil
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,174 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// "libsecurity" encoded at error correction level Medium (version 1, mask 6)
+var libsecurityCode = []string{
+	"#######.#.....#######",
+	"#.....#.#.##..#.....#",
+	"#.###.#.#.#...#.###.#",
+	"#.###.#..#.##.#.###.#",
+	"#.###.#.##.##.#.###.#",
+	"#.....#.......#.....#",
+	"#######.#.#.#.#######",
+	"..........#..........",
+	"#..######..#.#..#.###",
+	"...###.##..##.##.....",
+	".##.#.##.####.....###",
+	".###........##.##.#..",
+	".#..#.#.#.####..##...",
+	"........#.#.##.##.##.",
+	"#######.####....#....",
+	"#.....#.#.#..###.###.",
+	"#.###.#.###..#.#.....",
+	"#.###.#.#.####...##..",
+	"#.###.#..######.#..##",
+	"#.....#...###.##.####",
+	"#######.#.....#.#....",
+}
+
+// The data and the error correction codewords of "HELLO WORLD" (alphanumeric mode) at version 1, level Medium
+var (
+	helloWorldData = []byte{0x20, 0x5B, 0x0B, 0x78, 0xD1, 0x72, 0xDC, 0x4D, 0x43, 0x40, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	helloWorldEcc  = []byte{0xC4, 0x23, 0x27, 0x77, 0xEB, 0xD7, 0xE7, 0xE2, 0x5D, 0x17}
+)
+
+// Return the error correction level and the mask of the format information of the given copy
+func getFormatInfo(c *Code, copyIdx int) (ErrorCorrectionLevel, int) {
+	bits := 0
+	for i := 0; i < 15; i++ {
+		var x, y int
+		if copyIdx == 0 {
+			switch {
+			case i <= 5:
+				x, y = 8, i
+			case i == 6:
+				x, y = 8, 7
+			case i == 7:
+				x, y = 8, 8
+			case i == 8:
+				x, y = 7, 8
+			default:
+				x, y = 14-i, 8
+			}
+		} else if i < 8 {
+			x, y = c.size-1-i, 8
+		} else {
+			x, y = 8, c.size-15+i
+		}
+		if c.IsDark(x, y) {
+			bits |= 1 << uint(i)
+		}
+	}
+	bits ^= 0x5412
+	level := ErrorCorrectionLevel(-1)
+	for l, f := range formatBits {
+		if f == bits>>13 {
+			level = ErrorCorrectionLevel(l)
+		}
+	}
+	return level, (bits >> 10) & 0x7
+}
+
+// Verify that the Reed-Solomon error correction codewords are as expected
+func Test_reedSolomon(t *testing.T) {
+	ecc := getReedSolomonRemainder(helloWorldData, getReedSolomonDivisor(len(helloWorldEcc)))
+	if bytes.Equal(ecc, helloWorldEcc) == false {
+		t.Errorf("Test fail: the error correction codewords are % X instead of % X", ecc, helloWorldEcc)
+	}
+}
+
+// Verify that the encoded QR code is the same as the expected one
+func Test_encodeKnownCode(t *testing.T) {
+	c, err := Encode([]byte("libsecurity"), Medium)
+	if err != nil {
+		t.Fatalf("Test fail: can't encode the data, error: %v", err)
+	}
+	if c.Version != 1 || c.Mask != 6 || c.Size() != len(libsecurityCode) {
+		t.Fatalf("Test fail: the encoded %v is not version 1 with mask 6", c)
+	}
+	for y, row := range libsecurityCode {
+		for x, m := range row {
+			if c.IsDark(x, y) != (m == '#') {
+				t.Fatalf("Test fail: the module at (%v, %v) is not as expected", x, y)
+			}
+		}
+	}
+}
+
+// Verify that the smallest version that fits the data is used, that the format information of both of the copies holds
+// the error correction level and the mask and that data that is too long is rejected
+func Test_encodeVersions(t *testing.T) {
+	maxLen := []int{2953, 2331, 1663, 1273}
+	for l := Low; l <= High; l++ {
+		for _, dataLen := range []int{0, 10, 100, 500, maxLen[l]} {
+			c, err := Encode(bytes.Repeat([]byte{'a'}, dataLen), l)
+			if err != nil {
+				t.Fatalf("Test fail: can't encode %v bytes at level %v, error: %v", dataLen, l, err)
+			}
+			if c.Size() != c.Version*4+17 || (c.Version > 1 && 4+getCharCountBits(c.Version-1)+dataLen*8 <= getNumOfDataCodewords(c.Version-1, l)*8) {
+				t.Errorf("Test fail: %v is not the smallest QR code that fits %v bytes", c, dataLen)
+			}
+			for i := 0; i < 2; i++ {
+				level, mask := getFormatInfo(c, i)
+				if level != l || mask != c.Mask {
+					t.Errorf("Test fail: the format information copy %v of %v is level %v, mask %v", i, c, level, mask)
+				}
+			}
+		}
+		_, err := Encode(bytes.Repeat([]byte{'a'}, maxLen[l]+1), l)
+		if err == nil {
+			t.Errorf("Test fail: %v bytes were encoded at level %v", maxLen[l]+1, l)
+		}
+	}
+	_, err := Encode([]byte("a"), High+1)
+	if err == nil {
+		t.Errorf("Test fail: the data was encoded using an illegal error correction level")
+	}
+}
+
+// Verify that the PNG and the SVG images include the quiet zone and the modules of the QR code
+func Test_encodeImages(t *testing.T) {
+	moduleSize := 3
+	c, _ := Encode([]byte("libsecurity"), Medium)
+	data, err := c.PNG(moduleSize)
+	if err != nil {
+		t.Fatalf("Test fail: can't generate the PNG image, error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Test fail: can't decode the PNG image, error: %v", err)
+	}
+	imgSize := (c.Size() + 2*quietZone) * moduleSize
+	if img.Bounds().Dx() != imgSize || img.Bounds().Dy() != imgSize {
+		t.Fatalf("Test fail: the PNG image size is %v instead of %vx%v", img.Bounds(), imgSize, imgSize)
+	}
+	for py := 0; py < imgSize; py++ {
+		for px := 0; px < imgSize; px++ {
+			r, _, _, _ := img.At(px, py).RGBA()
+			if (r == 0) != c.IsDark(px/moduleSize-quietZone, py/moduleSize-quietZone) {
+				t.Fatalf("Test fail: the PNG image pixel (%v, %v) is not as expected", px, py)
+			}
+		}
+	}
+	svg, err := c.SVG(moduleSize)
+	if err != nil {
+		t.Fatalf("Test fail: can't generate the SVG image, error: %v", err)
+	}
+	if strings.Contains(svg, "<svg") == false || strings.Count(svg, "h1v1h-1z") != strings.Count(strings.Join(libsecurityCode, ""), "#") {
+		t.Errorf("Test fail: the SVG image does not include the modules of the QR code: '%v'", svg)
+	}
+	_, err = c.PNG(0)
+	if err == nil {
+		t.Errorf("Test fail: a PNG image with module size 0 was generated")
+	}
+	_, err = c.SVG(0)
+	if err == nil {
+		t.Errorf("Test fail: an SVG image with module size 0 was generated")
+	}
+}
@@ -0,0 +1,70 @@
+package qrcode
+
+// The error correction codewords are computed using Reed-Solomon over GF(2^8) with the primitive polynomial
+// x^8 + x^4 + x^3 + x^2 + 1 (0x11D), as defined by the QR code standard
+
+const (
+	gfPrimitivePoly = 0x11D
+)
+
+// bitBuffer : A sequence of bits, each item holds a single bit
+type bitBuffer []bool
+
+// Append the given number of the low bits of val, the most significant bit first
+func (bb *bitBuffer) appendBits(val int, numOfBits int) {
+	for i := numOfBits - 1; i >= 0; i-- {
+		*bb = append(*bb, (val>>uint(i))&1 != 0)
+	}
+}
+
+// Return the bits packed into bytes, the most significant bit first. The length must be a multiple of 8
+func (bb bitBuffer) getBytes() []byte {
+	res := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			res[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+	return res
+}
+
+// Return the product of the 2 field elements
+func gfMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * gfPrimitivePoly)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// Return the coefficients of the generator polynomial of the given degree, the leading coefficient (always 1) is omitted
+func getReedSolomonDivisor(degree int) []byte {
+	res := make([]byte, degree)
+	res[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range res {
+			res[j] = gfMultiply(res[j], root)
+			if j+1 < len(res) {
+				res[j] ^= res[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return res
+}
+
+// Return the error correction codewords of the given data using the given generator polynomial
+func getReedSolomonRemainder(data []byte, divisor []byte) []byte {
+	res := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ res[0]
+		copy(res, res[1:])
+		res[len(res)-1] = 0
+		for i := range res {
+			res[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return res
+}
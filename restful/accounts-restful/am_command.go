@@ -101,6 +101,23 @@ func (l AmRestful) setFullRoute(service *restful.WebService) {
 		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
 		Writes(cr.Secret{}))
 
+	str = fmt.Sprintf(urlCommands[handleUserPwdCommand], usersPath, userIDParam, resetTokenPath)
+	service.Route(service.POST(str).
+		To(l.restSendResetToken).
+		Doc("Send a password reset token to the user using the delivery channel").
+		Operation("sendResetToken").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Writes(cr.StringMessage{}))
+
+	str = fmt.Sprintf(urlCommands[handleUserPwdCommand], usersPath, userIDParam, resetTokenPath)
+	service.Route(service.PATCH(str).
+		To(l.restResetPwdWithToken).
+		Doc("Set a new Account Management password using a password reset token").
+		Operation("resetPwdWithToken").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Reads(cr.ResetTokenSecret{}).
+		Writes(cr.URL{}))
+
 	str = fmt.Sprintf(urlCommands[handleAuthenticateCommand], verifyPath)
 	service.Route(service.GET(str).
 		Filter(l.st.VerifyToken).
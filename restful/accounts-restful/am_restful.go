@@ -26,6 +26,7 @@ const (
 	logoutPath      = "/logout"
 	pwdPath         = "password"
 	privilegePath   = "privilege"
+	resetTokenPath  = "reset-token"
 	userIDParam     = "user-name"
 	userNameComment = "user name"
 
@@ -195,7 +196,13 @@ func (l AmRestful) restAddAm(request *restful.Request, response *restful.Respons
 	}
 	saltStr, _ := salt.GetRandomSalt(saltLen)
 
-	data, err := am.NewUserAm(privilege.Privilege, []byte(privilege.Password), saltStr, checkPasswordStrength)
+	err := password.CheckBlocklist(privilege.Password, name)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data, err := am.NewUserAmWithPolicy(privilege.Privilege, []byte(privilege.Password), saltStr, checkPasswordStrength,
+		l.st.UsersList.GetEntityPasswordPolicy(name))
 	if err != nil {
 		l.setError(response, http.StatusBadRequest, err)
 		return
@@ -276,7 +283,12 @@ func (l AmRestful) restUpdatePwd(request *restful.Request, response *restful.Res
 	if data == nil {
 		return
 	}
-	tPwd, err := salt.GenerateSaltedPassword([]byte(secrets.OldPassword), password.MinPasswordLength, password.MaxPasswordLength, data.Pwd.Salt, -1)
+	err = password.CheckBlocklist(secrets.NewPassword, userName)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	tPwd, err := salt.GenerateSaltedPassword(data.Pwd.GetPolicy().NormalizePwd([]byte(secrets.OldPassword)), password.MinPasswordLength, password.MaxPasswordLength, data.Pwd.Salt, -1)
 	oldPwd := password.GetHashedPwd(tPwd)
 	err = data.UpdateUserPwd(userName, oldPwd, []byte(secrets.NewPassword), false)
 	if err != nil {
@@ -310,3 +322,57 @@ func (l AmRestful) restResetPwd(request *restful.Request, response *restful.Resp
 	}
 	response.WriteHeaderAndEntity(http.StatusCreated, cr.Secret{Secret: string(pwd)})
 }
+
+func (l AmRestful) restSendResetToken(request *restful.Request, response *restful.Response) {
+	userName := request.PathParameter(userIDParam)
+	if password.GetResetTokenSender() == nil {
+		l.setError(response, http.StatusServiceUnavailable, fmt.Errorf("Password reset tokens can't be used: no delivery channel was set"))
+		return
+	}
+	err := password.ThrottleResetTokenRequest(userName)
+	if err != nil {
+		l.setError(response, http.StatusTooManyRequests, err)
+		return
+	}
+	data, err := cr.GetPropertyData(userName, defs.AmPropertyName, l.st.UsersList)
+	// as with the direct reset, the root user password can't be reset
+	if err == nil && userName != defs.RootUserName {
+		err = data.(*am.AmUserInfo).Pwd.SendResetToken(userName)
+		if err != nil {
+			logger.Error.Printf("The password reset token of the user '%v' was not sent, error: %v", userName, err)
+		}
+	}
+	// the same response is returned for unknown users and for failed deliveries in order not to reveal which users exist
+	response.WriteHeaderAndEntity(http.StatusAccepted, cr.StringMessage{Str: fmt.Sprintf("A password reset token was sent to the user '%v'", userName)})
+}
+
+func (l AmRestful) restResetPwdWithToken(request *restful.Request, response *restful.Response) {
+	var secret cr.ResetTokenSecret
+	userName := request.PathParameter(userIDParam)
+
+	err := request.ReadEntity(&secret)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	// the new password is checked before the user is looked up so unknown users get the same responses as the existing ones
+	if checkPasswordStrength {
+		err = password.CheckBlocklist(secret.NewPassword, userName)
+		if err != nil {
+			l.setError(response, http.StatusBadRequest, err)
+			return
+		}
+	}
+	data, err := cr.GetPropertyData(userName, defs.AmPropertyName, l.st.UsersList)
+	if err != nil {
+		// the same response is returned for unknown users as for a wrong token in order not to reveal which users exist
+		l.setError(response, http.StatusBadRequest, password.ErrInvalidResetToken)
+		return
+	}
+	err = data.(*am.AmUserInfo).ResetUserPwdWithToken(userName, secret.Token, []byte(secret.NewPassword), checkPasswordStrength)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusCreated, l.getURLPath(request, userName))
+}
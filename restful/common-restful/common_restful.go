@@ -71,6 +71,12 @@ type UpdateSecret struct {
 	NewPassword string
 }
 
+// ResetTokenSecret : ResetTokenSecret struct definition
+type ResetTokenSecret struct {
+	Token       string
+	NewPassword string
+}
+
 // URL : Uel struct definition
 type URL struct {
 	URL string
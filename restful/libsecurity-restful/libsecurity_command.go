@@ -59,6 +59,24 @@ func (s LibsecurityRestful) loadStroreRoute(service *restful.WebService) {
 		Reads(cr.SecureFile{}))
 }
 
+func (s LibsecurityRestful) unsealRoute(service *restful.WebService) {
+	str := fmt.Sprintf(urlCommands[handleCommand], unsealPath)
+	service.Route(service.PATCH(str).
+		// no filter is needed, the data is not loaded yet while the server is sealed
+		To(s.restUnseal).
+		Doc("Submit a key share to unseal the server").
+		Operation("unseal").
+		Reads(unsealShare{}).
+		Writes(unsealStatus{}))
+
+	str = fmt.Sprintf(urlCommands[handleCommand], unsealPath)
+	service.Route(service.GET(str).
+		To(s.restGetUnsealStatus).
+		Doc("Get the server seal status").
+		Operation("getUnsealStatus").
+		Writes(unsealStatus{}))
+}
+
 func (s LibsecurityRestful) versionRoute(service *restful.WebService) {
 	str := fmt.Sprintf(urlCommands[handleCommand], cr.VersionPath)
 	service.Route(service.GET(str).
@@ -81,5 +99,6 @@ func (s LibsecurityRestful) RegisterBasic(container *restful.Container) {
 
 	s.loadStroreRoute(service)
 	s.versionRoute(service)
+	s.unsealRoute(service)
 	container.Add(service)
 }
@@ -17,9 +17,12 @@ import (
 )
 
 const (
-	stPrefix  = "/libsecurity"
-	storePath = "/store"
-	loadPath  = "/load"
+	stPrefix   = "/libsecurity"
+	storePath  = "/store"
+	loadPath   = "/load"
+	unsealPath = "/unseal"
+
+	maxExtraUnsealShares = 2 // the number of shares above the threshold that are tried before all the shares are discarded
 
 	userIDParam = "user-name"
 )
@@ -38,6 +41,28 @@ type LibsecurityRestful struct {
 	loginKey      []byte
 	SignKey       *rsa.PrivateKey
 	SecureStorage *ss.SecureStorage
+
+	storageBackendName   string
+	secureStorageBackend ss.Backend // if it is set, the secure storage is persisted using it with a write-ahead journal
+	seal                 *sealState
+}
+
+// The state of the sealed mode: the Security Tool data is loaded only after enough key shares are submitted
+type sealState struct {
+	sealed    bool
+	backend   ss.Backend
+	threshold int
+	shares    []string
+}
+
+type unsealShare struct {
+	Share string
+}
+
+type unsealStatus struct {
+	Sealed    bool
+	Threshold int
+	Progress  int
 }
 
 func init() {
@@ -167,6 +192,24 @@ func (l LibsecurityRestful) SameUserUpdatePasswordFilter(req *restful.Request, r
 	l.sameUserFilterCheckPasswordUpdate(req, resp, chain, false)
 }
 
+// IsSameUserOrSuperUser : return true if the request is done by a super user or by the given user (or if there is no filtering),
+// it is used by commands that don't require authentication but return more information to the user itself
+func (l LibsecurityRestful) IsSameUserOrSuperUser(req *restful.Request, name string) bool {
+	if l.toFilter() == false {
+		return true
+	}
+	tokenStr := l.getCookieAccessTokenValue(req)
+	if tokenStr == "" {
+		return false
+	}
+	isUserMatch, err := app.IsItTheSameUser(tokenStr, name, getIPAddress(req), l.verifyKey)
+	if err != nil {
+		return false
+	}
+	isPrivilegeOk, _ := app.IsPrivilegeOk(tokenStr, am.SuperUserPermission, getIPAddress(req), l.verifyKey)
+	return isUserMatch || isPrivilegeOk
+}
+
 // VerifyToken : verify is the received token is legal and as expected
 func (l LibsecurityRestful) VerifyToken(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 	tokenStr := l.getCookieAccessTokenValue(req)
@@ -191,6 +234,130 @@ func (l *LibsecurityRestful) SetData(el *en.EntityManager, loginKeyVal []byte, v
 	l.SecureStorage = secureStorage
 }
 
+// SetStorageBackendName : set the backend type to be used when the Security Tool data is stored/loaded
+func (l *LibsecurityRestful) SetStorageBackendName(name string) error {
+	_, err := ss.NewBackend(name, "")
+	if err != nil {
+		return err
+	}
+	l.storageBackendName = name
+	return nil
+}
+
+// NewStorageBackend : return the configured storage backend for the given path
+func (l LibsecurityRestful) NewStorageBackend(path string) (ss.Backend, error) {
+	return ss.NewBackend(l.storageBackendName, path)
+}
+
+// SetSecureStorageBackend : set the backend that the secure storage is persisted to: the secure storage is loaded from it
+// when it is created, and each item change is written to its write-ahead journal before it is applied
+func (l *LibsecurityRestful) SetSecureStorageBackend(backend ss.Backend) {
+	l.secureStorageBackend = backend
+}
+
+// GetSecureStorageBackend : return the backend that the secure storage is persisted to, nil if it is kept only in memory
+func (l LibsecurityRestful) GetSecureStorageBackend() ss.Backend {
+	return l.secureStorageBackend
+}
+
+// SetSealed : Start in sealed mode: the storage key is not known, it is reconstructed from the key shares that are submitted
+// to the unseal command, and the Security Tool data is loaded from the given backend once enough shares are submitted
+func (l *LibsecurityRestful) SetSealed(backend ss.Backend) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	l.seal = &sealState{sealed: true, backend: backend}
+}
+
+// IsSealed : return true if the Security Tool data was not loaded yet since not enough key shares were submitted
+func (l LibsecurityRestful) IsSealed() bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return l.seal != nil && l.seal.sealed
+}
+
+// SealedFilter : Reject all the commands except the unseal and version commands while the server is sealed
+func (l LibsecurityRestful) SealedFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	path := req.Request.URL.Path
+	if l.IsSealed() && strings.HasPrefix(path, cr.ServicePathPrefix) &&
+		strings.HasSuffix(path, unsealPath) == false && strings.HasSuffix(path, cr.VersionPath) == false {
+		l.setError(resp, http.StatusServiceUnavailable, fmt.Errorf("The server is sealed, the key shares must be submitted first"))
+		return
+	}
+	chain.ProcessFilter(req, resp)
+}
+
+func (l LibsecurityRestful) getUnsealStatus() unsealStatus {
+	if l.seal == nil {
+		return unsealStatus{Sealed: false}
+	}
+	return unsealStatus{Sealed: l.seal.sealed, Threshold: l.seal.threshold, Progress: len(l.seal.shares)}
+}
+
+// Add the given key share, when the threshold is reached the storage key is reconstructed and the data is loaded.
+// If the reconstructed key can't load the data (e.g. one of the shares is of another key), the shares are kept and
+// each additional share is tried with the previous ones, up to maxExtraUnsealShares shares above the threshold
+func (l LibsecurityRestful) addUnsealShare(share string) (unsealStatus, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if l.seal == nil || l.seal.sealed == false {
+		return l.getUnsealStatus(), fmt.Errorf("The server is not sealed")
+	}
+	threshold, err := ss.GetShareThreshold(share)
+	if err != nil {
+		return l.getUnsealStatus(), err
+	}
+	if len(l.seal.shares) > 0 && threshold != l.seal.threshold {
+		return l.getUnsealStatus(), fmt.Errorf("The share threshold %v is not as the threshold of the submitted shares %v", threshold, l.seal.threshold)
+	}
+	for _, s := range l.seal.shares {
+		if s == share {
+			return l.getUnsealStatus(), fmt.Errorf("The share was already submitted")
+		}
+	}
+	l.seal.threshold = threshold
+	if len(l.seal.shares)+1 < threshold {
+		l.seal.shares = append(l.seal.shares, share)
+		return l.getUnsealStatus(), nil
+	}
+	err = l.unsealUsingShares(l.seal.shares, []string{share}, threshold)
+	if err != nil {
+		logger.Error.Printf("Unseal failed: %v", err)
+		if len(l.seal.shares)+1 >= threshold+maxExtraUnsealShares {
+			l.seal.shares = nil
+			return l.getUnsealStatus(), fmt.Errorf("The submitted shares can't unseal the storage, all the shares must be submitted again")
+		}
+		l.seal.shares = append(l.seal.shares, share)
+		return l.getUnsealStatus(), fmt.Errorf("The submitted shares can't unseal the storage, one of them may be invalid, additional shares must be submitted")
+	}
+	l.seal.shares = nil
+	l.seal.sealed = false
+	logger.Info.Println("The server is unsealed, the data was loaded from:", l.seal.backend)
+	return l.getUnsealStatus(), nil
+}
+
+// Try to load the data using the storage key that is reconstructed from each combination of the selected shares
+// and the shares, until the threshold is reached. Return nil if one of the keys loaded the data
+func (l LibsecurityRestful) unsealUsingShares(shares []string, selected []string, threshold int) error {
+	if len(selected) == threshold {
+		key, err := ss.CombineShares(selected)
+		if err != nil {
+			return err
+		}
+		return en.LoadInfoFromBackend(l.seal.backend, key, l.UsersList)
+	}
+	err := fmt.Errorf("Not enough shares to reconstruct the storage key")
+	for i := range shares {
+		err = l.unsealUsingShares(shares[i+1:], append(selected[:len(selected):len(selected)], shares[i]), threshold)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 func (l LibsecurityRestful) getURLPath(request *restful.Request, name string) cr.URL {
 	return cr.URL{URL: fmt.Sprintf("%v/%v", servicePath, name)}
 }
@@ -213,7 +380,17 @@ func (l LibsecurityRestful) restStoreData(request *restful.Request, response *re
 		l.setError(response, http.StatusNotFound, err)
 		return
 	}
-	err = l.UsersList.StoreInfo(fileData.FilePath, []byte(fileData.Secret), checkSecretStrength)
+	backend, err := l.NewStorageBackend(fileData.FilePath)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	if l.UsersList.IsLoadedWithKeyProvider() {
+		// the data was unlocked by a key provider: it is stored using the same keys and key providers, the given secret is not used
+		err = l.UsersList.StoreInfoWithLoadedKeys(backend)
+	} else {
+		err = l.UsersList.StoreInfoToBackend(backend, []byte(fileData.Secret), checkSecretStrength)
+	}
 	if err != nil {
 		l.setError(response, http.StatusInternalServerError, err)
 		return
@@ -230,7 +407,12 @@ func (l LibsecurityRestful) restLoadData(request *restful.Request, response *res
 		l.setError(response, http.StatusNotFound, err)
 		return
 	}
-	err = en.LoadInfo(fileData.FilePath, []byte(fileData.Secret), l.UsersList)
+	backend, err := l.NewStorageBackend(fileData.FilePath)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	err = en.LoadInfoFromBackend(backend, []byte(fileData.Secret), l.UsersList)
 	if err != nil {
 		l.setError(response, http.StatusInternalServerError, err)
 		return
@@ -238,6 +420,29 @@ func (l LibsecurityRestful) restLoadData(request *restful.Request, response *res
 	response.WriteHeaderAndEntity(http.StatusCreated, fileData.FilePath)
 }
 
+func (l LibsecurityRestful) restUnseal(request *restful.Request, response *restful.Response) {
+	var share unsealShare
+
+	err := request.ReadEntity(&share)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	status, err := l.addUnsealShare(share.Share)
+	if err != nil {
+		l.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, status)
+}
+
+func (l LibsecurityRestful) restGetUnsealStatus(request *restful.Request, response *restful.Response) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	response.WriteHeaderAndEntity(http.StatusOK, l.getUnsealStatus())
+}
+
 func getIPAddress(request *restful.Request) string {
 	return strings.Split(request.Request.RemoteAddr, ":")[0]
 }
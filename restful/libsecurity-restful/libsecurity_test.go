@@ -1,15 +1,25 @@
 package libsecurityRestful
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/emicklei/go-restful"
 	am "github.com/ibm-security-innovation/libsecurity-go/accounts"
 	"github.com/ibm-security-innovation/libsecurity-go/acl"
+	app "github.com/ibm-security-innovation/libsecurity-go/app/token"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 	en "github.com/ibm-security-innovation/libsecurity-go/entity"
 	"github.com/ibm-security-innovation/libsecurity-go/ocra"
 	"github.com/ibm-security-innovation/libsecurity-go/otp"
 	"github.com/ibm-security-innovation/libsecurity-go/password"
+	cr "github.com/ibm-security-innovation/libsecurity-go/restful/common-restful"
+	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
 )
 
 const ()
@@ -112,3 +122,93 @@ func Test_AddCheckRemoveACLUserProperty(t *testing.T) {
 
 	testAddCheckRemoveUserProperty(t, defs.AclPropertyName, moduleData)
 }
+
+// Verify that the sealed server loads the data only after the threshold of key shares were submitted
+// Verify that invalid or duplicated shares are rejected without discarding the submitted shares
+// Verify that shares of another key don't discard the valid shares and that the server is unsealed using the valid shares
+// Verify that all the shares are discarded when too many shares can't unseal the server, and that the error doesn't include the storage path
+func Test_Unseal(t *testing.T) {
+	filePath := "./tmp.txt"
+	userName := "user1"
+	key := []byte("the storage key")
+	defer os.Remove(filePath)
+
+	usersList := en.New()
+	usersList.AddUser(userName)
+	backend := ss.NewFileBackend(filePath)
+	usersList.StoreInfoToBackend(backend, key, false)
+	shares, _ := ss.SplitSecret(key, 4, 3)
+	otherShares, _ := ss.SplitSecret([]byte("the other key!!"), 4, 3)
+
+	st := NewLibsecurityRestful()
+	st.SetData(en.New(), nil, nil, nil, nil)
+	_, err := st.addUnsealShare(shares[0])
+	if err == nil {
+		t.Errorf("Test fail: a share was accepted while the server is not sealed")
+	}
+	st.SetSealed(backend)
+	for _, share := range []string{otherShares[0], otherShares[1], shares[0]} {
+		st.addUnsealShare(share)
+	}
+	if st.IsSealed() == false || st.UsersList.IsEntityInList(userName) {
+		t.Errorf("Test fail: the server was unsealed using shares of another key")
+	}
+	for _, share := range []string{"abc", shares[0]} {
+		_, err = st.addUnsealShare(share)
+		if err == nil {
+			t.Errorf("Test fail: the illegal or duplicated share '%v' was accepted", share)
+		}
+	}
+	status, _ := st.addUnsealShare(shares[3])
+	if status.Sealed == false || status.Progress != 4 || status.Threshold != 3 {
+		t.Errorf("Test fail: the unseal status %v is not as expected", status)
+	}
+	status, err = st.addUnsealShare(shares[2])
+	if err != nil || status.Sealed || st.IsSealed() {
+		t.Fatalf("Test fail: the server was not unsealed, status: %v, error: %v", status, err)
+	}
+	if st.UsersList.IsEntityInList(userName) == false {
+		t.Errorf("Test fail: the user '%v' was not loaded when the server was unsealed", userName)
+	}
+
+	st.SetSealed(backend)
+	for _, share := range []string{otherShares[0], otherShares[1], otherShares[2], shares[0]} {
+		st.addUnsealShare(share)
+	}
+	status, err = st.addUnsealShare(shares[1])
+	if err == nil || status.Sealed == false || status.Progress != 0 {
+		t.Errorf("Test fail: the shares were not discarded after %v shares could not unseal the server, status: %v", 3+maxExtraUnsealShares, status)
+	}
+	if err != nil && strings.Contains(err.Error(), filePath) {
+		t.Errorf("Test fail: the unseal error '%v' includes the storage path", err)
+	}
+}
+
+// Verify that a request without a token is not accepted as the request of the user when filtering is used
+// Verify that a request with the token of the user is accepted as the request of that user only
+// Verify that all the requests are accepted when there is no filtering
+func Test_IsSameUserOrSuperUser(t *testing.T) {
+	userName := "user1"
+	signKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	st := NewLibsecurityRestful()
+	st.SetData(en.New(), nil, &signKey.PublicKey, signKey, nil)
+	defer st.SetToFilterFlag(toFilterFlag)
+	st.SetToFilterFlag(true)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if st.IsSameUserOrSuperUser(restful.NewRequest(req), userName) {
+		t.Errorf("Test fail: a request without a token was accepted as the request of the user '%v'", userName)
+	}
+	tokenStr, _ := app.GenerateToken(userName, am.UserPermission, false, getIPAddress(restful.NewRequest(req)), signKey)
+	req.AddCookie(&http.Cookie{Name: cr.AccessToken, Value: tokenStr})
+	if st.IsSameUserOrSuperUser(restful.NewRequest(req), userName) == false {
+		t.Errorf("Test fail: the request with the token of the user '%v' was not accepted", userName)
+	}
+	if st.IsSameUserOrSuperUser(restful.NewRequest(req), "user2") {
+		t.Errorf("Test fail: the request with the token of the user '%v' was accepted as the request of another user", userName)
+	}
+	st.SetToFilterFlag(false)
+	if st.IsSameUserOrSuperUser(restful.NewRequest(httptest.NewRequest("GET", "/", nil)), userName) == false {
+		t.Errorf("Test fail: a request was not accepted when there is no filtering")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,8 @@ import (
 	app "github.com/ibm-security-innovation/libsecurity-go/app/token"
 	en "github.com/ibm-security-innovation/libsecurity-go/entity"
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+	"github.com/ibm-security-innovation/libsecurity-go/otp"
+	"github.com/ibm-security-innovation/libsecurity-go/password"
 	"github.com/ibm-security-innovation/libsecurity-go/restful/accounts-restful"
 	"github.com/ibm-security-innovation/libsecurity-go/restful/acl-restful"
 	cr "github.com/ibm-security-innovation/libsecurity-go/restful/common-restful"
@@ -31,19 +34,27 @@ import (
 )
 
 const (
-	amToken            = "accountManager"
-	umToken            = "um"
-	aclToken           = "acl"
-	appAclToken        = "appAcl"
-	otpToken           = "otp"
-	ocraToken          = "ocra"
-	passwordToken      = "password"
-	secureStorageToken = "secureStorage"
+	amToken                 = "accountManager"
+	umToken                 = "um"
+	aclToken                = "acl"
+	appAclToken             = "appAcl"
+	otpToken                = "otp"
+	ocraToken               = "ocra"
+	passwordToken           = "password"
+	secureStorageToken      = "secureStorage"
+	storageBackendToken     = "storageBackend"
+	storageGenerationsToken = "storageGenerations"
+	storageJournalToken     = "storageJournal"
+	storageKdfToken         = "storageKdf"
+	passwordHashToken       = "passwordHash"
+	passwordModeToken       = "passwordMode"
 
 	fullToken  = "full"
 	basicToken = "basic"
 	noneToken  = "none"
 
+	defaultPasswordModeName = "default"
+
 	httpsStr = "https"
 )
 
@@ -66,6 +77,18 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "\nConfiguration file tokens are: %v\n", configOptions)
 	fmt.Fprintf(os.Stderr, "Options to configure: ('%v', '%v')\n", basicToken, fullToken)
 	fmt.Fprintf(os.Stderr, "Note: The option '%v' is relevant only for %v\n", fullToken, amToken)
+	fmt.Fprintf(os.Stderr, "The storage backend token is: %v, Options to configure: ('%v', '%v', '%v')\n",
+		storageBackendToken, ss.FileBackendName, ss.DirectoryBackendName, ss.BoltBackendName)
+	fmt.Fprintf(os.Stderr, "The storage generations token is: %v, the number of previous generations of the storage file to keep (default %v)\n",
+		storageGenerationsToken, ss.DefaultGenerationsNum)
+	fmt.Fprintf(os.Stderr, "The storage journal token is: %v, the path that the secure storage is persisted to with a write-ahead journal of its item changes\n",
+		storageJournalToken)
+	fmt.Fprintf(os.Stderr, "The storage key derivation function token is: %v, Options to configure: ('%v', '%v', '%v')\n",
+		storageKdfToken, ss.Pbkdf2Sha256KdfName, ss.ScryptKdfName, ss.Argon2idKdfName)
+	fmt.Fprintf(os.Stderr, "The password hashing algorithm token is: %v, Options to configure: ('%v', '%v', '%v', '%v')\n",
+		passwordHashToken, password.Argon2idAlgorithm, password.BcryptAlgorithm, password.ScryptAlgorithm, password.Pbkdf2Sha256Algorithm)
+	fmt.Fprintf(os.Stderr, "The password mode token is: %v, Options to configure: ('%v', '%v')\n",
+		passwordModeToken, defaultPasswordModeName, password.NistModeName)
 	os.Exit(2)
 }
 
@@ -120,7 +143,7 @@ func readConfigFile(configFile string) (config, error) {
 	return configData, nil
 }
 
-func registerComponents(configFile string, secureKeyFilePath string, privateKeyFilePath string, usersDataPath string) {
+func registerComponents(configFile string, secureKeyFilePath string, privateKeyFilePath string, usersDataPath string, sealed bool, keyProvider ss.KeyProvider) {
 	conf, err := readConfigFile(configFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
@@ -131,10 +154,68 @@ func registerComponents(configFile string, secureKeyFilePath string, privateKeyF
 
 	//	amUsers := am.NewAmUsersList()
 	signKey, verifyKey = app.SetupAToken(privateKeyFilePath)
-	loginKey = ss.GetSecureKey(secureKeyFilePath)
+	if sealed == false && keyProvider == nil {
+		loginKey = ss.GetSecureKey(secureKeyFilePath)
+	}
+
+	if generationsStr, exist := conf[storageGenerationsToken]; exist {
+		generations, err := strconv.Atoi(generationsStr)
+		if err == nil {
+			err = ss.SetDefaultGenerationsNum(generations)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+			os.Exit(1)
+		}
+	}
+	backend, err := ss.NewBackend(conf[storageBackendToken], usersDataPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+		os.Exit(1)
+	}
+	if kdfName, exist := conf[storageKdfToken]; exist {
+		kdf, err := ss.NewKdfParams(kdfName)
+		if err == nil {
+			err = ss.SetDefaultKdfParams(kdf)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+			os.Exit(1)
+		}
+	}
+	if hashName, exist := conf[passwordHashToken]; exist {
+		p, err := password.NewHashParams(hashName)
+		if err == nil {
+			err = password.SetHashParams(p)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+			os.Exit(1)
+		}
+	}
+	if modeName, exist := conf[passwordModeToken]; exist && modeName != defaultPasswordModeName {
+		if modeName != password.NistModeName {
+			fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: unknown password mode '%v'\n", configFile, modeName)
+			os.Exit(1)
+		}
+		password.SetDefaultPasswordPolicy(password.NewNistPasswordPolicy())
+	}
 
 	st := libsecurityRestful.NewLibsecurityRestful()
 	st.SetData(usersList, loginKey, verifyKey, signKey, nil)
+	err = st.SetStorageBackendName(conf[storageBackendToken])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+		os.Exit(1)
+	}
+	if journalPath, exist := conf[storageJournalToken]; exist {
+		journalBackend, err := st.NewStorageBackend(journalPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while reading configuration file '%v', error: %v\n", configFile, err)
+			os.Exit(1)
+		}
+		st.SetSecureStorageBackend(journalBackend)
+	}
 
 	l := accountsRestful.NewAmRestful()
 	l.SetData(st)
@@ -182,9 +263,20 @@ func registerComponents(configFile string, secureKeyFilePath string, privateKeyF
 
 	st.RegisterBasic(wsContainer)
 
-	err = en.LoadInfo(usersDataPath, loginKey, usersList)
-	if err != nil {
-		fmt.Println("Load info error:", err)
+	if sealed {
+		st.SetSealed(backend)
+		wsContainer.Filter(st.SealedFilter)
+		log.Printf("The server is sealed, the data will be loaded from '%v' once enough key shares are submitted", backend)
+	} else if keyProvider != nil {
+		err = en.LoadInfoWithKeyProvider(backend, keyProvider, usersList)
+		if err != nil {
+			fmt.Println("Load info error:", err)
+		}
+	} else {
+		err = en.LoadInfoFromBackend(backend, loginKey, usersList)
+		if err != nil {
+			fmt.Println("Load info error:", err)
+		}
 	}
 	runRestAPI(wsContainer)
 }
@@ -225,14 +317,83 @@ func generateJSON(path string, distPath string) {
 	ioutil.WriteFile(fmt.Sprintf(fileFmt, distPath, file), []byte(newS), 0777)
 }
 
+// Load the password hashing peppers from the given comma separated list of version:file
+func loadPeppers(pepperFiles string) {
+	fileNames := make(map[int]string)
+	for _, versionFile := range strings.Split(pepperFiles, ",") {
+		vf := strings.SplitN(versionFile, ":", 2)
+		version, err := strconv.Atoi(vf[0])
+		if len(vf) != 2 || err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error: the pepper file '%v' must be given as version:file\n", versionFile)
+			os.Exit(1)
+		}
+		fileNames[version] = vf[1]
+	}
+	err := password.LoadPeppers(fileNames)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal error while loading the password peppers, error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	privateKeyFilePath := flag.String("rsa-private", "./dist/key.private", "RSA private key file path")
 	secureKeyFilePath := flag.String("secure-key", "./dist/secureKey", "password to encrypt the secure storage")
-	usersDataPath := flag.String("storage-file", "./dist/data.txt", "persistence storage file")
+	usersDataPath := flag.String("storage-file", "./dist/data.txt", "persistence storage file (or directory, depending on the configured storage backend)")
 	configFile := flag.String("config-file", "./config.json", "Configuration information file")
+	sealed := flag.Bool("sealed", false, "start sealed: the secure key is not read from a file, it is reconstructed from the key shares submitted to the unseal command")
+	keyProviderSpec := flag.String("key-provider", "", "the key provider that unlocks the storage instead of the secure key: type:name:argument, e.g. 'file:operator1:./dist/operator1.key', 'env:operator2:ENV_VAR_NAME' or 'kms:operator3:./dist/kms.json:keyID'")
+	commonPwdsFile := flag.String("common-passwords", "", "common passwords file (one password per line) that can't be used as passwords")
+	breachedPwdsFile := flag.String("breached-passwords", "", "breached passwords file (sorted SHA-1 prefixes) that can't be used as passwords")
+	resetTokensFile := flag.String("reset-tokens-file", "", "file that the password reset tokens are appended to, for an external mailer to deliver them (the reset tokens are disabled if not set)")
+	resetPassphraseWords := flag.Int("reset-passphrase-words", 0, "when set, the reset passwords are passphrases of (at least) this number of words instead of random passwords")
+	pepperFiles := flag.String("peppers", "", "comma separated list of version:file of the password hashing pepper files, e.g. '1:./dist/pepper1,2:./dist/pepper2' (the pepper of the highest version is used for new hashes)")
+	otpIssuer := flag.String("otp-issuer", otpRestful.DefaultIssuer, "the issuer (service name) of the OTP Key URIs, displayed by the authenticator applications")
+	otpPendingExpiration := flag.Duration("otp-pending-expiration", otp.GetPendingExpiration(), "the time that a self service OTP enrollment must be confirmed in, e.g. '10m'")
 	flag.Parse()
 	if flag.NArg() > 0 {
 		usage()
 	}
-	registerComponents(*configFile, *secureKeyFilePath, *privateKeyFilePath, *usersDataPath)
+	if len(*pepperFiles) > 0 {
+		loadPeppers(*pepperFiles)
+	}
+	otpRestful.SetIssuer(*otpIssuer)
+	err := otp.SetPendingExpiration(*otpPendingExpiration)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal error while setting the OTP pending enrollment expiration, error: %v\n", err)
+		os.Exit(1)
+	}
+	if *resetPassphraseWords > 0 {
+		params := password.NewDefaultPassphraseParams()
+		params.Words = *resetPassphraseWords
+		err := password.SetResetPassphraseParams(&params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while setting the reset passphrase parameters, error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(*commonPwdsFile) > 0 || len(*breachedPwdsFile) > 0 {
+		blocklist, err := password.LoadBlocklist(*commonPwdsFile, *breachedPwdsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while loading the password blocklist, error: %v\n", err)
+			os.Exit(1)
+		}
+		password.SetBlocklist(blocklist)
+	}
+	if len(*resetTokensFile) > 0 {
+		password.SetResetTokenSender(password.FileResetTokenSender{FileName: *resetTokensFile})
+	}
+	var keyProvider ss.KeyProvider
+	if len(*keyProviderSpec) > 0 {
+		if *sealed {
+			fmt.Fprintf(os.Stderr, "Fatal error: a sealed server can't use a key provider\n")
+			os.Exit(1)
+		}
+		keyProvider, err = ss.NewKeyProviderFromSpec(*keyProviderSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fatal error while creating the key provider, error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	registerComponents(*configFile, *secureKeyFilePath, *privateKeyFilePath, *usersDataPath, *sealed, keyProvider)
 }
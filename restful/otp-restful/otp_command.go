@@ -12,6 +12,10 @@ const (
 	handleUserCommand = iota
 	handleUserBlockCommand
 	verifyUserCodeCommand
+	enrollmentCommand
+	confirmEnrollmentCommand
+	recoveryCodesCommand
+	recoveryCodesActionCommand
 )
 
 var (
@@ -19,6 +23,10 @@ var (
 		{handleUserCommand, "%v/{%v}"},
 		{handleUserBlockCommand, "%v/{%v}/%v"},
 		{verifyUserCodeCommand, "%v/{%v}/%v"},
+		{enrollmentCommand, "%v/{%v}/%v"},
+		{confirmEnrollmentCommand, "%v/{%v}/%v/%v"},
+		{recoveryCodesCommand, "%v/{%v}/%v"},
+		{recoveryCodesActionCommand, "%v/{%v}/%v/%v"},
 	}
 
 	urlCommands = make(cr.CommandToPath)
@@ -38,7 +46,7 @@ func (u OtpRestful) setRoute(service *restful.WebService) {
 		Doc("Add OTP").
 		Operation("addOtp").
 		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
-		Reads(cr.Secret{}).
+		Reads(otpData{}).
 		Writes(cr.URL{}))
 
 	str = fmt.Sprintf(urlCommands[handleUserCommand], usersPath, userIDParam)
@@ -94,6 +102,93 @@ func (u OtpRestful) setRoute(service *restful.WebService) {
 		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
 		Reads(cr.Secret{}).
 		Writes(cr.Match{}))
+
+	str = fmt.Sprintf(urlCommands[enrollmentCommand], usersPath, userIDParam, enrollmentToken)
+	service.Route(service.GET(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restGetOtpEnrollment).
+		Doc("Get the pending OTP Key URI and its QR code (PNG and SVG) to enroll the user into an authenticator application, the Key URI of an active OTP is not returned").
+		Operation("getOtpEnrollment").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Param(service.QueryParameter(otpTypeParam, otpTypeComment).DataType("string")).
+		Writes(otpEnrollment{}))
+
+	str = fmt.Sprintf(urlCommands[enrollmentCommand], usersPath, userIDParam, enrollmentToken)
+	service.Route(service.POST(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restAddPendingOtp).
+		Doc("Start a self service OTP enrollment: generate a pending OTP with a random secret, it is activated when the enrollment is confirmed").
+		Operation("addPendingOtp").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Param(service.QueryParameter(otpTypeParam, otpTypeComment).DataType("string")).
+		Reads(otpData{}).
+		Writes(otpEnrollment{}))
+
+	str = fmt.Sprintf(urlCommands[confirmEnrollmentCommand], usersPath, userIDParam, enrollmentToken, confirmToken)
+	service.Route(service.POST(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restConfirmOtpEnrollment).
+		Doc("Confirm the pending OTP enrollment using a code generated by the authenticator application").
+		Operation("confirmOtpEnrollment").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Param(service.QueryParameter(otpTypeParam, otpTypeComment).DataType("string")).
+		Reads(cr.Secret{}).
+		Writes(cr.Match{}))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesCommand], usersPath, userIDParam, recoveryCodesToken)
+	service.Route(service.POST(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restGenerateRecoveryCodes).
+		Doc("Generate new single use recovery codes, the existing recovery codes are replaced. The codes are returned only once").
+		Operation("generateRecoveryCodes").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Param(service.QueryParameter(countParam, countComment).DataType("integer")).
+		Writes(recoveryCodes{}))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesCommand], usersPath, userIDParam, recoveryCodesToken)
+	service.Route(service.GET(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restGetRecoveryCodes).
+		Doc("Get the number of the remaining recovery codes").
+		Operation("getRecoveryCodes").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Writes(recoveryCodes{}))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesCommand], usersPath, userIDParam, recoveryCodesToken)
+	service.Route(service.DELETE(str).
+		Filter(u.st.SuperUserFilter).
+		To(u.restDeleteRecoveryCodes).
+		Doc("Remove the recovery codes").
+		Operation("deleteRecoveryCodes").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesActionCommand], usersPath, userIDParam, recoveryCodesToken, verifyToken)
+	service.Route(service.POST(str).
+		To(u.restVerifyRecoveryCode). // no filter is needed
+		Doc("Verify that a given code is one of the recovery codes, the code is consumed").
+		Operation("verifyRecoveryCode").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Reads(cr.Secret{}).
+		Writes(cr.Match{}))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesActionCommand], usersPath, userIDParam, recoveryCodesToken, blockedStateToken)
+	service.Route(service.GET(str).
+		Filter(u.st.SameUserFilter).
+		To(u.restIsRecoveryBlocked).
+		Doc("Check if the recovery codes are blocked").
+		Operation("isRecoveryBlocked").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Writes(userState{}))
+
+	str = fmt.Sprintf(urlCommands[recoveryCodesActionCommand], usersPath, userIDParam, recoveryCodesToken, blockedStateToken)
+	service.Route(service.PUT(str).
+		Filter(u.st.SuperUserFilter).
+		To(u.restSetRecoveryBlockedState).
+		Doc("Set the recovery codes blocked state").
+		Operation("setRecoveryBlockedState").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Reads(userState{}).
+		Writes(cr.URL{}))
 }
 
 // RegisterBasic : register the OTP to the RESTFul API container
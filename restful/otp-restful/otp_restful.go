@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/emicklei/go-restful"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
 	"github.com/ibm-security-innovation/libsecurity-go/otp"
+	"github.com/ibm-security-innovation/libsecurity-go/qrcode"
 	cr "github.com/ibm-security-innovation/libsecurity-go/restful/common-restful"
 	"github.com/ibm-security-innovation/libsecurity-go/restful/libsecurity-restful"
 )
@@ -22,6 +25,21 @@ const (
 	blockedStateParam   = "blocked-state"
 	verifyHotpTypeParam = "verify-hotp"
 	verifyTotpTypeParam = "verify-totp"
+	enrollmentToken     = "enrollment"
+	confirmToken        = "confirm"
+	otpTypeParam        = "type"
+	otpTypeComment      = "the OTP type: totp (default) or hotp"
+	hotpTypeStr         = "hotp"
+	totpTypeStr         = "totp"
+	recoveryCodesToken  = "recovery-codes"
+	verifyToken         = "verify"
+	countParam          = "count"
+	countComment        = "the number of recovery codes to generate"
+
+	// DefaultIssuer : the default issuer of the OTP Key URIs, displayed by the authenticator applications
+	DefaultIssuer = "libsecurity"
+
+	qrCodeModuleSize = 4
 
 	originToken = "Origin"
 
@@ -35,6 +53,9 @@ const (
 var (
 	servicePath         string // = cr.ServicePathPrefix + otpPrefix
 	checkSecretStrength = true // Allow only strength passwords
+
+	issuerLock sync.Mutex
+	issuer     = DefaultIssuer
 )
 
 // OtpRestful : OtpRestful structure
@@ -46,6 +67,28 @@ type userState struct {
 	Blocked bool
 }
 
+// The OTP secret and its optional parameters, the parameters that are not set get their default values
+type otpData struct {
+	Secret    string
+	Algorithm string
+	Digits    int
+	PeriodSec int
+}
+
+// The PNG image is base64 encoded by the JSON encoding
+type otpEnrollment struct {
+	URI     string
+	PNG     []byte
+	SVG     string
+	Pending bool
+}
+
+// The new recovery codes are returned only when they are generated
+type recoveryCodes struct {
+	Codes     []string `json:",omitempty"`
+	Remaining int
+}
+
 func init() {
 	initCommandToPath()
 }
@@ -55,6 +98,19 @@ func NewOtpRestful() *OtpRestful {
 	return &OtpRestful{}
 }
 
+// SetIssuer : Set the issuer of the OTP Key URIs, it is displayed by the authenticator applications next to the user name
+func SetIssuer(newIssuer string) {
+	issuerLock.Lock()
+	defer issuerLock.Unlock()
+	issuer = newIssuer
+}
+
+func getIssuer() string {
+	issuerLock.Lock()
+	defer issuerLock.Unlock()
+	return issuer
+}
+
 // SetData : initialize the OtpRestful structure
 func (u *OtpRestful) SetData(stR *libsecurityRestful.LibsecurityRestful) {
 	u.st = stR
@@ -80,15 +136,30 @@ func (u OtpRestful) getOtp(request *restful.Request, response *restful.Response)
 	return data.(*otp.UserInfoOtp)
 }
 
+// Return the OTP parameters of the request, the parameters that are not set get their default values
+func getOtpParams(secret otpData) otp.OtpParams {
+	params := otp.NewDefaultOtpParams()
+	if len(secret.Algorithm) > 0 {
+		params.Algorithm = secret.Algorithm
+	}
+	if secret.Digits != 0 {
+		params.Digits = secret.Digits
+	}
+	if secret.PeriodSec != 0 {
+		params.PeriodSec = secret.PeriodSec
+	}
+	return params
+}
+
 func (u OtpRestful) restAddOtp(request *restful.Request, response *restful.Response) {
-	var secret cr.Secret
+	var secret otpData
 	name := request.PathParameter(userIDParam)
 	err := request.ReadEntity(&secret)
 	if err != nil {
 		u.setError(response, http.StatusBadRequest, err)
 		return
 	}
-	data, err := otp.NewSimpleOtpUser([]byte(secret.Secret), checkSecretStrength)
+	data, err := otp.NewSimpleOtpUserWithParams([]byte(secret.Secret), checkSecretStrength, getOtpParams(secret))
 	if err != nil {
 		u.setError(response, http.StatusBadRequest, err)
 		return
@@ -183,3 +254,246 @@ func (u OtpRestful) verifyUserOtp(request *restful.Request, response *restful.Re
 	}
 	response.WriteHeaderAndEntity(http.StatusOK, res)
 }
+
+// Return the OTP type of the request, TOTP if it is not set
+func (u OtpRestful) getOtpTypeParam(request *restful.Request, response *restful.Response) (otp.TypeOfOtp, bool) {
+	switch request.QueryParameter(otpTypeParam) {
+	case "", totpTypeStr:
+		return otp.TotpType, true
+	case hotpTypeStr:
+		return otp.HotpType, true
+	}
+	u.setError(response, http.StatusBadRequest, fmt.Errorf("The OTP type '%v' is not valid, it must be '%v' or '%v'",
+		request.QueryParameter(otpTypeParam), totpTypeStr, hotpTypeStr))
+	return 0, false
+}
+
+func (u OtpRestful) writeEnrollment(request *restful.Request, response *restful.Response, data *otp.UserInfoOtp, otpType otp.TypeOfOtp, httpStatusCode int) {
+	keyURI, err := data.GetKeyURI(otpType, getIssuer(), request.PathParameter(userIDParam))
+	if err != nil {
+		u.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	code, err := keyURI.QRCode(qrcode.Medium)
+	var res otpEnrollment
+	if err == nil {
+		res.PNG, err = code.PNG(qrCodeModuleSize)
+	}
+	if err == nil {
+		res.SVG, err = code.SVG(qrCodeModuleSize)
+	}
+	if err != nil {
+		u.setError(response, http.StatusInternalServerError, err)
+		return
+	}
+	res.URI = keyURI.String()
+	res.Pending = data.Pending
+	response.WriteHeaderAndEntity(httpStatusCode, res)
+}
+
+func (u OtpRestful) restGetOtpEnrollment(request *restful.Request, response *restful.Response) {
+	otpType, ok := u.getOtpTypeParam(request, response)
+	if ok == false {
+		return
+	}
+	data := u.getOtp(request, response)
+	if data == nil {
+		return
+	}
+	// the enrollment information includes the OTP secret, it is returned only before the OTP is activated
+	if data.Pending == false {
+		u.setError(response, http.StatusPreconditionFailed, fmt.Errorf("The OTP of the user '%v' is active, its enrollment information can't be returned", request.PathParameter(userIDParam)))
+		return
+	}
+	u.writeEnrollment(request, response, data, otpType, http.StatusOK)
+}
+
+// Generate a pending OTP with a random secret and the requested OTP parameters (the body is optional),
+// an existing pending OTP is replaced but an active OTP must be removed first
+func (u OtpRestful) restAddPendingOtp(request *restful.Request, response *restful.Response) {
+	var params otpData
+
+	otpType, ok := u.getOtpTypeParam(request, response)
+	if ok == false {
+		return
+	}
+	if request.Request.ContentLength != 0 {
+		err := request.ReadEntity(&params)
+		if err != nil {
+			u.setError(response, http.StatusBadRequest, err)
+			return
+		}
+	}
+	name := request.PathParameter(userIDParam)
+	current, err := cr.GetPropertyData(name, defs.OtpPropertyName, u.st.UsersList)
+	if err == nil && current.(*otp.UserInfoOtp).Pending == false {
+		u.setError(response, http.StatusPreconditionFailed, fmt.Errorf("The user '%v' already has an active OTP, it must be removed before enrolling again", name))
+		return
+	}
+	otpParams := getOtpParams(params)
+	err = otpParams.IsValid()
+	if err != nil {
+		u.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data, err := otp.NewPendingOtpUser(otpParams)
+	if err != nil {
+		u.setError(response, http.StatusInternalServerError, err)
+		return
+	}
+	err = u.st.UsersList.AddPropertyToEntity(name, defs.OtpPropertyName, data)
+	if err != nil {
+		u.setError(response, http.StatusNotFound, err)
+		return
+	}
+	u.writeEnrollment(request, response, data, otpType, http.StatusCreated)
+}
+
+// Activate the pending OTP using a code generated by the authenticator application, an expired pending OTP is removed
+func (u OtpRestful) restConfirmOtpEnrollment(request *restful.Request, response *restful.Response) {
+	var secret cr.Secret
+
+	otpType, ok := u.getOtpTypeParam(request, response)
+	if ok == false {
+		return
+	}
+	err := request.ReadEntity(&secret)
+	if err != nil {
+		u.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data := u.getOtp(request, response)
+	if data == nil {
+		return
+	}
+	if data.IsPendingExpired() {
+		u.st.UsersList.RemovePropertyFromEntity(request.PathParameter(userIDParam), defs.OtpPropertyName)
+		u.setError(response, http.StatusNotFound, fmt.Errorf("The OTP enrollment expired, please enroll again"))
+		return
+	}
+	if data.Pending == false {
+		u.setError(response, http.StatusPreconditionFailed, fmt.Errorf("The OTP enrollment is not pending"))
+		return
+	}
+	ok, err = data.ConfirmOtpEnrollment(secret.Secret, otpType)
+	res := cr.Match{Match: ok, Message: cr.NoMessageStr}
+	if ok == false && err != nil {
+		res.Message = fmt.Sprintf("%v", err)
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, res)
+}
+
+func (u OtpRestful) getRecovery(request *restful.Request, response *restful.Response) *otp.UserInfoRecovery {
+	userName := request.PathParameter(userIDParam)
+	data, err := cr.GetPropertyData(userName, defs.RecoveryPropertyName, u.st.UsersList)
+	if err != nil {
+		u.setError(response, http.StatusNotFound, err)
+		return nil
+	}
+	return data.(*otp.UserInfoRecovery)
+}
+
+// Generate new recovery codes, the existing codes of the user are replaced (its blocking state is not changed)
+func (u OtpRestful) restGenerateRecoveryCodes(request *restful.Request, response *restful.Response) {
+	var codes []string
+
+	name := request.PathParameter(userIDParam)
+	numOfCodes := otp.DefaultNumOfRecoveryCodes
+	str := request.QueryParameter(countParam)
+	if len(str) > 0 {
+		val, err := strconv.Atoi(str)
+		if err != nil {
+			u.setError(response, http.StatusBadRequest, fmt.Errorf("The parameter '%v' value '%v' must be a number", countParam, str))
+			return
+		}
+		numOfCodes = val
+	}
+	data, err := cr.GetPropertyData(name, defs.RecoveryPropertyName, u.st.UsersList)
+	if err == nil {
+		codes, err = data.(*otp.UserInfoRecovery).RegenerateRecoveryCodes(numOfCodes)
+		if err != nil {
+			u.setError(response, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		data, codes, err = otp.NewRecoveryCodes(numOfCodes)
+		if err != nil {
+			u.setError(response, http.StatusBadRequest, err)
+			return
+		}
+		err = u.st.UsersList.AddPropertyToEntity(name, defs.RecoveryPropertyName, data)
+		if err != nil {
+			u.setError(response, http.StatusNotFound, err)
+			return
+		}
+	}
+	response.WriteHeaderAndEntity(http.StatusCreated, recoveryCodes{Codes: codes, Remaining: len(codes)})
+}
+
+func (u OtpRestful) restGetRecoveryCodes(request *restful.Request, response *restful.Response) {
+	data := u.getRecovery(request, response)
+	if data == nil {
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, recoveryCodes{Remaining: data.GetNumOfRemainingCodes()})
+}
+
+func (u OtpRestful) restDeleteRecoveryCodes(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(userIDParam)
+	err := u.st.UsersList.RemovePropertyFromEntity(name, defs.RecoveryPropertyName)
+	if err != nil {
+		u.setError(response, http.StatusNotFound, err)
+	} else {
+		response.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (u OtpRestful) restVerifyRecoveryCode(request *restful.Request, response *restful.Response) {
+	var secret cr.Secret
+
+	err := request.ReadEntity(&secret)
+	if err != nil {
+		u.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data := u.getRecovery(request, response)
+	if data == nil {
+		return
+	}
+	var otpUser *otp.UserInfoOtp // the user's OTP state applies to the recovery codes, if the user has an OTP
+	otpData, err := cr.GetPropertyData(request.PathParameter(userIDParam), defs.OtpPropertyName, u.st.UsersList)
+	if err == nil {
+		otpUser = otpData.(*otp.UserInfoOtp)
+	}
+	ok, err := data.VerifyRecoveryCode(secret.Secret, otpUser)
+	res := cr.Match{Match: ok, Message: cr.NoMessageStr}
+	if ok == false && err != nil {
+		res.Message = fmt.Sprintf("%v", err)
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, res)
+}
+
+func (u OtpRestful) restIsRecoveryBlocked(request *restful.Request, response *restful.Response) {
+	data := u.getRecovery(request, response)
+	if data == nil {
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, userState{data.IsRecoveryBlocked()})
+}
+
+func (u OtpRestful) restSetRecoveryBlockedState(request *restful.Request, response *restful.Response) {
+	var blockedState userState
+
+	name := request.PathParameter(userIDParam)
+	err := request.ReadEntity(&blockedState)
+	if err != nil {
+		u.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data := u.getRecovery(request, response)
+	if data == nil {
+		return
+	}
+	data.SetRecoveryBlockedState(blockedState.Blocked)
+	response.WriteHeaderAndEntity(http.StatusOK, u.getURLPath(request, name))
+}
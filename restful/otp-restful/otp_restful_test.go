@@ -1,11 +1,14 @@
 package otpRestful
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image/png"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -91,6 +94,11 @@ func getExpectedData(sData string, okJ interface{}) (string, string, cr.Error, e
 		err = json.Unmarshal([]byte(sData), &state)
 		res = fmt.Sprintf("%v", state.Blocked)
 		exp = fmt.Sprintf("%v", okJ.(userState).Blocked)
+	case recoveryCodes:
+		var codes recoveryCodes
+		err = json.Unmarshal([]byte(sData), &codes)
+		res = fmt.Sprintf("%v", codes.Remaining)
+		exp = fmt.Sprintf("%v", okJ.(recoveryCodes).Remaining)
 	default:
 		panic(fmt.Sprintf("Error unknown type: %v", okJ))
 	}
@@ -188,6 +196,220 @@ func TestVerifyHotpCode(t *testing.T) {
 	}
 }
 
+// Get the TOTP and the HOTP enrollment information of a pending OTP and verify that the Key URI is the user's OTP and that
+// the QR code images are valid, verify that an illegal OTP type is rejected and that the enrollment information
+// of an active OTP is not returned
+func TestOtpEnrollment(t *testing.T) {
+	var res otpEnrollment
+	userName := usersName[0]
+
+	initAListOfUsers(t, usersName)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[enrollmentCommand]), usersPath, userName, enrollmentToken)
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusPreconditionFailed, "", cr.Error{Code: http.StatusPreconditionFailed})
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, resourcePath+"/"+userName, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	code, sData, _ := cr.HTTPDataMethod(cr.HTTPPostStr, url, "")
+	if code != http.StatusCreated {
+		t.Fatalf("Test fail: run POST '%v' Expected status: %v, received %v, data: '%v'", url, http.StatusCreated, code, sData)
+	}
+	data, _ := stRestful.UsersList.GetPropertyAttachedToEntity(userName, propertyName)
+	for _, otpType := range []otp.TypeOfOtp{otp.TotpType, otp.HotpType} {
+		query := ""
+		if otpType == otp.HotpType {
+			query = "?" + otpTypeParam + "=" + hotpTypeStr
+		}
+		code, sData, _ := cr.HTTPDataMethod(cr.HTTPGetStr, url+query, "")
+		err := json.Unmarshal([]byte(sData), &res)
+		if code != http.StatusOK || err != nil {
+			t.Fatalf("Test fail: run GET '%v' Expected status: %v, received %v, data: '%v', error: %v", url+query, http.StatusOK, code, sData, err)
+		}
+		exp, _ := data.(*otp.UserInfoOtp).GetKeyURI(otpType, DefaultIssuer, userName)
+		if res.URI != exp.String() {
+			t.Errorf("Test fail: the enrollment Key URI is '%v' instead of '%v'", res.URI, exp)
+		}
+		_, err = png.Decode(bytes.NewReader(res.PNG))
+		if err != nil || strings.Contains(res.SVG, "<svg") == false {
+			t.Errorf("Test fail: the enrollment QR code images are not valid, PNG error: %v, SVG: '%v'", err, res.SVG)
+		}
+	}
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+"?"+otpTypeParam+"=motp", http.StatusBadRequest, "", cr.Error{Code: http.StatusBadRequest})
+	url = listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[enrollmentCommand]), usersPath, "undef user", enrollmentToken)
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, "", cr.Error{Code: http.StatusNotFound})
+}
+
+func getEnrollmentTotp(t *testing.T, sData string) *otp.Totp {
+	var res otpEnrollment
+
+	err := json.Unmarshal([]byte(sData), &res)
+	if err != nil {
+		t.Fatalf("Test fail: can't parse the enrollment data '%v', error: %v", sData, err)
+	}
+	k, err := otp.ParseKeyURI(res.URI)
+	if err != nil || res.Pending == false {
+		t.Fatalf("Test fail: the enrollment Key URI '%v' is not valid or the enrollment is not pending, error: %v", res.URI, err)
+	}
+	baseOtp, _ := k.GetOtp()
+	return &otp.Totp{Interval: time.Duration(k.Period) * time.Second, BaseOtp: baseOtp}
+}
+
+// Start a self service enrollment and verify that the pending OTP can't be used, that it is not activated
+// by a wrong code and that it is activated by a code of the enrollment Key URI. Verify that a user with an active OTP
+// can't enroll again and that an expired pending OTP is removed
+func TestOtpSelfEnrollment(t *testing.T) {
+	userName := usersName[1]
+
+	initAListOfUsers(t, usersName)
+	url := resourcePath + "/" + userName
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	enrollURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[enrollmentCommand]), usersPath, userName, enrollmentToken)
+	confirmURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[confirmEnrollmentCommand]), usersPath, userName, enrollmentToken, confirmToken)
+	verifyURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[verifyUserCodeCommand]), usersPath, userName, verifyTotpTypeParam)
+
+	var totp *otp.Totp
+	for i := 0; i < 2; i++ { // the second enrollment replaces the pending one
+		code, sData, _ := cr.HTTPDataMethod(cr.HTTPPostStr, enrollURL, "")
+		if code != http.StatusCreated {
+			t.Fatalf("Test fail: run POST '%v' Expected status: %v, received %v, data: '%v'", enrollURL, http.StatusCreated, code, sData)
+		}
+		totp = getEnrollmentTotp(t, sData)
+	}
+	otpCode, _ := totp.Now()
+	secret, _ := json.Marshal(cr.Secret{Secret: otpCode})
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: false, Message: cr.NoMessageStr})
+	wrongSecret, _ := json.Marshal(cr.Secret{Secret: "1234"})
+	exeCommandCheckRes(t, cr.HTTPPostStr, confirmURL+"?"+otpTypeParam+"="+hotpTypeStr, http.StatusOK, string(wrongSecret), cr.Match{Match: false, Message: cr.NoMessageStr})
+	exeCommandCheckRes(t, cr.HTTPPostStr, confirmURL, http.StatusOK, string(secret), cr.Match{Match: true, Message: cr.NoMessageStr})
+
+	exeCommandCheckRes(t, cr.HTTPPostStr, enrollURL, http.StatusPreconditionFailed, "", cr.Error{Code: http.StatusPreconditionFailed})
+	exeCommandCheckRes(t, cr.HTTPPostStr, confirmURL, http.StatusPreconditionFailed, string(secret), cr.Error{Code: http.StatusPreconditionFailed})
+
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	code, sData, _ := cr.HTTPDataMethod(cr.HTTPPostStr, enrollURL, "")
+	if code != http.StatusCreated {
+		t.Fatalf("Test fail: run POST '%v' Expected status: %v, received %v, data: '%v'", enrollURL, http.StatusCreated, code, sData)
+	}
+	otpCode, _ = getEnrollmentTotp(t, sData).Now()
+	secret, _ = json.Marshal(cr.Secret{Secret: otpCode})
+	data, _ := stRestful.UsersList.GetPropertyAttachedToEntity(userName, propertyName)
+	data.(*otp.UserInfoOtp).PendingExpiration = time.Now().Add(-time.Second)
+	exeCommandCheckRes(t, cr.HTTPPostStr, confirmURL, http.StatusNotFound, string(secret), cr.Error{Code: http.StatusNotFound})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, "", cr.Error{Code: http.StatusNotFound})
+}
+
+func getEnrollmentKeyURI(t *testing.T, url string, method string, expCode int, data string) otp.KeyURI {
+	var res otpEnrollment
+
+	code, sData, _ := cr.HTTPDataMethod(method, url, data)
+	err := json.Unmarshal([]byte(sData), &res)
+	if code != expCode || err != nil {
+		t.Fatalf("Test fail: run %v '%v' Expected status: %v, received %v, data: '%v', error: %v", method, url, expCode, code, sData, err)
+	}
+	k, err := otp.ParseKeyURI(res.URI)
+	if err != nil {
+		t.Fatalf("Test fail: the enrollment Key URI '%v' is not valid, error: %v", res.URI, err)
+	}
+	return *k
+}
+
+// Verify that the OTP parameters that are set when the OTP is added are used by the OTP, that the parameters that are set
+// when a self service enrollment is started are used by the enrollment Key URI, and that illegal OTP parameters are rejected
+func TestOtpParams(t *testing.T) {
+	userName := usersName[0]
+
+	initAListOfUsers(t, usersName)
+	url := resourcePath + "/" + userName
+	enrollURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[enrollmentCommand]), usersPath, userName, enrollmentToken)
+	params := otp.OtpParams{Algorithm: otp.Sha256AlgorithmName, Digits: 8, PeriodSec: 60}
+	pData, _ := json.Marshal(otpData{Secret: secretCode, Algorithm: params.Algorithm, Digits: params.Digits, PeriodSec: params.PeriodSec})
+	exeCommandCheckRes(t, cr.HTTPPutStr, url, http.StatusCreated, string(pData), cr.URL{URL: fmt.Sprintf("%v/%v", servicePath, userName)})
+	data, _ := stRestful.UsersList.GetPropertyAttachedToEntity(userName, propertyName)
+	p, err := data.(*otp.UserInfoOtp).GetOtpParams()
+	if err != nil || p != params {
+		t.Errorf("Test fail: the OTP parameters are %v instead of %v, error: %v", p, params, err)
+	}
+
+	illegalParams := []otpData{{Secret: secretCode, Digits: 9}, {Secret: secretCode, Algorithm: "MD5"}, {Secret: secretCode, PeriodSec: 61}}
+	for _, p := range illegalParams {
+		pData, _ = json.Marshal(p)
+		exeCommandCheckRes(t, cr.HTTPPutStr, url, http.StatusBadRequest, string(pData), cr.Error{Code: http.StatusBadRequest})
+	}
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	for _, p := range illegalParams {
+		pData, _ = json.Marshal(p)
+		exeCommandCheckRes(t, cr.HTTPPostStr, enrollURL, http.StatusBadRequest, string(pData), cr.Error{Code: http.StatusBadRequest})
+	}
+
+	params = otp.OtpParams{Algorithm: otp.Sha512AlgorithmName, Digits: 7, PeriodSec: 45}
+	pData, _ = json.Marshal(otpData{Algorithm: params.Algorithm, Digits: params.Digits, PeriodSec: params.PeriodSec})
+	k := getEnrollmentKeyURI(t, enrollURL, cr.HTTPPostStr, http.StatusCreated, string(pData))
+	if k.Algorithm != params.Algorithm || k.Digits != params.Digits || k.Period != params.PeriodSec {
+		t.Errorf("Test fail: the pending enrollment Key URI parameters are %v, %v, %v instead of %v", k.Algorithm, k.Digits, k.Period, params)
+	}
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+}
+
+func generateRecoveryCodes(t *testing.T, url string, numOfCodes int) []string {
+	var res recoveryCodes
+
+	code, sData, _ := cr.HTTPDataMethod(cr.HTTPPostStr, url, "")
+	err := json.Unmarshal([]byte(sData), &res)
+	if code != http.StatusCreated || err != nil || len(res.Codes) != numOfCodes || res.Remaining != numOfCodes {
+		t.Fatalf("Test fail: run POST '%v' Expected status: %v and %v codes, received %v, data: '%v', error: %v", url, http.StatusCreated, numOfCodes, code, sData, err)
+	}
+	return res.Codes
+}
+
+// Verify that each recovery code can be used once, that a blocked user or a user that must wait for the throttling time
+// can't use a valid code, that the regenerated codes replace the old ones and that the number of remaining codes is reported
+func TestRecoveryCodes(t *testing.T) {
+	userName := usersName[0]
+
+	initAListOfUsers(t, usersName)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[recoveryCodesCommand]), usersPath, userName, recoveryCodesToken)
+	verifyURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[recoveryCodesActionCommand]), usersPath, userName, recoveryCodesToken, verifyToken)
+	blockedURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[recoveryCodesActionCommand]), usersPath, userName, recoveryCodesToken, blockedStateToken)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v/%v", servicePath, userName)}
+
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, "", cr.Error{Code: http.StatusNotFound})
+	for _, count := range []string{"0", "21", "three"} {
+		exeCommandCheckRes(t, cr.HTTPPostStr, url+"?"+countParam+"="+count, http.StatusBadRequest, "", cr.Error{Code: http.StatusBadRequest})
+	}
+	codes := generateRecoveryCodes(t, url+"?"+countParam+"=3", 3)
+	secret, _ := json.Marshal(cr.Secret{Secret: codes[0]})
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: true, Message: cr.NoMessageStr})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusOK, "", recoveryCodes{Remaining: 2})
+
+	secret, _ = json.Marshal(cr.Secret{Secret: codes[1]})
+	for _, blocked := range []bool{true, false} {
+		data, _ := json.Marshal(userState{blocked})
+		exeCommandCheckRes(t, cr.HTTPPutStr, blockedURL, http.StatusOK, string(data), okURLJ)
+		exeCommandCheckRes(t, cr.HTTPGetStr, blockedURL, http.StatusOK, "", userState{blocked})
+		exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: blocked == false, Message: cr.NoMessageStr})
+	}
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: false, Message: cr.NoMessageStr})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusOK, "", recoveryCodes{Remaining: 1})
+
+	codes = generateRecoveryCodes(t, url, otp.DefaultNumOfRecoveryCodes)
+	secret, _ = json.Marshal(cr.Secret{Secret: codes[0]})
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: false, Message: cr.NoMessageStr})
+	time.Sleep(time.Second + 100*time.Millisecond) // wait for the throttling time of the reused code
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: true, Message: cr.NoMessageStr})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusOK, "", recoveryCodes{Remaining: otp.DefaultNumOfRecoveryCodes - 1})
+
+	// the recovery codes can't be used while the user's OTP is blocked
+	otpBlockedURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleUserBlockCommand]), usersPath, userName, blockedStateToken)
+	secret, _ = json.Marshal(cr.Secret{Secret: codes[1]})
+	for _, blocked := range []bool{true, false} {
+		data, _ := json.Marshal(userState{blocked})
+		exeCommandCheckRes(t, cr.HTTPPutStr, otpBlockedURL, http.StatusOK, string(data), okURLJ)
+		exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(secret), cr.Match{Match: blocked == false, Message: cr.NoMessageStr})
+	}
+
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusNotFound, string(secret), cr.Error{Code: http.StatusNotFound})
+	url = listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[recoveryCodesCommand]), usersPath, "undef user", recoveryCodesToken)
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusNotFound, "", cr.Error{Code: http.StatusNotFound})
+}
+
 // Verify errors for the following secenarios:
 // 1. Verify that simple password is not accepted
 // 2. Verify that wrong parameter as password is not accepted
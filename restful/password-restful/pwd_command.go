@@ -12,6 +12,12 @@ const (
 	handleUserCommand = iota
 	verifyUserPasswordCommand
 	resetUserPasswordCommand
+	handleDefaultPolicyCommand
+	handleGroupPolicyCommand
+	getUserPolicyCommand
+	estimateStrengthCommand
+	resetTokenCommand
+	generatePassphraseCommand
 )
 
 var (
@@ -19,6 +25,12 @@ var (
 		{handleUserCommand, "%v/{%v}"},
 		{verifyUserPasswordCommand, "%v/{%v}"},
 		{resetUserPasswordCommand, "%v/{%v}/%v"},
+		{handleDefaultPolicyCommand, "%v"},
+		{handleGroupPolicyCommand, "%v/{%v}%v"},
+		{getUserPolicyCommand, "%v/{%v}%v"},
+		{estimateStrengthCommand, "%v"},
+		{resetTokenCommand, "%v/{%v}/%v"},
+		{generatePassphraseCommand, "%v"},
 	}
 	urlCommands = make(cr.CommandToPath)
 )
@@ -84,6 +96,83 @@ func (p PwdRestful) setRoute(service *restful.WebService) {
 		Operation("resetPassword").
 		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
 		Writes(secretData{}))
+
+	str = fmt.Sprintf(urlCommands[handleDefaultPolicyCommand], policyPath)
+	service.Route(service.GET(str).
+		Filter(p.st.SuperUserFilter).
+		To(p.restGetDefaultPolicy).
+		Doc("Get the default password policy").
+		Operation("getDefaultPolicy").
+		Writes(password.PasswordPolicy{}))
+
+	str = fmt.Sprintf(urlCommands[handleGroupPolicyCommand], groupsPath, groupIDParam, policyPath)
+	service.Route(service.PUT(str).
+		Filter(p.st.SuperUserFilter).
+		To(p.restAddGroupPolicy).
+		Doc("Add (or replace) the password policy of a group").
+		Operation("addGroupPolicy").
+		Param(service.PathParameter(groupIDParam, groupNameComment).DataType("string")).
+		Reads(password.PasswordPolicy{}).
+		Writes(cr.URL{}))
+
+	str = fmt.Sprintf(urlCommands[handleGroupPolicyCommand], groupsPath, groupIDParam, policyPath)
+	service.Route(service.GET(str).
+		Filter(p.st.SuperUserFilter).
+		To(p.restGetGroupPolicy).
+		Doc("Get the password policy of a group").
+		Operation("getGroupPolicy").
+		Param(service.PathParameter(groupIDParam, groupNameComment).DataType("string")).
+		Writes(password.PasswordPolicy{}))
+
+	str = fmt.Sprintf(urlCommands[handleGroupPolicyCommand], groupsPath, groupIDParam, policyPath)
+	service.Route(service.DELETE(str).
+		Filter(p.st.SuperUserFilter).
+		To(p.restDeleteGroupPolicy).
+		Doc("Remove the password policy of a group").
+		Operation("deleteGroupPolicy").
+		Param(service.PathParameter(groupIDParam, groupNameComment).DataType("string")))
+
+	str = fmt.Sprintf(urlCommands[getUserPolicyCommand], usersPath, userIDParam, policyPath)
+	service.Route(service.GET(str).
+		Filter(p.st.SameUserFilter).
+		To(p.restGetUserPolicy).
+		Doc("Get the effective password policy of a user").
+		Operation("getUserPolicy").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Writes(password.PasswordPolicy{}))
+
+	str = fmt.Sprintf(urlCommands[estimateStrengthCommand], strengthPath)
+	service.Route(service.POST(str).
+		To(p.restEstimateStrength).
+		Doc("Estimate the strength of a password and check if it is accepted by the effective password policy of the user (if given and the command is called by root or the user)").
+		Operation("estimateStrength").
+		Reads(strengthData{}).
+		Writes(strengthResult{}))
+
+	str = fmt.Sprintf(urlCommands[generatePassphraseCommand], passphrasePath)
+	service.Route(service.POST(str).
+		To(p.restGeneratePassphrase).
+		Doc("Generate a passphrase that adheres to the effective password policy of the user (if given and the command is called by root or the user)").
+		Operation("generatePassphrase").
+		Reads(passphraseData{}).
+		Writes(password.Passphrase{}))
+
+	str = fmt.Sprintf(urlCommands[resetTokenCommand], usersPath, userIDParam, resetTokenPath)
+	service.Route(service.POST(str).
+		To(p.restSendResetToken).
+		Doc("Send a password reset token to the user using the delivery channel").
+		Operation("sendResetToken").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Writes(cr.StringMessage{}))
+
+	str = fmt.Sprintf(urlCommands[resetTokenCommand], usersPath, userIDParam, resetTokenPath)
+	service.Route(service.PATCH(str).
+		To(p.restResetPwdWithToken).
+		Doc("Set a new password using a password reset token").
+		Operation("resetPwdWithToken").
+		Param(service.PathParameter(userIDParam, userNameComment).DataType("string")).
+		Reads(cr.ResetTokenSecret{}).
+		Writes(cr.URL{}))
 }
 
 // RegisterBasic : register the Password to the RESTFul API container
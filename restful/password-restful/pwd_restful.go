@@ -7,6 +7,7 @@ import (
 
 	"github.com/emicklei/go-restful"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
+	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
 	"github.com/ibm-security-innovation/libsecurity-go/password"
 	cr "github.com/ibm-security-innovation/libsecurity-go/restful/common-restful"
 	"github.com/ibm-security-innovation/libsecurity-go/restful/libsecurity-restful"
@@ -19,6 +20,13 @@ const (
 	userIDParam      = "user-name"
 	userNameComment  = "user name"
 	resetUserPwdPath = "reset"
+	policyPath       = "/policy"
+	groupsPath       = "/groups"
+	groupIDParam     = "group-name"
+	groupNameComment = "group name"
+	strengthPath     = "/strength"
+	resetTokenPath   = "reset-token"
+	passphrasePath   = "/passphrase"
 )
 
 var (
@@ -39,6 +47,22 @@ type secretData struct {
 	Password string
 }
 
+type strengthData struct {
+	UserName string
+	Password string
+}
+
+type strengthResult struct {
+	Estimate password.StrengthEstimate
+	Accepted bool
+	Message  string
+}
+
+type passphraseData struct {
+	UserName string
+	Params   password.PassphraseParams
+}
+
 type userState struct {
 	Blocked bool
 }
@@ -86,7 +110,12 @@ func (p PwdRestful) restAddPwd(request *restful.Request, response *restful.Respo
 		p.setError(response, http.StatusBadRequest, err)
 		return
 	}
-	data, err := password.NewUserPwd([]byte(secret.Password), p.saltStr, checkPasswordStrength)
+	err = password.CheckBlocklist(secret.Password, name)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data, err := password.NewUserPwdWithPolicy([]byte(secret.Password), p.saltStr, checkPasswordStrength, p.st.UsersList.GetEntityPasswordPolicy(name))
 	if err != nil {
 		p.setError(response, http.StatusBadRequest, err)
 		return
@@ -133,12 +162,13 @@ func (p PwdRestful) restUpdatePassword(request *restful.Request, response *restf
 	if data == nil {
 		return
 	}
-	tPwd, _ := salt.GenerateSaltedPassword([]byte(secrets.OldPassword), password.MinPasswordLength, password.MaxPasswordLength, p.saltStr, -1)
-	pass := password.GetHashedPwd(tPwd)
+	err = password.CheckBlocklist(secrets.NewPassword, name)
 	if err != nil {
 		p.setError(response, http.StatusBadRequest, err)
 		return
 	}
+	tPwd, _ := salt.GenerateSaltedPassword(data.GetPolicy().NormalizePwd([]byte(secrets.OldPassword)), password.MinPasswordLength, password.MaxPasswordLength, p.saltStr, -1)
+	pass := password.GetHashedPwd(tPwd)
 	_, err = data.UpdatePassword(pass, []byte(secrets.NewPassword), checkPasswordStrength)
 	if err != nil {
 		p.setError(response, http.StatusBadRequest, err)
@@ -163,8 +193,6 @@ func (p PwdRestful) restResetPassword(request *restful.Request, response *restfu
 func (p PwdRestful) restVerifyPassword(request *restful.Request, response *restful.Response) {
 	var secret secretData
 	err := request.ReadEntity(&secret)
-	tPwd, _ := salt.GenerateSaltedPassword([]byte(secret.Password), password.MinPasswordLength, password.MaxPasswordLength, p.saltStr, -1)
-	pass := password.GetHashedPwd(tPwd)
 	if err != nil {
 		p.setError(response, http.StatusBadRequest, err)
 		return
@@ -173,6 +201,8 @@ func (p PwdRestful) restVerifyPassword(request *restful.Request, response *restf
 	if data == nil {
 		return
 	}
+	tPwd, _ := salt.GenerateSaltedPassword(data.GetPolicy().NormalizePwd([]byte(secret.Password)), password.MinPasswordLength, password.MaxPasswordLength, p.saltStr, -1)
+	pass := password.GetHashedPwd(tPwd)
 	err = data.IsPasswordMatch(pass)
 	ok := true
 	if err != nil {
@@ -184,3 +214,172 @@ func (p PwdRestful) restVerifyPassword(request *restful.Request, response *restf
 	}
 	response.WriteHeaderAndEntity(http.StatusOK, res)
 }
+
+func (p PwdRestful) readPolicy(request *restful.Request, response *restful.Response) *password.PasswordPolicy {
+	var policy password.PasswordPolicy
+
+	err := request.ReadEntity(&policy)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return nil
+	}
+	err = policy.IsValid()
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return nil
+	}
+	return &policy
+}
+
+func (p PwdRestful) restGetDefaultPolicy(request *restful.Request, response *restful.Response) {
+	response.WriteHeaderAndEntity(http.StatusOK, password.GetDefaultPasswordPolicy())
+}
+
+func (p PwdRestful) restAddGroupPolicy(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(groupIDParam)
+	policy := p.readPolicy(request, response)
+	if policy == nil {
+		return
+	}
+	err := p.st.UsersList.AddPropertyToEntity(name, defs.PwdPolicyPropertyName, policy)
+	if err != nil {
+		p.setError(response, http.StatusNotFound, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusCreated, cr.URL{URL: fmt.Sprintf("%v%v/%v%v", servicePath, groupsPath, name, policyPath)})
+}
+
+func (p PwdRestful) restGetGroupPolicy(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(groupIDParam)
+	data, err := cr.GetPropertyData(name, defs.PwdPolicyPropertyName, p.st.UsersList)
+	if err != nil {
+		p.setError(response, http.StatusNotFound, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, data.(*password.PasswordPolicy))
+}
+
+func (p PwdRestful) restDeleteGroupPolicy(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(groupIDParam)
+	err := p.st.UsersList.RemovePropertyFromEntity(name, defs.PwdPolicyPropertyName)
+	if err != nil {
+		p.setError(response, http.StatusNotFound, err)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (p PwdRestful) restGetUserPolicy(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(userIDParam)
+	if p.st.UsersList.IsEntityInList(name) == false {
+		p.setError(response, http.StatusNotFound, fmt.Errorf("The entity '%v' is not in the entity list", name))
+		return
+	}
+	policy := p.st.UsersList.GetEntityPasswordPolicy(name)
+	if policy == nil {
+		response.WriteHeaderAndEntity(http.StatusOK, password.GetDefaultPasswordPolicy())
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, policy)
+}
+
+// Return the effective password policy of the given user if the request is done by the user or by a super user,
+// otherwise (e.g. an unauthenticated request) the group policies of the user are not exposed and the default policy is returned
+func (p PwdRestful) getRequestUserPolicy(request *restful.Request, name string) password.PasswordPolicy {
+	policy := password.GetDefaultPasswordPolicy()
+	if name == "" || p.st.IsSameUserOrSuperUser(request, name) == false {
+		return policy
+	}
+	if userPolicy := p.st.UsersList.GetEntityPasswordPolicy(name); userPolicy != nil {
+		policy = *userPolicy
+	}
+	return policy
+}
+
+func (p PwdRestful) restEstimateStrength(request *restful.Request, response *restful.Response) {
+	var data strengthData
+
+	err := request.ReadEntity(&data)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	policy := p.getRequestUserPolicy(request, data.UserName)
+	res := strengthResult{Estimate: password.EstimateStrength(data.Password, data.UserName), Accepted: true, Message: cr.NoMessageStr}
+	err = policy.CheckStrength(data.Password)
+	if err == nil {
+		err = password.CheckBlocklist(data.Password, data.UserName)
+	}
+	if err != nil {
+		res.Accepted = false
+		res.Message = fmt.Sprintf("%v", err)
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, res)
+}
+
+func (p PwdRestful) restGeneratePassphrase(request *restful.Request, response *restful.Response) {
+	var data passphraseData
+
+	err := request.ReadEntity(&data)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	policy := p.getRequestUserPolicy(request, data.UserName)
+	res, err := password.GeneratePolicyValidPassphrase(policy, data.Params)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, res)
+}
+
+func (p PwdRestful) restSendResetToken(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter(userIDParam)
+	if password.GetResetTokenSender() == nil {
+		p.setError(response, http.StatusServiceUnavailable, fmt.Errorf("Password reset tokens can't be used: no delivery channel was set"))
+		return
+	}
+	err := password.ThrottleResetTokenRequest(name)
+	if err != nil {
+		p.setError(response, http.StatusTooManyRequests, err)
+		return
+	}
+	data, err := cr.GetPropertyData(name, defs.PwdPropertyName, p.st.UsersList)
+	if err == nil {
+		err = data.(*password.UserPwd).SendResetToken(name)
+		if err != nil {
+			logger.Error.Printf("The password reset token of the user '%v' was not sent, error: %v", name, err)
+		}
+	}
+	// the same response is returned for unknown users and for failed deliveries in order not to reveal which users exist
+	response.WriteHeaderAndEntity(http.StatusAccepted, cr.StringMessage{Str: fmt.Sprintf("A password reset token was sent to the user '%v'", name)})
+}
+
+func (p PwdRestful) restResetPwdWithToken(request *restful.Request, response *restful.Response) {
+	var secret cr.ResetTokenSecret
+	name := request.PathParameter(userIDParam)
+
+	err := request.ReadEntity(&secret)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	err = password.CheckBlocklist(secret.NewPassword, name)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	data, err := cr.GetPropertyData(name, defs.PwdPropertyName, p.st.UsersList)
+	if err != nil {
+		// the same response is returned for unknown users as for a wrong token in order not to reveal which users exist
+		p.setError(response, http.StatusBadRequest, password.ErrInvalidResetToken)
+		return
+	}
+	_, err = data.(*password.UserPwd).ResetPasswordWithToken(secret.Token, []byte(secret.NewPassword), checkPasswordStrength)
+	if err != nil {
+		p.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusCreated, p.getURLPath(request, name))
+}
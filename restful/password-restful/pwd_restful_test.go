@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,8 +27,11 @@ const (
 
 	userName1 = "User1"
 	userName2 = "User2"
+	groupName = "Group1"
 
 	secretCode    = "1AaB@2345678"
+
+	passphraseSeparator = "."
 )
 
 var (
@@ -55,6 +59,8 @@ func init() {
 	for _, name := range usersName {
 		stRestful.UsersList.AddUser(name)
 	}
+	stRestful.UsersList.AddGroup(groupName)
+	stRestful.UsersList.AddUserToGroup(groupName, userName2)
 
 	go runServer()
 	time.Sleep(100 * time.Millisecond)
@@ -89,6 +95,21 @@ func getExpectedData(sData string, okJ interface{}) (string, string, cr.Error, e
 		} else {
 			exp = res
 		}
+	case password.PasswordPolicy:
+		var policy password.PasswordPolicy
+		json.Unmarshal([]byte(sData), &policy)
+		res = policy.String()
+		exp = okJ.(password.PasswordPolicy).String()
+	case password.Passphrase: // the passphrase is random: only its number of words is compared
+		var result password.Passphrase
+		json.Unmarshal([]byte(sData), &result)
+		res = fmt.Sprintf("Words: %v", len(strings.Split(result.Passphrase, passphraseSeparator)))
+		exp = fmt.Sprintf("Words: %v", len(strings.Split(okJ.(password.Passphrase).Passphrase, passphraseSeparator)))
+	case strengthResult: // only the score and the acceptance are compared
+		var result strengthResult
+		json.Unmarshal([]byte(sData), &result)
+		res = fmt.Sprintf("Score: %v, accepted: %v", result.Estimate.Score, result.Accepted)
+		exp = fmt.Sprintf("Score: %v, accepted: %v", okJ.(strengthResult).Estimate.Score, okJ.(strengthResult).Accepted)
 	default:
 		panic(fmt.Sprintf("Error unknown type: value: %v", okJ))
 	}
@@ -181,3 +202,136 @@ func TestVerifyResetPassword(t *testing.T) {
 	secret1, _ := json.Marshal(secretData{secretCode})
 	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusOK, string(secret1), cr.Match{Match: false, Message: cr.NoMessageStr})
 }
+
+// Add a password policy to a group and verify that it is the effective policy only of the group members
+// Verify that a password that does not adhere to the policy is rejected
+// Remove the group policy and verify that the default policy is used
+func TestGroupPolicy(t *testing.T) {
+	policy := password.NewDefaultPasswordPolicy()
+	policy.MinLength = len(secretCode) + 1
+	pData, _ := json.Marshal(policy)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleGroupPolicyCommand]), groupsPath, groupName, policyPath)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v%v/%v%v", servicePath, groupsPath, groupName, policyPath)}
+	exeCommandCheckRes(t, cr.HTTPPutStr, url, http.StatusCreated, string(pData), okURLJ)
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusOK, "", policy)
+
+	for _, name := range usersName {
+		exp := password.GetDefaultPasswordPolicy()
+		if name == userName2 {
+			exp = policy
+		}
+		userURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[getUserPolicyCommand]), usersPath, name, policyPath)
+		exeCommandCheckRes(t, cr.HTTPGetStr, userURL, http.StatusOK, "", exp)
+	}
+	exeCommandCheckRes(t, cr.HTTPPutStr, resourcePath+"/"+userName2, http.StatusBadRequest, string(uData), cr.Error{Code: http.StatusBadRequest})
+	exeCommandCheckRes(t, cr.HTTPPutStr, resourcePath+"/"+userName1, http.StatusCreated, string(uData), cr.URL{URL: fmt.Sprintf("%v/%v", servicePath, userName1)})
+
+	policy.MaxAttempts = 0
+	pData, _ = json.Marshal(policy)
+	exeCommandCheckRes(t, cr.HTTPPutStr, url, http.StatusBadRequest, string(pData), cr.Error{Code: http.StatusBadRequest})
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, "", cr.Error{Code: http.StatusNotFound})
+	userURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[getUserPolicyCommand]), usersPath, userName2, policyPath)
+	exeCommandCheckRes(t, cr.HTTPGetStr, userURL, http.StatusOK, "", password.GetDefaultPasswordPolicy())
+}
+
+// Verify that a password that is derived from the user name is rejected when it is added or updated
+func TestBlockedPassword(t *testing.T) {
+	name := userName1
+	blocked, _ := json.Marshal(secretData{name + "@Ab12"})
+	url := resourcePath + "/" + name
+	exeCommandCheckRes(t, cr.HTTPPutStr, url, http.StatusBadRequest, string(blocked), cr.Error{Code: http.StatusBadRequest})
+
+	initAListOfUsers(t, usersName)
+	secret, _ := json.Marshal(cr.UpdateSecret{OldPassword: secretCode, NewPassword: name + "@Ab12"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusBadRequest, string(secret), cr.Error{Code: http.StatusBadRequest})
+}
+
+// Verify that the estimated strength of weak and strong passwords is returned
+// and that passwords that are derived from the user name are not accepted
+func TestEstimateStrength(t *testing.T) {
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[estimateStrengthCommand]), strengthPath)
+	passwords := []strengthData{{"", "password"}, {userName1, userName1 + "@Ab12"}, {userName1, "xK9#mQ2$vL7p"}}
+	expected := []strengthResult{{password.StrengthEstimate{Score: 0}, false, ""}, {password.StrengthEstimate{Score: 2}, false, ""},
+		{password.StrengthEstimate{Score: password.MaxStrengthScore}, true, ""}}
+	for i, pwd := range passwords {
+		data, _ := json.Marshal(pwd)
+		exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusOK, string(data), expected[i])
+	}
+}
+
+type testTokenSender struct {
+	token string
+}
+
+func (s *testTokenSender) SendResetToken(userName string, token string, expiration time.Time) error {
+	s.token = token
+	return nil
+}
+
+// Verify that a reset token can't be requested without a delivery channel, that the same response is returned
+// for unknown users, that the requests for the same user are throttled, that the password is set using the delivered token
+// and that the token can't be used again
+func TestResetToken(t *testing.T) {
+	defer password.SetResetTokenSender(nil)
+	userName := usersName[0]
+	newPwd := "2BbC#3456789"
+
+	initAListOfUsers(t, usersName)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[resetTokenCommand]), usersPath, userName, resetTokenPath)
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusServiceUnavailable, "", cr.Error{Code: http.StatusServiceUnavailable})
+
+	sender := &testTokenSender{}
+	password.SetResetTokenSender(sender)
+	unknownURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[resetTokenCommand]), usersPath, "unknown", resetTokenPath)
+	exeCommandCheckRes(t, cr.HTTPPostStr, unknownURL, http.StatusAccepted, "", cr.StringMessage{Str: cr.GetMessageStr})
+	if len(sender.token) > 0 {
+		t.Errorf("Test fail: a reset token was sent to an unknown user")
+	}
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusAccepted, "", cr.StringMessage{Str: cr.GetMessageStr})
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusTooManyRequests, "", cr.Error{Code: http.StatusTooManyRequests})
+	exeCommandCheckRes(t, cr.HTTPPostStr, unknownURL, http.StatusTooManyRequests, "", cr.Error{Code: http.StatusTooManyRequests})
+
+	wrong, _ := json.Marshal(cr.ResetTokenSecret{Token: sender.token + "a", NewPassword: newPwd})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusBadRequest, string(wrong), cr.Error{Code: http.StatusBadRequest})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, unknownURL, http.StatusBadRequest, string(wrong), cr.Error{Code: http.StatusBadRequest})
+	secret, _ := json.Marshal(cr.ResetTokenSecret{Token: sender.token, NewPassword: newPwd})
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v/%v", servicePath, userName)}
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusCreated, string(secret), okURLJ)
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusBadRequest, string(secret), cr.Error{Code: http.StatusBadRequest})
+
+	verifyURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[verifyUserPasswordCommand]), usersPath, userName)
+	pwdData, _ := json.Marshal(secretData{newPwd})
+	exeCommandCheckRes(t, cr.HTTPPostStr, verifyURL, http.StatusOK, string(pwdData), cr.Match{Match: true, Message: cr.NoMessageStr})
+}
+
+// Verify that a passphrase with the requested number of words is generated, that more words are added
+// when the effective policy of the user requires it and that illegal parameters are rejected
+func TestGeneratePassphrase(t *testing.T) {
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[generatePassphraseCommand]), passphrasePath)
+	params := password.PassphraseParams{Words: 4, Separator: passphraseSeparator, UpperCase: 1, Digits: 1, Symbols: 1}
+	data, _ := json.Marshal(passphraseData{"", params})
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusOK, string(data), password.Passphrase{Passphrase: "a.b.c.d"})
+
+	policy := password.NewDefaultPasswordPolicy()
+	policy.MinLength = 40
+	policy.MaxLength = 80 // a window that is wider than the longest word and its separator
+	pData, _ := json.Marshal(policy)
+	policyURL := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleGroupPolicyCommand]), groupsPath, groupName, policyPath)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v%v/%v%v", servicePath, groupsPath, groupName, policyPath)}
+	exeCommandCheckRes(t, cr.HTTPPutStr, policyURL, http.StatusCreated, string(pData), okURLJ)
+	defer exeCommandCheckRes(t, cr.HTTPDeleteStr, policyURL, http.StatusNoContent, "", cr.StringMessage{Str: ""})
+	params.Words = 1
+	data, _ = json.Marshal(passphraseData{userName2, params})
+	code, sData, _ := cr.HTTPDataMethod(cr.HTTPPostStr, url, string(data))
+	var res password.Passphrase
+	json.Unmarshal([]byte(sData), &res)
+	if code != http.StatusOK || len(res.Passphrase) < policy.MinLength {
+		t.Errorf("Test fail: the generated passphrase '%v' does not adhere to the minimum length %v of the policy, status: %v",
+			res.Passphrase, policy.MinLength, code)
+	}
+
+	params.Separator = "x"
+	data, _ = json.Marshal(passphraseData{"", params})
+	exeCommandCheckRes(t, cr.HTTPPostStr, url, http.StatusBadRequest, string(data), cr.Error{Code: http.StatusBadRequest})
+}
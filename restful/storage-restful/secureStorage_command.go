@@ -62,7 +62,7 @@ func (s SRestful) setRoute(service *restful.WebService) {
 	service.Route(service.PATCH(str).
 		// no filter is needed, the filter is the secure key		Filter(s.st.SuperUserFilter).
 		To(s.restAddItemToSecureStorage).
-		Doc("Add a new item to the secure storage").
+		Doc("Add a new item to the secure storage, the item expires after its TTL (in seconds) if it is set").
 		Operation("addANewItemToTheSecureStorage").
 		Param(service.HeaderParameter(secretIDParam, secretComment).DataType("string")).
 		Reads(itemData{}).
@@ -86,6 +86,47 @@ func (s SRestful) setRoute(service *restful.WebService) {
 		Operation("deleteItemFromSecureStorage").
 		Param(service.HeaderParameter(secretIDParam, secretComment).DataType("string")).
 		Param(service.HeaderParameter(keyIDParam, keyComment).DataType("string")))
+
+	str = fmt.Sprintf(urlCommands[handleStorageCommand], storageItemsPath)
+	service.Route(service.GET(str).
+		// no filter is needed, the filter is the secure key		Filter(s.st.SuperUserFilter).
+		To(s.restGetItemsFromSecureStorage).
+		Doc("Get the keys of the secure storage items and their metadata, sorted by the keys").
+		Operation("getItemsFromTheSecureStorage").
+		Param(service.HeaderParameter(secretIDParam, secretComment).DataType("string")).
+		Param(service.QueryParameter(prefixParam, prefixComment).DataType("string")).
+		Param(service.QueryParameter(offsetParam, offsetComment).DataType("integer")).
+		Param(service.QueryParameter(limitParam, limitComment).DataType("integer")).
+		Writes(itemsList{}))
+
+	str = fmt.Sprintf(urlCommands[handleStorageCommand], storageItemsPath)
+	service.Route(service.PATCH(str).
+		// no filter is needed, the filter is the secure key		Filter(s.st.SuperUserFilter).
+		To(s.restUpdateItemsInSecureStorage).
+		Doc("Remove and add several items of the secure storage together: either all the changes are done or none of them").
+		Operation("updateItemsInTheSecureStorage").
+		Param(service.HeaderParameter(secretIDParam, secretComment).DataType("string")).
+		Reads(itemsBatch{}).
+		Writes(commonRestful.URL{}))
+
+	str = fmt.Sprintf(urlCommands[handleStorageCommand], secretPath)
+	service.Route(service.PATCH(str).
+		// no filter is needed, the filter is the secure key		Filter(s.st.SuperUserFilter).
+		To(s.restRekeySecureStorage).
+		Doc("Replace the secure storage secret, all the items are re-encrypted using the new secret").
+		Operation("rekeySecureStorage").
+		Param(service.HeaderParameter(secretIDParam, secretComment).DataType("string")).
+		Reads(commonRestful.Secret{}).
+		Writes(commonRestful.URL{}))
+
+	str = fmt.Sprintf(urlCommands[handleStorageCommand], fileSecretPath)
+	service.Route(service.PATCH(str).
+		Filter(s.st.SuperUserFilter).
+		To(s.restRekeySecureStorageFile).
+		Doc("Replace the secret of a secure storage file, all the items are re-encrypted and the file is signed using the new secret").
+		Operation("rekeySecureStorageFile").
+		Reads(rekeyFileData{}).
+		Writes(commonRestful.FileData{}))
 }
 
 // RegisterBasic : register the Secure Storage to the RESTFul API container
@@ -4,22 +4,38 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/emicklei/go-restful"
+	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
 	cr "github.com/ibm-security-innovation/libsecurity-go/restful/common-restful"
 	"github.com/ibm-security-innovation/libsecurity-go/restful/libsecurity-restful"
 	ss "github.com/ibm-security-innovation/libsecurity-go/storage"
 )
 
 const (
-	sPrefix         = "/securestorage"
-	storagePath     = "/storage"
-	storageItemPath = "/item"
+	sPrefix          = "/securestorage"
+	storagePath      = "/storage"
+	storageItemPath  = "/item"
+	storageItemsPath = "/items"
+	secretPath       = "/secret"
+	fileSecretPath   = "/file/secret"
 
 	secretIDParam = "secret"
 	secretComment = "secret val"
 	keyIDParam    = "key-id"
 	keyComment    = "key val"
+	prefixParam   = "prefix"
+	prefixComment = "list only the keys that start with this prefix"
+	offsetParam   = "offset"
+	offsetComment = "the index of the first key to return"
+	limitParam    = "limit"
+	limitComment  = "the maximum number of keys to return (up to 1000)"
+
+	defaultItemsLimit = 100
+	maxItemsLimit     = 1000
 )
 
 var (
@@ -31,12 +47,31 @@ var (
 type itemData struct {
 	Key   string
 	Value string
+	TTL   int // the item time to live in seconds, 0 for an item that doesn't expire
+}
+
+// The item changes that are applied to the secure storage together: first the removals and then the additions
+type itemsBatch struct {
+	Add    []itemData
+	Remove []string
 }
 
 type itemValue struct {
 	Data string
 }
 
+type itemsList struct {
+	Items  []ss.KeyMetadata
+	Offset int
+	Total  int
+}
+
+type rekeyFileData struct {
+	FilePath  string
+	Secret    string
+	NewSecret string
+}
+
 // SRestful : Secure Storage restful structure
 type SRestful struct {
 	st *libsecurityRestful.LibsecurityRestful
@@ -85,9 +120,41 @@ func (s SRestful) isSecretMatch(request *restful.Request, response *restful.Resp
 	return true
 }
 
+// Return the secure storage that is persisted using the given backend: it is loaded (and its journal is replayed)
+// if it was already stored, otherwise a new one is created. The following item changes are written to its journal
+func openSecureStorage(backend ss.Backend, secret []byte) (*ss.SecureStorage, error) {
+	var data *ss.SecureStorage
+
+	_, err := os.Stat(backend.String())
+	if err == nil {
+		data, err = ss.LoadInfoFromBackend(backend, secret)
+		if err != nil {
+			return nil, fmt.Errorf("Error: The stored secure storage can't be loaded using the given secret")
+		}
+	} else {
+		data, err = ss.NewStorage(secret, checkSecretStrength)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = data.EnableJournal(backend)
+	if err != nil {
+		return nil, fmt.Errorf("Error: The secure storage journal can't be started")
+	}
+	return data, nil
+}
+
 func (s *SRestful) restCreateSecureStorage(request *restful.Request, response *restful.Response) {
+	var data *ss.SecureStorage
+	var err error
+
 	secret := request.HeaderParameter(secretIDParam)
-	data, err := ss.NewStorage([]byte(secret), checkSecretStrength)
+	backend := s.st.GetSecureStorageBackend()
+	if backend != nil {
+		data, err = openSecureStorage(backend, []byte(secret))
+	} else {
+		data, err = ss.NewStorage([]byte(secret), checkSecretStrength)
+	}
 	if err != nil {
 		s.setError(response, http.StatusBadRequest, err)
 		return
@@ -103,6 +170,7 @@ func (s SRestful) restDeleteSecureStorage(request *restful.Request, response *re
 	if s.isSecretMatch(request, response) == false {
 		return
 	}
+	s.st.SecureStorage.DisableJournal()
 	s.st.SecureStorage = nil
 	response.WriteHeader(http.StatusNoContent)
 }
@@ -131,7 +199,11 @@ func (s SRestful) restAddItemToSecureStorage(request *restful.Request, response
 		return
 	}
 
-	err = s.st.SecureStorage.AddItem(item.Key, item.Value)
+	if item.TTL < 0 {
+		s.setError(response, http.StatusBadRequest, fmt.Errorf("The item time to live %v must not be negative", item.TTL))
+		return
+	}
+	err = s.st.SecureStorage.AddItemWithTTL(item.Key, item.Value, time.Duration(item.TTL)*time.Second)
 	if err != nil {
 		s.setError(response, http.StatusInternalServerError, err)
 		return
@@ -139,6 +211,40 @@ func (s SRestful) restAddItemToSecureStorage(request *restful.Request, response
 	response.WriteHeaderAndEntity(http.StatusCreated, s.getURLPath(request))
 }
 
+func (s SRestful) restUpdateItemsInSecureStorage(request *restful.Request, response *restful.Response) {
+	if s.isSecureStorgaeValid(response) == false {
+		return
+	}
+	if s.isSecretMatch(request, response) == false {
+		return
+	}
+	var batch itemsBatch
+	err := request.ReadEntity(&batch)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	tx := s.st.SecureStorage.NewTransaction()
+	for _, key := range batch.Remove {
+		tx.RemoveItem(key)
+	}
+	for _, item := range batch.Add {
+		err = tx.AddItemWithTTL(item.Key, item.Value, time.Duration(item.TTL)*time.Second)
+		if err != nil {
+			tx.Rollback()
+			s.setError(response, http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		s.setError(response, http.StatusNotFound, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, s.getURLPath(request))
+}
+
 func (s SRestful) restGetItemFromSecureStorage(request *restful.Request, response *restful.Response) {
 	if s.isSecureStorgaeValid(response) == false {
 		return
@@ -156,6 +262,54 @@ func (s SRestful) restGetItemFromSecureStorage(request *restful.Request, respons
 	response.WriteHeaderAndEntity(http.StatusOK, itemValue{val})
 }
 
+func getIntQueryParameter(request *restful.Request, name string, defaultVal int) (int, error) {
+	str := request.QueryParameter(name)
+	if len(str) == 0 {
+		return defaultVal, nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("The parameter '%v' value '%v' must be a non negative number", name, str)
+	}
+	return val, nil
+}
+
+func (s SRestful) restGetItemsFromSecureStorage(request *restful.Request, response *restful.Response) {
+	if s.isSecureStorgaeValid(response) == false {
+		return
+	}
+	if s.isSecretMatch(request, response) == false {
+		return
+	}
+	offset, err := getIntQueryParameter(request, offsetParam, 0)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := getIntQueryParameter(request, limitParam, defaultItemsLimit)
+	if err == nil && limit > maxItemsLimit {
+		err = fmt.Errorf("The parameter '%v' value %v must not be larger than %v", limitParam, limit, maxItemsLimit)
+	}
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	items, err := s.st.SecureStorage.GetItemsMetadata(request.QueryParameter(prefixParam))
+	if err != nil {
+		s.setError(response, http.StatusInternalServerError, err)
+		return
+	}
+	list := itemsList{Items: []ss.KeyMetadata{}, Offset: offset, Total: len(items)}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		list.Items = items[offset:end]
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, list)
+}
+
 func (s SRestful) restDeleteItemFromSecureStorage(request *restful.Request, response *restful.Response) {
 	if s.isSecureStorgaeValid(response) == false {
 		return
@@ -171,3 +325,66 @@ func (s SRestful) restDeleteItemFromSecureStorage(request *restful.Request, resp
 	}
 	response.WriteHeader(http.StatusNoContent)
 }
+
+func (s SRestful) restRekeySecureStorage(request *restful.Request, response *restful.Response) {
+	if s.isSecureStorgaeValid(response) == false {
+		return
+	}
+	if s.isSecretMatch(request, response) == false {
+		return
+	}
+	var secret cr.Secret
+	err := request.ReadEntity(&secret)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	if checkSecretStrength {
+		err = ss.CheckSecretStrength([]byte(secret.Secret))
+		if err != nil {
+			s.setError(response, http.StatusBadRequest, err)
+			return
+		}
+	}
+	backend := s.st.GetSecureStorageBackend()
+	if backend == nil {
+		// the secure storage is kept only in memory, there is nothing to persist
+		logger.Info.Println("The secure storage is not persisted, only the secure storage in memory is rekeyed")
+		err = s.st.SecureStorage.Rekey([]byte(secret.Secret), checkSecretStrength)
+		if err != nil {
+			s.setError(response, http.StatusBadRequest, err)
+			return
+		}
+		response.WriteHeaderAndEntity(http.StatusOK, s.getURLPath(request))
+		return
+	}
+	// the secure storage is changed only after it was stored using the new secret,
+	// the previous generations that are protected by the old secret are removed
+	err = s.st.SecureStorage.RekeyToBackend(backend, []byte(secret.Secret), checkSecretStrength)
+	if err != nil {
+		logger.Error.Printf("Rekey of the secure storage failed: %v", err)
+		s.setError(response, http.StatusInternalServerError, fmt.Errorf("Error: The rekeyed secure storage can't be stored"))
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, s.getURLPath(request))
+}
+
+func (s SRestful) restRekeySecureStorageFile(request *restful.Request, response *restful.Response) {
+	var fileData rekeyFileData
+	err := request.ReadEntity(&fileData)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	backend, err := s.st.NewStorageBackend(fileData.FilePath)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	err = ss.RekeyInfo(backend, []byte(fileData.Secret), []byte(fileData.NewSecret), checkSecretStrength)
+	if err != nil {
+		s.setError(response, http.StatusBadRequest, err)
+		return
+	}
+	response.WriteHeaderAndEntity(http.StatusOK, cr.FileData{FilePath: fileData.FilePath})
+}
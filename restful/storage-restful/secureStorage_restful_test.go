@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -79,6 +80,11 @@ func getExpectedData(sData string, okJ interface{}) (string, string, cr.Error, e
 		err = json.Unmarshal([]byte(sData), &val)
 		res = fmt.Sprintf("%v", val.Data)
 		exp = fmt.Sprintf("%v", okJ.(itemValue).Data)
+	case itemsList:
+		var list itemsList
+		err = json.Unmarshal([]byte(sData), &list)
+		res = getItemsListStr(list)
+		exp = getItemsListStr(okJ.(itemsList))
 	case ss.SecureStorage:
 		var data ss.SecureStorage
 		err = json.Unmarshal([]byte(sData), &data)
@@ -94,6 +100,15 @@ func getExpectedData(sData string, okJ interface{}) (string, string, cr.Error, e
 	return exp, res, e, err
 }
 
+// Only the keys, the sizes and the total are compared, the times are not known in advance
+func getItemsListStr(list itemsList) string {
+	str := fmt.Sprintf("total: %v, offset: %v, items:", list.Total, list.Offset)
+	for _, item := range list.Items {
+		str += fmt.Sprintf(" %v (%v)", item.Key, item.Size)
+	}
+	return str
+}
+
 func HTTPDataMethodWithHeader(method string, url string, data string, headerInfo headerMapT) (int, string, error) {
 	client := &http.Client{}
 	request, err := http.NewRequest(method, url, strings.NewReader(data))
@@ -144,7 +159,7 @@ func TestAddGetDeleteItem(t *testing.T) {
 	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
 	for i, key := range keys {
 		url := itemPath
-		item, _ := json.Marshal(itemData{key, values[i]})
+		item, _ := json.Marshal(itemData{Key: key, Value: values[i]})
 		exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
 		headerInfo[keyIDParam] = key
 		exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusOK, "", headerInfo, itemValue{values[i]})
@@ -175,8 +190,213 @@ func TestErrors(t *testing.T) {
 	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNotFound, cr.GetMessageStr, headerInfo, cr.StringMessage{Str: cr.GetMessageStr})
 
 	url = itemPath
-	item, _ := json.Marshal(itemData{"123", "1"})
+	item, _ := json.Marshal(itemData{Key: "123", Value: "1"})
 	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusNotFound, string(item), headerInfo, cr.StringMessage{Str: cr.GetMessageStr})
 	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, string(item), headerInfo, cr.StringMessage{Str: cr.GetMessageStr})
 	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNotFound, string(item), headerInfo, cr.StringMessage{Str: cr.GetMessageStr})
-}
\ No newline at end of file
+}
+// Test the rekey of the secure storage and of a secure storage file
+// 1. Create a storage, add an item and replace the storage secret
+// 2. Verify that the item can be read only using the new secret
+// 3. Verify that rekey using a simple secret fails
+// 4. Store a secure storage file, replace its secret and verify that it can be loaded only using the new secret
+func TestRekey(t *testing.T) {
+	newSecretCode := "dEFf@1234567890654321"
+	fileName := "./tmp.txt"
+	headerInfo := make(headerMapT)
+	newHeaderInfo := make(headerMapT)
+	defer os.Remove(fileName)
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	item, _ := json.Marshal(itemData{Key: "key", Value: "value"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), secretPath)
+	secret, _ := json.Marshal(cr.Secret{Secret: "1234"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusBadRequest, string(secret), baseHeaderInfo, cr.Error{Code: http.StatusBadRequest})
+	secret, _ = json.Marshal(cr.Secret{Secret: newSecretCode})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusOK, string(secret), baseHeaderInfo, okURLJ)
+
+	headerInfo[secretIDParam] = secretCode
+	headerInfo[keyIDParam] = "key"
+	newHeaderInfo[secretIDParam] = newSecretCode
+	newHeaderInfo[keyIDParam] = "key"
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusNotFound, "", headerInfo, cr.Error{Code: http.StatusNotFound})
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusOK, "", newHeaderInfo, itemValue{"value"})
+
+	stRestful.SecureStorage.StoreInfo(fileName)
+	url = listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), fileSecretPath)
+	fileData, _ := json.Marshal(rekeyFileData{FilePath: fileName, Secret: newSecretCode, NewSecret: secretCode})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusOK, string(fileData), baseHeaderInfo, cr.FileData{FilePath: fileName})
+	_, err := ss.LoadInfo(fileName, []byte(newSecretCode))
+	if err == nil {
+		t.Errorf("Test fail: Successfully load the secure storage file using the old secret after rekey")
+	}
+	_, err = ss.LoadInfo(fileName, []byte(secretCode))
+	if err != nil {
+		t.Errorf("Test fail: Load the secure storage file using the new secret after rekey fail, error: %v", err)
+	}
+	url = fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", newHeaderInfo, cr.EmptyStr)
+}
+
+// Test the items list: the keys are sorted, filtered by the prefix and paginated using the offset and the limit
+func TestListItems(t *testing.T) {
+	keys := []string{"user-b", "user-a", "group-a", "user-c"}
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	for _, key := range keys {
+		item, _ := json.Marshal(itemData{Key: key, Value: "value"})
+		exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	}
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), storageItemsPath)
+	meta := ss.ItemMetadata{Size: len("value")}
+	okJ := itemsList{Items: []ss.KeyMetadata{{Key: "user-a", ItemMetadata: meta}, {Key: "user-b", ItemMetadata: meta}, {Key: "user-c", ItemMetadata: meta}}, Total: 3}
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+"?prefix=user-", http.StatusOK, "", baseHeaderInfo, okJ)
+	okJ = itemsList{Items: []ss.KeyMetadata{{Key: "user-b", ItemMetadata: meta}}, Offset: 1, Total: 3}
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+"?prefix=user-&offset=1&limit=1", http.StatusOK, "", baseHeaderInfo, okJ)
+	okJ = itemsList{Items: []ss.KeyMetadata{}, Offset: 10, Total: 4}
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+"?offset=10", http.StatusOK, "", baseHeaderInfo, okJ)
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+"?limit=-1", http.StatusBadRequest, "", baseHeaderInfo, cr.Error{Code: http.StatusBadRequest})
+	exeCommandCheckRes(t, cr.HTTPGetStr, url+fmt.Sprintf("?limit=%v", maxItemsLimit+1), http.StatusBadRequest, "", baseHeaderInfo, cr.Error{Code: http.StatusBadRequest})
+	headerInfo := make(headerMapT)
+	headerInfo[secretIDParam] = "wrong secret"
+	exeCommandCheckRes(t, cr.HTTPGetStr, url, http.StatusNotFound, "", headerInfo, cr.Error{Code: http.StatusNotFound})
+	url = fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", baseHeaderInfo, cr.EmptyStr)
+}
+
+// Test the item time to live: the item can be read before it expires and it is not found after it expires
+// Verify that a negative time to live is rejected
+func TestItemTTL(t *testing.T) {
+	headerInfo := make(headerMapT)
+	headerInfo[secretIDParam] = secretCode
+	headerInfo[keyIDParam] = "key"
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	item, _ := json.Marshal(itemData{Key: "key", Value: "value", TTL: -1})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusBadRequest, string(item), baseHeaderInfo, cr.Error{Code: http.StatusBadRequest})
+	item, _ = json.Marshal(itemData{Key: "key", Value: "value", TTL: 1})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusOK, "", headerInfo, itemValue{"value"})
+	time.Sleep(1100 * time.Millisecond)
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusNotFound, "", headerInfo, cr.Error{Code: http.StatusNotFound})
+	url := fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", baseHeaderInfo, cr.EmptyStr)
+}
+
+// Test the update of several items together:
+// 1. Verify that the items of a successful update are added and removed
+// 2. Verify that no item is changed if one of the updates fails
+func TestUpdateItems(t *testing.T) {
+	headerInfo := make(headerMapT)
+	headerInfo[secretIDParam] = secretCode
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	item, _ := json.Marshal(itemData{Key: "key1", Value: "value1"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), storageItemsPath)
+	batch, _ := json.Marshal(itemsBatch{Add: []itemData{{Key: "key2", Value: "value2"}, {Key: "key3", Value: "value3"}}, Remove: []string{"key1"}})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusOK, string(batch), baseHeaderInfo, okURLJ)
+	headerInfo[keyIDParam] = "key2"
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusOK, "", headerInfo, itemValue{"value2"})
+	headerInfo[keyIDParam] = "key1"
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusNotFound, "", headerInfo, cr.Error{Code: http.StatusNotFound})
+
+	batch, _ = json.Marshal(itemsBatch{Add: []itemData{{Key: "key4", Value: "value4"}}, Remove: []string{"key3", "key1"}})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusNotFound, string(batch), baseHeaderInfo, cr.Error{Code: http.StatusNotFound})
+	batch, _ = json.Marshal(itemsBatch{Add: []itemData{{Key: "key4", Value: "value4"}, {Key: "key5", Value: "value5", TTL: -1}}})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusBadRequest, string(batch), baseHeaderInfo, cr.Error{Code: http.StatusBadRequest})
+	headerInfo[keyIDParam] = "key3"
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusOK, "", headerInfo, itemValue{"value3"})
+	headerInfo[keyIDParam] = "key4"
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusNotFound, "", headerInfo, cr.Error{Code: http.StatusNotFound})
+	url = fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", baseHeaderInfo, cr.EmptyStr)
+}
+
+// Test the secure storage that is persisted with a journal:
+// 1. Verify that an added item is in the journal: it is found when the stored secure storage is loaded
+// 2. Verify that the stored secure storage is loaded when the secure storage is created again
+func TestJournal(t *testing.T) {
+	fileName := "./journal.txt"
+	headerInfo := make(headerMapT)
+	headerInfo[secretIDParam] = secretCode
+	headerInfo[keyIDParam] = "key"
+	backend := ss.NewFileBackend(fileName)
+	stRestful.SetSecureStorageBackend(backend)
+	defer stRestful.SetSecureStorageBackend(nil)
+	defer os.Remove(fileName)
+	defer os.Remove(fileName + ".journal")
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	item, _ := json.Marshal(itemData{Key: "key", Value: "value"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	data, err := ss.LoadInfoFromBackend(backend, []byte(secretCode))
+	if err != nil {
+		t.Fatalf("Test fail: can't load the stored secure storage, error: %v", err)
+	}
+	val, err := data.GetItem("key")
+	if err != nil || val != "value" {
+		t.Errorf("Test fail: the item that was added is not in the journal, its value is '%v', error: %v", val, err)
+	}
+	url := fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", baseHeaderInfo, cr.EmptyStr)
+	initState(t)
+	exeCommandCheckRes(t, cr.HTTPGetStr, itemPath, http.StatusOK, "", headerInfo, itemValue{"value"})
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", baseHeaderInfo, cr.EmptyStr)
+}
+
+// Test the rekey of a persisted secure storage
+// 1. Verify that the stored secure storage can be loaded only using the new secret after the rekey
+// 2. Verify that the previous generations that are protected by the old secret are removed
+// 3. Verify that the item changes after the rekey are written to the journal
+func TestRekeyPersisted(t *testing.T) {
+	newSecretCode := "dEFf@1234567890654321"
+	fileName := "./rekey.txt"
+	backend := ss.NewFileBackend(fileName)
+	backend.SetGenerationsNum(2)
+	stRestful.SetSecureStorageBackend(backend)
+	defer stRestful.SetSecureStorageBackend(nil)
+	defer os.Remove(fileName)
+	defer os.Remove(fileName + ".journal")
+	defer os.Remove(backend.GetGenerationName(1))
+	defer os.Remove(backend.GetGenerationName(2))
+
+	initState(t)
+	okURLJ := cr.URL{URL: fmt.Sprintf("%v", servicePath)}
+	item, _ := json.Marshal(itemData{Key: "key", Value: "value"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), baseHeaderInfo, okURLJ)
+	stRestful.SecureStorage.StoreInfoToBackend(backend)
+	url := listener + servicePath + fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), secretPath)
+	secret, _ := json.Marshal(cr.Secret{Secret: newSecretCode})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, url, http.StatusOK, string(secret), baseHeaderInfo, okURLJ)
+	for i := 1; i <= 2; i++ {
+		if _, err := os.Stat(backend.GetGenerationName(i)); err == nil {
+			t.Errorf("Test fail: the generation %v that is protected by the old secret was not removed", i)
+		}
+	}
+	_, err := ss.LoadInfoFromBackend(backend, []byte(secretCode))
+	if err == nil {
+		t.Errorf("Test fail: Successfully load the stored secure storage using the old secret after rekey")
+	}
+	newHeaderInfo := make(headerMapT)
+	newHeaderInfo[secretIDParam] = newSecretCode
+	item, _ = json.Marshal(itemData{Key: "key1", Value: "value1"})
+	exeCommandCheckRes(t, cr.HTTPPatchStr, itemPath, http.StatusCreated, string(item), newHeaderInfo, okURLJ)
+	data, err := ss.LoadInfoFromBackend(backend, []byte(newSecretCode))
+	if err != nil {
+		t.Fatalf("Test fail: Load the stored secure storage using the new secret after rekey fail, error: %v", err)
+	}
+	for _, key := range []string{"key", "key1"} {
+		if _, err := data.GetItem(key); err != nil {
+			t.Errorf("Test fail: the item '%v' is not in the stored secure storage after rekey, error: %v", key, err)
+		}
+	}
+	url = fmt.Sprintf(cr.ConvertCommandToRequest(urlCommands[handleStorageCommand]), resourcePath)
+	exeCommandCheckRes(t, cr.HTTPDeleteStr, url, http.StatusNoContent, "", newHeaderInfo, cr.EmptyStr)
+}
@@ -1,15 +1,21 @@
 // Package salt : The salt package provides salting services for anyone who uses passwords
+//
+// The salted password is calculated using a digest (SHA-1 by default, SHA-256 and SHA-512 are supported as well)
+// either by iterating the digest over the secret and the salt or by HMAC based stretching (PBKDF2) with the given
+// number of iterations. The salted output may be serialized together with its parameters and its salt, so it can be
+// matched later even if the default parameters were changed
 package salt
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	"fmt"
 	"hash"
 	"io"
 
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 const (
@@ -21,6 +27,7 @@ const (
 	minSaltLen          = 0
 	maxSaltLen          = 128
 	minNumOfItterations = 1
+	maxNumOfItterations = 1 << 24
 )
 
 var defaultHashFunc = sha1.New
@@ -32,11 +39,12 @@ type Salt struct {
 	OutputLen  int              // Number of digits in the code. Default is 6
 	Iterations int              // Number of iterations to run the hash function, Default is 64
 	Digest     func() hash.Hash // Digest type, Default is sha1
+	Hmac       bool             // Use HMAC based stretching (PBKDF2) instead of iterating the digest, Default is false
 }
 
 func (s Salt) String() string {
-	ret := fmt.Sprintf("Salt info: secret: %v, salt: %v, iterations: %v, output len: %v, digest: %v",
-		string(s.Secret), string(s.Salt), s.Iterations, s.OutputLen, s.Digest)
+	ret := fmt.Sprintf("Salt info: secret: %v, salt: %v, iterations: %v, output len: %v, digest: %v, HMAC: %v",
+		string(s.Secret), string(s.Salt), s.Iterations, s.OutputLen, s.Digest, s.Hmac)
 	return ret
 }
 
@@ -69,8 +77,8 @@ func isSaltValid(salt []byte) error {
 }
 
 func isNumOfIterationsValid(val int) error {
-	if val < minNumOfItterations {
-		return fmt.Errorf("Salt struct is not valid, The number of iterations %v is less than the minimum %v", val, minNumOfItterations)
+	if val < minNumOfItterations || val > maxNumOfItterations {
+		return fmt.Errorf("Salt struct is not valid, The number of iterations %v must be between %v and %v", val, minNumOfItterations, maxNumOfItterations)
 	}
 	return nil
 }
@@ -115,6 +123,7 @@ func NewSalt(secret []byte, minSecretLen int, maxSecretLen int, salt []byte) (*S
 		defaultOutputLen,
 		defaultNumOfItterations,
 		defaultHashFunc,
+		false,
 	}, nil
 }
 
@@ -145,7 +154,7 @@ func GeneratePasswordWithRndSalt(pass string, minSecretLen int, maxSecretLen int
 }
 
 // Generate : Return the encrypted data for a given salt and secret
-// The way to add salt is: secret + salt
+// The way to add salt is: secret + salt, or when HMAC is set: PBKDF2 of the secret and the salt
 //TODO: output len from right or from left
 func (s Salt) Generate(minSecretLen int, maxSecretLen int) ([]byte, error) {
 	err := s.isValid(minSecretLen, maxSecretLen)
@@ -154,11 +163,20 @@ func (s Salt) Generate(minSecretLen int, maxSecretLen int) ([]byte, error) {
 	}
 	h := s.Digest()
 
-	data := s.Secret
-	for i := 0; i < s.Iterations; i++ {
-		data = append(data, s.Salt...)
-		h.Write(data)
-		data = h.Sum(nil)
+	var data []byte
+	if s.Hmac {
+		keyLen := h.Size()
+		if keyLen > s.OutputLen {
+			keyLen = s.OutputLen
+		}
+		data = pbkdf2.Key(s.Secret, s.Salt, s.Iterations, keyLen, s.Digest)
+	} else {
+		data = s.Secret
+		for i := 0; i < s.Iterations; i++ {
+			data = append(data, s.Salt...)
+			h.Write(data)
+			data = h.Sum(nil)
+		}
 	}
 	logger.Trace.Println("data:", data)
 	len := len(data)
@@ -169,10 +187,23 @@ func (s Salt) Generate(minSecretLen int, maxSecretLen int) ([]byte, error) {
 	return ret, nil
 }
 
-// Match : compare 2 given salt information
+// Match : compare 2 given salt information, if the given reference is serialized (GenerateSerialized), the secret
+// is salted using the parameters and the salt that are serialized with it instead of the ones of the Salt structure
 func (s Salt) Match(ref []byte, minSecretLen int, maxSecretLen int) (bool, error) {
+	if IsSerialized(ref) {
+		params, saltData, data, err := parseSerialized(ref)
+		if err != nil {
+			return false, err
+		}
+		s1, err := NewSaltWithParams(s.Secret, minSecretLen, maxSecretLen, saltData, params)
+		if err != nil {
+			return false, err
+		}
+		s = *s1
+		ref = data
+	}
 	res, _ := s.Generate(minSecretLen, maxSecretLen)
-	ok := bytes.Equal(res, ref)
+	ok := subtle.ConstantTimeCompare(res, ref) == 1
 	return ok, nil
 }
 
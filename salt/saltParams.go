@@ -0,0 +1,220 @@
+package salt
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The serialized salted output is a self describing string: $salt$d=<digest>,h=<0|1>,i=<iterations>,l=<output len>$<salt>$<output>
+// where the salt and the output are base64 encoded (without padding)
+
+const (
+	// Sha1DigestName : the name of the SHA-1 digest (the default digest)
+	Sha1DigestName = "sha1"
+	// Sha256DigestName : the name of the SHA-256 digest
+	Sha256DigestName = "sha256"
+	// Sha512DigestName : the name of the SHA-512 digest
+	Sha512DigestName = "sha512"
+
+	serializedPrefix = "$salt$"
+)
+
+var (
+	digests = map[string]func() hash.Hash{
+		Sha1DigestName:   sha1.New,
+		Sha256DigestName: sha256.New,
+		Sha512DigestName: sha512.New,
+	}
+
+	serializedEncoding = base64.RawStdEncoding
+)
+
+// Params : The salting parameters that are serialized with the salted output: the digest name, whether HMAC based
+// stretching is used, the number of iterations and the output length
+type Params struct {
+	Digest     string
+	Hmac       bool
+	Iterations int
+	OutputLen  int
+}
+
+func (p Params) String() string {
+	return fmt.Sprintf("Digest: %v, HMAC: %v, iterations: %v, output len: %v", p.Digest, p.Hmac, p.Iterations, p.OutputLen)
+}
+
+// NewDefaultParams : Return the parameters of the default Salt: SHA-1, 1 iteration, no HMAC
+func NewDefaultParams() Params {
+	return Params{Digest: Sha1DigestName, Iterations: defaultNumOfItterations, OutputLen: defaultOutputLen}
+}
+
+// GetDigest : Return the digest function of the given digest name
+func GetDigest(name string) (func() hash.Hash, error) {
+	digest, exist := digests[name]
+	if exist == false {
+		return nil, fmt.Errorf("The digest '%v' is not supported, the supported digests are: '%v', '%v', '%v'",
+			name, Sha1DigestName, Sha256DigestName, Sha512DigestName)
+	}
+	return digest, nil
+}
+
+// Return the name of the given digest function, only the supported digests have names
+func getDigestName(digest func() hash.Hash) (string, error) {
+	if digest != nil {
+		ptr := reflect.ValueOf(digest).Pointer()
+		for name, d := range digests {
+			if reflect.ValueOf(d).Pointer() == ptr {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("The digest can't be serialized, the supported digests are: '%v', '%v', '%v'",
+		Sha1DigestName, Sha256DigestName, Sha512DigestName)
+}
+
+// NewSaltWithParams : Return a Salt that uses the given parameters
+func NewSaltWithParams(secret []byte, minSecretLen int, maxSecretLen int, salt []byte, params Params) (*Salt, error) {
+	digest, err := GetDigest(params.Digest)
+	if err != nil {
+		return nil, err
+	}
+	err = isNumOfIterationsValid(params.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	err = isOutputLenValid(params.OutputLen)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSalt(secret, minSecretLen, maxSecretLen, salt)
+	if err != nil {
+		return nil, err
+	}
+	s.Digest = digest
+	s.Hmac = params.Hmac
+	s.Iterations = params.Iterations
+	s.OutputLen = params.OutputLen
+	return s, nil
+}
+
+// GetParams : Return the serializable parameters of the Salt
+func (s Salt) GetParams() (Params, error) {
+	name, err := getDigestName(s.Digest)
+	if err != nil {
+		return Params{}, err
+	}
+	return Params{Digest: name, Hmac: s.Hmac, Iterations: s.Iterations, OutputLen: s.OutputLen}, nil
+}
+
+// GenerateSerialized : Return the salted data serialized together with the salting parameters and the salt
+func (s Salt) GenerateSerialized(minSecretLen int, maxSecretLen int) ([]byte, error) {
+	params, err := s.GetParams()
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.Generate(minSecretLen, maxSecretLen)
+	if err != nil {
+		return nil, err
+	}
+	hmacFlag := 0
+	if params.Hmac {
+		hmacFlag = 1
+	}
+	return []byte(fmt.Sprintf("%vd=%v,h=%v,i=%v,l=%v$%v$%v", serializedPrefix, params.Digest, hmacFlag, params.Iterations, params.OutputLen,
+		serializedEncoding.EncodeToString(s.Salt), serializedEncoding.EncodeToString(data))), nil
+}
+
+// GenerateSerializedSaltedPassword : generate a salted password using the given password, salt and parameters,
+// serialized together with the parameters and the salt
+func GenerateSerializedSaltedPassword(pwd []byte, minSecretLen int, maxSecretLen int, saltData []byte, params Params) ([]byte, error) {
+	s, err := NewSaltWithParams(pwd, minSecretLen, maxSecretLen, saltData, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.GenerateSerialized(minSecretLen, maxSecretLen)
+}
+
+// MatchSerializedSaltedPassword : Verify that the given password matches the given serialized salted password,
+// using the parameters and the salt that are serialized with it
+func MatchSerializedSaltedPassword(pwd []byte, minSecretLen int, maxSecretLen int, ref []byte) (bool, error) {
+	if IsSerialized(ref) == false {
+		return false, fmt.Errorf("The salted password is not serialized")
+	}
+	s := Salt{Secret: pwd}
+	return s.Match(ref, minSecretLen, maxSecretLen)
+}
+
+// IsSerialized : Check if the given salted data is serialized with its parameters
+func IsSerialized(data []byte) bool {
+	return strings.HasPrefix(string(data), serializedPrefix)
+}
+
+// GetSerializedParams : Return the salting parameters of the given serialized salted data,
+// e.g. to check if it should be salted again using the current parameters
+func GetSerializedParams(data []byte) (Params, error) {
+	params, _, _, err := parseSerialized(data)
+	return params, err
+}
+
+// Return the parameters, the salt and the salted output of the given serialized salted data
+func parseSerialized(data []byte) (Params, []byte, []byte, error) {
+	var params Params
+
+	errFmt := "The serialized salted data is not valid: %v"
+	if IsSerialized(data) == false {
+		return params, nil, nil, fmt.Errorf(errFmt, "it does not start with "+serializedPrefix)
+	}
+	fields := strings.Split(string(data)[len(serializedPrefix):], "$")
+	if len(fields) != 3 {
+		return params, nil, nil, fmt.Errorf(errFmt, "wrong number of fields")
+	}
+	values := make(map[string]string)
+	for _, param := range strings.Split(fields[0], ",") {
+		nameValue := strings.SplitN(param, "=", 2)
+		if len(nameValue) != 2 {
+			return params, nil, nil, fmt.Errorf(errFmt, fmt.Sprintf("the parameter '%v' is not valid", param))
+		}
+		values[nameValue[0]] = nameValue[1]
+	}
+	var err error
+	params.Digest = values["d"]
+	params.Hmac = values["h"] == "1"
+	if values["h"] != "0" && values["h"] != "1" {
+		return params, nil, nil, fmt.Errorf(errFmt, fmt.Sprintf("the HMAC flag '%v' is not valid", values["h"]))
+	}
+	params.Iterations, err = strconv.Atoi(values["i"])
+	if err == nil {
+		params.OutputLen, err = strconv.Atoi(values["l"])
+	}
+	if err != nil || len(values) != 4 {
+		return params, nil, nil, fmt.Errorf(errFmt, fmt.Sprintf("the parameters '%v' are not valid", fields[0]))
+	}
+	_, err = GetDigest(params.Digest)
+	if err == nil {
+		err = isNumOfIterationsValid(params.Iterations)
+	}
+	if err == nil {
+		err = isOutputLenValid(params.OutputLen)
+	}
+	if err != nil {
+		return params, nil, nil, err
+	}
+	saltData, err := serializedEncoding.DecodeString(fields[1])
+	if err == nil {
+		err = isSaltValid(saltData)
+	}
+	if err != nil {
+		return params, nil, nil, fmt.Errorf(errFmt, fmt.Sprintf("the salt is not valid: %v", err))
+	}
+	output, err := serializedEncoding.DecodeString(fields[2])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf(errFmt, fmt.Sprintf("the salted output is not valid: %v", err))
+	}
+	return params, saltData, output, nil
+}
@@ -0,0 +1,114 @@
+package salt
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+type testVector struct {
+	Secret string
+	Salt   string
+	Params Params
+	Result string
+}
+
+// The HMAC vectors are the PBKDF2 test vectors (RFC 6070 for SHA-1), the other vectors are
+// the digest of secret + salt, iterated over the accumulated data
+var testVectors = []testVector{
+	{"ABCD", "A1B2", Params{Sha1DigestName, false, 1, 128}, "f877eed103f74c751952861e0630e643c4ec1eaa"},
+	{"ABCD", "A1B2", Params{Sha1DigestName, false, 3, 128}, "c6cf71920f703abfc748de84871379def2ec3ebf"},
+	{"ABCD", "A1B2", Params{Sha256DigestName, false, 1, 128}, "a193d7d1ba2253b712d13a0dd27bd7dfddcf04a6c8d904ae7e0e9ba2ced0f8fb"},
+	{"ABCD", "A1B2", Params{Sha256DigestName, false, 3, 128}, "63cb30f8ec3d757af77169d2b4c47c4a5954187a824a678d55744e07a6f002bb"},
+	{"ABCD", "A1B2", Params{Sha512DigestName, false, 1, 128},
+		"dd0f8983e5a770442a0aca37f62e59ef15988a508bd43ed2e6a9ce0ac94caefe7f25bca6d1ef2d6196ae981737c055900378463cac60769d59b15d0ab0b5dc30"},
+	{"ABCD", "A1B2", Params{Sha512DigestName, false, 3, 128},
+		"a2161ec82f3040090d0a19516f206e30eb867a736322f283772964cfd8df9f9b14d635f55e016890c48671e6ff093ff3518c557bb8bd265e2a6fde86eef6af95"},
+	{"password", "salt", Params{Sha1DigestName, true, 1, 128}, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+	{"password", "salt", Params{Sha1DigestName, true, 2, 128}, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+	{"password", "salt", Params{Sha1DigestName, true, 4096, 128}, "4b007901b765489abead49d926f721d065a429c1"},
+	{"password", "salt", Params{Sha256DigestName, true, 1, 128}, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+	{"password", "salt", Params{Sha256DigestName, true, 2, 128}, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	{"password", "salt", Params{Sha256DigestName, true, 4096, 128}, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	{"password", "salt", Params{Sha512DigestName, true, 1, 128},
+		"867f70cf1ade02cff3752599a3a53dc4af34c7a669815ae5d513554e1c8cf252c02d470a285a0501bad999bfe943c08f050235d7d68b1da55e63f73b60a57fce"},
+	{"password", "salt", Params{Sha512DigestName, true, 2, 128},
+		"e1d9c16aa681708a45f5c7c4e215ceb66e011a2e9f0040713f18aefdb866d53cf76cab2868a39b9f7840edce4fef5a82be67335c77a6068e04112754f27ccf4e"},
+	{"password", "salt", Params{Sha512DigestName, true, 4096, 128},
+		"d197b1b33db0143e018b12f3d1d1479e6cdebdcc97c5c0f87f6902e072f457b5143f30602641b3d55cd335988cb36b84376060ecd532e039b742a239434af2d5"},
+	{"password", "salt", Params{Sha256DigestName, true, 4096, 16}, "c5e478d59288c841aa530db6845c4c8d"},
+}
+
+// Verify that the salted output of each of the digests, with and without HMAC, matches the test vectors
+func Test_saltTestVectors(t *testing.T) {
+	for i, v := range testVectors {
+		s, err := NewSaltWithParams([]byte(v.Secret), testMinPwdLen, testMaxPwdLen, []byte(v.Salt), v.Params)
+		if err != nil {
+			t.Fatalf("Test fail: can't initialize the Salt using the parameters: %v, error: %v", v.Params, err)
+		}
+		res, err := s.Generate(testMinPwdLen, testMaxPwdLen)
+		if err != nil || hex.EncodeToString(res) != v.Result {
+			t.Errorf("Test %v fail: the salted output using %v is '%v' instead of '%v', error: %v", i, v.Params, hex.EncodeToString(res), v.Result, err)
+		}
+	}
+}
+
+// Verify that the serialized salted output includes its parameters and that it is matched using them
+// even when the Salt that matches it uses other parameters
+func Test_serializedSaltMatch(t *testing.T) {
+	for _, v := range testVectors {
+		serialized, err := GenerateSerializedSaltedPassword([]byte(v.Secret), testMinPwdLen, testMaxPwdLen, []byte(v.Salt), v.Params)
+		if err != nil {
+			t.Fatalf("Test fail: can't generate a serialized salted password using %v, error: %v", v.Params, err)
+		}
+		if IsSerialized(serialized) == false {
+			t.Errorf("Test fail: the serialized salted password '%v' is not recognized as serialized", string(serialized))
+		}
+		p, err := GetSerializedParams(serialized)
+		if err != nil || p != v.Params {
+			t.Errorf("Test fail: the parameters of '%v' are %v instead of %v, error: %v", string(serialized), p, v.Params, err)
+		}
+		s, _ := NewSaltWithParams([]byte(v.Secret), testMinPwdLen, testMaxPwdLen, []byte("other salt"), Params{Sha512DigestName, true, 10, 64})
+		ok, err := s.Match(serialized, testMinPwdLen, testMaxPwdLen)
+		if ok == false || err != nil {
+			t.Errorf("Test fail: the serialized salted password '%v' was not matched, error: %v", string(serialized), err)
+		}
+		ok, _ = MatchSerializedSaltedPassword([]byte(v.Secret+"a"), testMinPwdLen, testMaxPwdLen, serialized)
+		if ok {
+			t.Errorf("Test fail: a wrong password was matched to the serialized salted password '%v'", string(serialized))
+		}
+	}
+}
+
+// Verify that illegal serialized salted data, parameters and digests that can't be serialized are rejected
+func Test_serializedSaltCorners(t *testing.T) {
+	illegal := []string{"salt$d=sha1,h=0,i=1,l=128$QTFCMg$AAAA", "$salt$d=sha1,h=0,i=1,l=128$QTFCMg", "$salt$d=md5,h=0,i=1,l=128$QTFCMg$AAAA",
+		"$salt$d=sha1,h=2,i=1,l=128$QTFCMg$AAAA", "$salt$d=sha1,h=0,i=0,l=128$QTFCMg$AAAA", "$salt$d=sha1,h=0,i=1,l=1$QTFCMg$AAAA",
+		"$salt$d=sha1,h=0,i=1$QTFCMg$AAAA", "$salt$d=sha1,h=0,i=1,l=128$Q!$AAAA", "$salt$d=sha1,h=0,i=1,l=128,x=1$QTFCMg$AAAA"}
+	for _, data := range illegal {
+		_, err := GetSerializedParams([]byte(data))
+		if err == nil {
+			t.Errorf("Test fail: the illegal serialized salted data '%v' was accepted", data)
+		}
+		_, err = MatchSerializedSaltedPassword(BaseSecret, testMinPwdLen, testMaxPwdLen, []byte(data))
+		if err == nil {
+			t.Errorf("Test fail: a password was matched to the illegal serialized salted data '%v' without an error", data)
+		}
+	}
+	s, _ := NewSalt(BaseSecret, testMinPwdLen, testMaxPwdLen, BaseSalt)
+	s.Digest = md5.New
+	_, err := s.GenerateSerialized(testMinPwdLen, testMaxPwdLen)
+	if err == nil || strings.Contains(err.Error(), Sha256DigestName) == false {
+		t.Errorf("Test fail: a salted output using MD5 was serialized, error: %v", err)
+	}
+	_, err = NewSaltWithParams(BaseSecret, testMinPwdLen, testMaxPwdLen, BaseSalt, Params{Sha256DigestName, true, maxNumOfItterations + 1, 32})
+	if err == nil {
+		t.Errorf("Test fail: a Salt with %v iterations was created", maxNumOfItterations+1)
+	}
+	s, _ = NewSalt(BaseSecret, testMinPwdLen, testMaxPwdLen, BaseSalt)
+	p, _ := s.GetParams()
+	if p != NewDefaultParams() {
+		t.Errorf("Test fail: the parameters of the default Salt are %v instead of %v", p, NewDefaultParams())
+	}
+}
@@ -80,3 +80,17 @@ func ExampleGetRandomSalt() {
 			"with", iter, "iterations, output password length:", size, "bytes and MD5 function is:", res)
 	}
 }
+
+// This example shows how to generate a salted password using HMAC based stretching with SHA-256 and 10000 iterations,
+// serialized with its parameters, and how to match a password to it
+func ExampleGenerateSerializedSaltedPassword() {
+	pass := "MyPassword"
+	params := salt.Params{Digest: salt.Sha256DigestName, Hmac: true, Iterations: 10000, OutputLen: 32}
+	res, err := salt.GenerateSerializedSaltedPassword([]byte(pass), minSecretLen, maxSecretLen, BasicSalt, params)
+	if err != nil {
+		fmt.Println("GenerateSerializedSaltedPassword failed, error:", err)
+		return
+	}
+	ok, err := salt.MatchSerializedSaltedPassword([]byte(pass), minSecretLen, maxSecretLen, res)
+	fmt.Println("* The serialized salted password of:", pass, "using", params, "is:", string(res), "matched:", ok, err)
+}
@@ -1,12 +1,31 @@
 // Initialization services.
 //
 // Utility that generates an initial secureStorage file to be used later by all other components
+// or replaces the secure key of an existing secureStorage file
 // The usage is:
 //	usage: generate_login_file
 //	 -generate-rsa=false: Generate RSA private/public files ('key.private', 'key.pub')
 //	 -login-file="./data.txt": First data file that includes the root user
 //	 -password="root": Root password
+//	 -passphrase-words=0: when set, a random passphrase of this number of words is generated and used as the root password (instead of -password)
 //	 -secure-key="./secureKey": secure key file path
+//	 -new-secure-key="": new secure key file path, when set the storage file is re-encrypted using the new secure key
+//	 -storage-backend="file": storage backend ('file', 'directory' or 'bolt')
+//	 -shares=0: when set, a random secure key is generated and split into this number of key shares (instead of using the secure key file)
+//	 -threshold=0: the number of key shares that are needed to unseal the server
+//	 -shares-dir="./shares": the directory to write the key shares to, a file for each share
+//	 -kdf="PBKDF2-SHA256": the key derivation function of the storage file and of a new secure key file ('PBKDF2-SHA256', 'scrypt' or 'Argon2id')
+//	 -update-kdf=false: when set, the storage file is re-encrypted using the key derivation function (e.g. to raise its cost), its data is not changed
+//	 -breached-hashes="": sorted hex encoded SHA-1 hashes of breached passwords file (one per line), when set the breached passwords file is generated from it
+//	 -breached-passwords="./breached.bin": breached passwords file to generate
+//	 -new-pepper="": when set, a random password hashing pepper file (and its parameters file) is generated, it must not exist
+//	 -add-key-provider="": when set, the key provider (type:name:argument) is added to the storage file, so it can unlock it instead of the secure key
+//	 -remove-key-provider="": when set, the key provider with this name is removed from the storage file (it can't unlock it anymore)
+//	 -key-providers="": comma separated list of the key providers (type:name:argument) of the storage file,
+//	   they wrap the new storage key when the secure key or the key derivation function is replaced
+//
+// The salt and the KDF parameters of a secure key file are stored next to it (with the '.kdf' suffix),
+// the file is created with a random salt when a new storage file is generated (or re-encrypted using a new secure key file) and it does not exist
 package main
 
 import (
@@ -20,6 +39,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	am "github.com/ibm-security-innovation/libsecurity-go/accounts"
 	defs "github.com/ibm-security-innovation/libsecurity-go/defs"
@@ -30,7 +50,8 @@ import (
 )
 
 const (
-	saltLen = 8
+	saltLen      = 8
+	secureKeyLen = 32
 
 	rsaPrivateKeyFileName = "key.private"
 	rsaPublicKeyFileName  = "key.pub"
@@ -50,7 +71,7 @@ func usage() {
 
 // Generate a new secure storage minimal file that includes the root user with
 // basic Account Management: the root user privilege and password
-func createBasicFile(stFilePath string, name string, pass string, key []byte) {
+func createBasicFile(backend ss.Backend, name string, pass string, key []byte) {
 	saltStr, _ := salt.GetRandomSalt(saltLen)
 	_, err := salt.GenerateSaltedPassword([]byte(pass), password.MinPasswordLength, password.MaxPasswordLength, saltStr, -1)
 	if err != nil {
@@ -60,7 +81,137 @@ func createBasicFile(stFilePath string, name string, pass string, key []byte) {
 	ul.AddUser(name)
 	amUser, _ := am.NewUserAm(am.SuperUserPermission, []byte(pass), saltStr, true)
 	ul.AddPropertyToEntity(name, defs.AmPropertyName, amUser)
-	ul.StoreInfo(stFilePath, key, false)
+	ul.StoreInfoToBackend(backend, key, false)
+}
+
+// Generate a root passphrase of the given number of words that adheres to the default password policy
+func generateRootPassphrase(words int) string {
+	params := password.NewDefaultPassphraseParams()
+	params.Words = words
+	p, err := password.GeneratePolicyValidPassphrase(password.GetDefaultPasswordPolicy(), params)
+	if err != nil {
+		log.Fatalf("Error: can't generate the root passphrase, error: %v", err)
+	}
+	fmt.Printf("The generated root passphrase is: %v (entropy: %.1f bits), keep it in a safe place\n", p.Passphrase, p.EntropyBits)
+	return p.Passphrase
+}
+
+// Re-encrypt the storage using the key read from the new secure key file
+func rekeyStorage(backend ss.Backend, key []byte, newSecureKeyFilePath string, providers []ss.KeyProvider) {
+	newKey := ss.GetSecureKey(newSecureKeyFilePath)
+	err := ss.RekeyInfo(backend, key, newKey, false, providers...)
+	if err != nil {
+		log.Fatalf("Error: can't replace the secure key of '%v', error: %v", backend, err)
+	}
+	fmt.Println("The storage:", backend, "is now protected by the secure key file:", newSecureKeyFilePath)
+}
+
+// Re-encrypt the storage using the given KDF parameters, the data is not changed
+func updateStorageKdf(backend ss.Backend, key []byte, kdf ss.KdfParams, providers []ss.KeyProvider) {
+	err := ss.UpdateKdfInfo(backend, key, kdf, providers...)
+	if err != nil {
+		log.Fatalf("Error: can't replace the key derivation function of '%v', error: %v", backend, err)
+	}
+	fmt.Println("The storage:", backend, "is now protected using the", kdf)
+}
+
+// Return the key providers of the given comma separated list of key providers specifications
+func getKeyProviders(specs string) []ss.KeyProvider {
+	var providers []ss.KeyProvider
+
+	if len(specs) == 0 {
+		return nil
+	}
+	for _, spec := range strings.Split(specs, ",") {
+		p, err := ss.NewKeyProviderFromSpec(spec)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// Add the given key provider to the storage (or remove the key provider with the given name) and store it
+func updateStorageKeyProviders(backend ss.Backend, key []byte, addSpec string, removeName string) {
+	s, err := ss.LoadInfoFromBackend(backend, key)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if len(addSpec) > 0 {
+		var p ss.KeyProvider
+		p, err = ss.NewKeyProviderFromSpec(addSpec)
+		if err == nil {
+			err = s.AddKeyProvider(p)
+		}
+	} else {
+		err = s.RemoveKeyProvider(removeName)
+	}
+	if err == nil {
+		err = s.StoreInfoToBackend(backend)
+	}
+	if err != nil {
+		log.Fatalf("Error: can't update the key providers of '%v', error: %v", backend, err)
+	}
+	fmt.Println("The storage:", backend, "can be unlocked by the key providers:", s.GetKeyProvidersNames())
+}
+
+// Create the parameters file (a random salt and the given KDF parameters) of the given secure key file, if it does not exist
+func createSecureKeyParams(secureKeyFilePath string, kdf ss.KdfParams) {
+	_, err := os.Stat(secureKeyFilePath + ss.SecureKeyParamsSuffix)
+	if err == nil {
+		return
+	}
+	err = ss.NewSecureKeyParams(secureKeyFilePath, kdf)
+	if err != nil {
+		log.Fatalf("Error: can't create the parameters file of the secure key file '%v', error: %v", secureKeyFilePath, err)
+	}
+}
+
+// Generate a random secure key, split it into key shares (each written to a separate file) and return it
+func generateSharedKey(sharesNum int, threshold int, sharesDir string) []byte {
+	key := make([]byte, secureKeyLen)
+	_, err := rand.Read(key)
+	if err != nil {
+		log.Fatalf("Error: can't generate a random secure key, error: %v", err)
+	}
+	shares, err := ss.SplitSecret(key, sharesNum, threshold)
+	if err != nil {
+		log.Fatalf("Error: can't split the secure key, error: %v", err)
+	}
+	err = os.MkdirAll(sharesDir, 0700)
+	if err != nil {
+		log.Fatalf("Error: can't create the key shares directory '%v', error: %v", sharesDir, err)
+	}
+	for i, share := range shares {
+		fileName := filepath.Join(sharesDir, fmt.Sprintf("share-%v", i+1))
+		err = ioutil.WriteFile(fileName, []byte(share), ss.FilePermissions)
+		if err != nil {
+			log.Fatalf("Error: can't write the key share '%v', error: %v", fileName, err)
+		}
+	}
+	fmt.Printf("The secure key was split into %v key shares in '%v', %v of them are needed to unseal the server, hand each of them to a different custodian\n",
+		sharesNum, sharesDir, threshold)
+	return key
+}
+
+// Generate a random password hashing pepper file and its parameters file, the pepper file is read like a secure key file
+func generatePepperFile(fileName string, kdf ss.KdfParams) {
+	_, err := os.Stat(fileName)
+	if err == nil {
+		log.Fatalf("Error: the pepper file '%v' already exists", fileName)
+	}
+	pepper := make([]byte, secureKeyLen)
+	_, err = rand.Read(pepper)
+	if err != nil {
+		log.Fatalf("Error: can't generate a random pepper, error: %v", err)
+	}
+	err = ioutil.WriteFile(fileName, pepper, ss.FilePermissions)
+	if err != nil {
+		log.Fatalf("Error: can't write the pepper file '%v', error: %v", fileName, err)
+	}
+	createSecureKeyParams(fileName, kdf)
+	fmt.Println("The generated pepper file name is:", fileName)
 }
 
 // Generate RSA public and private keys to the given file name
@@ -88,30 +239,107 @@ func generateRSAKeys(rsaPrivateKeyFileName string, rsaPublicKeyFileName string)
 	fmt.Println("Generate RSA files:", rsaPrivateKeyFileName, "And", rsaPublicKeyFileName)
 }
 
+// Generate the breached passwords file of the password blocklist from the given SHA-1 hashes file
+func generateBreachedPasswordsFile(hashesFileName string, fileName string) {
+	f, err := os.Open(hashesFileName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer f.Close()
+	err = password.WriteBreachedPasswordsFile(fileName, f)
+	if err != nil {
+		log.Fatalf("Error while generating the breached passwords file '%v': %v", fileName, err)
+	}
+	fmt.Println("The generated breached passwords file name is:", fileName)
+}
+
 func main() {
 	defaultRootPassword := defs.RootUserName
 
 	secureKeyFileNamePath := flag.String("secure-key", "./secureKey", "secure key file path")
 	loginFilePath := flag.String("storage-file", "./data.txt", "First storage file that includes the root user")
 	rootPassword := flag.String("password", defaultRootPassword, "Root password")
+	passphraseWords := flag.Int("passphrase-words", 0, "when set, a random passphrase of this number of words is generated and used as the root password (instead of -password)")
+	newSecureKeyFileNamePath := flag.String("new-secure-key", "", "new secure key file path, when set the storage file is re-encrypted using the new secure key")
+	storageBackend := flag.String("storage-backend", ss.FileBackendName, "storage backend ('file', 'directory' or 'bolt')")
+	generations := flag.Int("storage-generations", ss.DefaultGenerationsNum, "the number of previous generations of the storage file to keep, they are used if the storage file is corrupted")
+	sharesNum := flag.Int("shares", 0, "when set, a random secure key is generated and split into this number of key shares (instead of using the secure key file)")
+	threshold := flag.Int("threshold", 0, "the number of key shares that are needed to unseal the server")
+	sharesDir := flag.String("shares-dir", "./shares", "the directory to write the key shares to, a file for each share")
+	kdfName := flag.String("kdf", ss.Pbkdf2Sha256KdfName, fmt.Sprintf("the key derivation function of the storage file and of a new secure key file ('%v', '%v' or '%v')",
+		ss.Pbkdf2Sha256KdfName, ss.ScryptKdfName, ss.Argon2idKdfName))
+	updateKdf := flag.Bool("update-kdf", false, "when set, the storage file is re-encrypted using the key derivation function (e.g. to raise its cost), its data is not changed")
+	breachedHashes := flag.String("breached-hashes", "", "sorted hex encoded SHA-1 hashes of breached passwords file (one per line), when set the breached passwords file is generated from it")
+	breachedPwdsFile := flag.String("breached-passwords", "./breached.bin", "breached passwords file to generate")
+	newPepperFile := flag.String("new-pepper", "", "when set, a random password hashing pepper file (and its parameters file) is generated, it must not exist")
+	addKeyProvider := flag.String("add-key-provider", "", "when set, the key provider (type:name:argument) is added to the storage file, so it can unlock it instead of the secure key")
+	removeKeyProvider := flag.String("remove-key-provider", "", "when set, the key provider with this name is removed from the storage file (it can't unlock it anymore)")
+	keyProviders := flag.String("key-providers", "", "comma separated list of the key providers (type:name:argument) of the storage file, they wrap the new storage key when the secure key or the key derivation function is replaced")
 	str := fmt.Sprintf("Generate RSA private/public files ('%s', '%s')", rsaPrivateKeyFileName, rsaPublicKeyFileName)
 	generateRSA := flag.Bool("generate-rsa", false, str)
 	flag.Parse()
 	if flag.NArg() > 0 {
 		usage()
 	}
+	if *breachedHashes != "" {
+		generateBreachedPasswordsFile(*breachedHashes, *breachedPwdsFile)
+		return
+	}
+	if *newPepperFile != "" {
+		kdf, err := ss.NewKdfParams(*kdfName)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		generatePepperFile(*newPepperFile, kdf)
+		return
+	}
+	err := ss.SetDefaultGenerationsNum(*generations)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	backend, err := ss.NewBackend(*storageBackend, *loginFilePath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	kdf, err := ss.NewKdfParams(*kdfName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	ss.SetDefaultKdfParams(kdf)
+	if *newSecureKeyFileNamePath != "" {
+		createSecureKeyParams(*newSecureKeyFileNamePath, kdf)
+		rekeyStorage(backend, ss.GetSecureKey(*secureKeyFileNamePath), *newSecureKeyFileNamePath, getKeyProviders(*keyProviders))
+		return
+	}
+	if *updateKdf {
+		updateStorageKdf(backend, ss.GetSecureKey(*secureKeyFileNamePath), kdf, getKeyProviders(*keyProviders))
+		return
+	}
+	if *addKeyProvider != "" || *removeKeyProvider != "" {
+		updateStorageKeyProviders(backend, ss.GetSecureKey(*secureKeyFileNamePath), *addKeyProvider, *removeKeyProvider)
+		return
+	}
 
+	if *passphraseWords > 0 {
+		*rootPassword = generateRootPassphrase(*passphraseWords)
+	}
 	if *rootPassword == defaultRootPassword {
 		fmt.Printf("Error: The root password must be set (and not to '%v')\n", defaultRootPassword)
 		usage()
 	}
-	err := password.CheckPasswordStrength(*rootPassword)
+	err = password.CheckPasswordStrength(*rootPassword)
 	if err != nil {
 		log.Fatalf("Error: The root password must be more complex: %v", err)
 	}
 
-	key := ss.GetSecureKey(*secureKeyFileNamePath)
-	createBasicFile(*loginFilePath, defs.RootUserName, *rootPassword, key)
+	var key []byte
+	if *sharesNum > 0 {
+		key = generateSharedKey(*sharesNum, *threshold, *sharesDir)
+	} else {
+		createSecureKeyParams(*secureKeyFileNamePath, kdf)
+		key = ss.GetSecureKey(*secureKeyFileNamePath)
+	}
+	createBasicFile(backend, defs.RootUserName, *rootPassword, key)
 	fmt.Println("The generated file name is:", *loginFilePath)
 	if *generateRSA {
 		generateRSAKeys(rsaPrivateKeyFileName, rsaPublicKeyFileName)
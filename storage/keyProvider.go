@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The key hierarchy: the storage items are encrypted using keys that are derived from the storage data key (DEK).
+// The data key is wrapped (encrypted) by one or more key-encryption keys (KEK), each supplied by a key provider,
+// and the wrapped copies are stored in the storage header. Each key provider can unlock the storage
+// and removing a wrapped copy revokes its key provider without re-encrypting the data.
+
+const (
+	// FileKeyProviderType : a key-encryption key that is derived from the content of a key file
+	FileKeyProviderType = "file"
+	// PassphraseKeyProviderType : a key-encryption key that is derived from a passphrase
+	PassphraseKeyProviderType = "passphrase"
+	// EnvKeyProviderType : a key-encryption key that is derived from the value of an environment variable
+	EnvKeyProviderType = "env"
+	// KmsKeyProviderType : the data key is wrapped by a key management service (KMS) master key
+	KmsKeyProviderType = "kms"
+
+	dataKeyLen = keyLen
+)
+
+// KeyProvider : a source of a key-encryption key that wraps and unwraps the storage data key.
+// The name identifies the wrapped copy of the data key in the storage header, so it must be unique per storage
+type KeyProvider interface {
+	Name() string
+	Type() string
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+// WrappedKey : the data key wrapped by the key provider with the given name
+type WrappedKey struct {
+	Name     string
+	Provider string
+	Key      []byte
+}
+
+func (w WrappedKey) String() string {
+	return fmt.Sprintf("Name: %v, provider: %v", w.Name, w.Provider)
+}
+
+// Encrypt the given key using AES-GCM with a random nonce, the nonce is prepended to the result
+func sealKey(kek []byte, key []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, additionalData), nil
+}
+
+func openKey(kek []byte, wrappedKey []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("The wrapped key is too short")
+	}
+	nonce := wrappedKey[:aead.NonceSize()]
+	return aead.Open(nil, nonce, wrappedKey[aead.NonceSize():], additionalData)
+}
+
+//------------------- Secret based key providers
+
+// SecretKeyProvider : a key provider that derives the key-encryption key from a secret (a key file content,
+// a passphrase or an environment variable value) and a random salt that is drawn each time the data key is wrapped
+type SecretKeyProvider struct {
+	name         string
+	providerType string
+	secret       []byte
+}
+
+func newSecretKeyProvider(name string, providerType string, secret []byte) (*SecretKeyProvider, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("The key provider name must not be empty")
+	}
+	err := isValidSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKeyProvider{name: name, providerType: providerType, secret: secret}, nil
+}
+
+// NewFileKeyProvider : Return a key provider whose key-encryption key is derived from the content of the given key file
+func NewFileKeyProvider(name string, keyFilePath string) (*SecretKeyProvider, error) {
+	secret, err := ioutil.ReadFile(keyFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading key file: '%v', error: %v", keyFilePath, err)
+	}
+	return newSecretKeyProvider(name, FileKeyProviderType, secret)
+}
+
+// NewPassphraseKeyProvider : Return a key provider whose key-encryption key is derived from the given passphrase
+func NewPassphraseKeyProvider(name string, passphrase []byte) (*SecretKeyProvider, error) {
+	return newSecretKeyProvider(name, PassphraseKeyProviderType, passphrase)
+}
+
+// NewEnvKeyProvider : Return a key provider whose key-encryption key is derived from the value of the given environment variable
+func NewEnvKeyProvider(name string, envVarName string) (*SecretKeyProvider, error) {
+	secret := os.Getenv(envVarName)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("The environment variable '%v' is not set", envVarName)
+	}
+	return newSecretKeyProvider(name, EnvKeyProviderType, []byte(secret))
+}
+
+func (p SecretKeyProvider) String() string {
+	return fmt.Sprintf("Key provider: %v, type: %v", p.name, p.providerType)
+}
+
+// Name : Return the key provider name
+func (p SecretKeyProvider) Name() string {
+	return p.name
+}
+
+// Type : Return the key provider type
+func (p SecretKeyProvider) Type() string {
+	return p.providerType
+}
+
+func (p SecretKeyProvider) getKek(saltData []byte) []byte {
+	return pbkdf2.Key(p.secret, saltData, DefaultKdfIterations, keyLen, sha256.New)
+}
+
+// WrapKey : Wrap the given key using a key-encryption key derived from the secret and a random salt,
+// the salt is prepended to the wrapped key
+func (p SecretKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	saltData := make([]byte, kdfSaltLen)
+	_, err := io.ReadFull(rand.Reader, saltData)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := sealKey(p.getKek(saltData), key, []byte(p.name))
+	if err != nil {
+		return nil, fmt.Errorf("Error while wrapping the key by '%v': %v", p.name, err)
+	}
+	return append(saltData, wrapped...), nil
+}
+
+// UnwrapKey : Unwrap a key that was wrapped by WrapKey
+func (p SecretKeyProvider) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	if len(wrappedKey) < kdfSaltLen {
+		return nil, fmt.Errorf("The key wrapped by '%v' is too short", p.name)
+	}
+	key, err := openKey(p.getKek(wrappedKey[:kdfSaltLen]), wrappedKey[kdfSaltLen:], []byte(p.name))
+	if err != nil {
+		return nil, fmt.Errorf("The key wrapped by '%v' can't be unwrapped, error: %v", p.name, err)
+	}
+	return key, nil
+}
+
+//------------------- KMS key provider
+
+// Kms : the operations of a key management service (KMS) that are used to wrap the data key,
+// the KMS master keys never leave the KMS
+type Kms interface {
+	Encrypt(keyID string, plaintext []byte, additionalData []byte) ([]byte, error)
+	Decrypt(keyID string, ciphertext []byte, additionalData []byte) ([]byte, error)
+}
+
+// KmsKeyProvider : a key provider that wraps the data key using a KMS master key
+type KmsKeyProvider struct {
+	name  string
+	keyID string
+	kms   Kms
+}
+
+// NewKmsKeyProvider : Return a key provider that wraps the data key using the KMS master key with the given ID
+func NewKmsKeyProvider(name string, kms Kms, keyID string) (*KmsKeyProvider, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("The key provider name must not be empty")
+	}
+	if kms == nil {
+		return nil, fmt.Errorf("The KMS must not be nil")
+	}
+	return &KmsKeyProvider{name: name, keyID: keyID, kms: kms}, nil
+}
+
+func (p KmsKeyProvider) String() string {
+	return fmt.Sprintf("Key provider: %v, type: %v, KMS key: %v", p.name, KmsKeyProviderType, p.keyID)
+}
+
+// Name : Return the key provider name
+func (p KmsKeyProvider) Name() string {
+	return p.name
+}
+
+// Type : Return the key provider type
+func (p KmsKeyProvider) Type() string {
+	return KmsKeyProviderType
+}
+
+// WrapKey : Encrypt the given key by the KMS
+func (p KmsKeyProvider) WrapKey(key []byte) ([]byte, error) {
+	return p.kms.Encrypt(p.keyID, key, []byte(p.name))
+}
+
+// UnwrapKey : Decrypt the given wrapped key by the KMS
+func (p KmsKeyProvider) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	return p.kms.Decrypt(p.keyID, wrappedKey, []byte(p.name))
+}
+
+// LocalKms : a local stand-in for an external KMS: the master keys are kept in a local file (JSON format)
+// and used only to encrypt and decrypt data by the KMS. Deleting a master key revokes all the keys that were wrapped by it
+type LocalKms struct {
+	fileName string
+	keys     map[string][]byte
+	mutex    sync.Mutex
+}
+
+// NewLocalKms : Return a local KMS that keeps its master keys in the given file, the file is created when the first key is created
+func NewLocalKms(fileName string) (*LocalKms, error) {
+	k := LocalKms{fileName: fileName, keys: make(map[string][]byte)}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return &k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read the KMS keys file: '%v', error: %v", fileName, err)
+	}
+	err = json.Unmarshal(data, &k.keys)
+	if err != nil {
+		return nil, fmt.Errorf("The KMS keys file '%v' is not valid, error: %v", fileName, err)
+	}
+	return &k, nil
+}
+
+func (k *LocalKms) String() string {
+	return fmt.Sprintf("Local KMS: %v", k.fileName)
+}
+
+func (k *LocalKms) store() error {
+	data, err := json.Marshal(k.keys)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(k.fileName, data)
+}
+
+// CreateKey : Create a new random master key with the given ID
+func (k *LocalKms) CreateKey(keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if len(keyID) == 0 {
+		return fmt.Errorf("The KMS key ID must not be empty")
+	}
+	if _, exist := k.keys[keyID]; exist {
+		return fmt.Errorf("The KMS key '%v' already exists", keyID)
+	}
+	key := make([]byte, keyLen)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return err
+	}
+	k.keys[keyID] = key
+	return k.store()
+}
+
+// DeleteKey : Delete the master key with the given ID, the keys that were wrapped by it can't be unwrapped anymore
+func (k *LocalKms) DeleteKey(keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, exist := k.keys[keyID]; exist == false {
+		return fmt.Errorf("The KMS key '%v' was not found", keyID)
+	}
+	delete(k.keys, keyID)
+	return k.store()
+}
+
+func (k *LocalKms) getKey(keyID string) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, exist := k.keys[keyID]
+	if exist == false {
+		return nil, fmt.Errorf("The KMS key '%v' was not found", keyID)
+	}
+	return key, nil
+}
+
+// Encrypt : Encrypt the given plaintext using the master key with the given ID
+func (k *LocalKms) Encrypt(keyID string, plaintext []byte, additionalData []byte) ([]byte, error) {
+	key, err := k.getKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return sealKey(key, plaintext, additionalData)
+}
+
+// Decrypt : Decrypt the given ciphertext using the master key with the given ID
+func (k *LocalKms) Decrypt(keyID string, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	key, err := k.getKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openKey(key, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("The data can't be decrypted by the KMS key '%v', error: %v", keyID, err)
+	}
+	return plaintext, nil
+}
+
+//------------------- Key provider specification
+
+// NewKeyProviderFromSpec : Return the key provider that is described by the given specification (e.g. a command line argument):
+// type:name:argument, where the argument is the key file path (file type), the environment variable name (env type)
+// or the local KMS keys file and the KMS key ID separated by ':' (kms type).
+// Passphrase key providers are not supported since a passphrase must not be given as a command line argument
+func NewKeyProviderFromSpec(spec string) (KeyProvider, error) {
+	var p KeyProvider
+	var err error
+
+	fields := strings.SplitN(spec, ":", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("The key provider '%v' must be given as type:name:argument", spec)
+	}
+	providerType, name, arg := fields[0], fields[1], fields[2]
+	switch providerType {
+	case FileKeyProviderType:
+		p, err = NewFileKeyProvider(name, arg)
+	case EnvKeyProviderType:
+		p, err = NewEnvKeyProvider(name, arg)
+	case KmsKeyProviderType:
+		i := strings.LastIndex(arg, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("The KMS key provider argument '%v' must be given as keysFile:keyID", arg)
+		}
+		var kms *LocalKms
+		kms, err = NewLocalKms(arg[:i])
+		if err == nil {
+			_, err = kms.getKey(arg[i+1:]) // the KMS key must exist
+		}
+		if err == nil {
+			p, err = NewKmsKeyProvider(name, kms, arg[i+1:])
+		}
+	default:
+		return nil, fmt.Errorf("The key provider type '%v' is not supported, the supported types are: '%v', '%v', '%v'",
+			providerType, FileKeyProviderType, EnvKeyProviderType, KmsKeyProviderType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const (
+	keyFileName = "./tmp.key"
+	kmsFileName = "./tmp.kms"
+	storageFile = "./tmpKeys.txt"
+	kmsKeyID    = "master-1"
+	envVarName  = "LIBSECURITY_TEST_STORAGE_KEY"
+)
+
+func getTestKeyProviders(t *testing.T) ([]KeyProvider, *LocalKms) {
+	err := ioutil.WriteFile(keyFileName, []byte("the key file content"), FilePermissions)
+	if err != nil {
+		t.Fatalf("Test fail: can't write the key file, error: %v", err)
+	}
+	fileProvider, err := NewFileKeyProvider("operator1", keyFileName)
+	if err != nil {
+		t.Fatalf("Test fail: can't create file key provider, error: %v", err)
+	}
+	passProvider, err := NewPassphraseKeyProvider("operator2", []byte("a passphrase"))
+	if err != nil {
+		t.Fatalf("Test fail: can't create passphrase key provider, error: %v", err)
+	}
+	os.Setenv(envVarName, "an environment secret")
+	envProvider, err := NewEnvKeyProvider("operator3", envVarName)
+	if err != nil {
+		t.Fatalf("Test fail: can't create environment key provider, error: %v", err)
+	}
+	kms, err := NewLocalKms(kmsFileName)
+	if err != nil {
+		t.Fatalf("Test fail: can't create local KMS, error: %v", err)
+	}
+	err = kms.CreateKey(kmsKeyID)
+	if err != nil {
+		t.Fatalf("Test fail: can't create KMS key, error: %v", err)
+	}
+	kmsProvider, err := NewKmsKeyProvider("operator4", kms, kmsKeyID)
+	if err != nil {
+		t.Fatalf("Test fail: can't create KMS key provider, error: %v", err)
+	}
+	return []KeyProvider{fileProvider, passProvider, envProvider, kmsProvider}, kms
+}
+
+// Verify that each of the key providers can unlock the storage,
+// and that a revoked key provider can't unlock it while the data is not re-encrypted
+func Test_keyProviders(t *testing.T) {
+	defer os.Remove(keyFileName)
+	defer os.Remove(kmsFileName)
+	defer os.Remove(storageFile)
+	defer os.Unsetenv(envVarName)
+
+	providers, kms := getTestKeyProviders(t)
+	s, err := NewStorageWithKeyProviders(providers...)
+	if err != nil {
+		t.Fatalf("Test fail: can't create storage, error: %v", err)
+	}
+	s.AddItem("key1", "value1")
+	s.AddItem("key2", "value2")
+	err = s.StoreInfo(storageFile)
+	if err != nil {
+		t.Fatalf("Test fail: can't store, error: %v", err)
+	}
+	for _, p := range providers {
+		s1, err := LoadInfoWithKeyProvider(NewFileBackend(storageFile), p)
+		if err != nil {
+			t.Fatalf("Test fail: can't load the storage using key provider '%v', error: %v", p.Name(), err)
+		}
+		val, err := s1.GetItem("key1")
+		if err != nil || val != "value1" {
+			t.Errorf("Test fail: the item read using key provider '%v' is '%v', expected 'value1', error: %v", p.Name(), val, err)
+		}
+	}
+	_, err = LoadInfo(storageFile, []byte("a passphrase"))
+	if err == nil {
+		t.Errorf("Test fail: storage that is protected by key providers only was loaded using a secret")
+	}
+
+	err = s.RemoveKeyProvider(providers[1].Name())
+	if err != nil {
+		t.Fatalf("Test fail: can't remove key provider, error: %v", err)
+	}
+	s.StoreInfo(storageFile)
+	s1, err := LoadInfoWithKeyProvider(NewFileBackend(storageFile), providers[0])
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage after key provider revocation, error: %v", err)
+	}
+	if reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the data was changed by the key provider revocation")
+	}
+	_, err = LoadInfoWithKeyProvider(NewFileBackend(storageFile), providers[1])
+	if err == nil {
+		t.Errorf("Test fail: the storage was loaded using the revoked key provider '%v'", providers[1].Name())
+	}
+
+	kms.DeleteKey(kmsKeyID)
+	_, err = LoadInfoWithKeyProvider(NewFileBackend(storageFile), providers[3])
+	if err == nil {
+		t.Errorf("Test fail: the storage was loaded although the KMS key was deleted")
+	}
+	for _, p := range providers {
+		if p.Name() != providers[0].Name() {
+			s.RemoveKeyProvider(p.Name())
+		}
+	}
+	err = s.RemoveKeyProvider(providers[0].Name())
+	if err == nil {
+		t.Errorf("Test fail: the last key provider was removed")
+	}
+}
+
+// Verify that a storage that was created using a secret can be unlocked by both the secret and an added key provider
+func Test_secretStorageWithKeyProvider(t *testing.T) {
+	secret := []byte("ABCD@#12efgh")
+	defer os.Remove(storageFile)
+
+	s, _ := NewStorage(secret, true)
+	s.AddItem("key1", "value1")
+	p, _ := NewPassphraseKeyProvider("operator", []byte("a passphrase"))
+	err := s.AddKeyProvider(p)
+	if err != nil {
+		t.Fatalf("Test fail: can't add key provider, error: %v", err)
+	}
+	s.StoreInfo(storageFile)
+	_, err = LoadInfo(storageFile, secret)
+	if err != nil {
+		t.Errorf("Test fail: can't load the storage using the secret, error: %v", err)
+	}
+	s1, err := LoadInfoWithKeyProvider(NewFileBackend(storageFile), p)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage using the key provider, error: %v", err)
+	}
+	if s1.IsSecretMatch(secret) == false {
+		t.Errorf("Test fail: the secret doesn't match the storage that was loaded using the key provider")
+	}
+	wrongP, _ := NewPassphraseKeyProvider("operator", []byte("a wrong passphrase"))
+	_, err = LoadInfoWithKeyProvider(NewFileBackend(storageFile), wrongP)
+	if err == nil {
+		t.Errorf("Test fail: the storage was loaded using a wrong passphrase")
+	}
+	newSecret := []byte("EFGH@#34abcd")
+	err = s.Rekey(newSecret, true)
+	if err == nil || s.IsSecretMatch(secret) == false {
+		t.Errorf("Test fail: the storage was rekeyed without its key provider")
+	}
+	err = s.Rekey(newSecret, true, p)
+	if err != nil {
+		t.Fatalf("Test fail: can't rekey the storage, error: %v", err)
+	}
+	s.StoreInfo(storageFile)
+	s1, err = LoadInfoWithKeyProvider(NewFileBackend(storageFile), p)
+	if err != nil || s1.IsSecretMatch(newSecret) == false {
+		t.Errorf("Test fail: the key provider can't unlock the rekeyed storage, error: %v", err)
+	}
+}
+
+// Verify that the key providers are created from their specification and that illegal specifications are rejected
+func Test_keyProviderFromSpec(t *testing.T) {
+	defer os.Remove(keyFileName)
+	defer os.Remove(kmsFileName)
+	defer os.Unsetenv(envVarName)
+
+	providers, _ := getTestKeyProviders(t)
+	specs := []string{FileKeyProviderType + ":operator1:" + keyFileName, EnvKeyProviderType + ":operator3:" + envVarName,
+		KmsKeyProviderType + ":operator4:" + kmsFileName + ":" + kmsKeyID}
+	s, _ := NewStorageWithKeyProviders(providers...)
+	s.StoreInfo(storageFile)
+	defer os.Remove(storageFile)
+	for _, spec := range specs {
+		p, err := NewKeyProviderFromSpec(spec)
+		if err != nil {
+			t.Fatalf("Test fail: can't create the key provider '%v', error: %v", spec, err)
+		}
+		_, err = LoadInfoWithKeyProvider(NewFileBackend(storageFile), p)
+		if err != nil {
+			t.Errorf("Test fail: the key provider '%v' can't unlock the storage, error: %v", spec, err)
+		}
+	}
+	illegal := []string{"file:operator1", PassphraseKeyProviderType + ":operator2:a passphrase", KmsKeyProviderType + ":operator4:" + kmsFileName,
+		EnvKeyProviderType + ":operator3:NOT_SET_ENV_VAR", KmsKeyProviderType + ":operator4:" + kmsFileName + ":unknown"}
+	for _, spec := range illegal {
+		p, err := NewKeyProviderFromSpec(spec)
+		if err == nil || p != nil {
+			t.Errorf("Test fail: the illegal key provider '%v' was created", spec)
+		}
+	}
+}
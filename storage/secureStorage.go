@@ -3,23 +3,28 @@
 // The secure storgae allows maintaining data persistently and securely.
 // 	The implementation of the secure storage is based on encrypted key-value pairs that are stored
 //	 in signed files to guarantee that the data is not altered or corrupted.
-//	- Both the key and the value are encrypted when they are added to the storage using an Advanced Encryption Standard (AES) algorithm.
-//	- Each time a new secure storage is generated, a secret supplied by the user accompanies it
-//	  and is used in all HMAC and AES calculations related to that storage. To make it difficult for a third party to decipher or use the stored data,
-//	  Cipher Block Chaining (CBC) mode is used to ensure that multiple independent encryptions of the same data with the same key have different results.
-//	  That is, when a block with the same piece of plain text is encrypted with the same key, the result is always different.
+//	- Both the key and the value are encrypted when they are added to the storage using an authenticated encryption (AES-GCM) algorithm.
+//	- Each time a new secure storage is generated, a secret supplied by the user accompanies it.
+//	  The storage keys are derived from that secret and from a random per-file salt using a key derivation function (KDF):
+//	  PBKDF2-SHA256 (the default), scrypt or Argon2id. The KDF parameters are recorded in the file header so that the same keys
+//	  can be derived when the file is loaded, and they can be replaced (e.g. to raise the cost) by re-encrypting the file.
+//	  A random nonce is drawn for each encryption, so multiple independent encryptions of the same data with the same key have different results.
 //	- To implement a time efficient secure storage with keys, that is, to identify keys that are
-//	  already stored without decrypting the entire storage, and when such a key is identified replacing its value, a two step mechanism is used.
-//	  The first time a key is introduced, a new IV is drawn, the key is 'HMAC'ed with the secret and is stored with the IV as the value (1st step).
-//	  The original key is encrypted with the drawn IV and stored again, this time with the value that is encrypted with its own random IV (2nd step).
-//	  The next time that same key is stored, the algorithm, identifies that it already exists in the storage, pulls out the random IV that was stored in the 1st step,
-//	  finds the 2nd step storage of that key and replaces its value with the new encrypted one.
+//	  already stored without decrypting the entire storage, each item is stored in a slot whose name is the key 'HMAC'ed with the derived secret.
+//	  The slot holds the encrypted key, the encrypted value and the encrypted item metadata (creation time, update time and size).
+//	  The value and the metadata are encrypted with their key as the associated data, so an item that is moved to another slot can't be decrypted.
+//	  The keys can be listed (optionally filtered by a prefix) by decrypting only the keys.
+//	- An item may have an expiry time: an expired item is treated as missing and it is purged when the storage is stored.
 //	- To guarantee that the data is not altered or corrupted, the storage is signed using HMAC. The signature is added to the secure storage. When the storage is loaded,
 //	  the HMAC is calculated and compared with the stored signature to verify that the file is genuine.
+//	- Instead of a secret, the storage may be protected by a random data key that is wrapped by one or more key-encryption keys,
+//	  each supplied by a key provider (a key file, a passphrase or environment variable, or a key management service).
+//	  Each key provider can unlock the storage on its own and revoking a key provider does not require re-encrypting the data.
+//	- Files that were stored using the previous version ("V 1.2", AES-CBC) are loaded transparently,
+//	  they are converted to the current version and stored in the current format on the next store.
 package storage
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -29,12 +34,16 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
@@ -52,8 +61,10 @@ const (
 	SecretLen    = 16
 	minSecretLen = 8
 	maxSecretLen = 255
-	// SaltData : the default salting string
+	// SaltData : the salting string of secure key files that don't have KDF parameters file (the legacy processing)
 	SaltData = "Ravid"
+	// SecureKeyParamsSuffix : the suffix of the file that holds the salt and the KDF parameters of a secure key file
+	SecureKeyParamsSuffix = ".kdf"
 
 	extraCharStr  = "@#%^&()'-_+=;:"
 	minUpperCase  = 2
@@ -62,7 +73,42 @@ const (
 	minExtraChars = 1
 
 	// version : version number to be used when the file is stored
-	version = "V 1.2"
+	version = "V 2.0"
+	// legacyVersion : the previous version, files with this version are converted to the current version when loaded
+	legacyVersion = "V 1.2"
+
+	// Pbkdf2Sha256KdfName : PBKDF2 with HMAC-SHA256 key derivation function
+	Pbkdf2Sha256KdfName = "PBKDF2-SHA256"
+	// ScryptKdfName : scrypt key derivation function
+	ScryptKdfName = "scrypt"
+	// Argon2idKdfName : Argon2id key derivation function
+	Argon2idKdfName = "Argon2id"
+	// DefaultKdfIterations : the default number of iterations of the key derivation function
+	DefaultKdfIterations = 10000
+	// DefaultScryptCost : the default scrypt CPU/memory cost (N)
+	DefaultScryptCost = 1 << 15
+	// DefaultScryptBlockSize : the default scrypt block size (r)
+	DefaultScryptBlockSize = 8
+	// DefaultArgon2idIterations : the default number of Argon2id passes over the memory
+	DefaultArgon2idIterations = 3
+	// DefaultArgon2idMemory : the default Argon2id memory size in KiB (64 MiB)
+	DefaultArgon2idMemory = 64 * 1024
+	// DefaultArgon2idParallelism : the default number of Argon2id threads
+	DefaultArgon2idParallelism = 4
+	kdfSaltLen                 = 16
+	keyLen                     = 32
+	// the limits of the KDF parameters: the parameters are read from the file before its signature can be verified
+	// (it is verified using the derived keys), so they bound the time and the memory that a tampered file can demand
+	maxPbkdf2Iterations   = 1 << 20
+	maxArgon2idIterations = 16
+	maxKdfMemory          = 256 * 1024       // KiB
+	maxKdfWork            = 4 * maxKdfMemory // KiB passes: the memory multiplied by the Argon2id passes or the scrypt parallelization
+	maxKdfParallelism     = 16
+	legacyKdfIterations   = 4096
+
+	encKeyLabel   = "encryption key"
+	macKeyLabel   = "mac key"
+	itemSeparator = "."
 )
 
 var (
@@ -70,7 +116,15 @@ var (
 	aesKeySize    = make(map[int]interface{})
 	aesKeySizeStr string
 
+	kdfLock    sync.Mutex
+	defaultKdf = KdfParams{Name: Pbkdf2Sha256KdfName, Iterations: DefaultKdfIterations, KeyLen: keyLen}
+
 	nullChar = byte(0)
+
+	// SecretStrengthCheck : call back function that adds checks to the secure storage secret strength test, it is set
+	// by the password package to check the secret using the password policy as well. It can only tighten the test:
+	// it is called only for secrets that passed the default test
+	SecretStrengthCheck func(secret string) error
 )
 
 func init() {
@@ -87,13 +141,51 @@ func init() {
 // SecureDataMap : hash to map the modules data
 type SecureDataMap map[string]string
 
+// KdfParams : the key derivation function parameters that were used to derive the storage keys from the secret.
+// Iterations is the number of PBKDF2 iterations, the number of Argon2id passes or the scrypt CPU/memory cost (N, a power of 2),
+// Memory is the Argon2id memory size in KiB, BlockSize is the scrypt block size (r) and
+// Parallelism is the number of Argon2id threads or the scrypt parallelization (p)
+type KdfParams struct {
+	Name        string
+	Iterations  int
+	KeyLen      int
+	Memory      int `json:",omitempty"`
+	BlockSize   int `json:",omitempty"`
+	Parallelism int `json:",omitempty"`
+}
+
+// The salt and the KDF parameters that are used to derive the key from a secure key file
+type secureKeyParams struct {
+	Salt []byte
+	Kdf  KdfParams
+}
+
+// ItemMetadata : the metadata of a stored item, the expiry time is zero for items that don't expire
+type ItemMetadata struct {
+	Created time.Time
+	Updated time.Time
+	Expires time.Time
+	Size    int
+}
+
+// KeyMetadata : the key of a stored item and its metadata
+type KeyMetadata struct {
+	Key string
+	ItemMetadata
+}
+
 // SecureStorage : structure that holds all the secure data to be store/read from the storage include the calculated signature (the secret is not stored on the disk)
 type SecureStorage struct {
-	Salt   []byte
-	Sign   []byte
-	Data   SecureDataMap
+	Salt    []byte
+	Sign    []byte
+	Data    SecureDataMap
 	Version string
-	secret []byte
+	Kdf     KdfParams
+	Keys    []WrappedKey `json:",omitempty"` // the storage master key wrapped by each of the key providers
+	secret  []byte
+	groups  map[string]string // the group ID of each slot, used by backends that store each group separately
+	keys    map[string]string // the key of each slot, so the keys are decrypted once when the keys are listed
+	journal *journal          // the write-ahead journal of the item changes, if it is enabled
 }
 
 func (s SecureStorage) String() string {
@@ -105,13 +197,110 @@ func (s SecureStorage) String() string {
 	return fmt.Sprintf("Data: %v", sArray)
 }
 
-func getSaltedPass(secret, saltData []byte) []byte {
-	pass, _ := salt.GenerateSaltedPassword(secret, minSecretLen, maxSecretLen, saltData, SecretLen)
-	return bytes.Replace(pass, []byte{'0'}, []byte{'a'}, -1)
+func (k KdfParams) String() string {
+	return fmt.Sprintf("KDF: %v, iterations: %v, key length: %v, memory: %v, block size: %v, parallelism: %v",
+		k.Name, k.Iterations, k.KeyLen, k.Memory, k.BlockSize, k.Parallelism)
+}
+
+// NewKdfParams : Return the default parameters of the given key derivation function
+func NewKdfParams(name string) (KdfParams, error) {
+	var kdf KdfParams
+
+	switch name {
+	case Pbkdf2Sha256KdfName:
+		kdf = KdfParams{Name: name, Iterations: DefaultKdfIterations, KeyLen: keyLen}
+	case ScryptKdfName:
+		kdf = KdfParams{Name: name, Iterations: DefaultScryptCost, KeyLen: keyLen, BlockSize: DefaultScryptBlockSize, Parallelism: 1}
+	case Argon2idKdfName:
+		kdf = KdfParams{Name: name, Iterations: DefaultArgon2idIterations, KeyLen: keyLen, Memory: DefaultArgon2idMemory, Parallelism: DefaultArgon2idParallelism}
+	default:
+		return kdf, fmt.Errorf("The key derivation function '%v' is not supported, the supported functions are: '%v', '%v', '%v'",
+			name, Pbkdf2Sha256KdfName, ScryptKdfName, Argon2idKdfName)
+	}
+	return kdf, nil
+}
+
+// SetDefaultKdfParams : Set the key derivation function parameters that are used by new storages (and when a storage is rekeyed)
+func SetDefaultKdfParams(kdf KdfParams) error {
+	err := kdf.isValid()
+	if err != nil {
+		return err
+	}
+	kdfLock.Lock()
+	defer kdfLock.Unlock()
+	defaultKdf = kdf
+	return nil
+}
+
+func getDefaultKdfParams() KdfParams {
+	kdfLock.Lock()
+	defer kdfLock.Unlock()
+	return defaultKdf
+}
+
+func (k KdfParams) isValid() error {
+	maxIterations := maxPbkdf2Iterations
+	switch k.Name {
+	case Pbkdf2Sha256KdfName:
+	case ScryptKdfName:
+		if k.Iterations < 2 || k.Iterations&(k.Iterations-1) != 0 {
+			return fmt.Errorf("The scrypt cost %v must be a power of 2 greater than 1", k.Iterations)
+		}
+		if k.BlockSize < 1 || k.Parallelism < 1 || k.Parallelism > maxKdfParallelism {
+			return fmt.Errorf("The scrypt block size %v must be at least 1 and the parallelization %v must be between 1 and %v",
+				k.BlockSize, k.Parallelism, maxKdfParallelism)
+		}
+		maxIterations = maxKdfMemory * 1024 / 128 / k.BlockSize
+		if k.Iterations > maxIterations || k.Iterations > maxKdfWork*1024/128/k.BlockSize/k.Parallelism {
+			return fmt.Errorf("The scrypt memory (cost %v, block size %v) must be at most %v KiB and multiplied by the parallelization %v at most %v KiB",
+				k.Iterations, k.BlockSize, maxKdfMemory, k.Parallelism, maxKdfWork)
+		}
+	case Argon2idKdfName:
+		if k.Parallelism < 1 || k.Parallelism > maxKdfParallelism {
+			return fmt.Errorf("The Argon2id parallelism %v must be between 1 and %v", k.Parallelism, maxKdfParallelism)
+		}
+		if k.Memory < 8*k.Parallelism || k.Memory > maxKdfMemory {
+			return fmt.Errorf("The Argon2id memory %v KiB must be at least 8 KiB per thread and at most %v KiB", k.Memory, maxKdfMemory)
+		}
+		maxIterations = maxArgon2idIterations
+		if k.Iterations > maxKdfWork/k.Memory {
+			return fmt.Errorf("The Argon2id memory %v KiB multiplied by the number of passes %v must be at most %v KiB", k.Memory, k.Iterations, maxKdfWork)
+		}
+	default:
+		_, err := NewKdfParams(k.Name)
+		return err
+	}
+	if k.Iterations < 1 || k.Iterations > maxIterations {
+		return fmt.Errorf("The number of key derivation iterations %v must be between 1 and %v", k.Iterations, maxIterations)
+	}
+	if _, exist := aesKeySize[k.KeyLen]; exist == false {
+		return fmt.Errorf("The key length %v is not valid, it must be one of: %v", k.KeyLen, aesKeySizeStr)
+	}
+	return nil
+}
+
+// Derive the storage master secret from the given secret and salt using the given KDF parameters
+func deriveSecret(secret []byte, saltData []byte, kdf KdfParams) ([]byte, error) {
+	err := kdf.isValid()
+	if err != nil {
+		return nil, err
+	}
+	switch kdf.Name {
+	case ScryptKdfName:
+		return scrypt.Key(secret, saltData, kdf.Iterations, kdf.BlockSize, kdf.Parallelism, kdf.KeyLen)
+	case Argon2idKdfName:
+		return argon2.IDKey(secret, saltData, uint32(kdf.Iterations), uint32(kdf.Memory), uint8(kdf.Parallelism), uint32(kdf.KeyLen)), nil
+	}
+	return pbkdf2.Key(secret, saltData, kdf.Iterations, kdf.KeyLen, sha256.New), nil
 }
 
-// NewStorage : Create a new storage using the given secret
+// NewStorage : Create a new storage using the given secret, the storage keys are derived using the default KDF parameters
 func NewStorage(secret []byte, checkSecretStrength bool) (*SecureStorage, error) {
+	return NewStorageWithKdf(secret, checkSecretStrength, getDefaultKdfParams())
+}
+
+// NewStorageWithKdf : Create a new storage using the given secret, the storage keys are derived using the given KDF parameters
+func NewStorageWithKdf(secret []byte, checkSecretStrength bool, kdf KdfParams) (*SecureStorage, error) {
 	err := isValidData(secret)
 	if err != nil {
 		return nil, err
@@ -120,33 +309,105 @@ func NewStorage(secret []byte, checkSecretStrength bool) (*SecureStorage, error)
 	if err != nil && checkSecretStrength {
 		return nil, err
 	}
-	saltData, _ := salt.GetRandomSalt(SaltLen)
-	pass := getSaltedPass(secret, saltData)
-	s := SecureStorage{Data: make(SecureDataMap), secret: pass, Salt: saltData, Version: version}
+	saltData, _ := salt.GetRandomSalt(kdfSaltLen)
+	pass, err := deriveSecret(secret, saltData, kdf)
+	if err != nil {
+		return nil, err
+	}
+	s := SecureStorage{Data: make(SecureDataMap), secret: pass, Salt: saltData, Version: version, Kdf: kdf}
+	return &s, nil
+}
+
+// NewStorageWithKeyProviders : Create a new storage that is protected by a random data key,
+// the data key is wrapped by each of the given key providers and any of them can unlock the storage
+func NewStorageWithKeyProviders(providers ...KeyProvider) (*SecureStorage, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("At least one key provider must be given")
+	}
+	dataKey := make([]byte, dataKeyLen)
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	s := SecureStorage{Data: make(SecureDataMap), secret: dataKey, Version: version}
+	for _, p := range providers {
+		err := s.addKeyProvider(p)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &s, nil
 }
 
+// NewStorageWithKeysOf : Create a new (empty) storage that is protected by the master key of the given storage,
+// the master key is wrapped by the same key providers so any of them can unlock the new storage
+func NewStorageWithKeysOf(s *SecureStorage) (*SecureStorage, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(s.Keys) == 0 {
+		return nil, fmt.Errorf("The storage is not protected by key providers")
+	}
+	ns := SecureStorage{Data: make(SecureDataMap), secret: append([]byte{}, s.secret...), Salt: s.Salt, Version: s.Version, Kdf: s.Kdf}
+	ns.Keys = append(ns.Keys, s.Keys...)
+	return &ns, nil
+}
+
 // IsSecretMatch : Verify if the given secret match the secure stiorage secret use throttling
 func (s *SecureStorage) IsSecretMatch(secret []byte) bool {
-	pass := getSaltedPass(secret, s.Salt)
+	pass, err := deriveSecret(secret, s.Salt, s.Kdf)
+	if err != nil {
+		return false
+	}
 	return subtle.ConstantTimeCompare(s.secret, pass) == 1
 }
 
 func manipulateSecureKey(key []byte, saltData []byte) []byte {
-	return pbkdf2.Key(key, saltData, 4096, 32, sha256.New)
+	return pbkdf2.Key(key, saltData, legacyKdfIterations, keyLen, sha256.New)
 }
 
-// GetSecureKey : Read a secure key from the given file, process it with cryptographic manipulations  and return it
+// NewSecureKeyParams : Draw a random salt for the given secure key file and store it with the given KDF parameters
+// in the secure key parameters file (the secure key file path with the SecureKeyParamsSuffix).
+// Note that the key that is derived from the secure key file changes, so it must be done before the key is used to protect a storage
+func NewSecureKeyParams(secureKeyFilePath string, kdf KdfParams) error {
+	err := kdf.isValid()
+	if err != nil {
+		return err
+	}
+	saltData, err := salt.GetRandomSalt(kdfSaltLen)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(secureKeyParams{Salt: saltData, Kdf: kdf})
+	return writeFileAtomic(secureKeyFilePath+SecureKeyParamsSuffix, data)
+}
+
+// GetSecureKey : Read a secure key from the given file, derive a key from it and return it. The key is derived
+// using the salt and the KDF parameters in the secure key parameters file, if it exists, otherwise the legacy fixed salt is used
 func GetSecureKey(secureKeyFilePath string) []byte {
+	var params secureKeyParams
+
 	secureKey, err := ioutil.ReadFile(secureKeyFilePath)
 	if err != nil {
 		logger.Error.Fatal("Error reading secure key file:", secureKeyFilePath)
 	}
-	saltLen := len(secureKey)
-	if saltLen > MaxSaltLen {
-		saltLen = MaxSaltLen
+	paramsFilePath := secureKeyFilePath + SecureKeyParamsSuffix
+	data, err := ioutil.ReadFile(paramsFilePath)
+	if os.IsNotExist(err) {
+		logger.Warning.Printf("The secure key parameters file '%v' does not exist, the secure key is processed using a fixed salt", paramsFilePath)
+		return manipulateSecureKey(secureKey, []byte(SaltData))
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &params)
+	}
+	var key []byte
+	if err == nil {
+		key, err = deriveSecret(secureKey, params.Salt, params.Kdf)
 	}
-	return manipulateSecureKey(secureKey, []byte(SaltData))
+	if err != nil {
+		logger.Error.Fatalf("Error reading the secure key parameters file: %v, error: %v", paramsFilePath, err)
+	}
+	return key
 }
 
 func isValidData(secret []byte) error {
@@ -161,167 +422,386 @@ func isValidSecret(secret []byte) error {
 }
 
 // AddItem : Add (or replace) to the storage a new item using the given key and value
+// If the journal is enabled, the change is written to the journal before it is applied
 func (s *SecureStorage) AddItem(key string, value string) error {
-	s.RemoveItem(key) // if the key already exist, remove it
+	return s.AddItemWithTTL(key, value, 0)
+}
+
+// AddItemWithTTL : Add (or replace) to the storage a new item using the given key and value, the item expires
+// after the given time to live (0 for an item that doesn't expire). An expired item is treated as missing
+func (s *SecureStorage) AddItemWithTTL(key string, value string, ttl time.Duration) error {
 	lock.Lock()
 	defer lock.Unlock()
 
-	hKey, rKey, err := s.generateRandomToKey(key)
-	if err != nil {
-		return err
+	if ttl < 0 {
+		return fmt.Errorf("The item time to live %v must not be negative", ttl)
 	}
-	cipherKey, err := s.encrypt([]byte(key), true, rKey)
+	meta := s.newItemMetadata(s.getSlot(key), key, value)
+	if ttl > 0 {
+		meta.Expires = meta.Updated.Add(ttl)
+	}
+	slot, item, err := s.encryptItem(key, value, meta)
 	if err != nil {
 		return err
 	}
-	cipherData, err := s.encrypt([]byte(value), false, "")
+	groupID := s.getGroupID(key)
+	if s.journal != nil {
+		err = s.journal.append(s, journalEntry{Op: journalAddOp, Slot: slot, Item: item, Group: groupID})
+		if err != nil {
+			return err
+		}
+	}
+	s.Data[slot] = item
+	s.setItemGroup(slot, groupID)
+	s.setSlotKey(slot, key)
+	return nil
+}
+
+func (s *SecureStorage) addItem(key string, value string) error {
+	return s.addItemWithMetadata(key, value, s.newItemMetadata(s.getSlot(key), key, value))
+}
+
+func (s *SecureStorage) addItemWithMetadata(key string, value string, meta ItemMetadata) error {
+	slot, item, err := s.encryptItem(key, value, meta)
 	if err != nil {
 		return err
 	}
-	s.Data[hKey] = rKey
-	s.Data[cipherKey] = cipherData
+	s.Data[slot] = item
+	s.setItemGroup(slot, s.getGroupID(key))
+	s.setSlotKey(slot, key)
 	return nil
 }
 
-// GetItem : Return from storage the item that is associated with the given key
-func (s *SecureStorage) GetItem(key string) (string, error) {
-	lock.Lock()
-	defer lock.Unlock()
+// Return the metadata of the given item that is stored now in the given slot: the creation time of an existing item
+// is kept, unless it is expired (since an expired item is treated as missing)
+func (s *SecureStorage) newItemMetadata(slot string, key string, value string) ItemMetadata {
+	item, exist := s.Data[slot]
+	return s.replaceItemMetadata(key, value, item, exist)
+}
+
+// Return the metadata of the given item that replaces the given old item, if it exists and it is not expired
+func (s *SecureStorage) replaceItemMetadata(key string, value string, oldItem string, exist bool) ItemMetadata {
+	now := time.Now()
+	meta := ItemMetadata{Created: now, Updated: now, Size: len(value)}
+	if exist {
+		oldMeta, err := s.getItemMetadata(key, oldItem)
+		if err == nil && oldMeta.Created.IsZero() == false && oldMeta.IsExpired(now) == false {
+			meta.Created = oldMeta.Created
+		}
+	}
+	return meta
+}
 
-	_, rKey, err := s.getRandomFromKey(key)
+// Return the slot of the given key and the item to be stored in it: the encrypted key, the encrypted value and the encrypted metadata
+func (s *SecureStorage) encryptItem(key string, value string, meta ItemMetadata) (string, string, error) {
+	slot := s.getSlot(key)
+	cipherKey, err := s.encrypt([]byte(key), []byte(slot))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	cipherKey, err := s.encrypt([]byte(key), true, rKey)
+	cipherData, err := s.encrypt([]byte(value), []byte(key))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	val, exist := s.Data[cipherKey]
-	if !exist {
+	metaData, _ := json.Marshal(meta)
+	cipherMeta, err := s.encrypt(metaData, []byte(key))
+	if err != nil {
+		return "", "", err
+	}
+	return slot, cipherKey + itemSeparator + cipherData + itemSeparator + cipherMeta, nil
+}
+
+// GetItem : Return from storage the item that is associated with the given key, expired items are treated as missing
+func (s *SecureStorage) GetItem(key string) (string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	slot := s.getSlot(key)
+	item, exist := s.Data[slot]
+	if !exist || s.isItemExpired(key, item, time.Now()) {
 		return "", fmt.Errorf("Key '%v' was not found", key)
 	}
-	value, err := s.decrypt([]byte(val))
+	_, cipherData, _, err := splitItem(item)
 	if err != nil {
 		return "", err
 	}
-	ret, err := s.extractDataFromEncodedString(value)
+	value, err := s.decrypt(cipherData, []byte(key))
 	if err != nil {
 		return "", err
 	}
-	return ret, nil
+	return string(value), nil
 }
 
 // RemoveItem : Remove from the storage the item that is associated with the given key
+// If the journal is enabled, the change is written to the journal before it is applied
 func (s *SecureStorage) RemoveItem(key string) error {
 	lock.Lock()
 	defer lock.Unlock()
 
-	hKey, rKey, err := s.getRandomFromKey(key)
-	if err != nil {
-		return err
-	}
-	delete(s.Data, hKey)
-	cipherKey, err := s.encrypt([]byte(key), true, rKey)
-	if err != nil {
-		return err
-	}
-	_, exist := s.Data[cipherKey]
+	slot := s.getSlot(key)
+	_, exist := s.Data[slot]
 	if !exist {
 		return fmt.Errorf("Key '%v' was not found", key)
 	}
-	delete(s.Data, cipherKey)
+	if s.journal != nil {
+		err := s.journal.append(s, journalEntry{Op: journalRemoveOp, Slot: slot})
+		if err != nil {
+			return err
+		}
+	}
+	delete(s.Data, slot)
+	delete(s.groups, slot)
 	return nil
 }
 
-func (s SecureStorage) encrypt(text []byte, fixedIv bool, inIv string) (string, error) {
-	var b string
+// The encryption and the mac keys are derived from the storage secret
+func (s SecureStorage) getSubKey(label string) []byte {
+	return s.calcHMac([]byte(label), s.secret)
+}
+
+// The slot of a key is the key HMAC'ed with the derived mac key
+func (s SecureStorage) getSlot(key string) string {
+	return base64.StdEncoding.EncodeToString(s.calcHMac([]byte(key), s.getSubKey(macKeyLabel)))
+}
+
+// Return the encrypted key, value and metadata of the given item, items that were stored without metadata have an empty metadata
+func splitItem(item string) (string, string, string, error) {
+	val := strings.Split(item, itemSeparator)
+	if len(val) == 2 {
+		return val[0], val[1], "", nil
+	}
+	if len(val) != 3 {
+		return "", "", "", fmt.Errorf("Error: the stored item is not in the expected format")
+	}
+	return val[0], val[1], val[2], nil
+}
+
+func (s SecureStorage) getAead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.getSubKey(encKeyLabel))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
 
-	block, err := aes.NewCipher(s.secret)
+// Encrypt the given text with a random nonce, the additional data is authenticated but not encrypted
+func (s SecureStorage) encrypt(text []byte, additionalData []byte) (string, error) {
+	aead, err := s.getAead()
 	if err != nil {
-		return "", fmt.Errorf("Error during encryption: '%v', %v", err, text)
+		return "", fmt.Errorf("Error during encryption: '%v'", err)
 	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", fmt.Errorf("Error during encryption: '%v'", err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, text, additionalData)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
 
-	data := text
-	for {
-		b = base64.StdEncoding.EncodeToString(data)
-		if len(b)%aes.BlockSize == 0 {
-			break
-		}
-		data = append(data, nullChar)
+func (s SecureStorage) decrypt(text string, additionalData []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("Error during decryption: %v", err)
 	}
-	ciphertext := make([]byte, aes.BlockSize+len(b))
-	iv := ciphertext[:aes.BlockSize]
-	if fixedIv == false {
-		_, err = io.ReadFull(rand.Reader, iv)
-	} else {
-		str := inIv + strings.Repeat("a", aes.BlockSize-len(inIv)+10)
-		copy(iv, []byte(str)[:aes.BlockSize])
+	aead, err := s.getAead()
+	if err != nil {
+		return nil, fmt.Errorf("Error during decryption: %v", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("Error during decryption: Ciphertext too short")
 	}
+	nonce := data[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, data[aead.NonceSize():], additionalData)
 	if err != nil {
-		return "", fmt.Errorf("Error during encryption: '%v', %v", err, text)
+		return nil, fmt.Errorf("Error during decryption: the item is not genuine")
 	}
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ciphertext[aes.BlockSize:], []byte(b))
-	ret := base64.StdEncoding.EncodeToString(ciphertext)
-	return ret, nil
+	return plaintext, nil
 }
 
-func (s SecureStorage) getHKey(key string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(key))
-	hKey := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
-	return hKey
+// Return the key and the value stored in the given slot
+func (s SecureStorage) decryptItem(slot string, item string) (string, string, error) {
+	cipherKey, cipherData, _, err := splitItem(item)
+	if err != nil {
+		return "", "", err
+	}
+	key, err := s.decrypt(cipherKey, []byte(slot))
+	if err != nil {
+		return "", "", err
+	}
+	value, err := s.decrypt(cipherData, key)
+	if err != nil {
+		return "", "", err
+	}
+	return string(key), string(value), nil
 }
 
-func (s SecureStorage) getRandomFromKey(key string) (string, string, error) {
-	hKey := s.getHKey(key)
-	val, exist := s.Data[hKey]
-	if !exist {
-		return "", "", fmt.Errorf("Key '%v' was not found", key)
+// Return the key that is stored in the given slot, the value is not decrypted
+func (s SecureStorage) decryptItemKey(slot string, item string) (string, error) {
+	cipherKey, _, _, err := splitItem(item)
+	if err != nil {
+		return "", err
+	}
+	key, err := s.decrypt(cipherKey, []byte(slot))
+	if err != nil {
+		return "", err
 	}
-	return hKey, string(val), nil
+	return string(key), nil
 }
 
-func (s SecureStorage) generateRandomToKey(key string) (string, string, error) {
-	hKey := s.getHKey(key)
-	val := make([]byte, aes.BlockSize)
-	_, err := io.ReadFull(rand.Reader, val)
+// Return the metadata of the given item, the metadata of items that were stored without it is empty
+func (s SecureStorage) getItemMetadata(key string, item string) (ItemMetadata, error) {
+	var meta ItemMetadata
+
+	_, _, cipherMeta, err := splitItem(item)
+	if err != nil || len(cipherMeta) == 0 {
+		return meta, err
+	}
+	data, err := s.decrypt(cipherMeta, []byte(key))
 	if err != nil {
-		return "", "", err
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// IsExpired : return true if the item has an expiry time that is not after the given time
+func (m ItemMetadata) IsExpired(now time.Time) bool {
+	return m.Expires.IsZero() == false && m.Expires.After(now) == false
+}
+
+func (s SecureStorage) isItemExpired(key string, item string, now time.Time) bool {
+	meta, err := s.getItemMetadata(key, item)
+	return err == nil && meta.IsExpired(now)
+}
+
+// PurgeExpired : Remove the expired items from the storage and return their number
+func (s *SecureStorage) PurgeExpired() int {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.purgeExpired()
+}
+
+// If the journal is enabled, the removal of the expired items is written to the journal before it is applied,
+// otherwise replaying the journal would add them back. If the journal can't be written, the items are not purged
+func (s *SecureStorage) purgeExpired() int {
+	var entries []journalEntry
+	now := time.Now()
+	for slot, item := range s.Data {
+		key, err := s.decryptItemKey(slot, item)
+		if err == nil && s.isItemExpired(key, item, now) {
+			entries = append(entries, journalEntry{Op: journalRemoveOp, Slot: slot})
+		}
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	batch := journalEntry{Op: journalBatchOp, Changes: entries}
+	if s.journal != nil {
+		err := s.journal.append(s, batch)
+		if err != nil {
+			logger.Error.Printf("The expired items were not purged: %v", err)
+			return 0
+		}
 	}
-	hVal := base64.StdEncoding.EncodeToString(val)
-	return hKey, hVal, nil
+	s.applyJournalEntry(batch)
+	return len(entries)
 }
 
-func (s SecureStorage) decrypt(text1 []byte) (string, error) {
-	var data []byte
+func (s *SecureStorage) setSlotKey(slot string, key string) {
+	if s.keys == nil {
+		s.keys = make(map[string]string)
+	}
+	s.keys[slot] = key
+}
 
-	// The decrypt may be called with un-encrypted data (the hash key to random,
-	//   may be OK in some cases thus thiis has to be verified by the caller)
-	defer func() (string, error) {
-		if r := recover(); r != nil {
-			return "", fmt.Errorf("during decryption: '%v'", text1)
+// Return the keys of the items that start with the given prefix and their items: only the keys that were not
+// added or listed before are decrypted, since the slot of a key is derived from the key, its key never changes
+func (s *SecureStorage) getPrefixItems(prefix string) (map[string]string, error) {
+	items := make(map[string]string)
+	for slot, item := range s.Data {
+		key, exist := s.keys[slot]
+		if !exist {
+			var err error
+			key, err = s.decryptItemKey(slot, item)
+			if err != nil {
+				return nil, err
+			}
+			s.setSlotKey(slot, key)
+		}
+		if strings.HasPrefix(key, prefix) {
+			items[key] = item
 		}
-		return string(data), nil
-	}()
+	}
+	// remove the keys of the items that were removed
+	if len(s.keys) > len(s.Data) {
+		for slot := range s.keys {
+			if _, exist := s.Data[slot]; !exist {
+				delete(s.keys, slot)
+			}
+		}
+	}
+	return items, nil
+}
 
-	text, err := base64.StdEncoding.DecodeString(string(text1))
+// GetKeys : Return the sorted keys of the items that start with the given prefix (all the keys if the prefix is empty),
+// only the metadata of the matching items is decrypted and each key is decrypted once. Expired items are not included
+func (s *SecureStorage) GetKeys(prefix string) ([]string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	items, err := s.getPrefixItems(prefix)
 	if err != nil {
-		return "", fmt.Errorf("during decryption: '%v', error: %v", text, err)
+		return nil, err
+	}
+	keys := make([]string, 0, len(items))
+	now := time.Now()
+	for key, item := range items {
+		if s.isItemExpired(key, item, now) == false {
+			keys = append(keys, key)
+		}
 	}
+	sort.Strings(keys)
+	return keys, nil
+}
 
-	block, err := aes.NewCipher(s.secret)
+// GetItemsMetadata : Return the keys and the metadata of the items that start with the given prefix, sorted by the keys.
+// Expired items are not included
+func (s *SecureStorage) GetItemsMetadata(prefix string) ([]KeyMetadata, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	prefixItems, err := s.getPrefixItems(prefix)
 	if err != nil {
-		return "", fmt.Errorf("during decryption: '%v', error: %v", text, err)
+		return nil, err
 	}
-	if len(text) < aes.BlockSize {
-		return "", fmt.Errorf("Error during decryption: Ciphertext too short")
+	items := make([]KeyMetadata, 0, len(prefixItems))
+	now := time.Now()
+	for key, item := range prefixItems {
+		meta, err := s.getItemMetadata(key, item)
+		if err != nil {
+			return nil, err
+		}
+		if meta.IsExpired(now) {
+			continue
+		}
+		items = append(items, KeyMetadata{Key: key, ItemMetadata: meta})
 	}
-	iv := text[:aes.BlockSize]
-	dtext := text[aes.BlockSize:]
-	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(dtext, dtext)
-	return string(dtext), nil
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+// GetItemMetadata : Return the metadata of the item that is associated with the given key
+func (s *SecureStorage) GetItemMetadata(key string) (ItemMetadata, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	item, exist := s.Data[s.getSlot(key)]
+	if !exist || s.isItemExpired(key, item, time.Now()) {
+		return ItemMetadata{}, fmt.Errorf("Key '%v' was not found", key)
+	}
+	return s.getItemMetadata(key, item)
 }
 
 func (s SecureStorage) calcHMac(data []byte, secret []byte) []byte {
@@ -330,85 +810,390 @@ func (s SecureStorage) calcHMac(data []byte, secret []byte) []byte {
 	return hmacHash.Sum(nil)
 }
 
+// The signature covers the file header (version, KDF parameters, salt and wrapped keys) and the data
+func (s SecureStorage) calcSignature() []byte {
+	sData, _ := json.Marshal(struct {
+		Version string
+		Kdf     KdfParams
+		Salt    []byte
+		Keys    []WrappedKey `json:",omitempty"`
+		Data    SecureDataMap
+	}{s.Version, s.Kdf, s.Salt, s.Keys, s.Data})
+	return s.calcHMac(sData, s.getSubKey(macKeyLabel))
+}
+
+// Verify the storage signature
+func (s SecureStorage) isGenuine() bool {
+	return hmac.Equal(s.calcSignature(), s.Sign)
+}
+
 // LoadInfo : Read a secure storage from file (JSON format), verify that the file is genuine
 // by calculating the expected signature
+// Files that were stored with the previous version are converted to the current version
 func LoadInfo(fileName string, secret []byte) (*SecureStorage, error) {
+	return LoadInfoFromBackend(NewFileBackend(fileName), secret)
+}
+
+// LoadInfoFromBackend : Read a secure storage using the given backend, verify that it is genuine
+// by calculating the expected signature
+// If the stored data is corrupted, the newest valid previous generation is used (for backends that keep generations)
+// and the journal of the changes that were done after the data was stored is replayed
+func LoadInfoFromBackend(backend Backend, secret []byte) (*SecureStorage, error) {
 	lock.Lock()
 	defer lock.Unlock()
 
-	var s SecureStorage
-	data, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		return nil, fmt.Errorf("Cannot read secure storage from file: '%v'", fileName)
+	return loadFromBackend(backend, func(name string, s *SecureStorage) (*SecureStorage, error) {
+		if s.Version == legacyVersion {
+			return loadLegacyInfo(name, s, secret)
+		}
+		if s.Version != version {
+			return nil, fmt.Errorf("The loaded file version '%v' is not as the current version %v", s.Version, version)
+		}
+		if len(s.Kdf.Name) == 0 {
+			return nil, fmt.Errorf("The file '%v' is protected by key providers only, it must be loaded using one of them", name)
+		}
+		pass, err := deriveSecret(secret, s.Salt, s.Kdf)
+		if err != nil {
+			return nil, fmt.Errorf("The file '%v' is not genuine, error: %v", name, err)
+		}
+		s.secret = pass
+		if s.isGenuine() == false {
+			return nil, fmt.Errorf("The file '%v' is not genuine", name)
+		}
+		return s, nil
+	})
+}
+
+// LoadInfoWithKeyProvider : Read a secure storage using the given backend, unwrap its master key
+// using the given key provider and verify that it is genuine
+func LoadInfoWithKeyProvider(backend Backend, provider KeyProvider) (*SecureStorage, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return loadFromBackend(backend, func(name string, s *SecureStorage) (*SecureStorage, error) {
+		if s.Version != version {
+			return nil, fmt.Errorf("The loaded file version '%v' is not as the current version %v", s.Version, version)
+		}
+		idx := s.getKeyProviderIdx(provider.Name())
+		if idx == -1 {
+			return nil, fmt.Errorf("The file '%v' can't be unlocked by the key provider '%v'", name, provider.Name())
+		}
+		key, err := provider.UnwrapKey(s.Keys[idx].Key)
+		if err != nil {
+			return nil, fmt.Errorf("The file '%v' is not genuine, error: %v", name, err)
+		}
+		s.secret = key
+		if s.isGenuine() == false {
+			return nil, fmt.Errorf("The file '%v' is not genuine", name)
+		}
+		return s, nil
+	})
+}
+
+// Read the storage using the given backend and unlock it using the given function. If the stored data can't be used
+// and the backend keeps previous generations, the newest generation that can be used is returned.
+// The journal is replayed only on the current data since it holds the changes that were done after it was stored
+func loadFromBackend(backend Backend, unlock func(name string, s *SecureStorage) (*SecureStorage, error)) (*SecureStorage, error) {
+	s, err := backend.Read()
+	if err == nil {
+		s, err = unlock(backend.String(), s)
 	}
-	json.Unmarshal(data, &s)
-	sData, _ := json.Marshal(s.Data)
-	pass := getSaltedPass(secret, s.Salt)
-	sign := s.calcHMac(sData, pass)
-	if bytes.Compare(sign, s.Sign) != 0 {
-		return nil, fmt.Errorf("The file '%v' is not genuine", fileName)
+	if err == nil {
+		s.replayJournal(backend)
+		return s, nil
 	}
-	if s.Version != version {
-		return nil, fmt.Errorf("The loaded file version '%v' is not as the current version %v", s.Version, version)
+	gBackend, ok := backend.(GenerationsBackend)
+	if ok == false {
+		return nil, err
 	}
-	s.secret = pass
-	return &s, nil
+	for i := 1; i <= gBackend.GetGenerationsNum(); i++ {
+		gs, gErr := gBackend.ReadGeneration(i)
+		if gErr == nil {
+			gs, gErr = unlock(gBackend.GetGenerationName(i), gs)
+		}
+		if gErr == nil {
+			logger.Error.Printf("The secure storage '%v' can't be used, error: %v, the previous generation '%v' is used instead",
+				backend, err, gBackend.GetGenerationName(i))
+			return gs, nil
+		}
+	}
+	return nil, err
 }
 
 // StoreInfo : Sign the secure storage and than store it to a given file path without the secret
 func (s SecureStorage) StoreInfo(fileName string) error {
-	tmpFileName := "./tmpA1B2.tr1"
+	return s.StoreInfoToBackend(NewFileBackend(fileName))
+}
+
+// StoreInfoToBackend : Sign the secure storage and than store it using the given backend without the secret
+// The expired items are purged before the storage is stored. If the journal of the storage is enabled for this backend, it is cleared since the stored data includes all the changes
+func (s SecureStorage) StoreInfoToBackend(backend Backend) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.storeInfoToBackend(backend)
+}
+
+func (s *SecureStorage) storeInfoToBackend(backend Backend) error {
+	cnt := s.purgeExpired()
+	if cnt > 0 {
+		logger.Info.Printf("%v expired items were purged from the secure storage before it was stored to: %v", cnt, backend)
+	}
+	s.Sign = s.calcSignature()
+	err := backend.Write(s)
+	if err != nil {
+		return err
+	}
+	if s.journal != nil && s.journal.fileName == getJournalFileName(backend) {
+		return s.journal.reset(s.Sign)
+	}
+	return nil
+}
+
+// Rekey : Replace the secret of the storage: draw a new salt, re-encrypt all the items using the keys derived from the new secret (using the default KDF parameters)
+// The storage is signed using the new secret when it is stored. If an error occurs the storage is not changed.
+// The new master key is wrapped by the given key providers: each of the key providers of the storage must be given
+// (a key provider that should not unlock the storage anymore must be removed first), otherwise an error is returned.
+// The journal is closed since its changes are authenticated using the old keys, it should be enabled again
+func (s *SecureStorage) Rekey(newSecret []byte, checkSecretStrength bool, providers ...KeyProvider) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.rekey(newSecret, checkSecretStrength, getDefaultKdfParams(), providers)
+}
+
+// UpdateKdf : Replace the key derivation function parameters of the storage (e.g. to raise its cost): draw a new salt and
+// re-encrypt all the items using the keys that are derived from the given secret, that must match the storage secret, using the given parameters.
+// As for Rekey, each of the key providers of the storage must be given to wrap the new master key and the journal is closed
+func (s *SecureStorage) UpdateKdf(secret []byte, kdf KdfParams, providers ...KeyProvider) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(s.Kdf.Name) == 0 {
+		return fmt.Errorf("The storage is protected by key providers only, it has no key derivation function")
+	}
+	if s.IsSecretMatch(secret) == false {
+		return fmt.Errorf("The given secret does not match the storage secret")
+	}
+	return s.rekey(secret, false, kdf, providers)
+}
+
+func (s *SecureStorage) rekey(newSecret []byte, checkSecretStrength bool, kdf KdfParams, providers []KeyProvider) error {
+	ns, err := s.newRekeyedStorage(newSecret, checkSecretStrength, kdf, providers)
+	if err != nil {
+		return err
+	}
+	s.replaceKeys(ns)
+	s.closeJournal()
+	return nil
+}
+
+// Return a copy of the storage with all its items re-encrypted using the keys derived from the new secret,
+// the storage itself is not changed
+func (s *SecureStorage) newRekeyedStorage(newSecret []byte, checkSecretStrength bool, kdf KdfParams, providers []KeyProvider) (*SecureStorage, error) {
+	for _, k := range s.Keys {
+		found := false
+		for _, p := range providers {
+			found = found || p.Name() == k.Name
+		}
+		if found == false {
+			return nil, fmt.Errorf("The key provider '%v' must be given to wrap the new master key (or it must be removed first)", k.Name)
+		}
+	}
+	ns, err := NewStorageWithKdf(newSecret, checkSecretStrength, kdf)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range providers {
+		err = ns.addKeyProvider(p)
+		if err != nil {
+			return nil, fmt.Errorf("Error while wrapping the new master key using the key provider '%v': %v", p.Name(), err)
+		}
+	}
+	for slot, item := range s.Data {
+		key, value, err := s.decryptItem(slot, item)
+		if err != nil {
+			return nil, fmt.Errorf("Error while re-encrypting the storage: %v", err)
+		}
+		meta, err := s.getItemMetadata(key, item)
+		if err != nil {
+			return nil, fmt.Errorf("Error while re-encrypting the storage: %v", err)
+		}
+		err = ns.addItemWithMetadata(key, value, meta)
+		if err != nil {
+			return nil, fmt.Errorf("Error while re-encrypting the storage: %v", err)
+		}
+	}
+	return ns, nil
+}
+
+// Replace the keys and the items of the storage by the ones of the given re-encrypted storage
+func (s *SecureStorage) replaceKeys(ns *SecureStorage) {
+	s.Salt = ns.Salt
+	s.Kdf = ns.Kdf
+	s.Version = ns.Version
+	s.secret = ns.secret
+	s.Data = ns.Data
+	s.groups = ns.groups
+	s.keys = ns.keys
+	s.Keys = ns.Keys
+}
+
+// RekeyToBackend : Replace the secret of the storage as Rekey does and store it using the given backend, that the storage
+// is persisted to: the storage is changed only after the re-encrypted storage was stored, so if the store fails
+// the storage and its journal are not changed. When it succeeds, the previous generations that are protected
+// by the old secret are removed and a new journal is started for the backend
+func (s *SecureStorage) RekeyToBackend(backend Backend, newSecret []byte, checkSecretStrength bool, providers ...KeyProvider) error {
 	lock.Lock()
 	defer lock.Unlock()
 
-	sData, _ := json.Marshal(s.Data)
-	s.Sign = s.calcHMac(sData, s.secret)
-	data, err := json.Marshal(s)
+	ns, err := s.newRekeyedStorage(newSecret, checkSecretStrength, getDefaultKdfParams(), providers)
+	if err != nil {
+		return err
+	}
+	err = ns.storeInfoToBackend(backend)
+	if err != nil {
+		return err
+	}
+	s.replaceKeys(ns)
+	s.Sign = ns.Sign
+	s.closeJournal()
+	logger.Info.Println("Rekey the secure storage:", backend)
+	if gBackend, ok := backend.(GenerationsBackend); ok {
+		err = gBackend.RemoveGenerations()
+		if err != nil {
+			return err
+		}
+	}
+	j := &journal{fileName: getJournalFileName(backend)}
+	err = j.reset(s.Sign)
 	if err != nil {
-		return fmt.Errorf("Attempt to translate the secure storage to JSON failed eith error: %v", err)
+		return err
 	}
-	// If a uniq file name is not found within 10 attemps assume that there is another problem
-	for i := 0; i < 10; i++ {
-		tmpFileName = tmpFileName + "Q#9"
-		_, err := os.Stat(tmpFileName)
-		if os.IsNotExist(err) {
-			break
+	s.journal = j
+	return nil
+}
+
+func (s SecureStorage) getKeyProviderIdx(name string) int {
+	for i, k := range s.Keys {
+		if k.Name == name {
+			return i
 		}
 	}
-	err = ioutil.WriteFile(tmpFileName, data, FilePermissions)
+	return -1
+}
+
+func (s *SecureStorage) addKeyProvider(provider KeyProvider) error {
+	wrappedKey, err := provider.WrapKey(s.secret)
 	if err != nil {
-		return fmt.Errorf("attempt to write the Secure storage to file '%v' failed, error: %v", fileName, err)
+		return err
+	}
+	k := WrappedKey{Name: provider.Name(), Provider: provider.Type(), Key: wrappedKey}
+	idx := s.getKeyProviderIdx(k.Name)
+	if idx == -1 {
+		s.Keys = append(s.Keys, k)
+	} else {
+		s.Keys[idx] = k
+	}
+	return nil
+}
+
+// AddKeyProvider : Wrap the storage master key using the given key provider so it can unlock the storage,
+// a key provider with the same name is replaced. The change is saved when the storage is stored
+func (s *SecureStorage) AddKeyProvider(provider KeyProvider) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.addKeyProvider(provider)
+}
+
+// RemoveKeyProvider : Revoke the key provider with the given name: remove its wrapped copy of the master key
+// without re-encrypting the data. A storage that has no secret must keep at least one key provider
+func (s *SecureStorage) RemoveKeyProvider(name string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	idx := s.getKeyProviderIdx(name)
+	if idx == -1 {
+		return fmt.Errorf("Key provider '%v' was not found", name)
+	}
+	if len(s.Keys) == 1 && len(s.Kdf.Name) == 0 {
+		return fmt.Errorf("Key provider '%v' can't be removed: it is the last key that can unlock the storage", name)
 	}
-	os.Rename(tmpFileName, fileName)
+	s.Keys = append(s.Keys[:idx], s.Keys[idx+1:]...)
 	return nil
 }
 
-func (s SecureStorage) extractDataFromEncodedString(data string) (string, error) {
-	val := strings.Split(data, string(nullChar))
-	ret, err := base64.StdEncoding.DecodeString(val[0])
-	sLen := bytes.IndexByte(ret, 0)
-	if sLen <= 0 {
-		sLen = len(ret)
+// GetKeyProvidersNames : Return the names of the key providers that can unlock the storage
+func (s SecureStorage) GetKeyProvidersNames() []string {
+	names := make([]string, 0, len(s.Keys))
+	for _, k := range s.Keys {
+		names = append(names, k.Name)
+	}
+	return names
+}
+
+// RekeyInfo : Load the secure storage using the given backend and secret, re-encrypt it using the new secret
+// and store it using the same backend. The backend replaces the stored data in one step: if the operation fails
+// the stored data is still the one that is protected by the old secret.
+// When it succeeds, the previous generations and the journal, that are protected by the old secret, are removed.
+// The key providers of the storage must be given to wrap the new master key
+func RekeyInfo(backend Backend, secret []byte, newSecret []byte, checkSecretStrength bool, providers ...KeyProvider) error {
+	s, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		return err
+	}
+	err = s.Rekey(newSecret, checkSecretStrength, providers...)
+	if err != nil {
+		return err
+	}
+	logger.Info.Println("Rekey the secure storage:", backend)
+	return storeRekeyed(backend, s)
+}
+
+// UpdateKdfInfo : Load the secure storage using the given backend and secret, replace its key derivation function parameters
+// with the given ones (e.g. to raise its cost) and store it using the same backend. The data is not changed.
+// When it succeeds, the previous generations and the journal, that are protected by the old keys, are removed
+func UpdateKdfInfo(backend Backend, secret []byte, kdf KdfParams, providers ...KeyProvider) error {
+	s, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		return err
+	}
+	err = s.UpdateKdf(secret, kdf, providers...)
+	if err != nil {
+		return err
+	}
+	logger.Info.Printf("Update the key derivation function of the secure storage: %v to: %v", backend, kdf)
+	return storeRekeyed(backend, s)
+}
+
+// Store the storage that was re-encrypted and remove the previous generations and the journal that are protected by the old keys
+func storeRekeyed(backend Backend, s *SecureStorage) error {
+	err := s.StoreInfoToBackend(backend)
+	if err != nil {
+		return err
+	}
+	os.Remove(getJournalFileName(backend))
+	if gBackend, ok := backend.(GenerationsBackend); ok {
+		return gBackend.RemoveGenerations()
 	}
-	return string(ret[:sLen]), err
+	return nil
 }
 
-//GetDecryptStorageData : Get the decrypted storgae information
+//GetDecryptStorageData : Get the decrypted storgae information, expired items are not included
 func (s SecureStorage) GetDecryptStorageData() *SecureStorage {
 	data := make(SecureDataMap)
 
+	now := time.Now()
 	for k, v := range s.Data {
-		key1, err := s.decrypt([]byte(k))
+		key, value, err := s.decryptItem(k, v)
 		if err != nil {
 			fmt.Println("Internal error in GetDecryptStorageData, key is:", k, "val", v)
-		} else {
-			key, _ := s.extractDataFromEncodedString(key1)
-			value, _ := s.decrypt([]byte(v))
-			val, _ := s.extractDataFromEncodedString(value)
-			data[key] = val
+		} else if s.isItemExpired(key, v, now) == false {
+			data[key] = value
 		}
 	}
-	storage, err := NewStorage([]byte("aA12Bc@ junk secret!!!"), true)
+	storage, err := NewStorage([]byte("aA12Bc@ junk secret!!!"), false)
 	if err != nil {
 		fmt.Printf("Internal Error: Can't generate storage, error: %v\n", err)
 		return nil
@@ -423,6 +1208,15 @@ func (s SecureStorage) GetDecryptStorageData() *SecureStorage {
 	return storage
 }
 
+// CheckSecretStrength : Verify that the given secret is valid and strong enough to be used as a secure storage secret
+func CheckSecretStrength(secret []byte) error {
+	err := isValidData(secret)
+	if err != nil {
+		return err
+	}
+	return isSecretStrengthOk(string(secret))
+}
+
 func isSecretStrengthOk(pass string) error {
 	extraCnt := 0
 	digitCnt := 0
@@ -446,5 +1240,8 @@ func isSecretStrengthOk(pass string) error {
 		return fmt.Errorf("The secure storage secret does not pass the secret strength test. In order to be strong, the password must adhere to all of the following:\nContains at least %v characters\nInclude at least: %v digits\nInclude at least %v letters where at least %v must be upper-case and at least %v must be lower-case\nInclude at least %v special characters from the following list:\nSpecial characters: '%v'",
 			minSecretLen, minDigits, minUpperCase+minLowerCase, minUpperCase, minLowerCase, minExtraChars, extraCharStr)
 	}
+	if SecretStrengthCheck != nil {
+		return SecretStrengthCheck(pass)
+	}
 	return nil
 }
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+	"github.com/ibm-security-innovation/libsecurity-go/salt"
+)
+
+// The "V 1.2" storage format: used only to load files that were stored by previous versions.
+// Each key was stored twice: its sha256 hash with a random IV as the value and the key encrypted (AES-CBC)
+// with that IV with the encrypted value (AES-CBC, random IV). The encrypted text is base64 encoded and padded with null characters.
+
+func legacyGetSaltedPass(secret, saltData []byte) []byte {
+	pass, _ := salt.GenerateSaltedPassword(secret, minSecretLen, maxSecretLen, saltData, SecretLen)
+	return bytes.Replace(pass, []byte{'0'}, []byte{'a'}, -1)
+}
+
+func legacyGetHKey(key string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(key))
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+func legacyEncrypt(secret []byte, text []byte, iv []byte) (string, error) {
+	var b string
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", fmt.Errorf("Error during encryption: '%v', %v", err, text)
+	}
+	data := text
+	for {
+		b = base64.StdEncoding.EncodeToString(data)
+		if len(b)%aes.BlockSize == 0 {
+			break
+		}
+		data = append(data, nullChar)
+	}
+	ciphertext := make([]byte, aes.BlockSize+len(b))
+	copy(ciphertext[:aes.BlockSize], iv)
+	mode := cipher.NewCBCEncrypter(block, ciphertext[:aes.BlockSize])
+	mode.CryptBlocks(ciphertext[aes.BlockSize:], []byte(b))
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// The IV of an encrypted key is derived from the random value that is stored with the key hash
+func legacyGetKeyIv(rKey string) []byte {
+	str := rKey + strings.Repeat("a", aes.BlockSize-len(rKey)+10)
+	return []byte(str)[:aes.BlockSize]
+}
+
+func legacyDecrypt(secret []byte, text1 string) (string, error) {
+	text, err := base64.StdEncoding.DecodeString(text1)
+	if err != nil {
+		return "", fmt.Errorf("during decryption: '%v', error: %v", text, err)
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", fmt.Errorf("during decryption: '%v', error: %v", text, err)
+	}
+	if len(text) < aes.BlockSize || len(text)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("Error during decryption: Ciphertext length is not valid")
+	}
+	iv := text[:aes.BlockSize]
+	dtext := text[aes.BlockSize:]
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(dtext, dtext)
+	return extractDataFromEncodedString(string(dtext))
+}
+
+func extractDataFromEncodedString(data string) (string, error) {
+	val := strings.Split(data, string(nullChar))
+	ret, err := base64.StdEncoding.DecodeString(val[0])
+	sLen := bytes.IndexByte(ret, 0)
+	if sLen <= 0 {
+		sLen = len(ret)
+	}
+	return string(ret[:sLen]), err
+}
+
+// Verify the signature of a "V 1.2" secure storage, decrypt all its items and return
+// a new secure storage (current version) that holds them
+func loadLegacyInfo(fileName string, ls *SecureStorage, secret []byte) (*SecureStorage, error) {
+	pass := legacyGetSaltedPass(secret, ls.Salt)
+	sData, _ := json.Marshal(ls.Data)
+	if hmac.Equal(ls.calcHMac(sData, pass), ls.Sign) == false {
+		return nil, fmt.Errorf("The file '%v' is not genuine", fileName)
+	}
+	s, err := NewStorage(secret, false)
+	if err != nil {
+		return nil, err
+	}
+	for cipherKey, cipherData := range ls.Data {
+		// Only the entries that their key is an encrypted key that matches its stored hash hold items
+		key, err := legacyDecrypt(pass, cipherKey)
+		if err != nil {
+			continue
+		}
+		rKey, exist := ls.Data[legacyGetHKey(key)]
+		if exist == false {
+			continue
+		}
+		expected, err := legacyEncrypt(pass, []byte(key), legacyGetKeyIv(rKey))
+		if err != nil || expected != cipherKey {
+			continue
+		}
+		value, err := legacyDecrypt(pass, cipherData)
+		if err != nil {
+			return nil, fmt.Errorf("The file '%v' is not genuine, error: %v", fileName, err)
+		}
+		err = s.addItem(key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger.Info.Printf("The secure storage file '%v' version '%v' was converted to version '%v', it will be stored using the new version on the next store",
+		fileName, legacyVersion, version)
+	return s, nil
+}
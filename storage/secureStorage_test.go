@@ -2,14 +2,20 @@ package storage
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+	"github.com/ibm-security-innovation/libsecurity-go/salt"
 )
 
 const (
@@ -167,4 +173,417 @@ func Test_corners(t *testing.T) {
 	if err == nil {
 		t.Errorf("Test fail: simple secret was accepted")
 	}
-}
\ No newline at end of file
+}
+// Verify that without the secret strength call back, a secret without the required character classes is rejected
+// and that the call back can only reject secrets that pass the default test
+func Test_secretStrengthCheck(t *testing.T) {
+	defer func(check func(secret string) error) { SecretStrengthCheck = check }(SecretStrengthCheck)
+
+	SecretStrengthCheck = nil
+	for _, secret := range []string{"abcdefghijkl", "ABCDEFgh12", "Abcdefgh@1"} {
+		if isSecretStrengthOk(secret) == nil {
+			t.Errorf("Test fail: the secret '%v' that does not adhere to the default strength test was accepted", secret)
+		}
+	}
+	if err := isSecretStrengthOk(baseSecret); err != nil {
+		t.Errorf("Test fail: the secret '%v' was rejected, error: %v", baseSecret, err)
+	}
+	SecretStrengthCheck = func(secret string) error { return nil }
+	if isSecretStrengthOk("abcdefghijkl") == nil {
+		t.Errorf("Test fail: the call back loosened the default secret strength test")
+	}
+	SecretStrengthCheck = func(secret string) error { return fmt.Errorf("The secret is weak") }
+	if isSecretStrengthOk(baseSecret) == nil {
+		t.Errorf("Test fail: the secret '%v' was accepted although the call back rejected it", baseSecret)
+	}
+}
+
+// Store the given items in a "V 1.2" file format
+func storeLegacyFile(t *testing.T, fileName string, secret []byte, keys []string, values []string) {
+	s := SecureStorage{Data: make(SecureDataMap), Version: legacyVersion}
+	s.Salt, _ = salt.GetRandomSalt(SaltLen)
+	pass := legacyGetSaltedPass(secret, s.Salt)
+	for i, key := range keys {
+		rKey := make([]byte, aes.BlockSize)
+		io.ReadFull(rand.Reader, rKey)
+		hVal := base64.StdEncoding.EncodeToString(rKey)
+		cipherKey, err := legacyEncrypt(pass, []byte(key), legacyGetKeyIv(hVal))
+		if err != nil {
+			t.Fatalf("Fatal error: can't encrypt key, error: %v", err)
+		}
+		iv := make([]byte, aes.BlockSize)
+		io.ReadFull(rand.Reader, iv)
+		cipherData, err := legacyEncrypt(pass, []byte(values[i]), iv)
+		if err != nil {
+			t.Fatalf("Fatal error: can't encrypt value, error: %v", err)
+		}
+		s.Data[legacyGetHKey(key)] = hVal
+		s.Data[cipherKey] = cipherData
+	}
+	sData, _ := json.Marshal(s.Data)
+	s.Sign = s.calcHMac(sData, pass)
+	data, _ := json.Marshal(s)
+	ioutil.WriteFile(fileName, data, FilePermissions)
+}
+
+// Verify that a "V 1.2" file is loaded, that its items are as expected
+// and that it is stored using the current version
+// Verify that a "V 1.2" file can't be loaded with the wrong secret
+func Test_loadLegacyVersionFile(t *testing.T) {
+	keys := []string{"k1", "k2 is a long key", RandomStr}
+	values := []string{"v1", "v2 is a long value", RandomStr}
+	secret := []byte(baseSecret)
+	fileName := "./tmp.txt"
+	defer os.Remove(fileName)
+
+	storeLegacyFile(t, fileName, secret, keys, values)
+	_, err := LoadInfo(fileName, []byte(baseSecret1))
+	if err == nil {
+		t.Errorf("Test fail: Successfully read legacy secure storage from file while using wrong secret")
+	}
+	s, err := LoadInfo(fileName, secret)
+	if err != nil {
+		t.Fatalf("Test fail: Read legacy secure storage from file fail, error: %v", err)
+	}
+	if s.Version != version || len(s.Data) != len(keys) {
+		t.Errorf("Test fail: The loaded legacy storage version: '%v' and number of items %v, expected version '%v' with %v items",
+			s.Version, len(s.Data), version, len(keys))
+	}
+	s.StoreInfo(fileName)
+	s1, err := LoadInfo(fileName, secret)
+	if err != nil {
+		t.Fatalf("Test fail: Read converted secure storage from file fail, error: %v", err)
+	}
+	for i, key := range keys {
+		val, err := s1.GetItem(key)
+		if err != nil || val != values[i] {
+			t.Errorf("Test fail: key '%v' value '%v' is not as expected '%v', error: %v", key, val, values[i], err)
+		}
+	}
+}
+
+// Verify that an item that was moved to the slot of another key can't be read
+func Test_itemBoundToKey(t *testing.T) {
+	s, _ := NewStorage([]byte(baseSecret), true)
+	s.AddItem("k1", "v1")
+	s.AddItem("k2", "v2")
+	slot1 := s.getSlot("k1")
+	slot2 := s.getSlot("k2")
+	s.Data[slot1], s.Data[slot2] = s.Data[slot2], s.Data[slot1]
+	for _, key := range []string{"k1", "k2"} {
+		val, err := s.GetItem(key)
+		if err == nil {
+			t.Errorf("Test fail: item of other key was read successfully for key '%v', value: '%v'", key, val)
+		}
+	}
+}
+
+// Verify that after rekey, the items are the same, the salt was changed,
+// the storage can be loaded only using the new secret and the old secret doesn't match
+func Test_rekeySecureStorageFile(t *testing.T) {
+	keys := []string{"k1", "k2", RandomStr}
+	values := []string{"v1", "v2", RandomStr}
+	secret := []byte(baseSecret)
+	newSecret := []byte(baseSecret1)
+	fileName := "./tmp.txt"
+	defer os.Remove(fileName)
+
+	s, _ := NewStorage(secret, true)
+	for i, key := range keys {
+		s.AddItem(key, values[i])
+	}
+	s.StoreInfo(fileName)
+	backend := NewFileBackend(fileName)
+	err := RekeyInfo(backend, secret, []byte("1234"), true)
+	if err == nil {
+		t.Errorf("Test fail: Successfully rekey the storage using a simple secret")
+	}
+	err = RekeyInfo(backend, newSecret, newSecret, true)
+	if err == nil {
+		t.Errorf("Test fail: Successfully rekey the storage using the wrong current secret")
+	}
+	err = RekeyInfo(backend, secret, newSecret, true)
+	if err != nil {
+		t.Fatalf("Test fail: Rekey the secure storage fail, error: %v", err)
+	}
+	_, err = LoadInfo(fileName, secret)
+	if err == nil {
+		t.Errorf("Test fail: Successfully read secure storage using the old secret after rekey")
+	}
+	s1, err := LoadInfo(fileName, newSecret)
+	if err != nil {
+		t.Fatalf("Test fail: Read secure storage using the new secret after rekey fail, error: %v", err)
+	}
+	if bytes.Equal(s.Salt, s1.Salt) || s1.IsSecretMatch(secret) || s1.IsSecretMatch(newSecret) == false {
+		t.Errorf("Test fail: After rekey the salt must be changed and only the new secret must match")
+	}
+	for i, key := range keys {
+		val, err := s1.GetItem(key)
+		if err != nil || val != values[i] {
+			t.Errorf("Test fail: after rekey, key '%v' value '%v' is not as expected '%v', error: %v", key, val, values[i], err)
+		}
+	}
+}
+
+// Verify that when the rekeyed storage can't be stored, the storage is not changed
+// and that when it is stored, the storage and the stored data use the new secret
+func Test_rekeyToBackend(t *testing.T) {
+	secret := []byte(baseSecret)
+	newSecret := []byte(baseSecret1)
+	fileName := "./tmp.txt"
+	defer os.Remove(fileName)
+	defer os.Remove(fileName + journalFileSuffix)
+
+	s, _ := NewStorage(secret, true)
+	s.AddItem("k1", "v1")
+	err := s.RekeyToBackend(NewFileBackend("./no-such-dir/tmp.txt"), newSecret, true)
+	if err == nil {
+		t.Errorf("Test fail: Successfully rekey the storage to a backend that can't be written")
+	}
+	val, _ := s.GetItem("k1")
+	if s.IsSecretMatch(secret) == false || val != "v1" {
+		t.Errorf("Test fail: the storage was changed although the rekeyed storage was not stored")
+	}
+	backend := NewFileBackend(fileName)
+	err = s.RekeyToBackend(backend, newSecret, true)
+	if err != nil {
+		t.Fatalf("Test fail: Rekey the secure storage fail, error: %v", err)
+	}
+	defer s.DisableJournal()
+	s.AddItem("k2", "v2")
+	s1, err := LoadInfoFromBackend(backend, newSecret)
+	if err != nil || s.IsSecretMatch(newSecret) == false {
+		t.Fatalf("Test fail: the storage doesn't use the new secret after rekey, error: %v", err)
+	}
+	if reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the item changes after rekey were not written to the journal")
+	}
+}
+
+// Verify that the keys are listed sorted and filtered by the given prefix
+// Verify that the item metadata holds its size, and that the creation time is kept when the item is updated
+// Verify that the metadata is kept after rekey and that the keys of removed items are not kept
+func Test_listKeysAndMetadata(t *testing.T) {
+	keys := []string{"b-2", "a-1", "b-1", "c"}
+	s, _ := NewStorage([]byte(baseSecret), true)
+	for _, key := range keys {
+		s.AddItem(key, "value of "+key)
+	}
+	list, err := s.GetKeys("b-")
+	if err != nil || reflect.DeepEqual(list, []string{"b-1", "b-2"}) == false {
+		t.Errorf("Test fail: the keys with prefix 'b-' are %v, expected [b-1 b-2], error: %v", list, err)
+	}
+	list, _ = s.GetKeys("")
+	if reflect.DeepEqual(list, []string{"a-1", "b-1", "b-2", "c"}) == false {
+		t.Errorf("Test fail: the keys are %v, expected all the keys sorted", list)
+	}
+	meta, err := s.GetItemMetadata("c")
+	if err != nil || meta.Size != len("value of c") || meta.Created.IsZero() || meta.Created.Equal(meta.Updated) == false {
+		t.Errorf("Test fail: the metadata of a new item: %v is not as expected, error: %v", meta, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.AddItem("c", "new")
+	meta1, _ := s.GetItemMetadata("c")
+	if meta1.Created.Equal(meta.Created) == false || meta1.Updated.After(meta.Updated) == false || meta1.Size != len("new") {
+		t.Errorf("Test fail: the metadata of an updated item: %v is not as expected, the previous metadata: %v", meta1, meta)
+	}
+	items, _ := s.GetItemsMetadata("c")
+	if len(items) != 1 || items[0].Key != "c" || items[0].ItemMetadata != meta1 {
+		t.Errorf("Test fail: the items metadata %v is not as expected: %v", items, meta1)
+	}
+	s.Rekey([]byte(baseSecret1), true)
+	meta2, _ := s.GetItemMetadata("c")
+	if meta2 != meta1 {
+		t.Errorf("Test fail: the metadata after rekey %v is not as the metadata before it %v", meta2, meta1)
+	}
+	_, err = s.GetItemMetadata("undefined")
+	if err == nil {
+		t.Errorf("Test fail: get the metadata of an undefined key")
+	}
+	s.RemoveItem("a-1")
+	list, _ = s.GetKeys("")
+	if reflect.DeepEqual(list, []string{"b-1", "b-2", "c"}) == false || len(s.keys) != len(s.Data) {
+		t.Errorf("Test fail: the keys after an item was removed are %v, %v keys are kept for %v items", list, len(s.keys), len(s.Data))
+	}
+}
+
+// Verify that an expired item is treated as missing and that it is purged when the storage is stored
+// Verify that an item that doesn't expire is kept and that an expired item that is added again has a new creation time
+func Test_itemExpiry(t *testing.T) {
+	fileName := "./tmp.txt"
+	ttl := 50 * time.Millisecond
+	defer os.Remove(fileName)
+
+	s, _ := NewStorage([]byte(baseSecret), true)
+	err := s.AddItemWithTTL("short", "value", -ttl)
+	if err == nil {
+		t.Errorf("Test fail: an item with a negative time to live was added")
+	}
+	s.AddItemWithTTL("short", "value", ttl)
+	s.AddItem("long", "value")
+	val, err := s.GetItem("short")
+	if err != nil || val != "value" {
+		t.Errorf("Test fail: can't get an item before it expires, error: %v", err)
+	}
+	meta, _ := s.GetItemMetadata("short")
+	if meta.Expires.Equal(meta.Updated.Add(ttl)) == false {
+		t.Errorf("Test fail: the item expiry time %v is not as expected %v", meta.Expires, meta.Updated.Add(ttl))
+	}
+	time.Sleep(2 * ttl)
+	_, err = s.GetItem("short")
+	if err == nil {
+		t.Errorf("Test fail: get an expired item")
+	}
+	keys, _ := s.GetKeys("")
+	if reflect.DeepEqual(keys, []string{"long"}) == false {
+		t.Errorf("Test fail: the keys %v include an expired item", keys)
+	}
+	s.StoreInfo(fileName)
+	if len(s.Data) != 1 {
+		t.Errorf("Test fail: the expired item was not purged when the storage was stored")
+	}
+	s1, _ := LoadInfo(fileName, []byte(baseSecret))
+	if len(s1.Data) != 1 {
+		t.Errorf("Test fail: the expired item was stored")
+	}
+	if _, err := s1.GetItem("long"); err != nil {
+		t.Errorf("Test fail: an item that doesn't expire was not stored, error: %v", err)
+	}
+	s.AddItemWithTTL("short", "value", ttl)
+	expiredMeta, _ := s.GetItemMetadata("short")
+	time.Sleep(2 * ttl)
+	s.AddItem("short", "value")
+	meta, _ = s.GetItemMetadata("short")
+	if meta.Created.Equal(expiredMeta.Created) || meta.Created.Equal(meta.Updated) == false {
+		t.Errorf("Test fail: the creation time %v of the expired item was kept when the item was added again", expiredMeta.Created)
+	}
+}
+
+// Verify that a storage that its keys were derived using each of the supported KDFs can be stored and loaded
+// and that the KDF parameters are recorded in the stored file
+func Test_storeLoadKdfs(t *testing.T) {
+	secret := []byte(baseSecret)
+	fileName := "./tmp.txt"
+	defer os.Remove(fileName)
+
+	kdfs := []KdfParams{
+		{Name: Pbkdf2Sha256KdfName, Iterations: 1000, KeyLen: 32},
+		{Name: ScryptKdfName, Iterations: 1024, KeyLen: 32, BlockSize: 8, Parallelism: 1},
+		{Name: Argon2idKdfName, Iterations: 1, KeyLen: 32, Memory: 1024, Parallelism: 2},
+	}
+	for _, kdf := range kdfs {
+		s, err := NewStorageWithKdf(secret, true, kdf)
+		if err != nil {
+			t.Fatalf("Test fail: can't create a storage using %v, error: %v", kdf, err)
+		}
+		s.AddItem("k1", "v1")
+		s.StoreInfo(fileName)
+		s1, err := LoadInfo(fileName, secret)
+		if err != nil {
+			t.Fatalf("Test fail: can't load the storage that was stored using %v, error: %v", kdf, err)
+		}
+		if s1.Kdf != kdf || s1.IsSecretMatch(secret) == false {
+			t.Errorf("Test fail: the loaded KDF parameters %v are not as expected %v", s1.Kdf, kdf)
+		}
+		if val, err := s1.GetItem("k1"); err != nil || val != "v1" {
+			t.Errorf("Test fail: the item value '%v' is not as expected 'v1', error: %v", val, err)
+		}
+		_, err = LoadInfo(fileName, []byte(baseSecret1))
+		if err == nil {
+			t.Errorf("Test fail: the storage that was stored using %v was loaded using a wrong secret", kdf)
+		}
+	}
+}
+
+// Verify that illegal KDF parameters are rejected
+func Test_kdfParamsCorners(t *testing.T) {
+	kdfs := []KdfParams{
+		{Name: "md5", Iterations: 1, KeyLen: 32},
+		{Name: Pbkdf2Sha256KdfName, Iterations: 0, KeyLen: 32},
+		{Name: Pbkdf2Sha256KdfName, Iterations: 1, KeyLen: 20},
+		{Name: ScryptKdfName, Iterations: 1000, KeyLen: 32, BlockSize: 8, Parallelism: 1},
+		{Name: ScryptKdfName, Iterations: 1024, KeyLen: 32, BlockSize: 0, Parallelism: 1},
+		{Name: ScryptKdfName, Iterations: 1 << 30, KeyLen: 32, BlockSize: 8, Parallelism: 1},
+		{Name: Argon2idKdfName, Iterations: 1, KeyLen: 32, Memory: 8, Parallelism: 2},
+		{Name: Argon2idKdfName, Iterations: 1, KeyLen: 32, Memory: maxKdfMemory + 1, Parallelism: 1},
+		{Name: Pbkdf2Sha256KdfName, Iterations: maxPbkdf2Iterations + 1, KeyLen: 32},
+		{Name: ScryptKdfName, Iterations: 1 << 18, KeyLen: 32, BlockSize: 8, Parallelism: 8},
+		{Name: Argon2idKdfName, Iterations: maxArgon2idIterations + 1, KeyLen: 32, Memory: 1024, Parallelism: 1},
+		{Name: Argon2idKdfName, Iterations: 8, KeyLen: 32, Memory: maxKdfMemory, Parallelism: 1},
+	}
+	for _, kdf := range kdfs {
+		_, err := NewStorageWithKdf([]byte(baseSecret), true, kdf)
+		if err == nil {
+			t.Errorf("Test fail: a storage was created using the illegal KDF parameters %v", kdf)
+		}
+		err = SetDefaultKdfParams(kdf)
+		if err == nil {
+			t.Errorf("Test fail: the illegal KDF parameters %v were set as the default", kdf)
+		}
+	}
+	for _, name := range []string{Pbkdf2Sha256KdfName, ScryptKdfName, Argon2idKdfName} {
+		kdf, err := NewKdfParams(name)
+		if err != nil || kdf.isValid() != nil {
+			t.Errorf("Test fail: the default parameters of '%v': %v are not valid, error: %v", name, kdf, err)
+		}
+	}
+}
+
+// Verify that the KDF parameters of a stored file can be replaced without losing its data
+// Verify that the KDF parameters can't be replaced using a wrong secret
+func Test_updateKdfInfo(t *testing.T) {
+	secret := []byte(baseSecret)
+	fileName := "./tmp.txt"
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+
+	s, _ := NewStorageWithKdf(secret, true, KdfParams{Name: Pbkdf2Sha256KdfName, Iterations: 1000, KeyLen: 32})
+	s.AddItem("k1", "v1")
+	s.StoreInfoToBackend(backend)
+	kdf := KdfParams{Name: Argon2idKdfName, Iterations: 2, KeyLen: 32, Memory: 2048, Parallelism: 1}
+	err := UpdateKdfInfo(backend, []byte(baseSecret1), kdf)
+	if err == nil {
+		t.Errorf("Test fail: the KDF parameters were replaced using a wrong secret")
+	}
+	err = UpdateKdfInfo(backend, secret, kdf)
+	if err != nil {
+		t.Fatalf("Test fail: can't replace the KDF parameters, error: %v", err)
+	}
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage after its KDF parameters were replaced, error: %v", err)
+	}
+	if s1.Kdf != kdf || bytes.Equal(s1.Salt, s.Salt) {
+		t.Errorf("Test fail: the KDF parameters %v are not as expected %v or the salt was not replaced", s1.Kdf, kdf)
+	}
+	if val, err := s1.GetItem("k1"); err != nil || val != "v1" {
+		t.Errorf("Test fail: the item value '%v' is not as expected 'v1', error: %v", val, err)
+	}
+}
+
+// Verify that the key derived from a secure key file depends on its parameters file
+// and that the legacy processing is used when there is no parameters file
+func Test_secureKeyParams(t *testing.T) {
+	fileName := "./tmpKey"
+	defer os.Remove(fileName)
+	defer os.Remove(fileName + SecureKeyParamsSuffix)
+
+	ioutil.WriteFile(fileName, []byte(baseSecret), FilePermissions)
+	legacyKey := GetSecureKey(fileName)
+	if bytes.Equal(legacyKey, manipulateSecureKey([]byte(baseSecret), []byte(SaltData))) == false {
+		t.Errorf("Test fail: the key of a secure key file without parameters file is not the legacy one")
+	}
+	kdf := KdfParams{Name: ScryptKdfName, Iterations: 1024, KeyLen: 32, BlockSize: 8, Parallelism: 1}
+	err := NewSecureKeyParams(fileName, kdf)
+	if err != nil {
+		t.Fatalf("Test fail: can't create the secure key parameters file, error: %v", err)
+	}
+	key := GetSecureKey(fileName)
+	if bytes.Equal(key, legacyKey) || bytes.Equal(key, GetSecureKey(fileName)) == false {
+		t.Errorf("Test fail: the key derived using the secure key parameters file is not as expected")
+	}
+	NewSecureKeyParams(fileName, kdf)
+	if bytes.Equal(key, GetSecureKey(fileName)) {
+		t.Errorf("Test fail: the key derived using a new salt is equal to the previous key")
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Shamir's secret sharing over GF(2^8): each byte of the secret is the constant term of a random polynomial
+// of degree threshold-1, and each share holds the values of all the polynomials at a distinct non zero point.
+// Any threshold shares reconstruct the secret using Lagrange interpolation, while fewer shares reveal nothing about it.
+// A share is a hex string of: the threshold, the point and the polynomials values
+
+const (
+	// MaxSharesNum : the maximum number of shares that a secret can be split into
+	MaxSharesNum = 255
+	minThreshold = 2
+
+	shareHeaderLen = 2
+)
+
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		// multiply by the generator 3 modulo the AES polynomial x^8 + x^4 + x^3 + x + 1
+		x ^= x << 1
+		if x&0x100 != 0 {
+			x ^= 0x11b
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a byte, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// Evaluate the polynomial with the given coefficients (the constant term first) at the given point
+func evalPolynomial(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// SplitSecret : Split the given secret into the given number of shares, any threshold of them reconstruct the secret
+func SplitSecret(secret []byte, sharesNum int, threshold int) ([]string, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("The secret must not be empty")
+	}
+	if threshold < minThreshold || threshold > sharesNum || sharesNum > MaxSharesNum {
+		return nil, fmt.Errorf("The threshold %v must be at least %v and at most the number of shares %v, that must be at most %v",
+			threshold, minThreshold, sharesNum, MaxSharesNum)
+	}
+	shares := make([][]byte, sharesNum)
+	for i := range shares {
+		shares[i] = make([]byte, shareHeaderLen, shareHeaderLen+len(secret))
+		shares[i][0] = byte(threshold)
+		shares[i][1] = byte(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	for _, b := range secret {
+		_, err := io.ReadFull(rand.Reader, coefficients[1:])
+		if err != nil {
+			return nil, err
+		}
+		coefficients[0] = b
+		for i := range shares {
+			shares[i] = append(shares[i], evalPolynomial(coefficients, shares[i][1]))
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	sharesStr := make([]string, sharesNum)
+	for i, share := range shares {
+		sharesStr[i] = hex.EncodeToString(share)
+	}
+	return sharesStr, nil
+}
+
+func parseShare(share string) ([]byte, error) {
+	data, err := hex.DecodeString(share)
+	if err != nil || len(data) <= shareHeaderLen || data[0] < minThreshold || data[1] == 0 {
+		return nil, fmt.Errorf("The share '%v' is not valid", share)
+	}
+	return data, nil
+}
+
+// GetShareThreshold : Return the number of shares that are needed to reconstruct the secret that the given share belongs to
+func GetShareThreshold(share string) (int, error) {
+	data, err := parseShare(share)
+	if err != nil {
+		return 0, err
+	}
+	return int(data[0]), nil
+}
+
+// CombineShares : Reconstruct the secret from the given shares, at least threshold different shares of the same secret must be given.
+// Note that shares of different secrets can't be detected, the result should be verified (e.g. by loading the storage that it protects)
+func CombineShares(shares []string) ([]byte, error) {
+	var parsed [][]byte
+
+	used := make(map[byte]bool)
+	for _, share := range shares {
+		data, err := parseShare(share)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) > 0 && (data[0] != parsed[0][0] || len(data) != len(parsed[0])) {
+			return nil, fmt.Errorf("The shares don't belong to the same secret")
+		}
+		if used[data[1]] {
+			continue
+		}
+		used[data[1]] = true
+		parsed = append(parsed, data)
+	}
+	if len(parsed) == 0 || len(parsed) < int(parsed[0][0]) {
+		return nil, fmt.Errorf("Not enough different shares to reconstruct the secret")
+	}
+	parsed = parsed[:parsed[0][0]]
+	secret := make([]byte, len(parsed[0])-shareHeaderLen)
+	for i, share := range parsed {
+		// the Lagrange basis polynomial of this share evaluated at 0
+		basis := byte(1)
+		for j, other := range parsed {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[1], other[1]^share[1]))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(basis, share[shareHeaderLen+k])
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Verify that any threshold shares reconstruct the secret
+// Verify that fewer shares than the threshold can't reconstruct the secret
+// Verify that duplicated shares are counted once
+func Test_splitCombineSecret(t *testing.T) {
+	secret := []byte("a secret to split into shares!")
+	sharesNum := 5
+	threshold := 3
+
+	shares, err := SplitSecret(secret, sharesNum, threshold)
+	if err != nil {
+		t.Fatalf("Test fail: can't split the secret, error: %v", err)
+	}
+	if len(shares) != sharesNum {
+		t.Fatalf("Test fail: the number of shares %v is not as expected %v", len(shares), sharesNum)
+	}
+	for i := 0; i < sharesNum; i++ {
+		for j := i + 1; j < sharesNum; j++ {
+			for k := j + 1; k < sharesNum; k++ {
+				s, err := CombineShares([]string{shares[k], shares[i], shares[j]})
+				if err != nil || bytes.Equal(s, secret) == false {
+					t.Errorf("Test fail: shares %v, %v, %v reconstructed '%v', expected '%v', error: %v", i, j, k, s, secret, err)
+				}
+			}
+		}
+	}
+	th, _ := GetShareThreshold(shares[0])
+	if th != threshold {
+		t.Errorf("Test fail: the share threshold %v is not as expected %v", th, threshold)
+	}
+	_, err = CombineShares(shares[:threshold-1])
+	if err == nil {
+		t.Errorf("Test fail: the secret was reconstructed using %v shares while the threshold is %v", threshold-1, threshold)
+	}
+	_, err = CombineShares([]string{shares[0], shares[1], shares[1]})
+	if err == nil {
+		t.Errorf("Test fail: the secret was reconstructed using a duplicated share")
+	}
+	otherShares, _ := SplitSecret([]byte("other secret"), sharesNum, threshold)
+	_, err = CombineShares([]string{shares[0], shares[1], otherShares[2]})
+	if err == nil {
+		t.Errorf("Test fail: the secret was reconstructed using shares of different secrets")
+	}
+}
+
+// Verify that illegal parameters and shares are rejected
+func Test_splitCombineSecretCorners(t *testing.T) {
+	params := [][]int{{5, 1}, {3, 4}, {MaxSharesNum + 1, 3}}
+
+	for _, p := range params {
+		_, err := SplitSecret([]byte("secret"), p[0], p[1])
+		if err == nil {
+			t.Errorf("Test fail: the secret was split into %v shares with threshold %v", p[0], p[1])
+		}
+	}
+	_, err := SplitSecret(nil, 3, 2)
+	if err == nil {
+		t.Errorf("Test fail: an empty secret was split")
+	}
+	for _, share := range []string{"", "zz1234", "0201"} {
+		_, err := GetShareThreshold(share)
+		if err == nil {
+			t.Errorf("Test fail: the illegal share '%v' was accepted", share)
+		}
+	}
+}
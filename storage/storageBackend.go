@@ -0,0 +1,557 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// FileBackendName : store the secure storage in a single JSON file
+	FileBackendName = "file"
+	// DirectoryBackendName : store the secure storage in a directory: a header file and a file for each items group (e.g. entity)
+	DirectoryBackendName = "directory"
+	// BoltBackendName : store the secure storage in an embedded transactional key/value database
+	BoltBackendName = "bolt"
+
+	tmpFilePrefix     = ".tmp-"
+	headerFileName    = "header.json"
+	groupFileSuffix   = ".json"
+	defaultGroupName  = "common"
+	groupIDLen        = 16
+	groupLabel        = "group-"
+	tmpDirSuffix      = ".tmp"
+	oldDirSuffix      = ".old"
+	boltHeaderBucket  = "header"
+	boltDataBucket    = "data"
+	boltHeaderKey     = "header"
+	boltOpenTimeoutMs = 1000
+
+	// DefaultGenerationsNum : the default number of previous generations that are kept by the file backend
+	DefaultGenerationsNum = 3
+	maxGenerationsNum     = 100
+)
+
+var (
+	// GetItemGroup : call back function that returns the group that the given key belongs to (e.g. the entity name),
+	// it is used by backends that store each group separately
+	GetItemGroup func(key string) string
+
+	defaultGenerations = DefaultGenerationsNum
+	generationsLock    sync.Mutex
+)
+
+// Backend : persistence mechanism for the secure storage: the header (version, KDF parameters, salt and signature)
+// and the encrypted items. The signature is calculated and verified by the secure storage, not by the backend
+type Backend interface {
+	Read() (*SecureStorage, error)
+	Write(s *SecureStorage) error
+	String() string
+}
+
+// GenerationsBackend : a backend that keeps previous generations of the stored data,
+// they are used when the current data can't be used (e.g. it is corrupted)
+type GenerationsBackend interface {
+	Backend
+	GetGenerationsNum() int
+	GetGenerationName(generation int) string
+	ReadGeneration(generation int) (*SecureStorage, error)
+	RemoveGenerations() error
+}
+
+// The secure storage information without the items
+type storageHeader struct {
+	Salt    []byte
+	Sign    []byte
+	Version string
+	Kdf     KdfParams
+	Keys    []WrappedKey `json:",omitempty"`
+}
+
+func (s SecureStorage) getHeader() storageHeader {
+	return storageHeader{Salt: s.Salt, Sign: s.Sign, Version: s.Version, Kdf: s.Kdf, Keys: s.Keys}
+}
+
+func newStorageFromHeader(h storageHeader) *SecureStorage {
+	return &SecureStorage{Salt: h.Salt, Sign: h.Sign, Version: h.Version, Kdf: h.Kdf, Keys: h.Keys, Data: make(SecureDataMap)}
+}
+
+// SetDefaultGenerationsNum : Set the number of previous generations that are kept by the file backends that are returned by NewBackend
+func SetDefaultGenerationsNum(generations int) error {
+	if generations < 0 || generations > maxGenerationsNum {
+		return fmt.Errorf("The number of generations %v must be between 0 and %v", generations, maxGenerationsNum)
+	}
+	generationsLock.Lock()
+	defer generationsLock.Unlock()
+	defaultGenerations = generations
+	return nil
+}
+
+// GetDefaultGenerationsNum : Return the number of previous generations that are kept by the file backends that are returned by NewBackend
+func GetDefaultGenerationsNum() int {
+	generationsLock.Lock()
+	defer generationsLock.Unlock()
+	return defaultGenerations
+}
+
+// NewBackend : Return the backend with the given name that uses the given path,
+// the file backend keeps the default number of previous generations
+func NewBackend(name string, path string) (Backend, error) {
+	switch name {
+	case FileBackendName, "":
+		f := NewFileBackend(path)
+		f.SetGenerationsNum(GetDefaultGenerationsNum())
+		return f, nil
+	case DirectoryBackendName:
+		return NewDirectoryBackend(path), nil
+	case BoltBackendName:
+		return NewBoltBackend(path), nil
+	}
+	return nil, fmt.Errorf("The storage backend '%v' is not supported, it must be one of: '%v', '%v', '%v'",
+		name, FileBackendName, DirectoryBackendName, BoltBackendName)
+}
+
+// Return the ID of the group of the given key: the group name is not stored in clear text
+func (s *SecureStorage) getGroupID(key string) string {
+	name := ""
+	if GetItemGroup != nil {
+		name = GetItemGroup(key)
+	}
+	if len(name) == 0 {
+		return defaultGroupName
+	}
+	id := s.calcHMac([]byte(groupLabel+name), s.getSubKey(macKeyLabel))
+	return hex.EncodeToString(id[:groupIDLen])
+}
+
+func (s *SecureStorage) setItemGroup(slot string, groupID string) {
+	if s.groups == nil {
+		s.groups = make(map[string]string)
+	}
+	s.groups[slot] = groupID
+}
+
+// Return the items of the storage arranged by their groups
+func (s SecureStorage) getGroupsData() map[string]SecureDataMap {
+	groups := make(map[string]SecureDataMap)
+	for slot, item := range s.Data {
+		groupID, exist := s.groups[slot]
+		if exist == false {
+			groupID = defaultGroupName
+		}
+		if _, exist := groups[groupID]; exist == false {
+			groups[groupID] = make(SecureDataMap)
+		}
+		groups[groupID][slot] = item
+	}
+	return groups
+}
+
+//------------------- Single file backend
+
+// Write the data to the given file and flush it to the disk before it is closed
+func writeFileSync(fileName string, data []byte) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePermissions)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Write the data to a temporary file that is flushed to the disk and renamed over the given file,
+// so the file is never left partially written
+func writeFileAtomic(fileName string, data []byte) error {
+	return writeFileAtomicWithHook(fileName, data, nil)
+}
+
+// Write the data to a temporary file that is flushed to the disk and renamed over the given file, the given function
+// (if it is set) is called before the rename, if it fails the file is not replaced
+func writeFileAtomicWithHook(fileName string, data []byte, beforeRename func() error) error {
+	dir, name := filepath.Split(fileName)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	tmpFile, err := ioutil.TempFile(dir, tmpFilePrefix+name)
+	if err != nil {
+		return err
+	}
+	tmpFileName := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(FilePermissions)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && beforeRename != nil {
+		err = beforeRename()
+	}
+	if err == nil {
+		err = os.Rename(tmpFileName, fileName)
+	}
+	if err != nil {
+		os.Remove(tmpFileName)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Flush the directory entries (e.g. after a rename) to the disk
+func syncDir(dirName string) error {
+	dir, err := os.Open(dirName)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// FileBackend : store the secure storage in a single file (JSON format),
+// the previous generations of the file are kept in files with the generation number as a suffix (e.g. data.txt.1)
+type FileBackend struct {
+	fileName    string
+	generations int
+}
+
+// NewFileBackend : Return a single file backend that uses the given file, no previous generations are kept
+func NewFileBackend(fileName string) *FileBackend {
+	return &FileBackend{fileName: fileName}
+}
+
+func (f FileBackend) String() string {
+	return f.fileName
+}
+
+// SetGenerationsNum : Set the number of previous generations of the file to keep, 0 to keep none
+func (f *FileBackend) SetGenerationsNum(generations int) error {
+	if generations < 0 || generations > maxGenerationsNum {
+		return fmt.Errorf("The number of generations %v must be between 0 and %v", generations, maxGenerationsNum)
+	}
+	f.generations = generations
+	return nil
+}
+
+// GetGenerationsNum : Return the number of previous generations of the file that are kept
+func (f FileBackend) GetGenerationsNum() int {
+	return f.generations
+}
+
+// GetGenerationName : Return the name of the file that holds the given previous generation (1 is the newest)
+func (f FileBackend) GetGenerationName(generation int) string {
+	return fmt.Sprintf("%v.%v", f.fileName, generation)
+}
+
+func readFile(fileName string) (*SecureStorage, error) {
+	var s SecureStorage
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read secure storage from file: '%v'", fileName)
+	}
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("The file '%v' is not genuine", fileName)
+	}
+	return &s, nil
+}
+
+// Read : Read the secure storage from the file
+func (f FileBackend) Read() (*SecureStorage, error) {
+	return readFile(f.fileName)
+}
+
+// ReadGeneration : Read the secure storage from the given previous generation file (1 is the newest)
+func (f FileBackend) ReadGeneration(generation int) (*SecureStorage, error) {
+	if generation < 1 || generation > f.generations {
+		return nil, fmt.Errorf("The generation %v must be between 1 and %v", generation, f.generations)
+	}
+	return readFile(f.GetGenerationName(generation))
+}
+
+// RemoveGenerations : Remove all the previous generations files
+func (f FileBackend) RemoveGenerations() error {
+	for i := 1; i <= f.generations; i++ {
+		err := os.Remove(f.GetGenerationName(i))
+		if err != nil && os.IsNotExist(err) == false {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shift the previous generations by one (the oldest is removed) and keep the current file as the newest generation,
+// the current file is kept in place (hard linked, or copied if links are not supported)
+func (f FileBackend) rotateGenerations() error {
+	if f.generations == 0 {
+		return nil
+	}
+	if _, err := os.Stat(f.fileName); err != nil {
+		return nil
+	}
+	os.Remove(f.GetGenerationName(f.generations))
+	for i := f.generations - 1; i >= 1; i-- {
+		err := os.Rename(f.GetGenerationName(i), f.GetGenerationName(i+1))
+		if err != nil && os.IsNotExist(err) == false {
+			return err
+		}
+	}
+	err := os.Link(f.fileName, f.GetGenerationName(1))
+	if err == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(f.fileName)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(f.GetGenerationName(1), data)
+}
+
+// Write : Write the secure storage to a temporary file in the same directory, flush it to the disk and replace the file with it,
+// so the file is either the previous one or the new one. The previous file is kept as the newest generation
+func (f FileBackend) Write(s *SecureStorage) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("Attempt to translate the secure storage to JSON failed eith error: %v", err)
+	}
+	err = writeFileAtomicWithHook(f.fileName, data, f.rotateGenerations)
+	if err != nil {
+		return fmt.Errorf("attempt to write the Secure storage to file '%v' failed, error: %v", f.fileName, err)
+	}
+	return nil
+}
+
+//------------------- Directory backend
+
+// DirectoryBackend : store the secure storage in a directory: the header in one file
+// and the items of each group (e.g. entity) in a separate file
+type DirectoryBackend struct {
+	dirName string
+}
+
+// NewDirectoryBackend : Return a directory backend that uses the given directory
+func NewDirectoryBackend(dirName string) *DirectoryBackend {
+	return &DirectoryBackend{dirName: filepath.Clean(dirName)}
+}
+
+func (d DirectoryBackend) String() string {
+	return d.dirName
+}
+
+// Read : Read the header and all the groups files from the directory
+func (d DirectoryBackend) Read() (*SecureStorage, error) {
+	var header storageHeader
+
+	data, err := ioutil.ReadFile(filepath.Join(d.dirName, headerFileName))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read secure storage from directory: '%v'", d.dirName)
+	}
+	err = json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, fmt.Errorf("The directory '%v' header is not genuine", d.dirName)
+	}
+	s := newStorageFromHeader(header)
+	files, err := ioutil.ReadDir(d.dirName)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read secure storage from directory: '%v', error: %v", d.dirName, err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if name == headerFileName || strings.HasSuffix(name, groupFileSuffix) == false {
+			continue
+		}
+		var groupData SecureDataMap
+		data, err := ioutil.ReadFile(filepath.Join(d.dirName, name))
+		if err == nil {
+			err = json.Unmarshal(data, &groupData)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read secure storage file: '%v', error: %v", name, err)
+		}
+		groupID := strings.TrimSuffix(name, groupFileSuffix)
+		for slot, item := range groupData {
+			s.Data[slot] = item
+			s.setItemGroup(slot, groupID)
+		}
+	}
+	return s, nil
+}
+
+// GetGenerationsNum : Return the number of previous generations that are kept: the previous directory
+func (d DirectoryBackend) GetGenerationsNum() int {
+	return 1
+}
+
+// GetGenerationName : Return the name of the directory that holds the previous generation
+func (d DirectoryBackend) GetGenerationName(generation int) string {
+	return d.dirName + oldDirSuffix
+}
+
+// ReadGeneration : Read the secure storage from the previous directory
+func (d DirectoryBackend) ReadGeneration(generation int) (*SecureStorage, error) {
+	if generation != 1 {
+		return nil, fmt.Errorf("The generation %v must be 1", generation)
+	}
+	return DirectoryBackend{dirName: d.GetGenerationName(generation)}.Read()
+}
+
+// RemoveGenerations : Remove the previous directory
+func (d DirectoryBackend) RemoveGenerations() error {
+	return os.RemoveAll(d.GetGenerationName(1))
+}
+
+// Write : Write the secure storage to a new directory, flush it to the disk and replace the current directory with it,
+// the previous directory is kept as the previous generation
+func (d DirectoryBackend) Write(s *SecureStorage) error {
+	tmpDir := d.dirName + tmpDirSuffix
+	oldDir := d.dirName + oldDirSuffix
+
+	os.RemoveAll(tmpDir)
+	err := os.MkdirAll(tmpDir, 0700)
+	if err != nil {
+		return fmt.Errorf("attempt to create the Secure storage directory '%v' failed, error: %v", tmpDir, err)
+	}
+	data, _ := json.Marshal(s.getHeader())
+	err = writeFileSync(filepath.Join(tmpDir, headerFileName), data)
+	if err != nil {
+		return fmt.Errorf("attempt to write the Secure storage to directory '%v' failed, error: %v", d.dirName, err)
+	}
+	for groupID, groupData := range s.getGroupsData() {
+		data, _ := json.Marshal(groupData)
+		err = writeFileSync(filepath.Join(tmpDir, groupID+groupFileSuffix), data)
+		if err != nil {
+			return fmt.Errorf("attempt to write the Secure storage to directory '%v' failed, error: %v", d.dirName, err)
+		}
+	}
+	err = syncDir(tmpDir)
+	if err != nil {
+		return fmt.Errorf("attempt to write the Secure storage to directory '%v' failed, error: %v", d.dirName, err)
+	}
+	os.RemoveAll(oldDir)
+	_, err = os.Stat(d.dirName)
+	if err == nil {
+		err = os.Rename(d.dirName, oldDir)
+		if err != nil {
+			return fmt.Errorf("attempt to replace the Secure storage directory '%v' failed, error: %v", d.dirName, err)
+		}
+	}
+	err = os.Rename(tmpDir, d.dirName)
+	if err == nil {
+		err = syncDir(filepath.Dir(d.dirName))
+	}
+	if err != nil {
+		return fmt.Errorf("attempt to replace the Secure storage directory '%v' failed, error: %v", d.dirName, err)
+	}
+	return nil
+}
+
+//------------------- Embedded key/value database backend
+
+// BoltBackend : store the secure storage in an embedded transactional key/value database (bolt):
+// the header in one bucket and the items in another bucket
+type BoltBackend struct {
+	fileName string
+}
+
+// NewBoltBackend : Return an embedded key/value database backend that uses the given database file
+func NewBoltBackend(fileName string) *BoltBackend {
+	return &BoltBackend{fileName: fileName}
+}
+
+func (b BoltBackend) String() string {
+	return b.fileName
+}
+
+func (b BoltBackend) open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(b.fileName, FilePermissions, &bolt.Options{Timeout: boltOpenTimeoutMs * time.Millisecond, ReadOnly: readOnly})
+}
+
+// Read : Read the header and the items from the database in one transaction
+func (b BoltBackend) Read() (*SecureStorage, error) {
+	var s *SecureStorage
+
+	if _, err := os.Stat(b.fileName); err != nil {
+		return nil, fmt.Errorf("Cannot read secure storage from database: '%v'", b.fileName)
+	}
+	db, err := b.open(true)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read secure storage from database: '%v', error: %v", b.fileName, err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		var header storageHeader
+
+		hBucket := tx.Bucket([]byte(boltHeaderBucket))
+		dBucket := tx.Bucket([]byte(boltDataBucket))
+		if hBucket == nil || dBucket == nil {
+			return fmt.Errorf("The database '%v' is not genuine", b.fileName)
+		}
+		err := json.Unmarshal(hBucket.Get([]byte(boltHeaderKey)), &header)
+		if err != nil {
+			return fmt.Errorf("The database '%v' header is not genuine", b.fileName)
+		}
+		s = newStorageFromHeader(header)
+		return dBucket.ForEach(func(k, v []byte) error {
+			s.Data[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write : Replace the header and the items in the database in one transaction
+func (b BoltBackend) Write(s *SecureStorage) error {
+	db, err := b.open(false)
+	if err != nil {
+		return fmt.Errorf("attempt to open the Secure storage database '%v' failed, error: %v", b.fileName, err)
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		hBucket, err := tx.CreateBucketIfNotExists([]byte(boltHeaderBucket))
+		if err != nil {
+			return err
+		}
+		data, _ := json.Marshal(s.getHeader())
+		err = hBucket.Put([]byte(boltHeaderKey), data)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket([]byte(boltDataBucket)) != nil {
+			err = tx.DeleteBucket([]byte(boltDataBucket))
+			if err != nil {
+				return err
+			}
+		}
+		dBucket, err := tx.CreateBucket([]byte(boltDataBucket))
+		if err != nil {
+			return err
+		}
+		for slot, item := range s.Data {
+			err = dBucket.Put([]byte(slot), []byte(item))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
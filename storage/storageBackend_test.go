@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Verify that secure storage saved using each of the backends is equal to the one loaded from it
+// Verify that wrong secret return an error when reading a secure storage
+// Verify that the items are stored by groups when the directory backend is used
+func Test_storeLoadBackends(t *testing.T) {
+	keys := []string{"g1-k1", "g1-k2", "g2-k1", "k3"}
+	values := []string{"v1", "v2", "v3", "v4"}
+	paths := map[string]string{FileBackendName: "./tmp.txt", DirectoryBackendName: "./tmpDir", BoltBackendName: "./tmp.db"}
+	secret := []byte(baseSecret)
+
+	GetItemGroup = func(key string) string {
+		if strings.HasPrefix(key, "g") {
+			return strings.Split(key, "-")[0]
+		}
+		return ""
+	}
+	defer func() { GetItemGroup = nil }()
+	s, _ := NewStorage(secret, true)
+	for i, key := range keys {
+		s.AddItem(key, values[i])
+	}
+	for name, path := range paths {
+		defer os.RemoveAll(path)
+		backend, err := NewBackend(name, path)
+		if err != nil {
+			t.Fatalf("Test fail: can't create backend '%v', error: %v", name, err)
+		}
+		if gBackend, ok := backend.(GenerationsBackend); ok {
+			defer gBackend.RemoveGenerations()
+		}
+		err = s.StoreInfoToBackend(backend)
+		if err != nil {
+			t.Fatalf("Test fail: can't store to backend '%v', error: %v", name, err)
+		}
+		// store twice to verify that the data is replaced
+		s.StoreInfoToBackend(backend)
+		s1, err := LoadInfoFromBackend(backend, secret)
+		if err != nil {
+			t.Fatalf("Test fail: Read secure storage from backend '%v' fail, error: %v", name, err)
+		}
+		if reflect.DeepEqual(s.Data, s1.Data) == false {
+			t.Errorf("Test fail: The original secure storage: '%v' is not equal after store and load it using backend '%v': '%v'",
+				s.GetDecryptStorageData(), name, s1.GetDecryptStorageData())
+		}
+		_, err = LoadInfoFromBackend(backend, []byte(baseSecret1))
+		if err == nil {
+			t.Errorf("Test fail: Successfully read secure storage from backend '%v' while using wrong secret", name)
+		}
+	}
+	files, _ := ioutil.ReadDir(paths[DirectoryBackendName])
+	// header, 2 groups and the common group
+	if len(files) != 4 {
+		t.Errorf("Test fail: The number of files in the directory backend is %v, expected %v", len(files), 4)
+	}
+	_, err := NewBackend("undefined", "")
+	if err == nil {
+		t.Errorf("Test fail: Successfully create undefined backend")
+	}
+}
+
+// Verify that removing a group file of the directory backend is detected when the storage is loaded
+func Test_directoryBackendCorruption(t *testing.T) {
+	dirName := "./tmpDir"
+	defer os.RemoveAll(dirName)
+
+	GetItemGroup = func(key string) string { return key }
+	defer func() { GetItemGroup = nil }()
+	s, _ := NewStorage([]byte(baseSecret), true)
+	s.AddItem("k1", "v1")
+	s.AddItem("k2", "v2")
+	backend := NewDirectoryBackend(dirName)
+	s.StoreInfoToBackend(backend)
+	os.Remove(filepath.Join(dirName, s.getGroupID("k1")+groupFileSuffix))
+	_, err := LoadInfoFromBackend(backend, []byte(baseSecret))
+	if err == nil {
+		t.Errorf("Test fail: Successfully read secure storage from directory while a group file was removed")
+	}
+}
+
+// Verify that the file backend keeps the configured number of previous generations,
+// and that when the file is corrupted the newest valid generation is loaded
+func Test_fileBackendGenerations(t *testing.T) {
+	fileName := "./tmp.txt"
+	generations := 2
+	secret := []byte(baseSecret)
+
+	backend := NewFileBackend(fileName)
+	err := backend.SetGenerationsNum(-1)
+	if err == nil {
+		t.Errorf("Test fail: Successfully set a negative number of generations")
+	}
+	backend.SetGenerationsNum(generations)
+	defer os.Remove(fileName)
+	defer backend.RemoveGenerations()
+	s, _ := NewStorage(secret, true)
+	for i := 0; i <= generations+1; i++ {
+		s.AddItem("key", fmt.Sprintf("value%v", i))
+		err = s.StoreInfoToBackend(backend)
+		if err != nil {
+			t.Fatalf("Test fail: can't store generation %v, error: %v", i, err)
+		}
+	}
+	_, err = os.Stat(backend.GetGenerationName(generations + 1))
+	if err == nil {
+		t.Errorf("Test fail: more than %v generations were kept", generations)
+	}
+	ioutil.WriteFile(fileName, []byte("corrupted data"), FilePermissions)
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the previous generation of a corrupted file, error: %v", err)
+	}
+	val, _ := s1.GetItem("key")
+	expected := fmt.Sprintf("value%v", generations)
+	if val != expected {
+		t.Errorf("Test fail: the item value loaded from the previous generation is '%v', expected '%v'", val, expected)
+	}
+	_, err = LoadInfoFromBackend(backend, []byte(baseSecret1))
+	if err == nil {
+		t.Errorf("Test fail: Successfully read a previous generation while using wrong secret")
+	}
+	backend.RemoveGenerations()
+	_, err = LoadInfoFromBackend(backend, secret)
+	if err == nil {
+		t.Errorf("Test fail: Successfully read a corrupted file without previous generations")
+	}
+}
+
+// Verify that the file backends that are returned by NewBackend keep the default number of previous generations
+// and that an illegal default number of generations is rejected
+func Test_defaultGenerationsNum(t *testing.T) {
+	defer SetDefaultGenerationsNum(DefaultGenerationsNum)
+
+	for _, n := range []int{-1, maxGenerationsNum + 1} {
+		if SetDefaultGenerationsNum(n) == nil {
+			t.Errorf("Test fail: the illegal default number of generations %v was accepted", n)
+		}
+	}
+	SetDefaultGenerationsNum(5)
+	backend, _ := NewBackend(FileBackendName, "data.txt")
+	n := backend.(GenerationsBackend).GetGenerationsNum()
+	if n != 5 {
+		t.Errorf("Test fail: the file backend keeps %v previous generations instead of 5", n)
+	}
+}
+
+// Verify that when the directory backend directory is missing (e.g. a crash while it is replaced), the previous directory is loaded
+func Test_directoryBackendGenerations(t *testing.T) {
+	dirName := "./tmpDir"
+	backend := NewDirectoryBackend(dirName)
+	defer os.RemoveAll(dirName)
+	defer backend.RemoveGenerations()
+
+	s, _ := NewStorage([]byte(baseSecret), true)
+	s.AddItem("k1", "v1")
+	s.StoreInfoToBackend(backend)
+	s.AddItem("k2", "v2")
+	s.StoreInfoToBackend(backend)
+	os.RemoveAll(dirName)
+	s1, err := LoadInfoFromBackend(backend, []byte(baseSecret))
+	if err != nil {
+		t.Fatalf("Test fail: can't load the previous directory, error: %v", err)
+	}
+	if _, err := s1.GetItem("k2"); err == nil {
+		t.Errorf("Test fail: the item that was added after the previous directory was stored was found")
+	}
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	logger "github.com/ibm-security-innovation/libsecurity-go/logger"
+)
+
+// The write-ahead journal holds the item changes (AddItem and RemoveItem) that were done after the storage was stored,
+// so they are not lost if the process stops before the next store. The journal is a file next to the stored data:
+// its first line holds the signature of the stored data that it extends and each of the following lines holds one change.
+// The changes hold only encrypted items and each of them is authenticated by an HMAC that is chained to the previous one,
+// so changes can't be altered, removed or reordered. A partially written last change (e.g. a crash during the write) is ignored.
+// If a change can't be fully written, the journal is truncated back to the previous change so the following changes
+// are not written after a torn line. If the journal can't be truncated, it is closed and the item changes fail until the storage is stored again.
+// All the changes of a committed transaction are written as one batch change, so either all of them are replayed or none of them.
+
+const (
+	journalFileSuffix = ".journal"
+	journalAddOp      = "add"
+	journalRemoveOp   = "remove"
+	journalBatchOp    = "batch"
+)
+
+type journalHeader struct {
+	Base []byte // the signature of the stored data that the journal extends
+}
+
+type journalEntry struct {
+	Op      string
+	Slot    string
+	Item    string         `json:",omitempty"`
+	Group   string         `json:",omitempty"`
+	Changes []journalEntry `json:",omitempty"` // the changes of a batch
+	Mac     []byte         `json:",omitempty"`
+}
+
+type journal struct {
+	fileName string
+	file     *os.File
+	lastMac  []byte
+	size     int64 // the size of the journal up to the end of the last change that was fully written
+}
+
+func getJournalFileName(backend Backend) string {
+	return backend.String() + journalFileSuffix
+}
+
+// The HMAC of a change covers the change and the HMAC of the previous change (the stored data signature for the first change)
+func (s SecureStorage) calcJournalEntryMac(prevMac []byte, e journalEntry) []byte {
+	e.Mac = nil
+	data, _ := json.Marshal(e)
+	return s.calcHMac(append(append([]byte{}, prevMac...), data...), s.getSubKey(macKeyLabel))
+}
+
+func (j *journal) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = j.file.Write(data)
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		j.discardTornLine()
+		return fmt.Errorf("attempt to write to the journal '%v' failed, error: %v", j.fileName, err)
+	}
+	j.size += int64(len(data))
+	return nil
+}
+
+// Remove the part of a change that was written before the write failed, so the next change is written after the last
+// change that was fully written. If it can't be removed, the journal is closed since changes that are written after
+// a torn line are never replayed
+func (j *journal) discardTornLine() {
+	err := j.file.Truncate(j.size)
+	if err == nil {
+		_, err = j.file.Seek(j.size, io.SeekStart)
+	}
+	if err != nil {
+		logger.Error.Printf("The journal '%v' can't be truncated after a failed write, error: %v, it is closed until the storage is stored again", j.fileName, err)
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+// Start a new (empty) journal that extends the stored data with the given signature
+func (j *journal) reset(base []byte) error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	file, err := os.OpenFile(j.fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePermissions)
+	if err != nil {
+		return fmt.Errorf("attempt to create the journal '%v' failed, error: %v", j.fileName, err)
+	}
+	j.file = file
+	j.lastMac = base
+	j.size = 0
+	return j.writeLine(journalHeader{Base: base})
+}
+
+func (j *journal) append(s *SecureStorage, e journalEntry) error {
+	if j.file == nil {
+		return fmt.Errorf("the journal '%v' is closed since a change could not be written to it, the storage must be stored to start it again", j.fileName)
+	}
+	e.Mac = s.calcJournalEntryMac(j.lastMac, e)
+	err := j.writeLine(e)
+	if err != nil {
+		return err
+	}
+	j.lastMac = e.Mac
+	return nil
+}
+
+// EnableJournal : Store the secure storage using the given backend and start a write-ahead journal for it:
+// each following AddItem and RemoveItem is written to the journal before it is applied, and the journal is replayed
+// when the storage is loaded from the same backend. The journal is cleared each time the storage is stored using this backend
+func (s *SecureStorage) EnableJournal(backend Backend) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.closeJournal()
+	s.journal = &journal{fileName: getJournalFileName(backend)}
+	err := s.storeInfoToBackend(backend)
+	if err != nil {
+		s.journal = nil
+	}
+	return err
+}
+
+// DisableJournal : Stop writing the item changes to the journal, the changes that are already in the journal are kept
+func (s *SecureStorage) DisableJournal() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.closeJournal()
+}
+
+func (s *SecureStorage) closeJournal() {
+	if s.journal != nil && s.journal.file != nil {
+		s.journal.file.Close()
+	}
+	s.journal = nil
+}
+
+// Apply the changes in the journal of the given backend, if the journal extends the loaded data.
+// The changes are applied up to the first one that is not genuine
+func (s *SecureStorage) replayJournal(backend Backend) {
+	var header journalHeader
+
+	fileName := getJournalFileName(backend)
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<30)
+	if scanner.Scan() == false || json.Unmarshal(scanner.Bytes(), &header) != nil {
+		logger.Warning.Printf("The journal '%v' is not genuine, it is ignored", fileName)
+		return
+	}
+	if bytes.Equal(header.Base, s.Sign) == false {
+		logger.Info.Printf("The journal '%v' does not extend the loaded data, it is ignored", fileName)
+		return
+	}
+	lastMac := header.Base
+	cnt := 0
+	for scanner.Scan() {
+		var e journalEntry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil || hmac.Equal(s.calcJournalEntryMac(lastMac, e), e.Mac) == false {
+			logger.Warning.Printf("The journal '%v' change %v is not genuine, it and the following changes are ignored", fileName, cnt+1)
+			break
+		}
+		s.applyJournalEntry(e)
+		lastMac = e.Mac
+		cnt++
+	}
+	if cnt > 0 {
+		logger.Info.Printf("%v changes were replayed from the journal '%v'", cnt, fileName)
+	}
+}
+
+// Apply the given change to the storage data, a batch change applies all its changes in order
+func (s *SecureStorage) applyJournalEntry(e journalEntry) {
+	switch e.Op {
+	case journalAddOp:
+		s.Data[e.Slot] = e.Item
+		s.setItemGroup(e.Slot, e.Group)
+	case journalRemoveOp:
+		delete(s.Data, e.Slot)
+		delete(s.groups, e.Slot)
+	case journalBatchOp:
+		for _, c := range e.Changes {
+			s.applyJournalEntry(c)
+		}
+	}
+}
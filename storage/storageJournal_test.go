@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Verify that the item changes that were done after the storage was stored are replayed from the journal when it is loaded
+// Verify that the journal is cleared when the storage is stored
+// Verify that a partially written change is ignored
+func Test_journalReplay(t *testing.T) {
+	fileName := "./tmp.txt"
+	secret := []byte(baseSecret)
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+	defer os.Remove(getJournalFileName(backend))
+
+	s, _ := NewStorage(secret, true)
+	s.AddItem("k1", "v1")
+	s.AddItem("k2", "v2")
+	err := s.EnableJournal(backend)
+	if err != nil {
+		t.Fatalf("Test fail: can't enable the journal, error: %v", err)
+	}
+	defer s.DisableJournal()
+	s.AddItem("k3", "v3")
+	s.RemoveItem("k1")
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage, error: %v", err)
+	}
+	if reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the loaded storage: %v is not equal to the one that was changed: %v after the journal was replayed",
+			s1.GetDecryptStorageData(), s.GetDecryptStorageData())
+	}
+
+	s.StoreInfoToBackend(backend)
+	data, _ := ioutil.ReadFile(getJournalFileName(backend))
+	s.AddItem("k4", "v4")
+	// a crash while writing the last change
+	ioutil.WriteFile(getJournalFileName(backend), append(data, []byte(`{"Op":"add","Slot":"`)...), FilePermissions)
+	s1, err = LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage with a partially written journal, error: %v", err)
+	}
+	if _, err := s1.GetItem("k4"); err == nil {
+		t.Errorf("Test fail: the partially written change was replayed")
+	}
+	if _, err := s1.GetItem("k3"); err != nil {
+		t.Errorf("Test fail: the stored item was not loaded, error: %v", err)
+	}
+}
+
+// Verify that the expired items that are purged when the storage is stored using another backend are not replayed from the journal
+func Test_journalPurgeExpired(t *testing.T) {
+	fileName := "./tmp.txt"
+	otherFileName := "./tmp1.txt"
+	ttl := 50 * time.Millisecond
+	secret := []byte(baseSecret)
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+	defer os.Remove(otherFileName)
+	defer os.Remove(getJournalFileName(backend))
+
+	s, _ := NewStorage(secret, true)
+	s.AddItem("k1", "v1")
+	s.EnableJournal(backend)
+	defer s.DisableJournal()
+	s.AddItemWithTTL("k2", "v2", ttl)
+	time.Sleep(2 * ttl)
+	s.StoreInfo(otherFileName)
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage, error: %v", err)
+	}
+	if len(s1.Data) != 1 || reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the purged expired item was replayed from the journal, the loaded storage: %v", s1.GetDecryptStorageData())
+	}
+}
+
+// Verify that changed journal entries and a journal that does not extend the stored data are not replayed
+func Test_journalNotGenuine(t *testing.T) {
+	fileName := "./tmp.txt"
+	secret := []byte(baseSecret)
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+	defer os.Remove(getJournalFileName(backend))
+
+	s, _ := NewStorage(secret, true)
+	s.EnableJournal(backend)
+	defer s.DisableJournal()
+	s.AddItem("k1", "v1")
+	s.AddItem("k2", "v2")
+	journalData, _ := ioutil.ReadFile(getJournalFileName(backend))
+
+	// replace the order of the changes
+	lines := bytes.SplitAfter(journalData, []byte("\n"))
+	ioutil.WriteFile(getJournalFileName(backend), bytes.Join([][]byte{lines[0], lines[2], lines[1]}, nil), FilePermissions)
+	s1, _ := LoadInfoFromBackend(backend, secret)
+	if len(s1.Data) != 0 {
+		t.Errorf("Test fail: the changes that their order was replaced were replayed: %v", s1.GetDecryptStorageData())
+	}
+
+	// a journal of other stored data
+	s2, _ := NewStorage(secret, true)
+	s2.StoreInfoToBackend(backend)
+	ioutil.WriteFile(getJournalFileName(backend), journalData, FilePermissions)
+	s1, _ = LoadInfoFromBackend(backend, secret)
+	if len(s1.Data) != 0 {
+		t.Errorf("Test fail: the journal of other stored data was replayed: %v", s1.GetDecryptStorageData())
+	}
+}
+
+// Verify that a torn line that was left by a failed write is removed, so the following changes are replayed
+// Verify that if the journal can't be written and truncated, the item changes fail until the storage is stored again
+func Test_journalFailedWrite(t *testing.T) {
+	fileName := "./tmp.txt"
+	secret := []byte(baseSecret)
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+	defer os.Remove(getJournalFileName(backend))
+
+	s, _ := NewStorage(secret, true)
+	s.EnableJournal(backend)
+	defer s.DisableJournal()
+	s.AddItem("k1", "v1")
+	// a partial write of the next change
+	s.journal.file.Write([]byte(`{"Op":"add","Slot":"`))
+	s.journal.discardTornLine()
+	s.AddItem("k2", "v2")
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage, error: %v", err)
+	}
+	if reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the loaded storage: %v is not equal to the one that was changed: %v after the torn line was removed",
+			s1.GetDecryptStorageData(), s.GetDecryptStorageData())
+	}
+
+	// a journal that can't be written or truncated
+	readOnlyFile, _ := os.Open(getJournalFileName(backend))
+	s.journal.file.Close()
+	s.journal.file = readOnlyFile
+	err = s.AddItem("k3", "v3")
+	if err == nil {
+		t.Errorf("Test fail: adding an item succeeded although it was not written to the journal")
+	}
+	err = s.AddItem("k4", "v4")
+	if err == nil {
+		t.Errorf("Test fail: adding an item succeeded although the journal was closed")
+	}
+	err = s.StoreInfoToBackend(backend)
+	if err != nil {
+		t.Fatalf("Test fail: can't store the storage, error: %v", err)
+	}
+	err = s.AddItem("k5", "v5")
+	if err != nil {
+		t.Errorf("Test fail: can't add an item after the storage was stored, error: %v", err)
+	}
+	s1, _ = LoadInfoFromBackend(backend, secret)
+	if reflect.DeepEqual(s.Data, s1.Data) == false || len(s1.Data) != 3 {
+		t.Errorf("Test fail: the loaded storage: %v is not equal to the one that was changed: %v",
+			s1.GetDecryptStorageData(), s.GetDecryptStorageData())
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// A transaction stages item changes (adds and removes) and applies them to the storage together when it is committed:
+// if any of the changes fails (e.g. removing a missing key), none of them is applied. The staged changes are encrypted
+// and checked before the storage is changed, and if the journal is enabled they are written to it as one batch change,
+// so a crash can't leave only part of them either.
+
+// ItemsWriter : The item changes that can be done either directly on the secure storage or staged in a transaction
+type ItemsWriter interface {
+	AddItem(key string, value string) error
+	AddItemWithTTL(key string, value string, ttl time.Duration) error
+	RemoveItem(key string) error
+}
+
+type stagedChange struct {
+	remove bool
+	key    string
+	value  string
+	ttl    time.Duration
+}
+
+// Transaction : A set of item changes that are applied to the secure storage all together or not at all.
+// A transaction must not be used concurrently and can't be used after it was committed or rolled back
+type Transaction struct {
+	storage *SecureStorage
+	changes []stagedChange
+	done    bool
+}
+
+// NewTransaction : Return a new transaction of item changes for the secure storage
+func (s *SecureStorage) NewTransaction() *Transaction {
+	return &Transaction{storage: s}
+}
+
+func (t *Transaction) stage(change stagedChange) error {
+	if t.done {
+		return fmt.Errorf("The transaction was already committed or rolled back")
+	}
+	t.changes = append(t.changes, change)
+	return nil
+}
+
+// AddItem : Stage the addition (or replacement) of an item using the given key and value
+func (t *Transaction) AddItem(key string, value string) error {
+	return t.AddItemWithTTL(key, value, 0)
+}
+
+// AddItemWithTTL : Stage the addition (or replacement) of an item using the given key and value, the item expires
+// after the given time to live (0 for an item that doesn't expire)
+func (t *Transaction) AddItemWithTTL(key string, value string, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("The item time to live %v must not be negative", ttl)
+	}
+	return t.stage(stagedChange{key: key, value: value, ttl: ttl})
+}
+
+// RemoveItem : Stage the removal of the item that is associated with the given key,
+// the commit fails if the item does not exist at that point of the transaction
+func (t *Transaction) RemoveItem(key string) error {
+	return t.stage(stagedChange{remove: true, key: key})
+}
+
+// Commit : Apply all the staged changes to the storage, either all of them are applied or none of them
+func (t *Transaction) Commit() error {
+	if t.done {
+		return fmt.Errorf("The transaction was already committed or rolled back")
+	}
+	t.done = true
+
+	lock.Lock()
+	defer lock.Unlock()
+	return t.storage.applyChanges(t.changes)
+}
+
+// Rollback : Discard all the staged changes, the storage is not changed
+func (t *Transaction) Rollback() {
+	t.done = true
+	t.changes = nil
+}
+
+// Prepare the storage changes of all the given staged changes and apply them only if all of them succeeded.
+// Each change sees the results of the previous ones (e.g. an item that was added earlier in the same transaction can be removed)
+func (s *SecureStorage) applyChanges(changes []stagedChange) error {
+	var entries []journalEntry
+
+	if len(changes) == 0 {
+		return nil
+	}
+	staged := make(map[string]*string) // the items of the slots that were changed, nil for a removed item
+	for _, c := range changes {
+		slot := s.getSlot(c.key)
+		oldItem, exist := s.Data[slot]
+		if item, changed := staged[slot]; changed {
+			exist = item != nil
+			if exist {
+				oldItem = *item
+			}
+		}
+		if c.remove {
+			if !exist {
+				return fmt.Errorf("Key '%v' was not found", c.key)
+			}
+			staged[slot] = nil
+			entries = append(entries, journalEntry{Op: journalRemoveOp, Slot: slot})
+			continue
+		}
+		meta := s.replaceItemMetadata(c.key, c.value, oldItem, exist)
+		if c.ttl > 0 {
+			meta.Expires = meta.Updated.Add(c.ttl)
+		}
+		_, item, err := s.encryptItem(c.key, c.value, meta)
+		if err != nil {
+			return err
+		}
+		staged[slot] = &item
+		entries = append(entries, journalEntry{Op: journalAddOp, Slot: slot, Item: item, Group: s.getGroupID(c.key)})
+	}
+	batch := journalEntry{Op: journalBatchOp, Changes: entries}
+	if s.journal != nil {
+		err := s.journal.append(s, batch)
+		if err != nil {
+			return err
+		}
+	}
+	s.applyJournalEntry(batch)
+	return nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Verify that all the changes of a committed transaction are applied
+// Verify that none of the changes of a failed transaction are applied
+// Verify that a rolled back transaction does not change the storage and can't be used again
+func Test_transactionCommitRollback(t *testing.T) {
+	s, _ := NewStorage([]byte(baseSecret), true)
+	s.AddItem("k1", "v1")
+	s.AddItem("k2", "v2")
+
+	tx := s.NewTransaction()
+	tx.AddItem("k3", "v3")
+	tx.AddItem("k1", "v1.1")
+	tx.RemoveItem("k2")
+	tx.AddItem("k4", "v4")
+	tx.RemoveItem("k4")
+	err := tx.Commit()
+	if err != nil {
+		t.Fatalf("Test fail: can't commit the transaction, error: %v", err)
+	}
+	expected := SecureDataMap{"k1": "v1.1", "k3": "v3"}
+	if data := s.GetDecryptStorageData().Data; reflect.DeepEqual(data, expected) == false {
+		t.Errorf("Test fail: the storage data after the commit: %v is not as expected: %v", data, expected)
+	}
+	err = tx.AddItem("k5", "v5")
+	if err == nil {
+		t.Errorf("Test fail: a committed transaction was used again")
+	}
+
+	tx = s.NewTransaction()
+	tx.AddItem("k5", "v5")
+	tx.RemoveItem("k1")
+	tx.RemoveItem("k1")
+	err = tx.Commit()
+	if err == nil {
+		t.Errorf("Test fail: a transaction that removes a missing key was committed")
+	}
+	if data := s.GetDecryptStorageData().Data; reflect.DeepEqual(data, expected) == false {
+		t.Errorf("Test fail: the storage data after a failed commit: %v was changed, expected: %v", data, expected)
+	}
+
+	tx = s.NewTransaction()
+	tx.AddItem("k5", "v5")
+	tx.Rollback()
+	err = tx.Commit()
+	if err == nil {
+		t.Errorf("Test fail: a rolled back transaction was committed")
+	}
+	if _, err := s.GetItem("k5"); err == nil {
+		t.Errorf("Test fail: an item of a rolled back transaction was added")
+	}
+	err = s.NewTransaction().AddItemWithTTL("k5", "v5", -1)
+	if err == nil {
+		t.Errorf("Test fail: an item with a negative time to live was staged")
+	}
+}
+
+// Verify that a committed transaction is replayed from the journal
+func Test_transactionJournal(t *testing.T) {
+	fileName := "./tmp.txt"
+	secret := []byte(baseSecret)
+	backend := NewFileBackend(fileName)
+	defer os.Remove(fileName)
+	defer os.Remove(getJournalFileName(backend))
+
+	s, _ := NewStorage(secret, true)
+	s.AddItem("k1", "v1")
+	s.EnableJournal(backend)
+	defer s.DisableJournal()
+	tx := s.NewTransaction()
+	tx.AddItem("k2", "v2")
+	tx.RemoveItem("k1")
+	tx.AddItem("k3", "v3")
+	err := tx.Commit()
+	if err != nil {
+		t.Fatalf("Test fail: can't commit the transaction, error: %v", err)
+	}
+	s1, err := LoadInfoFromBackend(backend, secret)
+	if err != nil {
+		t.Fatalf("Test fail: can't load the storage, error: %v", err)
+	}
+	if reflect.DeepEqual(s.Data, s1.Data) == false {
+		t.Errorf("Test fail: the loaded storage: %v is not equal to the one that was changed: %v after the journal was replayed",
+			s1.GetDecryptStorageData(), s.GetDecryptStorageData())
+	}
+}